@@ -7,9 +7,12 @@ import (
 	"encoding/pem"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
 )
 
 func generateKeys(outDir string) error {
@@ -46,6 +49,18 @@ func generateKeys(outDir string) error {
 	return nil
 }
 
+// generateAPIKey prints a new API key and the hash to store in the server
+// key file.
+func generateAPIKey(w io.Writer) error {
+	key, err := apikey.Generate()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "API key: %s\nHash: %s\n", key, apikey.Hash(key))
+	return err
+}
+
 func main() {
 	execPath, err := os.Executable()
 	if err != nil {
@@ -54,9 +69,18 @@ func main() {
 	execDir := filepath.Dir(execPath)
 
 	var outDir string
+	var apiKey bool
 	flag.StringVar(&outDir, "out-dir", execDir, "")
+	flag.BoolVar(&apiKey, "api-key", false, "generate an api key instead of rsa keys")
 	flag.Parse()
 
+	if apiKey {
+		if err := generateAPIKey(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if err := generateKeys(outDir); err != nil {
 		log.Fatal(err)
 	}
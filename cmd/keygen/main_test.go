@@ -1,11 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
 )
 
 const (
@@ -66,3 +71,13 @@ func TestGenerateKeys(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateAPIKey(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, generateAPIKey(&buf))
+
+	var key, hash string
+	_, err := fmt.Sscanf(buf.String(), "API key: %s\nHash: %s\n", &key, &hash)
+	require.NoError(t, err)
+	assert.Equal(t, apikey.Hash(key), hash)
+}
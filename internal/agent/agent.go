@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -14,6 +15,7 @@ import (
 	"github.com/fragpit/yandex-go-dev-metrics/internal/config"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/tlsconfig"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -86,6 +88,11 @@ func Run() error {
 		return nil
 	})
 
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+
 	reporter, err := NewReporter(
 		logger.With("service", "reporter"),
 		repo,
@@ -94,12 +101,35 @@ func Run() error {
 		cfg.RateLimit,
 		cfg.CryptoKey,
 		cfg.GRPCServerAddress,
+		tlsConfig,
+		cfg.APIKey,
+		cfg.SecretKeyID,
+		cfg.CryptoKeyID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to init reporter: %w", err)
 	}
 	defer reporter.transport.Close()
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	eg.Go(func() error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-hup:
+				if err := reporter.Reload(); err != nil {
+					logger.Error("failed to reload keys", slog.Any("error", err))
+					continue
+				}
+				logger.Info("keys reloaded")
+			}
+		}
+	})
+
 	eg.Go(func() error {
 		if err := reporter.RunReporter(ctx, reportDuration); err != nil {
 			logger.Error("reporter error", slog.Any("error", err))
@@ -117,3 +147,33 @@ func Run() error {
 	logger.Info("agent shutdown")
 	return nil
 }
+
+// newTLSConfig builds the TLS configuration of the server connection, nil
+// when no TLS option is configured: REST then keeps the defaults of the
+// HTTP client and gRPC stays plaintext.
+func newTLSConfig(cfg *config.AgentConfig) (*tls.Config, error) {
+	var opts []tlsconfig.Option
+	if cfg.TLSServerName != "" {
+		opts = append(opts, tlsconfig.WithServerName(cfg.TLSServerName))
+	}
+	if cfg.TLSCA != "" {
+		opts = append(opts, tlsconfig.WithRootCA(cfg.TLSCA))
+	}
+	if cfg.TLSCert != "" {
+		opts = append(
+			opts,
+			tlsconfig.WithClientCertificate(cfg.TLSCert, cfg.TLSKey),
+		)
+	}
+
+	if len(opts) == 0 {
+		return nil, nil
+	}
+
+	c, err := tlsconfig.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls config: %w", err)
+	}
+
+	return c, nil
+}
@@ -44,6 +44,10 @@ func TestAgentComponents(t *testing.T) {
 			1,
 			"",
 			"",
+			nil,
+			"",
+			"",
+			"",
 		)
 		require.NoError(t, err)
 		assert.NotNil(t, reporter)
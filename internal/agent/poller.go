@@ -38,21 +38,17 @@ func Poll(
 	}
 }
 
+// registerMetric sends the metric to the aggregator channel unless the
+// context is cancelled first.
 func registerMetric(
+	ctx context.Context,
 	ch chan<- model.Metric,
-	tp model.MetricType,
-	name, value string,
+	metric model.Metric,
 ) error {
-	metric, err := model.NewMetric(name, tp)
-	if err != nil {
-		return err
+	select {
+	case ch <- metric:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-
-	if err := metric.SetValue(value); err != nil {
-		return err
-	}
-
-	ch <- metric
-
-	return nil
 }
@@ -28,19 +28,15 @@ func (p *CustomPoller) PollOnce(
 	p.logger.Info("starting poller")
 
 	randValue := rand.IntN(100)
-	metrics := []struct {
-		tp    model.MetricType
-		name  string
-		value string
-	}{
-		{model.GaugeType, "RandomValue", fmt.Sprintf("%d", randValue)},
-		{model.CounterType, "PollCount", fmt.Sprintf("%d", counter.Swap(0))},
+	metrics := []model.Metric{
+		model.NewGauge("RandomValue", float64(randValue)),
+		model.NewCounter("PollCount", counter.Swap(0)),
 	}
 
 	for _, m := range metrics {
-		if err := registerMetric(out, m.tp, m.name, m.value); err != nil {
+		if err := registerMetric(ctx, out, m); err != nil {
 			p.logger.Error("failed to register metric",
-				slog.String("name", m.name),
+				slog.String("name", m.GetID()),
 				slog.Any("error", err))
 			return fmt.Errorf("failed to register metric: %w", err)
 		}
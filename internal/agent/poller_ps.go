@@ -38,20 +38,16 @@ func (p *PSPoller) PollOnce(
 		return fmt.Errorf("error fetching cpu utilization: %w", err)
 	}
 
-	metrics := []struct {
-		tp    model.MetricType
-		name  string
-		value string
-	}{
-		{model.GaugeType, "TotalMemory", fmt.Sprintf("%d", memStat.Total)},
-		{model.GaugeType, "FreeMemory", fmt.Sprintf("%d", memStat.Free)},
-		{model.GaugeType, "CPUutilization1", fmt.Sprintf("%f", cpuUtil[0])},
+	metrics := []model.Metric{
+		model.NewGauge("TotalMemory", float64(memStat.Total)),
+		model.NewGauge("FreeMemory", float64(memStat.Free)),
+		model.NewGauge("CPUutilization1", cpuUtil[0]),
 	}
 
 	for _, m := range metrics {
-		if err := registerMetric(out, m.tp, m.name, m.value); err != nil {
+		if err := registerMetric(ctx, out, m); err != nil {
 			p.logger.Error("failed to register metric",
-				slog.String("name", m.name),
+				slog.String("name", m.GetID()),
 				slog.Any("error", err))
 			return fmt.Errorf("failed to register metric: %w", err)
 		}
@@ -30,44 +30,40 @@ func (p *RuntimePoller) PollOnce(
 	var mstat runtime.MemStats
 	runtime.ReadMemStats(&mstat)
 
-	metrics := []struct {
-		tp    model.MetricType
-		name  string
-		value string
-	}{
-		{model.GaugeType, "Alloc", fmt.Sprintf("%d", mstat.Alloc)},
-		{model.GaugeType, "BuckHashSys", fmt.Sprintf("%d", mstat.BuckHashSys)},
-		{model.GaugeType, "Frees", fmt.Sprintf("%d", mstat.Frees)},
-		{model.GaugeType, "GCCPUFraction", fmt.Sprintf("%f", mstat.GCCPUFraction)},
-		{model.GaugeType, "GCSys", fmt.Sprintf("%d", mstat.GCSys)},
-		{model.GaugeType, "HeapAlloc", fmt.Sprintf("%d", mstat.HeapAlloc)},
-		{model.GaugeType, "HeapIdle", fmt.Sprintf("%d", mstat.HeapIdle)},
-		{model.GaugeType, "HeapInuse", fmt.Sprintf("%d", mstat.HeapInuse)},
-		{model.GaugeType, "HeapObjects", fmt.Sprintf("%d", mstat.HeapObjects)},
-		{model.GaugeType, "HeapReleased", fmt.Sprintf("%d", mstat.HeapReleased)},
-		{model.GaugeType, "HeapSys", fmt.Sprintf("%d", mstat.HeapSys)},
-		{model.GaugeType, "LastGC", fmt.Sprintf("%d", mstat.LastGC)},
-		{model.GaugeType, "Lookups", fmt.Sprintf("%d", mstat.Lookups)},
-		{model.GaugeType, "MCacheInuse", fmt.Sprintf("%d", mstat.MCacheInuse)},
-		{model.GaugeType, "MCacheSys", fmt.Sprintf("%d", mstat.MCacheSys)},
-		{model.GaugeType, "MSpanInuse", fmt.Sprintf("%d", mstat.MSpanInuse)},
-		{model.GaugeType, "MSpanSys", fmt.Sprintf("%d", mstat.MSpanSys)},
-		{model.GaugeType, "Mallocs", fmt.Sprintf("%d", mstat.Mallocs)},
-		{model.GaugeType, "NextGC", fmt.Sprintf("%d", mstat.NextGC)},
-		{model.GaugeType, "NumForcedGC", fmt.Sprintf("%d", mstat.NumForcedGC)},
-		{model.GaugeType, "NumGC", fmt.Sprintf("%d", mstat.NumGC)},
-		{model.GaugeType, "OtherSys", fmt.Sprintf("%d", mstat.OtherSys)},
-		{model.GaugeType, "PauseTotalNs", fmt.Sprintf("%d", mstat.PauseTotalNs)},
-		{model.GaugeType, "StackInuse", fmt.Sprintf("%d", mstat.StackInuse)},
-		{model.GaugeType, "StackSys", fmt.Sprintf("%d", mstat.StackSys)},
-		{model.GaugeType, "Sys", fmt.Sprintf("%d", mstat.Sys)},
-		{model.GaugeType, "TotalAlloc", fmt.Sprintf("%d", mstat.TotalAlloc)},
+	metrics := []model.Metric{
+		model.NewGauge("Alloc", float64(mstat.Alloc)),
+		model.NewGauge("BuckHashSys", float64(mstat.BuckHashSys)),
+		model.NewGauge("Frees", float64(mstat.Frees)),
+		model.NewGauge("GCCPUFraction", float64(mstat.GCCPUFraction)),
+		model.NewGauge("GCSys", float64(mstat.GCSys)),
+		model.NewGauge("HeapAlloc", float64(mstat.HeapAlloc)),
+		model.NewGauge("HeapIdle", float64(mstat.HeapIdle)),
+		model.NewGauge("HeapInuse", float64(mstat.HeapInuse)),
+		model.NewGauge("HeapObjects", float64(mstat.HeapObjects)),
+		model.NewGauge("HeapReleased", float64(mstat.HeapReleased)),
+		model.NewGauge("HeapSys", float64(mstat.HeapSys)),
+		model.NewGauge("LastGC", float64(mstat.LastGC)),
+		model.NewGauge("Lookups", float64(mstat.Lookups)),
+		model.NewGauge("MCacheInuse", float64(mstat.MCacheInuse)),
+		model.NewGauge("MCacheSys", float64(mstat.MCacheSys)),
+		model.NewGauge("MSpanInuse", float64(mstat.MSpanInuse)),
+		model.NewGauge("MSpanSys", float64(mstat.MSpanSys)),
+		model.NewGauge("Mallocs", float64(mstat.Mallocs)),
+		model.NewGauge("NextGC", float64(mstat.NextGC)),
+		model.NewGauge("NumForcedGC", float64(mstat.NumForcedGC)),
+		model.NewGauge("NumGC", float64(mstat.NumGC)),
+		model.NewGauge("OtherSys", float64(mstat.OtherSys)),
+		model.NewGauge("PauseTotalNs", float64(mstat.PauseTotalNs)),
+		model.NewGauge("StackInuse", float64(mstat.StackInuse)),
+		model.NewGauge("StackSys", float64(mstat.StackSys)),
+		model.NewGauge("Sys", float64(mstat.Sys)),
+		model.NewGauge("TotalAlloc", float64(mstat.TotalAlloc)),
 	}
 
 	for _, m := range metrics {
-		if err := registerMetric(out, m.tp, m.name, m.value); err != nil {
+		if err := registerMetric(ctx, out, m); err != nil {
 			p.logger.Error("failed to register metric",
-				slog.String("name", m.name),
+				slog.String("name", m.GetID()),
 				slog.Any("error", err))
 			return fmt.Errorf("failed to register metric: %w", err)
 		}
@@ -24,8 +24,7 @@ func (m *mockPoller) PollOnce(
 		return m.err
 	}
 
-	metric, _ := model.NewMetric("test_metric", model.GaugeType)
-	_ = metric.SetValue("42")
+	metric, _ := model.ParseMetric("test_metric", model.GaugeType, "42")
 	out <- metric
 	return nil
 }
@@ -97,64 +96,50 @@ func TestPoll_ContextCancellation(t *testing.T) {
 
 func TestRegisterMetric(t *testing.T) {
 	tests := []struct {
-		name       string
-		tp         model.MetricType
-		metricName string
-		value      string
-		expectErr  bool
+		name      string
+		metric    model.Metric
+		cancelled bool
+		expectErr bool
 	}{
 		{
-			name:       "valid counter metric",
-			tp:         model.CounterType,
-			metricName: "test_counter",
-			value:      "100",
-			expectErr:  false,
+			name:   "valid counter metric",
+			metric: model.NewCounter("test_counter", 100),
 		},
 		{
-			name:       "valid gauge metric",
-			tp:         model.GaugeType,
-			metricName: "test_gauge",
-			value:      "42.5",
-			expectErr:  false,
+			name:   "valid gauge metric",
+			metric: model.NewGauge("test_gauge", 42.5),
 		},
 		{
-			name:       "invalid metric type",
-			tp:         model.MetricType("invalid"),
-			metricName: "test_metric",
-			value:      "100",
-			expectErr:  true,
-		},
-		{
-			name:       "invalid counter value",
-			tp:         model.CounterType,
-			metricName: "test_counter",
-			value:      "invalid",
-			expectErr:  true,
-		},
-		{
-			name:       "invalid gauge value",
-			tp:         model.GaugeType,
-			metricName: "test_gauge",
-			value:      "invalid",
-			expectErr:  true,
+			name:      "cancelled context",
+			metric:    model.NewGauge("test_gauge", 42.5),
+			cancelled: true,
+			expectErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			ch := make(chan model.Metric, 1)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
 
-			err := registerMetric(ch, tt.tp, tt.metricName, tt.value)
+			var ch chan model.Metric
+			if tt.cancelled {
+				cancel()
+				// unbuffered channel without a reader blocks the send
+				ch = make(chan model.Metric)
+			} else {
+				ch = make(chan model.Metric, 1)
+			}
+
+			err := registerMetric(ctx, ch, tt.metric)
 
 			if tt.expectErr {
-				assert.Error(t, err)
+				assert.ErrorIs(t, err, context.Canceled)
 			} else {
 				assert.NoError(t, err)
 				select {
 				case metric := <-ch:
-					assert.Equal(t, tt.metricName, metric.GetID())
-					assert.Equal(t, tt.tp, metric.GetType())
-					assert.Equal(t, tt.value, metric.GetValue())
+					assert.Equal(t, tt.metric, metric)
 				case <-time.After(100 * time.Millisecond):
 					t.Fatal("timeout waiting for metric")
 				}
@@ -2,6 +2,7 @@ package agent
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -22,6 +23,11 @@ type Transport interface {
 	Close() error
 }
 
+// reloader is a transport whose keys can be read again.
+type reloader interface {
+	Reload() error
+}
+
 // Reporter is responsible for reporting metrics to the server.
 type Reporter struct {
 	logger    *slog.Logger
@@ -38,21 +44,45 @@ func NewReporter(
 	rateLimit int,
 	cryptoKey string,
 	grpcServerAddress string,
+	tlsConfig *tls.Config,
+	apiKey string,
+	secretKeyID string,
+	cryptoKeyID string,
 ) (*Reporter, error) {
 	var t Transport
 	switch {
 	case len(grpcServerAddress) > 0:
 		var err error
-		if t, err = NewGRPCTransport(grpcServerAddress); err != nil {
+		if t, err = NewGRPCTransport(
+			grpcServerAddress,
+			tlsConfig,
+			apiKey,
+			secretKey,
+			secretKeyID,
+		); err != nil {
 			return nil, fmt.Errorf("failed to init grpc transport: %w", err)
 		}
 	case len(serverURL) > 0:
-		t = &RESTTransport{
-			serverURL: serverURL,
-			secretKey: secretKey,
-			rateLimit: rateLimit,
-			cryptoKey: cryptoKey,
+		rt := &RESTTransport{
+			serverURL:   serverURL,
+			secretKey:   secretKey,
+			secretKeyID: secretKeyID,
+			rateLimit:   rateLimit,
+			tlsConfig:   tlsConfig,
+			apiKey:      apiKey,
+		}
+		if len(cryptoKey) > 0 {
+			k, err := newPublicKey(cryptoKey, cryptoKeyID)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"failed to read public key from file %s: %w",
+					cryptoKey,
+					err,
+				)
+			}
+			rt.publicKey = k
 		}
+		t = rt
 	default:
 		return nil, ErrUnknownTransport
 	}
@@ -64,6 +94,15 @@ func NewReporter(
 	}, nil
 }
 
+// Reload reads the keys of the transport again, if it has any.
+func (r *Reporter) Reload() error {
+	if rl, ok := r.transport.(reloader); ok {
+		return rl.Reload()
+	}
+
+	return nil
+}
+
 // RunReporter starts the reporting process at the specified interval.
 func (r *Reporter) RunReporter(
 	ctx context.Context,
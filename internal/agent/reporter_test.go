@@ -1,11 +1,23 @@
 package agent
 
 import (
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
 
+	"github.com/fragpit/yandex-go-dev-metrics/internal/keyring"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestReporter_reportMetrics(t *testing.T) {
@@ -60,6 +72,10 @@ func TestNewReporter(t *testing.T) {
 		1,
 		"",
 		"",
+		nil,
+		"",
+		"",
+		"",
 	)
 
 	assert.NoError(t, err)
@@ -107,3 +123,139 @@ func TestReadKey(t *testing.T) {
 		})
 	}
 }
+
+func TestRESTTransport_SendMetrics_TLS(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusOK)
+		},
+	))
+	defer ts.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	tr := &RESTTransport{
+		serverURL: ts.URL,
+		rateLimit: 1,
+		tlsConfig: &tls.Config{RootCAs: pool},
+	}
+
+	err := tr.SendMetrics(t.Context(), map[string]model.Metric{
+		"requests": model.NewCounter("requests", 1),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestRESTTransport_SendMetrics_APIKey(t *testing.T) {
+	auth := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			auth <- r.Header.Get("Authorization")
+			w.WriteHeader(http.StatusOK)
+		},
+	))
+	defer ts.Close()
+
+	tr := &RESTTransport{
+		serverURL: ts.URL,
+		rateLimit: 1,
+		apiKey:    "agent-key",
+	}
+
+	err := tr.SendMetrics(t.Context(), map[string]model.Metric{
+		"requests": model.NewCounter("requests", 1),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer agent-key", <-auth)
+}
+
+func TestRESTTransport_SendMetrics_Signed(t *testing.T) {
+	v, err := signing.NewVerifier([]byte("secret"))
+	require.NoError(t, err)
+
+	verified := make(chan error, 1)
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body, err := io.ReadAll(zr)
+			require.NoError(t, err)
+
+			sig, err := signing.Parse(r.Header.Get)
+			require.NoError(t, err)
+			verified <- v.Verify(r.Method, r.URL.Path, sig, body)
+			w.WriteHeader(http.StatusOK)
+		},
+	))
+	defer ts.Close()
+
+	tr := &RESTTransport{
+		serverURL: ts.URL,
+		secretKey: []byte("secret"),
+		rateLimit: 1,
+	}
+
+	err = tr.SendMetrics(t.Context(), map[string]model.Metric{
+		"requests": model.NewCounter("requests", 1),
+	})
+	require.NoError(t, err)
+	assert.NoError(t, <-verified)
+}
+
+func TestRESTTransport_SendMetrics_KeyIDs(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	ts := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			headers <- r.Header.Clone()
+			w.WriteHeader(http.StatusOK)
+		},
+	))
+	defer ts.Close()
+
+	k, err := newPublicKey("testdata/public.pem", "2025-11")
+	require.NoError(t, err)
+
+	tr := &RESTTransport{
+		serverURL:   ts.URL,
+		secretKey:   []byte("secret"),
+		secretKeyID: "2025-10",
+		rateLimit:   1,
+		publicKey:   k,
+	}
+
+	err = tr.SendMetrics(t.Context(), map[string]model.Metric{
+		"requests": model.NewCounter("requests", 1),
+	})
+	require.NoError(t, err)
+
+	h := <-headers
+	assert.Equal(t, "2025-10", h.Get(signing.HeaderKeyID))
+	assert.Equal(t, "2025-11", h.Get(keyring.HeaderEncryptionKeyID))
+	assert.Equal(t, "rsa", h.Get("X-Encrypted"))
+}
+
+func TestRESTTransport_Reload(t *testing.T) {
+	data, err := os.ReadFile("testdata/public.pem")
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "public.pem")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	k, err := newPublicKey(path, "")
+	require.NoError(t, err)
+	key := k.key.Load()
+
+	r := &Reporter{transport: &RESTTransport{publicKey: k}}
+	require.NoError(t, r.Reload())
+	assert.True(t, key.Equal(k.key.Load()))
+	key = k.key.Load()
+
+	// a broken key file keeps the current key
+	require.NoError(t, os.WriteFile(path, []byte("invalid"), 0o600))
+	assert.Error(t, r.Reload())
+	assert.Same(t, key, k.key.Load())
+}
@@ -2,17 +2,21 @@ package agent
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net"
-	"strconv"
+	"net/http"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
 	pb "github.com/fragpit/yandex-go-dev-metrics/internal/proto"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
 )
 
 var _ Transport = (*GRPCTransport)(nil)
@@ -21,15 +25,27 @@ type GRPCTransport struct {
 	conn    *grpc.ClientConn
 	client  pb.MetricsClient
 	localIP net.IP
+	apiKey  string
+	signer  *signing.Signer
 }
 
+// NewGRPCTransport creates a transport for the server at addr. The
+// connection uses TLS with tlsConfig and is plaintext when it is nil. The
+// API key is sent as a bearer token and calls are signed with the secret
+// key when they are set, the signatures naming secretKeyID if not empty.
 func NewGRPCTransport(
 	addr string,
+	tlsConfig *tls.Config,
+	apiKey string,
+	secretKey []byte,
+	secretKeyID string,
 ) (*GRPCTransport, error) {
-	conn, err := grpc.NewClient(
-		addr,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-	)
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		return nil, fmt.Errorf("failed to init grpc client: %w", err)
 	}
@@ -53,11 +69,17 @@ func NewGRPCTransport(
 		)
 	}
 
-	return &GRPCTransport{
+	t := &GRPCTransport{
 		conn:    conn,
 		client:  c,
 		localIP: ip,
-	}, nil
+		apiKey:  apiKey,
+	}
+	if len(secretKey) > 0 {
+		t.signer = signing.NewSigner(secretKey, signing.WithKeyID(secretKeyID))
+	}
+
+	return t, nil
 }
 
 func (t *GRPCTransport) SendMetrics(
@@ -79,19 +101,10 @@ func (t *GRPCTransport) SendMetrics(
 		switch metric.GetType() {
 		case model.CounterType:
 			pm.SetType(pb.Metric_MTYPE_COUNTER)
-			v, err := strconv.ParseInt(metric.GetValue(), 10, 64)
-			if err != nil {
-				return fmt.Errorf("failed to convert %s: %w", id, err)
-			}
-			pm.SetDelta(v)
+			pm.SetDelta(metric.Int64())
 		case model.GaugeType:
 			pm.SetType(pb.Metric_MTYPE_GAUGE)
-			v, err := strconv.ParseFloat(metric.GetValue(), 64)
-			if err != nil {
-				return fmt.Errorf("failed to convert %s: %w", id, err)
-			}
-
-			pm.SetValue(v)
+			pm.SetValue(metric.Float64())
 		default:
 			return fmt.Errorf("unknown metric type %s for %s", metric.GetType(), id)
 		}
@@ -99,12 +112,33 @@ func (t *GRPCTransport) SendMetrics(
 		metrics = append(metrics, pm)
 	}
 
+	req := pb.UpdateMetricsRequest_builder{Metrics: metrics}.Build()
+
 	md := metadata.New(map[string]string{"x-real-ip": t.localIP.String()})
+	if t.apiKey != "" {
+		md.Set("authorization", "Bearer "+t.apiKey)
+	}
+	if t.signer != nil {
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+
+		sig, err := t.signer.Sign(
+			http.MethodPost,
+			pb.Metrics_UpdateMetrics_FullMethodName,
+			body,
+		)
+		if err != nil {
+			return err
+		}
+		for k, v := range sig.Headers() {
+			md.Set(k, v)
+		}
+	}
 	ctx = metadata.NewOutgoingContext(ctx, md)
-	_, err := t.client.UpdateMetrics(
-		ctx,
-		pb.UpdateMetricsRequest_builder{Metrics: metrics}.Build(),
-	)
+
+	_, err := t.client.UpdateMetrics(ctx, req)
 	if err != nil {
 		return fmt.Errorf("failed to send metrics: %w", err)
 	}
@@ -4,12 +4,10 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
 	"errors"
@@ -18,9 +16,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"sync/atomic"
 	"time"
 
+	"github.com/fragpit/yandex-go-dev-metrics/internal/keyring"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
 	"github.com/go-resty/resty/v2"
 	"golang.org/x/sync/errgroup"
 )
@@ -30,8 +31,16 @@ var _ Transport = (*RESTTransport)(nil)
 type RESTTransport struct {
 	serverURL string
 	secretKey []byte
-	rateLimit int
-	cryptoKey string
+	// secretKeyID names the secret key in the signatures when set.
+	secretKeyID string
+	rateLimit   int
+	// publicKey encrypts the bodies when set.
+	publicKey *publicKey
+	// tlsConfig verifies https servers and presents the client
+	// certificate, the defaults of the HTTP client when nil.
+	tlsConfig *tls.Config
+	// apiKey is sent as a bearer token when set.
+	apiKey string
 }
 
 func (t *RESTTransport) SendMetrics(
@@ -69,12 +78,23 @@ func (t *RESTTransport) SendMetrics(
 		SetHeader("Content-Type", "application/json").
 		OnBeforeRequest(addRealIPHeader(ip.String()))
 
+	if t.tlsConfig != nil {
+		client.SetTLSClientConfig(t.tlsConfig)
+	}
+
+	if t.apiKey != "" {
+		client.SetAuthToken(t.apiKey)
+	}
+
 	if len(t.secretKey) > 0 {
-		client.OnBeforeRequest(checksumRequestMiddleware(t.secretKey))
+		client.OnBeforeRequest(signRequestMiddleware(signing.NewSigner(
+			t.secretKey,
+			signing.WithKeyID(t.secretKeyID),
+		)))
 	}
 
-	if len(t.cryptoKey) > 0 {
-		client.OnBeforeRequest(encryptRequestMiddleware(t.cryptoKey))
+	if t.publicKey != nil {
+		client.OnBeforeRequest(encryptRequestMiddleware(t.publicKey))
 	} else {
 		client.OnBeforeRequest(gzipRequestMiddleware())
 	}
@@ -162,6 +182,15 @@ func (t *RESTTransport) SendMetrics(
 
 func (t *RESTTransport) Close() error { return nil }
 
+// Reload reads the public key again.
+func (t *RESTTransport) Reload() error {
+	if t.publicKey == nil {
+		return nil
+	}
+
+	return t.publicKey.reload()
+}
+
 func gzipRequestMiddleware() resty.RequestMiddleware {
 	return func(c *resty.Client, req *resty.Request) error {
 		if req.Body == nil {
@@ -195,10 +224,11 @@ func gzipRequestMiddleware() resty.RequestMiddleware {
 	}
 }
 
-func checksumRequestMiddleware(key []byte) resty.RequestMiddleware {
+// signRequestMiddleware signs the request with a version 2 signature. It
+// runs before compression and encryption, the signature covering the body
+// the server decodes.
+func signRequestMiddleware(signer *signing.Signer) resty.RequestMiddleware {
 	return func(c *resty.Client, req *resty.Request) error {
-		mac := hmac.New(sha256.New, key)
-
 		bodyBytes, ok := req.Body.([]byte)
 		if !ok {
 			data, err := json.Marshal(req.Body)
@@ -208,30 +238,61 @@ func checksumRequestMiddleware(key []byte) resty.RequestMiddleware {
 			bodyBytes = data
 		}
 
-		mac.Write(bodyBytes)
-		sum := mac.Sum(nil)
-		sumEncoded := base64.RawStdEncoding.EncodeToString(sum)
+		u, err := url.Parse(req.URL)
+		if err != nil {
+			return fmt.Errorf("failed to parse request url: %w", err)
+		}
 
-		req.SetHeader("HashSHA256", sumEncoded)
+		sig, err := signer.Sign(req.Method, u.Path, bodyBytes)
+		if err != nil {
+			return err
+		}
+		req.SetHeaders(sig.Headers())
 
 		return nil
 	}
 }
 
-func encryptRequestMiddleware(keyPath string) resty.RequestMiddleware {
-	return func(c *resty.Client, r *resty.Request) error {
-		publicKey, err := readKey(keyPath)
-		if err != nil {
-			return fmt.Errorf("failed to read key: %w", err)
-		}
+// publicKey is the server key the bodies are encrypted with, read once and
+// then again on reload.
+type publicKey struct {
+	path string
+	// id names the key in the server key set when set.
+	id  string
+	key atomic.Pointer[rsa.PublicKey]
+}
+
+func newPublicKey(path, id string) (*publicKey, error) {
+	k := &publicKey{path: path, id: id}
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
 
-		encBody, err := rsa.EncryptPKCS1v15(rand.Reader, publicKey, r.Body.([]byte))
+func (k *publicKey) reload() error {
+	key, err := readKey(k.path)
+	if err != nil {
+		return fmt.Errorf("failed to read key: %w", err)
+	}
+	k.key.Store(key)
+
+	return nil
+}
+
+func encryptRequestMiddleware(k *publicKey) resty.RequestMiddleware {
+	return func(c *resty.Client, r *resty.Request) error {
+		encBody, err := rsa.EncryptPKCS1v15(rand.Reader, k.key.Load(), r.Body.([]byte))
 		if err != nil {
 			return fmt.Errorf("failed to encrypt body: %w", err)
 		}
 
 		r.Body = encBody
 		r.SetHeader("X-Encrypted", "rsa")
+		if k.id != "" {
+			r.SetHeader(keyring.HeaderEncryptionKeyID, k.id)
+		}
 
 		return nil
 	}
@@ -0,0 +1,216 @@
+// Package apikey authenticates clients by API keys with scopes.
+//
+// Keys are stored hashed in a JSON file listing the keys by name:
+//
+//	[
+//	  {
+//	    "name": "agent-1",
+//	    "hash": "sha256:<hex of the SHA-256 of the key>",
+//	    "scopes": ["write"],
+//	    "prefix": "hosts.agent-1."
+//	  }
+//	]
+//
+// A key with a prefix only reads and writes the metrics whose name starts
+// with it. New keys and their hashes are printed by keygen -api-key.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// hashPrefix marks the hash algorithm of a stored key.
+const hashPrefix = "sha256:"
+
+// ErrInvalidKeys reports a malformed key file.
+var ErrInvalidKeys = errors.New("invalid api keys")
+
+// Scope is a permission granted to a key.
+type Scope string
+
+const (
+	// ScopeRead reads metrics.
+	ScopeRead Scope = "read"
+	// ScopeWrite updates metrics.
+	ScopeWrite Scope = "write"
+	// ScopeAdmin grants every scope.
+	ScopeAdmin Scope = "admin"
+)
+
+// Key is an API key known to the server.
+type Key struct {
+	Name   string  `json:"name"`
+	Hash   string  `json:"hash"`
+	Scopes []Scope `json:"scopes"`
+	Prefix string  `json:"prefix,omitempty"`
+}
+
+// Has reports whether the key is granted the scope.
+func (k *Key) Has(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope) ||
+		slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// Allows reports whether the key may access the metric.
+func (k *Key) Allows(metric string) bool {
+	return strings.HasPrefix(metric, k.Prefix)
+}
+
+// Restricted reports whether the key is limited to a metric prefix.
+func (k *Key) Restricted() bool {
+	return k.Prefix != ""
+}
+
+// Narrow returns the name prefix matching both the metrics of the key and
+// the ones starting with prefix, false if no metric can match both.
+func (k *Key) Narrow(prefix string) (string, bool) {
+	switch {
+	case strings.HasPrefix(prefix, k.Prefix):
+		return prefix, true
+	case strings.HasPrefix(k.Prefix, prefix):
+		return k.Prefix, true
+	}
+
+	return "", false
+}
+
+// Store looks keys up by their hash.
+type Store struct {
+	keys map[[sha256.Size]byte]*Key
+}
+
+// NewStore validates the keys and indexes them by hash.
+func NewStore(keys []Key) (*Store, error) {
+	s := &Store{keys: make(map[[sha256.Size]byte]*Key, len(keys))}
+	names := make(map[string]struct{}, len(keys))
+
+	for i := range keys {
+		k := &keys[i]
+		if k.Name == "" {
+			return nil, fmt.Errorf("%w: key %d has no name", ErrInvalidKeys, i)
+		}
+		if _, ok := names[k.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate key %s", ErrInvalidKeys, k.Name)
+		}
+		names[k.Name] = struct{}{}
+
+		sum, err := parseHash(k.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %s: %w", ErrInvalidKeys, k.Name, err)
+		}
+		if _, ok := s.keys[sum]; ok {
+			return nil, fmt.Errorf("%w: key %s reuses a hash", ErrInvalidKeys, k.Name)
+		}
+
+		if len(k.Scopes) == 0 {
+			return nil, fmt.Errorf("%w: key %s has no scopes", ErrInvalidKeys, k.Name)
+		}
+		for _, scope := range k.Scopes {
+			switch scope {
+			case ScopeRead, ScopeWrite, ScopeAdmin:
+			default:
+				return nil, fmt.Errorf(
+					"%w: key %s has unknown scope %q",
+					ErrInvalidKeys,
+					k.Name,
+					scope,
+				)
+			}
+		}
+
+		s.keys[sum] = k
+	}
+
+	return s, nil
+}
+
+// Load reads the keys from the JSON file at path.
+func Load(path string) (*Store, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read api keys: %w", err)
+	}
+
+	var keys []Key
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKeys, err)
+	}
+
+	return NewStore(keys)
+}
+
+// Lookup returns the key presented by a client.
+func (s *Store) Lookup(key string) (*Key, bool) {
+	if key == "" {
+		return nil, false
+	}
+
+	k, ok := s.keys[sha256.Sum256([]byte(key))]
+	return k, ok
+}
+
+// Hash returns the stored form of a key.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// Generate returns a new random key.
+func Generate() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func parseHash(hash string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	digest, ok := strings.CutPrefix(hash, hashPrefix)
+	if !ok {
+		return sum, fmt.Errorf("hash must start with %s", hashPrefix)
+	}
+
+	b, err := hex.DecodeString(digest)
+	if err != nil || len(b) != sha256.Size {
+		return sum, errors.New("hash must be a hex encoded sha256 digest")
+	}
+	copy(sum[:], b)
+
+	return sum, nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the authenticated key.
+func NewContext(ctx context.Context, k *Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, k)
+}
+
+// FromContext returns the authenticated key of the context.
+func FromContext(ctx context.Context) (*Key, bool) {
+	k, ok := ctx.Value(contextKey{}).(*Key)
+	return k, ok
+}
+
+// Name returns the name of the authenticated key of the context, or an
+// empty string without one.
+func Name(ctx context.Context) string {
+	if k, ok := FromContext(ctx); ok {
+		return k.Name
+	}
+
+	return ""
+}
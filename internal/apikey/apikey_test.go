@@ -0,0 +1,176 @@
+package apikey
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStore(t *testing.T) {
+	hash := Hash("secret")
+
+	tests := []struct {
+		name    string
+		keys    []Key
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			keys: []Key{
+				{Name: "agent", Hash: hash, Scopes: []Scope{ScopeWrite}},
+				{Name: "ops", Hash: Hash("other"), Scopes: []Scope{ScopeAdmin}},
+			},
+		},
+		{name: "empty"},
+		{
+			name:    "no name",
+			keys:    []Key{{Hash: hash, Scopes: []Scope{ScopeRead}}},
+			wantErr: true,
+		},
+		{
+			name: "duplicate name",
+			keys: []Key{
+				{Name: "agent", Hash: hash, Scopes: []Scope{ScopeRead}},
+				{Name: "agent", Hash: Hash("other"), Scopes: []Scope{ScopeRead}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate hash",
+			keys: []Key{
+				{Name: "agent", Hash: hash, Scopes: []Scope{ScopeRead}},
+				{Name: "ops", Hash: hash, Scopes: []Scope{ScopeRead}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "plain key",
+			keys:    []Key{{Name: "agent", Hash: "secret", Scopes: []Scope{ScopeRead}}},
+			wantErr: true,
+		},
+		{
+			name:    "short hash",
+			keys:    []Key{{Name: "agent", Hash: "sha256:abcd", Scopes: []Scope{ScopeRead}}},
+			wantErr: true,
+		},
+		{
+			name:    "no scopes",
+			keys:    []Key{{Name: "agent", Hash: hash}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown scope",
+			keys:    []Key{{Name: "agent", Hash: hash, Scopes: []Scope{"delete"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewStore(tt.keys)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidKeys)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	data := `[{"name":"agent","hash":"` + Hash("secret") +
+		`","scopes":["write"],"prefix":"hosts."}]`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+
+	s, err := Load(path)
+	require.NoError(t, err)
+
+	k, ok := s.Lookup("secret")
+	require.True(t, ok)
+	assert.Equal(t, "agent", k.Name)
+	assert.Equal(t, "hosts.", k.Prefix)
+
+	_, ok = s.Lookup("wrong")
+	assert.False(t, ok)
+	_, ok = s.Lookup("")
+	assert.False(t, ok)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = Load(path)
+	assert.ErrorIs(t, err, ErrInvalidKeys)
+}
+
+func TestKey_Has(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []Scope
+		scope  Scope
+		want   bool
+	}{
+		{name: "granted", scopes: []Scope{ScopeRead}, scope: ScopeRead, want: true},
+		{name: "not granted", scopes: []Scope{ScopeRead}, scope: ScopeWrite},
+		{name: "admin", scopes: []Scope{ScopeAdmin}, scope: ScopeWrite, want: true},
+		{name: "admin required", scopes: []Scope{ScopeWrite}, scope: ScopeAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &Key{Scopes: tt.scopes}
+			assert.Equal(t, tt.want, k.Has(tt.scope))
+		})
+	}
+}
+
+func TestKey_Narrow(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		prefix string
+		want   string
+		wantOK bool
+	}{
+		{name: "unrestricted", prefix: "cpu.", want: "cpu.", wantOK: true},
+		{name: "no query prefix", key: "hosts.", want: "hosts.", wantOK: true},
+		{name: "narrower query", key: "hosts.", prefix: "hosts.a.", want: "hosts.a.", wantOK: true},
+		{name: "wider query", key: "hosts.a.", prefix: "hosts.", want: "hosts.a.", wantOK: true},
+		{name: "disjoint", key: "hosts.", prefix: "cpu."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &Key{Prefix: tt.key}
+			got, ok := k.Narrow(tt.prefix)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	a, err := Generate()
+	require.NoError(t, err)
+	b, err := Generate()
+	require.NoError(t, err)
+
+	assert.NotEqual(t, a, b)
+	assert.Len(t, a, 43)
+}
+
+func TestContext(t *testing.T) {
+	assert.Empty(t, Name(context.Background()))
+
+	ctx := NewContext(context.Background(), &Key{Name: "agent"})
+	k, ok := FromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, "agent", k.Name)
+	assert.Equal(t, "agent", Name(ctx))
+}
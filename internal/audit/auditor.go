@@ -5,16 +5,82 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
 )
 
 const (
 	DefaultTimeout = 5 * time.Second
 )
 
+// EventType is the kind of a security event.
+type EventType string
+
+const (
+	// EventAuthFailed is a request without valid credentials: no API key,
+	// an unknown one or no client certificate.
+	EventAuthFailed EventType = "auth_failed"
+	// EventAccessDenied is a request whose client address, API key scope or
+	// client certificate does not allow it.
+	EventAccessDenied EventType = "access_denied"
+	// EventSignatureInvalid is a request with a missing, invalid, expired
+	// or replayed checksum or signature.
+	EventSignatureInvalid EventType = "signature_invalid"
+	// EventDecryptFailed is a request whose body cannot be decrypted.
+	EventDecryptFailed EventType = "decrypt_failed"
+)
+
+// Outcome is the result of an audited request.
+type Outcome string
+
+const (
+	// OutcomeSuccess is a request whose metrics were all stored.
+	OutcomeSuccess Outcome = "success"
+	// OutcomePartial is a batch some metrics of which were rejected.
+	OutcomePartial Outcome = "partial"
+	// OutcomeRejected is a request rejected for security reasons.
+	OutcomeRejected Outcome = "rejected"
+)
+
+// Transports of the audited requests.
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+// Event is an audited request, a metric update or a security event. The
+// JSON encoding of the fields after IPAddress is version 2 of the schema.
 type Event struct {
 	Timestamp int64    `json:"ts"`
 	Metrics   []string `json:"metrics"`
 	IPAddress string   `json:"ip_address"`
+	// Version is the schema version of the event, set by the Auditor.
+	Version int `json:"version,omitempty"`
+	// Values are the updated metrics with their type and value once
+	// stored.
+	Values []*model.Metrics `json:"values,omitempty"`
+	// Transport is TransportHTTP or TransportGRPC.
+	Transport string `json:"transport,omitempty"`
+	// Route is the REST path or the gRPC method of the request.
+	Route string `json:"route,omitempty"`
+	// UserAgent is the user agent of the client.
+	UserAgent string `json:"user_agent,omitempty"`
+	// RequestID is the ID of the request, the X-Request-Id header or the
+	// x-request-id metadata.
+	RequestID string `json:"request_id,omitempty"`
+	// Identity is the subject of the client certificate the agent
+	// authenticated with over mutual TLS.
+	Identity string `json:"identity,omitempty"`
+	// APIKey is the name of the API key the request authenticated with.
+	APIKey string `json:"api_key,omitempty"`
+	// KeyID is the signing or encryption key the request named.
+	KeyID string `json:"key_id,omitempty"`
+	// Outcome is the result of the request.
+	Outcome Outcome `json:"outcome,omitempty"`
+	// Type is the kind of a rejected request, empty for metric updates.
+	Type EventType `json:"type,omitempty"`
+	// Reason tells why the request was rejected.
+	Reason string `json:"reason,omitempty"`
 }
 
 // Observer is an interface for components that want to receive audit events.
@@ -22,6 +88,11 @@ type Observer interface {
 	Notify(ctx context.Context, event Event) error
 }
 
+// closer is an Observer holding events until closed, like the Dispatcher.
+type closer interface {
+	Close(ctx context.Context) error
+}
+
 type Auditor struct {
 	observers []Observer
 }
@@ -35,20 +106,24 @@ func (a *Auditor) Add(observer Observer) {
 	a.observers = append(a.observers, observer)
 }
 
-// LogEvent notifies all observers about the event.
-func (a *Auditor) LogEvent(
-	ctx context.Context,
-	metrics []string,
-	ipAddress string,
-) error {
-	if len(a.observers) == 0 {
+// Enabled reports whether the auditor has observers.
+func (a *Auditor) Enabled() bool {
+	return a != nil && len(a.observers) > 0
+}
+
+// LogEvent notifies all observers about the event, stamped with the
+// current time and the schema version unless it has them. A nil Auditor
+// drops the event.
+func (a *Auditor) LogEvent(ctx context.Context, event Event) error {
+	if !a.Enabled() {
 		return nil
 	}
 
-	event := Event{
-		Timestamp: time.Now().Unix(),
-		Metrics:   metrics,
-		IPAddress: ipAddress,
+	if event.Timestamp == 0 {
+		event.Timestamp = time.Now().Unix()
+	}
+	if event.Version == 0 {
+		event.Version = SchemaVersion
 	}
 
 	var errs []error
@@ -69,3 +144,20 @@ func (a *Auditor) LogEvent(
 
 	return nil
 }
+
+// Close closes the observers that hold events, waiting until they deliver
+// them or the context is done.
+func (a *Auditor) Close(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, obs := range a.observers {
+		if c, ok := obs.(closer); ok {
+			errs = append(errs, c.Close(ctx))
+		}
+	}
+
+	return errors.Join(errs...)
+}
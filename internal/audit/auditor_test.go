@@ -9,11 +9,13 @@ import (
 
 type mockObserver struct {
 	called bool
+	event  Event
 	err    error
 }
 
 func (m *mockObserver) Notify(ctx context.Context, event Event) error {
 	m.called = true
+	m.event = event
 	return m.err
 }
 
@@ -35,11 +37,10 @@ func TestAuditor_Add(t *testing.T) {
 func TestAuditor_LogEvent(t *testing.T) {
 	t.Run("no observers", func(t *testing.T) {
 		auditor := NewAuditor()
-		err := auditor.LogEvent(
-			context.Background(),
-			[]string{"metric1"},
-			"127.0.0.1",
-		)
+		err := auditor.LogEvent(context.Background(), Event{
+			Metrics:   []string{"metric1"},
+			IPAddress: "127.0.0.1",
+		})
 		assert.NoError(t, err)
 	})
 
@@ -48,25 +49,42 @@ func TestAuditor_LogEvent(t *testing.T) {
 		observer := &mockObserver{}
 		auditor.Add(observer)
 
-		err := auditor.LogEvent(
-			context.Background(),
-			[]string{"metric1"},
-			"127.0.0.1",
-		)
+		err := auditor.LogEvent(context.Background(), Event{
+			Metrics:   []string{"metric1"},
+			IPAddress: "127.0.0.1",
+		})
 		assert.NoError(t, err)
 		assert.True(t, observer.called)
 	})
 
+	t.Run("with identity", func(t *testing.T) {
+		auditor := NewAuditor()
+		observer := &mockObserver{}
+		auditor.Add(observer)
+
+		err := auditor.LogEvent(context.Background(), Event{
+			Metrics:   []string{"metric1"},
+			IPAddress: "127.0.0.1",
+			Identity:  "CN=agent-1",
+			APIKey:    "agent-1",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "CN=agent-1", observer.event.Identity)
+		assert.Equal(t, "agent-1", observer.event.APIKey)
+		assert.Equal(t, "127.0.0.1", observer.event.IPAddress)
+		assert.NotZero(t, observer.event.Timestamp)
+		assert.Equal(t, SchemaVersion, observer.event.Version)
+	})
+
 	t.Run("observer returns error", func(t *testing.T) {
 		auditor := NewAuditor()
 		observer := &mockObserver{err: assert.AnError}
 		auditor.Add(observer)
 
-		err := auditor.LogEvent(
-			context.Background(),
-			[]string{"metric1"},
-			"127.0.0.1",
-		)
+		err := auditor.LogEvent(context.Background(), Event{
+			Metrics:   []string{"metric1"},
+			IPAddress: "127.0.0.1",
+		})
 		assert.Error(t, err)
 		assert.True(t, observer.called)
 	})
@@ -0,0 +1,348 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultQueueSize = 1024
+	DefaultBatchSize = 100
+)
+
+// ErrDispatcherClosed is returned for the events sent to a closed
+// Dispatcher.
+var ErrDispatcherClosed = errors.New("audit dispatcher closed")
+
+// Overflow is what a Dispatcher does with an event when its queue is full.
+type Overflow string
+
+const (
+	// OverflowBlock waits for room in the queue until the context of the
+	// event is done.
+	OverflowBlock Overflow = "block"
+	// OverflowDropOldest drops the oldest queued event.
+	OverflowDropOldest Overflow = "drop-oldest"
+	// OverflowSpill writes the event to the spill file, delivered once the
+	// queue is empty.
+	OverflowSpill Overflow = "spill"
+)
+
+// ParseOverflow parses an overflow policy.
+func ParseOverflow(s string) (Overflow, error) {
+	switch o := Overflow(s); o {
+	case OverflowBlock, OverflowDropOldest, OverflowSpill:
+		return o, nil
+	default:
+		return "", fmt.Errorf("unknown audit overflow policy: %q", s)
+	}
+}
+
+// BatchObserver is an Observer that receives many events at once.
+type BatchObserver interface {
+	Observer
+	NotifyBatch(ctx context.Context, events []Event) error
+}
+
+// Dispatcher is an Observer that queues the events and delivers them to
+// another observer from its own goroutine, in batches of the events queued
+// meanwhile.
+type Dispatcher struct {
+	observer  Observer
+	queueSize int
+	batchSize int
+	overflow  Overflow
+	spillFile string
+	timeout   time.Duration
+
+	// mu is held for reading while queueing an event and for writing
+	// while closing.
+	mu     sync.RWMutex
+	closed bool
+	queue  chan Event
+
+	spillMu sync.Mutex
+	spilled bool
+
+	dropped   atomic.Int64
+	closeOnce sync.Once
+	stop      chan struct{}
+	flush     chan struct{}
+	done      chan struct{}
+}
+
+// DispatcherOption configures a Dispatcher.
+type DispatcherOption func(*Dispatcher) error
+
+// WithQueueSize sets the number of events the queue holds.
+func WithQueueSize(n int) DispatcherOption {
+	return func(d *Dispatcher) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid audit queue size: %d", n)
+		}
+		d.queueSize = n
+		return nil
+	}
+}
+
+// WithBatchSize sets the maximum number of events delivered at once.
+func WithBatchSize(n int) DispatcherOption {
+	return func(d *Dispatcher) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid audit batch size: %d", n)
+		}
+		d.batchSize = n
+		return nil
+	}
+}
+
+// WithOverflow sets the overflow policy, OverflowSpill requiring a spill
+// file.
+func WithOverflow(o Overflow) DispatcherOption {
+	return func(d *Dispatcher) error {
+		if _, err := ParseOverflow(string(o)); err != nil {
+			return err
+		}
+		d.overflow = o
+		return nil
+	}
+}
+
+// WithSpillFile sets the file the events overflowing the queue are written
+// to with OverflowSpill.
+func WithSpillFile(path string) DispatcherOption {
+	return func(d *Dispatcher) error {
+		d.spillFile = path
+		return nil
+	}
+}
+
+// WithDeliveryTimeout sets the time the observer has to handle a batch,
+// DefaultTimeout by default.
+func WithDeliveryTimeout(t time.Duration) DispatcherOption {
+	return func(d *Dispatcher) error {
+		if t <= 0 {
+			return fmt.Errorf("invalid audit delivery timeout: %s", t)
+		}
+		d.timeout = t
+		return nil
+	}
+}
+
+// NewDispatcher creates a Dispatcher delivering the events to the observer
+// and starts its goroutine. The events left in the spill file by a
+// previous run are delivered first.
+func NewDispatcher(observer Observer, opts ...DispatcherOption) (*Dispatcher, error) {
+	d := &Dispatcher{
+		observer:  observer,
+		queueSize: DefaultQueueSize,
+		batchSize: DefaultBatchSize,
+		overflow:  OverflowBlock,
+		timeout:   DefaultTimeout,
+		stop:      make(chan struct{}),
+		flush:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.overflow == OverflowSpill {
+		if d.spillFile == "" {
+			return nil, errors.New("audit spill file is required")
+		}
+		if _, err := os.Stat(d.spillFile); err == nil {
+			d.spilled = true
+		}
+	}
+
+	d.queue = make(chan Event, d.queueSize)
+	go d.run()
+
+	return d, nil
+}
+
+// Notify queues the event, applying the overflow policy when the queue is
+// full.
+func (d *Dispatcher) Notify(ctx context.Context, event Event) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return ErrDispatcherClosed
+	}
+
+	select {
+	case d.queue <- event:
+		return nil
+	default:
+	}
+
+	switch d.overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case <-d.queue:
+				d.dropped.Add(1)
+				slog.Warn(
+					"audit queue is full, dropped the oldest event",
+					slog.String("observer", fmt.Sprintf("%T", d.observer)),
+				)
+			default:
+			}
+
+			select {
+			case d.queue <- event:
+				return nil
+			default:
+			}
+		}
+	case OverflowSpill:
+		return d.spill(event)
+	default:
+		select {
+		case d.queue <- event:
+			return nil
+		case <-d.stop:
+			return ErrDispatcherClosed
+		case <-ctx.Done():
+			return fmt.Errorf("audit queue is full: %w", ctx.Err())
+		}
+	}
+}
+
+// Dropped returns the number of events dropped with OverflowDropOldest.
+func (d *Dispatcher) Dropped() int64 {
+	return d.dropped.Load()
+}
+
+// Close stops queueing the events and waits until the queued and the
+// spilled ones are delivered or the context is done.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.closeOnce.Do(func() {
+		close(d.stop)
+
+		d.mu.Lock()
+		d.closed = true
+		d.mu.Unlock()
+
+		close(d.flush)
+	})
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush audit events: %w", ctx.Err())
+	}
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+
+	d.replay()
+
+	for {
+		select {
+		case event := <-d.queue:
+			d.deliver(d.batch(event))
+			if len(d.queue) == 0 {
+				d.replay()
+			}
+		case <-d.flush:
+			for len(d.queue) > 0 {
+				d.deliver(d.batch(<-d.queue))
+			}
+			d.replay()
+			return
+		}
+	}
+}
+
+// batch returns the event with the events queued after it, up to the
+// batch size.
+func (d *Dispatcher) batch(event Event) []Event {
+	events := []Event{event}
+	for len(events) < d.batchSize {
+		select {
+		case e := <-d.queue:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+
+	return events
+}
+
+// deliver passes the events to the observer, logging the failures as
+// nobody waits for them.
+func (d *Dispatcher) deliver(events []Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	var err error
+	if bo, ok := d.observer.(BatchObserver); ok {
+		err = bo.NotifyBatch(ctx, events)
+	} else {
+		var errs []error
+		for _, event := range events {
+			errs = append(errs, d.observer.Notify(ctx, event))
+		}
+		err = errors.Join(errs...)
+	}
+
+	if err != nil {
+		slog.Error(
+			"failed to deliver audit events",
+			slog.String("observer", fmt.Sprintf("%T", d.observer)),
+			slog.Int("events", len(events)),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// spill appends the event to the spill file.
+func (d *Dispatcher) spill(event Event) error {
+	d.spillMu.Lock()
+	defer d.spillMu.Unlock()
+
+	if err := appendEvents(d.spillFile, []Event{event}); err != nil {
+		return fmt.Errorf("failed to spill audit event: %w", err)
+	}
+	d.spilled = true
+
+	return nil
+}
+
+// replay delivers the events of the spill file and removes it.
+func (d *Dispatcher) replay() {
+	d.spillMu.Lock()
+	if !d.spilled {
+		d.spillMu.Unlock()
+		return
+	}
+
+	events, err := takeEvents(d.spillFile)
+	d.spilled = false
+	d.spillMu.Unlock()
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error(
+			"failed to replay audit spill file",
+			slog.String("file", d.spillFile),
+			slog.Any("error", err),
+		)
+	}
+
+	batches(events, d.batchSize, d.deliver)
+}
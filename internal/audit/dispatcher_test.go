@@ -0,0 +1,254 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchObserver records the batches it receives, each delivery waiting
+// for the gate once started is signalled.
+type batchObserver struct {
+	mu      sync.Mutex
+	batches [][]Event
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func newBatchObserver() *batchObserver {
+	return &batchObserver{
+		started: make(chan struct{}, 100),
+		gate:    make(chan struct{}),
+	}
+}
+
+func (o *batchObserver) Notify(ctx context.Context, event Event) error {
+	return o.NotifyBatch(ctx, []Event{event})
+}
+
+func (o *batchObserver) NotifyBatch(_ context.Context, events []Event) error {
+	o.started <- struct{}{}
+	<-o.gate
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.batches = append(o.batches, events)
+	return nil
+}
+
+func (o *batchObserver) ips() [][]string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var ips [][]string
+	for _, b := range o.batches {
+		var batch []string
+		for _, e := range b {
+			batch = append(batch, e.IPAddress)
+		}
+		ips = append(ips, batch)
+	}
+	return ips
+}
+
+func waitStarted(t *testing.T, o *batchObserver) {
+	t.Helper()
+
+	select {
+	case <-o.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery did not start")
+	}
+}
+
+func TestParseOverflow(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Overflow
+		wantErr bool
+	}{
+		{in: "block", want: OverflowBlock},
+		{in: "drop-oldest", want: OverflowDropOldest},
+		{in: "spill", want: OverflowSpill},
+		{in: "drop", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseOverflow(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewDispatcher_Options(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []DispatcherOption
+	}{
+		{name: "zero queue size", opts: []DispatcherOption{WithQueueSize(0)}},
+		{name: "zero batch size", opts: []DispatcherOption{WithBatchSize(0)}},
+		{name: "unknown overflow", opts: []DispatcherOption{WithOverflow("drop")}},
+		{name: "zero delivery timeout", opts: []DispatcherOption{WithDeliveryTimeout(0)}},
+		{name: "spill without file", opts: []DispatcherOption{WithOverflow(OverflowSpill)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDispatcher(&mockObserver{}, tt.opts...)
+			assert.Error(t, err)
+			assert.Nil(t, d)
+		})
+	}
+}
+
+func TestDispatcher_Batches(t *testing.T) {
+	obs := newBatchObserver()
+	d, err := NewDispatcher(obs, WithQueueSize(10), WithBatchSize(2))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, d.Notify(ctx, Event{IPAddress: "1"}))
+	waitStarted(t, obs)
+
+	for _, ip := range []string{"2", "3", "4"} {
+		require.NoError(t, d.Notify(ctx, Event{IPAddress: ip}))
+	}
+	close(obs.gate)
+
+	require.NoError(t, d.Close(ctx))
+	assert.Equal(t, [][]string{{"1"}, {"2", "3"}, {"4"}}, obs.ips())
+
+	assert.ErrorIs(t, d.Notify(ctx, Event{}), ErrDispatcherClosed)
+}
+
+func TestDispatcher_Overflow(t *testing.T) {
+	t.Run("block", func(t *testing.T) {
+		obs := newBatchObserver()
+		d, err := NewDispatcher(obs, WithQueueSize(1))
+		require.NoError(t, err)
+
+		require.NoError(t, d.Notify(context.Background(), Event{IPAddress: "1"}))
+		waitStarted(t, obs)
+		require.NoError(t, d.Notify(context.Background(), Event{IPAddress: "2"}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, d.Notify(ctx, Event{IPAddress: "3"}), context.DeadlineExceeded)
+
+		close(obs.gate)
+		require.NoError(t, d.Close(context.Background()))
+		assert.Equal(t, [][]string{{"1"}, {"2"}}, obs.ips())
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		obs := newBatchObserver()
+		d, err := NewDispatcher(obs,
+			WithQueueSize(1),
+			WithOverflow(OverflowDropOldest),
+		)
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		require.NoError(t, d.Notify(ctx, Event{IPAddress: "1"}))
+		waitStarted(t, obs)
+		require.NoError(t, d.Notify(ctx, Event{IPAddress: "2"}))
+		require.NoError(t, d.Notify(ctx, Event{IPAddress: "3"}))
+
+		close(obs.gate)
+		require.NoError(t, d.Close(ctx))
+		assert.Equal(t, [][]string{{"1"}, {"3"}}, obs.ips())
+		assert.Equal(t, int64(1), d.Dropped())
+	})
+
+	t.Run("spill", func(t *testing.T) {
+		spill := filepath.Join(t.TempDir(), "audit.spill")
+		obs := newBatchObserver()
+		d, err := NewDispatcher(obs,
+			WithQueueSize(1),
+			WithOverflow(OverflowSpill),
+			WithSpillFile(spill),
+		)
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		require.NoError(t, d.Notify(ctx, Event{IPAddress: "1"}))
+		waitStarted(t, obs)
+		for _, ip := range []string{"2", "3", "4"} {
+			require.NoError(t, d.Notify(ctx, Event{IPAddress: ip}))
+		}
+		assert.FileExists(t, spill)
+
+		close(obs.gate)
+		require.NoError(t, d.Close(ctx))
+		assert.Equal(t, [][]string{{"1"}, {"2"}, {"3", "4"}}, obs.ips())
+		assert.NoFileExists(t, spill)
+	})
+}
+
+func TestDispatcher_ReplaysSpillFile(t *testing.T) {
+	spill := filepath.Join(t.TempDir(), "audit.spill")
+	require.NoError(t, os.WriteFile(spill, []byte(
+		`{"ts":1,"metrics":["a"],"ip_address":"1"}`+"\n"+
+			`{"ts":2,"metrics":["b"],"ip_a`+"\n"+
+			`{"ts":3,"metrics":["c"],"ip_address":"3"}`+"\n",
+	), 0600))
+
+	obs := newBatchObserver()
+	close(obs.gate)
+	d, err := NewDispatcher(obs,
+		WithOverflow(OverflowSpill),
+		WithSpillFile(spill),
+	)
+	require.NoError(t, err)
+	require.NoError(t, d.Close(context.Background()))
+
+	assert.Equal(t, [][]string{{"1", "3"}}, obs.ips())
+	assert.NoFileExists(t, spill)
+}
+
+func TestDispatcher_CloseTimeout(t *testing.T) {
+	obs := newBatchObserver()
+	d, err := NewDispatcher(obs)
+	require.NoError(t, err)
+
+	require.NoError(t, d.Notify(context.Background(), Event{IPAddress: "1"}))
+	waitStarted(t, obs)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, d.Close(ctx), context.DeadlineExceeded)
+
+	close(obs.gate)
+	require.NoError(t, d.Close(context.Background()))
+}
+
+func TestAuditor_Close(t *testing.T) {
+	obs := newBatchObserver()
+	close(obs.gate)
+	d, err := NewDispatcher(obs)
+	require.NoError(t, err)
+
+	auditor := NewAuditor()
+	auditor.Add(d)
+	auditor.Add(&mockObserver{})
+
+	require.NoError(t, auditor.LogEvent(context.Background(), Event{IPAddress: "1"}))
+	require.NoError(t, auditor.Close(context.Background()))
+	assert.Equal(t, [][]string{{"1"}}, obs.ips())
+
+	var nilAuditor *Auditor
+	assert.NoError(t, nilAuditor.Close(context.Background()))
+}
@@ -0,0 +1,123 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// appendEvents appends the events to a file of JSON events, one per line,
+// for the spill and the dead-letter files.
+func appendEvents(path string, events []Event) error {
+	data, err := encodeEvents(events)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit events file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed to write audit events file: %w", err)
+	}
+
+	return nil
+}
+
+// writeEvents replaces a file of appendEvents with the events, removing it
+// when there are none. The file is replaced at once, so that it holds either
+// the old or the new events after a crash.
+func writeEvents(path string, events []Event) error {
+	if len(events) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := encodeEvents(events)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write audit events file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace audit events file: %w", err)
+	}
+
+	return nil
+}
+
+func encodeEvents(events []Event) ([]byte, error) {
+	var data []byte
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode audit event: %w", err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	return data, nil
+}
+
+// readEvents reads a file of appendEvents, skipping the lines that cannot
+// be decoded such as one cut short by a crash.
+func readEvents(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			slog.Warn(
+				"skipping invalid audit event",
+				slog.String("file", path),
+				slog.Any("error", err),
+			)
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events, scanner.Err()
+}
+
+// takeEvents reads the events of a file of appendEvents and removes it.
+// The file is kept if it cannot be read.
+func takeEvents(path string) ([]Event, error) {
+	events, err := readEvents(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// batches calls fn with the events in batches of size.
+func batches(events []Event, size int, fn func([]Event)) {
+	for len(events) > 0 {
+		n := min(len(events), size)
+		fn(events[:n])
+		events = events[n:]
+	}
+}
@@ -2,7 +2,6 @@ package audit
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
@@ -12,31 +11,45 @@ import (
 type FileObserver struct {
 	mu       *sync.Mutex
 	filePath string
+	encoder  encoder
 }
 
 // NewFileObserver creates a new FileObserver which writes audit events to the
 // specified file.
-func NewFileObserver(filePath string) *FileObserver {
+func NewFileObserver(filePath string, opts ...ObserverOption) *FileObserver {
 	return &FileObserver{
 		filePath: filePath,
 		mu:       &sync.Mutex{},
+		encoder:  newObserverConfig(opts).encoder(),
 	}
 }
 
 func (o *FileObserver) Notify(ctx context.Context, event Event) error {
+	return o.NotifyBatch(ctx, []Event{event})
+}
+
+// NotifyBatch appends the events to the file with a single write and sync.
+func (o *FileObserver) NotifyBatch(ctx context.Context, events []Event) error {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
 	slog.Debug(
-		"sending file audit event",
-		slog.Int("metrics_num", len(event.Metrics)),
-		slog.String("client_ip", event.IPAddress),
+		"sending file audit events",
+		slog.Int("events_num", len(events)),
 	)
 
 	if err := ctx.Err(); err != nil {
 		return fmt.Errorf("context cancelled: %w", err)
 	}
 
+	data, err := o.encoder.marshalBatch(events)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
 	file, err := os.OpenFile(
 		o.filePath,
 		os.O_WRONLY|os.O_CREATE|os.O_APPEND,
@@ -47,8 +60,8 @@ func (o *FileObserver) Notify(ctx context.Context, event Event) error {
 	}
 	defer func() { _ = file.Close() }()
 
-	if err := json.NewEncoder(file).Encode(event); err != nil {
-		return fmt.Errorf("failed to encode audit event: %w", err)
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed to write audit events: %w", err)
 	}
 
 	if err := file.Sync(); err != nil {
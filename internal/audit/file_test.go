@@ -59,3 +59,28 @@ func TestFileObserver_Notify_OpenFileError(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestFileObserver_NotifyBatch(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "audit.log")
+	obs := NewFileObserver(filePath, WithSchemaVersion(SchemaV1))
+
+	events := []Event{
+		{Timestamp: 1, IPAddress: "10.0.0.1"},
+		{Timestamp: 2, IPAddress: "10.0.0.2", Type: EventAuthFailed},
+		{Timestamp: 3, IPAddress: "10.0.0.3"},
+	}
+	if err := obs.NotifyBatch(context.Background(), events); err != nil {
+		t.Fatalf("NotifyBatch returned unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+
+	want := `{"ts":1,"metrics":null,"ip_address":"10.0.0.1"}` + "\n" +
+		`{"ts":3,"metrics":null,"ip_address":"10.0.0.3"}` + "\n"
+	if string(data) != want {
+		t.Fatalf("file content mismatch: got %q want %q", data, want)
+	}
+}
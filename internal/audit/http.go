@@ -3,54 +3,428 @@ package audit
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
+	"github.com/fragpit/yandex-go-dev-metrics/pkg/retry"
+)
+
+const (
+	// DefaultRetries is the number of retries of a failed HTTP delivery.
+	DefaultRetries = 3
+	// DefaultRetryWait is the wait before the first retry, doubled before
+	// every next one.
+	DefaultRetryWait = time.Second
+
+	// replayingSuffix names the dead-letter file while it is sent again.
+	replayingSuffix = ".replaying"
 )
 
+// WithTimeout sets the timeout of an HTTP delivery attempt.
+func WithTimeout(t time.Duration) ObserverOption {
+	return func(c *observerConfig) {
+		c.timeout = t
+	}
+}
+
+// WithRetryBackoff sets the waits between the HTTP delivery attempts. An
+// empty backoff disables retries.
+func WithRetryBackoff(backoff []time.Duration) ObserverOption {
+	return func(c *observerConfig) {
+		c.backoff = backoff
+	}
+}
+
+// WithAuthToken sends the token as a bearer token in the Authorization
+// header.
+func WithAuthToken(token string) ObserverOption {
+	return func(c *observerConfig) {
+		c.authToken = token
+	}
+}
+
+// WithHMACKey signs the requests with the key like the agents sign theirs,
+// the signature headers naming the key ID if any.
+func WithHMACKey(key []byte, keyID string) ObserverOption {
+	return func(c *observerConfig) {
+		c.hmacKey = key
+		c.hmacKeyID = keyID
+	}
+}
+
+// WithDeadLetterFile writes the events that cannot be delivered to the
+// file. They are sent again after the next successful delivery.
+func WithDeadLetterFile(path string) ObserverOption {
+	return func(c *observerConfig) {
+		c.deadLetter = path
+	}
+}
+
+// WithNDJSONBatches sends the batches of events in a single request as
+// newline-delimited JSON. Every event is sent in its own request as a JSON
+// object by default, the format the endpoints receiving Notify expect.
+func WithNDJSONBatches() ObserverOption {
+	return func(c *observerConfig) {
+		c.ndjson = true
+	}
+}
+
+// statusError is an HTTP delivery rejected with a status other than 2xx.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("invalid status code: %d", e.code)
+}
+
+// isRetryable retries the network errors including the attempt timeouts,
+// the server errors and the throttled requests. The retrier stops by
+// itself once the delivery context is done.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= http.StatusInternalServerError ||
+			se.code == http.StatusTooManyRequests ||
+			se.code == http.StatusRequestTimeout
+	}
+
+	return true
+}
+
+// DeliveryStats are the counts of the event deliveries of an HTTPObserver,
+// a replayed dead letter counting once more.
+type DeliveryStats struct {
+	// Delivered events were accepted by the endpoint.
+	Delivered int64
+	// Failed events were not, after the retries.
+	Failed int64
+	// DeadLettered events were written to the dead-letter file.
+	DeadLettered int64
+}
+
 type HTTPObserver struct {
-	URL    string
-	client *http.Client
+	URL        string
+	client     *http.Client
+	encoder    encoder
+	retrier    *retry.Retrier
+	timeout    time.Duration
+	backoff    []time.Duration
+	authToken  string
+	signer     *signing.Signer
+	deadLetter string
+	ndjson     bool
+
+	// mu guards the dead-letter file.
+	mu         sync.Mutex
+	hasLetters bool
+	replaying  bool
+
+	delivered    atomic.Int64
+	failed       atomic.Int64
+	deadLettered atomic.Int64
 }
 
 // NewHTTPObserver creates a new HTTPObserver with the given URL.
 // The URL is the endpoint where audit events will be sent.
-func NewHTTPObserver(url string) *HTTPObserver {
-	return &HTTPObserver{
-		URL:    url,
-		client: &http.Client{},
+func NewHTTPObserver(url string, opts ...ObserverOption) *HTTPObserver {
+	c := newObserverConfig(opts)
+
+	o := &HTTPObserver{
+		URL:        url,
+		client:     &http.Client{Timeout: c.timeout},
+		encoder:    c.encoder(),
+		retrier:    retry.NewRetrier(isRetryable, retry.WithBackoff(c.backoff)),
+		timeout:    c.timeout,
+		backoff:    c.backoff,
+		authToken:  c.authToken,
+		deadLetter: c.deadLetter,
+		ndjson:     c.ndjson,
+	}
+	if len(c.hmacKey) > 0 {
+		o.signer = signing.NewSigner(c.hmacKey, signing.WithKeyID(c.hmacKeyID))
+	}
+	if o.deadLetter != "" {
+		for _, path := range []string{o.deadLetter, o.deadLetter + replayingSuffix} {
+			if _, err := os.Stat(path); err == nil {
+				o.hasLetters = true
+			}
+		}
+	}
+
+	return o
+}
+
+// DeliveryTimeout returns the longest time a delivery can take with its
+// retries.
+func (o *HTTPObserver) DeliveryTimeout() time.Duration {
+	t := time.Duration(len(o.backoff)+1) * o.timeout
+	for _, wait := range o.backoff {
+		t += wait
+	}
+
+	return t
+}
+
+// BatchTimeout returns the longest time NotifyBatch can take to deliver n
+// events, one DeliveryTimeout per request.
+func (o *HTTPObserver) BatchTimeout(n int) time.Duration {
+	if o.ndjson {
+		return o.DeliveryTimeout()
+	}
+
+	return time.Duration(max(n, 1)) * o.DeliveryTimeout()
+}
+
+// Stats returns the counts of the events sent so far.
+func (o *HTTPObserver) Stats() DeliveryStats {
+	return DeliveryStats{
+		Delivered:    o.delivered.Load(),
+		Failed:       o.failed.Load(),
+		DeadLettered: o.deadLettered.Load(),
 	}
 }
 
 func (o *HTTPObserver) Notify(ctx context.Context, event Event) error {
+	return o.NotifyBatch(ctx, []Event{event})
+}
+
+// NotifyBatch sends every event as a JSON object as by Notify, or the
+// events in a single request as newline-delimited JSON with
+// WithNDJSONBatches. Every request has DeliveryTimeout for its retries
+// within the context, see BatchTimeout. Once an event is delivered, the
+// dead letters are sent again. Events that cannot be delivered are written
+// to the dead-letter file if any, the error being returned otherwise.
+func (o *HTTPObserver) NotifyBatch(ctx context.Context, events []Event) error {
 	slog.Debug(
-		"sending http audit event",
-		slog.Int("metrics_num", len(event.Metrics)),
-		slog.String("client_ip", event.IPAddress),
+		"sending http audit events",
+		slog.Int("events_num", len(events)),
 	)
 
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(event); err != nil {
-		return fmt.Errorf("failed to encode audit event: %w", err)
+	delivered, err := o.deliverBatch(ctx, events)
+	if delivered {
+		o.replay(ctx)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL, &buf)
+	return err
+}
+
+// deliverBatch sends the events in a single request with ndjson batches and
+// one by one otherwise, reporting whether any were delivered.
+func (o *HTTPObserver) deliverBatch(ctx context.Context, events []Event) (bool, error) {
+	if o.ndjson {
+		return o.deliver(ctx, events)
+	}
+
+	var delivered bool
+	var errs []error
+	for _, event := range events {
+		ok, err := o.deliver(ctx, []Event{event})
+		delivered = delivered || ok
+		errs = append(errs, err)
+	}
+
+	return delivered, errors.Join(errs...)
+}
+
+// deliver sends the events and reports whether they were delivered,
+// writing them to the dead-letter file if they cannot be.
+func (o *HTTPObserver) deliver(ctx context.Context, events []Event) (bool, error) {
+	events = slices.DeleteFunc(slices.Clone(events), o.encoder.skip)
+	if len(events) == 0 {
+		return false, nil
+	}
+
+	data, err := o.encoder.marshalBatch(events)
+	if err != nil {
+		return false, err
+	}
+
+	// a slow request does not take the time of the next ones
+	ctx, cancel := context.WithTimeout(ctx, o.DeliveryTimeout())
+	defer cancel()
+
+	err = o.retrier.Do(ctx, func(ctx context.Context) error {
+		return o.send(ctx, data, len(events))
+	})
+	if err == nil {
+		o.delivered.Add(int64(len(events)))
+		return true, nil
+	}
+
+	o.failed.Add(int64(len(events)))
+	if o.deadLetter == "" {
+		return false, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if dlErr := appendEvents(o.deadLetter, events); dlErr != nil {
+		return false, errors.Join(
+			err,
+			fmt.Errorf("failed to write dead letters: %w", dlErr),
+		)
+	}
+	o.hasLetters = true
+	o.deadLettered.Add(int64(len(events)))
+
+	slog.Warn(
+		"audit events written to the dead-letter file",
+		slog.String("file", o.deadLetter),
+		slog.Int("events", len(events)),
+		slog.Any("error", err),
+	)
+
+	return false, nil
+}
+
+// send makes an attempt to deliver the encoded events.
+func (o *HTTPObserver) send(ctx context.Context, data []byte, n int) error {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		o.URL,
+		bytes.NewReader(data),
+	)
 	if err != nil {
 		return fmt.Errorf("failed to create audit request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	contentType := "application/json"
+	if n > 1 {
+		contentType = "application/x-ndjson"
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	if o.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+o.authToken)
+	}
+
+	if o.signer != nil {
+		sig, err := o.signer.Sign(http.MethodPost, req.URL.Path, data)
+		if err != nil {
+			return fmt.Errorf("failed to sign audit request: %w", err)
+		}
+		for k, v := range sig.Headers() {
+			req.Header.Set(k, v)
+		}
+	}
 
 	resp, err := o.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send audit request: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("invalid status code: %d", resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &statusError{code: resp.StatusCode}
 	}
 
 	return nil
 }
+
+// replay sends the dead letters again, in batches of DefaultBatchSize.
+// Those still failing go back to the dead-letter file. The file is moved
+// aside while it is sent and rewritten with the events left after every
+// batch, so that none are lost if the replay is cut short: the rest are
+// sent after the next delivery, a file left by a crash on the next start.
+func (o *HTTPObserver) replay(ctx context.Context) {
+	o.mu.Lock()
+	if !o.hasLetters || o.replaying {
+		o.mu.Unlock()
+		return
+	}
+
+	path := o.deadLetter + replayingSuffix
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(o.deadLetter, path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				o.hasLetters = false
+			} else {
+				slog.Error(
+					"failed to move audit dead letters",
+					slog.String("file", o.deadLetter),
+					slog.Any("error", err),
+				)
+			}
+			o.mu.Unlock()
+			return
+		}
+		o.hasLetters = false
+	}
+	o.replaying = true
+	o.mu.Unlock()
+
+	done := o.replayFile(ctx, path)
+
+	o.mu.Lock()
+	o.replaying = false
+	if !done {
+		o.hasLetters = true
+	}
+	o.mu.Unlock()
+}
+
+// replayFile sends the events of the file, reporting whether all of them
+// were sent and the file removed.
+func (o *HTTPObserver) replayFile(ctx context.Context, path string) bool {
+	events, err := readEvents(path)
+	if err != nil {
+		slog.Error(
+			"failed to read audit dead letters",
+			slog.String("file", path),
+			slog.Any("error", err),
+		)
+		return false
+	}
+	if len(events) == 0 {
+		// only events that cannot be decoded
+		if err := os.Remove(path); err != nil {
+			slog.Error(
+				"failed to remove audit dead letters",
+				slog.String("file", path),
+				slog.Any("error", err),
+			)
+			return false
+		}
+		return true
+	}
+
+	for len(events) > 0 {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		n := min(len(events), DefaultBatchSize)
+		if _, err := o.deliverBatch(ctx, events[:n]); err != nil {
+			slog.Error("failed to replay audit dead letters", slog.Any("error", err))
+		}
+		events = events[n:]
+
+		if err := writeEvents(path, events); err != nil {
+			slog.Error(
+				"failed to update audit dead letters",
+				slog.String("file", path),
+				slog.Any("error", err),
+			)
+			return false
+		}
+	}
+
+	return true
+}
@@ -2,12 +2,21 @@ package audit
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
 )
 
 func TestHTTPObserver_Notify(t *testing.T) {
@@ -46,7 +55,7 @@ func TestHTTPObserver_Notify(t *testing.T) {
 		)
 		defer ts.Close()
 
-		o := NewHTTPObserver(ts.URL)
+		o := NewHTTPObserver(ts.URL, WithRetryBackoff(nil))
 		o.client = ts.Client()
 
 		var ev Event
@@ -60,7 +69,7 @@ func TestHTTPObserver_Notify(t *testing.T) {
 	})
 
 	t.Run("client error", func(t *testing.T) {
-		o := NewHTTPObserver("http://example.invalid")
+		o := NewHTTPObserver("http://example.invalid", WithRetryBackoff(nil))
 
 		o.client = &http.Client{
 			Transport: errTransport{err: errors.New("network down")},
@@ -77,6 +86,436 @@ func TestHTTPObserver_Notify(t *testing.T) {
 	})
 }
 
+func TestHTTPObserver_NotifyBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []ObserverOption
+		contentType string
+		wantBodies  []int
+	}{
+		{
+			name:        "one request per event",
+			contentType: "application/json",
+			wantBodies:  []int{1, 1},
+		},
+		{
+			name:        "ndjson batch",
+			opts:        []ObserverOption{WithNDJSONBatches()},
+			contentType: "application/x-ndjson",
+			wantBodies:  []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var bodies []int
+			ts := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if ct := r.Header.Get("Content-Type"); ct != tt.contentType {
+						t.Errorf("expected content-type %s, got %s", tt.contentType, ct)
+					}
+					data, err := io.ReadAll(r.Body)
+					if err != nil {
+						t.Errorf("failed to read request body: %v", err)
+					}
+
+					mu.Lock()
+					defer mu.Unlock()
+					lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+					bodies = append(bodies, len(lines))
+					w.WriteHeader(http.StatusOK)
+				}),
+			)
+			defer ts.Close()
+
+			o := NewHTTPObserver(ts.URL, tt.opts...)
+			o.client = ts.Client()
+
+			events := []Event{
+				{Timestamp: 1, IPAddress: "10.0.0.1"},
+				{Timestamp: 2, IPAddress: "10.0.0.2"},
+			}
+			if err := o.NotifyBatch(context.Background(), events); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if !slices.Equal(bodies, tt.wantBodies) {
+				t.Fatalf("events per request mismatch: got %v want %v", bodies, tt.wantBodies)
+			}
+		})
+	}
+}
+
+func TestHTTPObserver_NotifyBatchSlowEvent(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	var requests atomic.Int64
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the first request outlives its attempt timeout
+			if requests.Add(1) == 1 {
+				time.Sleep(200 * time.Millisecond)
+				return
+			}
+
+			var ev Event
+			if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+				t.Errorf("failed to decode event: %v", err)
+			}
+			mu.Lock()
+			received = append(received, ev.IPAddress)
+			mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer ts.Close()
+
+	o := NewHTTPObserver(ts.URL,
+		WithTimeout(100*time.Millisecond),
+		WithRetryBackoff(nil),
+		WithDeadLetterFile(filepath.Join(t.TempDir(), "audit.dead")),
+	)
+
+	events := []Event{
+		{IPAddress: "10.0.0.1"},
+		{IPAddress: "10.0.0.2"},
+		{IPAddress: "10.0.0.3"},
+	}
+	ctx, cancel := context.WithTimeout(
+		context.Background(),
+		o.BatchTimeout(len(events)),
+	)
+	defer cancel()
+	if err := o.NotifyBatch(ctx, events); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	got := strings.Join(received, ",")
+	mu.Unlock()
+	if want := "10.0.0.2,10.0.0.3,10.0.0.1"; got != want {
+		t.Fatalf("received events mismatch: got %s want %s", got, want)
+	}
+}
+
+func TestHTTPObserver_Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "accepted", statuses: []int{http.StatusAccepted}, wantAttempts: 1},
+		{name: "no content", statuses: []int{http.StatusNoContent}, wantAttempts: 1},
+		{
+			name:         "server error then ok",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantAttempts: 2,
+		},
+		{
+			name:         "throttled then ok",
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			wantAttempts: 2,
+		},
+		{
+			name:         "bad request is not retried",
+			statuses:     []int{http.StatusBadRequest},
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name: "retries exhausted",
+			statuses: []int{
+				http.StatusBadGateway,
+				http.StatusBadGateway,
+				http.StatusBadGateway,
+			},
+			wantAttempts: 3,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			ts := httptest.NewServer(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					n := int(attempts.Add(1))
+					w.WriteHeader(tt.statuses[min(n, len(tt.statuses))-1])
+				}),
+			)
+			defer ts.Close()
+
+			o := NewHTTPObserver(ts.URL, WithRetryBackoff([]time.Duration{
+				time.Millisecond,
+				time.Millisecond,
+			}))
+
+			err := o.Notify(context.Background(), Event{IPAddress: "10.0.0.1"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := int(attempts.Load()); got != tt.wantAttempts {
+				t.Fatalf("attempts mismatch: got %d want %d", got, tt.wantAttempts)
+			}
+
+			want := DeliveryStats{Delivered: 1}
+			if tt.wantErr {
+				want = DeliveryStats{Failed: 1}
+			}
+			if got := o.Stats(); got != want {
+				t.Fatalf("stats mismatch: got %+v want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestHTTPObserver_Headers(t *testing.T) {
+	key := []byte("audit-secret")
+	verifier, err := signing.NewVerifier(key)
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("Authorization"); got != "Bearer token" {
+				t.Errorf("unexpected authorization header: %q", got)
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Errorf("failed to read request body: %v", err)
+			}
+
+			sig, err := signing.Parse(r.Header.Get)
+			if err != nil {
+				t.Errorf("failed to parse signature: %v", err)
+			}
+			if sig.KeyID != "audit" {
+				t.Errorf("unexpected key id: %q", sig.KeyID)
+			}
+			if err := verifier.Verify(r.Method, r.URL.Path, sig, body); err != nil {
+				t.Errorf("invalid signature: %v", err)
+			}
+
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer ts.Close()
+
+	o := NewHTTPObserver(ts.URL+"/audit",
+		WithAuthToken("token"),
+		WithHMACKey(key, "audit"),
+	)
+
+	if err := o.Notify(context.Background(), Event{IPAddress: "10.0.0.1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestHTTPObserver_DeadLetters(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	var received []string
+	var mu sync.Mutex
+
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if down.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Errorf("failed to read request body: %v", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for line := range strings.Lines(string(body)) {
+				var ev Event
+				if err := json.Unmarshal([]byte(line), &ev); err != nil {
+					t.Errorf("failed to decode event: %v", err)
+				}
+				received = append(received, ev.IPAddress)
+			}
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer ts.Close()
+
+	deadLetter := filepath.Join(t.TempDir(), "audit.dead")
+	o := NewHTTPObserver(ts.URL,
+		WithRetryBackoff(nil),
+		WithDeadLetterFile(deadLetter),
+	)
+
+	ctx := context.Background()
+	if err := o.NotifyBatch(ctx, []Event{
+		{IPAddress: "10.0.0.1"},
+		{IPAddress: "10.0.0.2"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(deadLetter); err != nil {
+		t.Fatalf("dead-letter file was not written: %v", err)
+	}
+
+	down.Store(false)
+	if err := o.Notify(ctx, Event{IPAddress: "10.0.0.3"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	got := strings.Join(received, ",")
+	mu.Unlock()
+	if want := "10.0.0.3,10.0.0.1,10.0.0.2"; got != want {
+		t.Fatalf("received events mismatch: got %s want %s", got, want)
+	}
+	if _, err := os.Stat(deadLetter); !os.IsNotExist(err) {
+		t.Fatalf("dead-letter file was not removed: %v", err)
+	}
+
+	want := DeliveryStats{Delivered: 3, Failed: 2, DeadLettered: 2}
+	if got := o.Stats(); got != want {
+		t.Fatalf("stats mismatch: got %+v want %+v", got, want)
+	}
+}
+
+func TestHTTPObserver_DeadLettersReplay(t *testing.T) {
+	deadLetter := filepath.Join(t.TempDir(), "audit.dead")
+	replaying := deadLetter + replayingSuffix
+
+	var mu sync.Mutex
+	var received []string
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var ev Event
+			if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+				t.Errorf("failed to decode event: %v", err)
+			}
+			// the dead letters are kept until they are sent
+			if _, err := os.Stat(replaying); err == nil {
+				ev.IPAddress += "+"
+			}
+
+			mu.Lock()
+			received = append(received, ev.IPAddress)
+			mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer ts.Close()
+
+	// left by a replay cut short by a crash
+	if err := appendEvents(replaying, []Event{
+		{IPAddress: "10.0.0.1"},
+		{IPAddress: "10.0.0.2"},
+	}); err != nil {
+		t.Fatalf("failed to write dead letters: %v", err)
+	}
+	if err := appendEvents(deadLetter, []Event{{IPAddress: "10.0.0.3"}}); err != nil {
+		t.Fatalf("failed to write dead letters: %v", err)
+	}
+
+	o := NewHTTPObserver(ts.URL,
+		WithRetryBackoff(nil),
+		WithDeadLetterFile(deadLetter),
+	)
+
+	ctx := context.Background()
+	for _, ip := range []string{"10.0.1.1", "10.0.1.2"} {
+		if err := o.Notify(ctx, Event{IPAddress: ip}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	mu.Lock()
+	got := strings.Join(received, ",")
+	mu.Unlock()
+	want := "10.0.1.1+,10.0.0.1+,10.0.0.2+,10.0.1.2,10.0.0.3+"
+	if got != want {
+		t.Fatalf("received events mismatch: got %s want %s", got, want)
+	}
+
+	for _, path := range []string{deadLetter, replaying} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("dead-letter file %s was not removed: %v", path, err)
+		}
+	}
+}
+
+func TestHTTPObserver_DeadLettersReadFailure(t *testing.T) {
+	ts := httptest.NewServer(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	defer ts.Close()
+
+	// a directory exists but cannot be read as dead letters
+	deadLetter := filepath.Join(t.TempDir(), "audit.dead")
+	replaying := deadLetter + replayingSuffix
+	if err := os.Mkdir(replaying, 0700); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	o := NewHTTPObserver(ts.URL, WithDeadLetterFile(deadLetter))
+
+	ctx := context.Background()
+	if err := o.Notify(ctx, Event{IPAddress: "10.0.0.1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	o.mu.Lock()
+	hasLetters := o.hasLetters
+	o.mu.Unlock()
+	if !hasLetters {
+		t.Fatal("dead letters were forgotten after a read failure")
+	}
+
+	if err := os.Remove(replaying); err != nil {
+		t.Fatalf("failed to remove directory: %v", err)
+	}
+	if err := o.Notify(ctx, Event{IPAddress: "10.0.0.2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	o.mu.Lock()
+	hasLetters = o.hasLetters
+	o.mu.Unlock()
+	if hasLetters {
+		t.Fatal("dead letters were kept after the file was removed")
+	}
+}
+
+func TestHTTPObserver_DeliveryTimeout(t *testing.T) {
+	o := NewHTTPObserver("http://example.invalid",
+		WithTimeout(2*time.Second),
+		WithRetryBackoff([]time.Duration{time.Second, 2 * time.Second}),
+	)
+
+	if got, want := o.DeliveryTimeout(), 9*time.Second; got != want {
+		t.Fatalf("delivery timeout mismatch: got %s want %s", got, want)
+	}
+	if got, want := o.BatchTimeout(3), 27*time.Second; got != want {
+		t.Fatalf("batch timeout mismatch: got %s want %s", got, want)
+	}
+
+	o = NewHTTPObserver("http://example.invalid",
+		WithTimeout(2*time.Second),
+		WithRetryBackoff(nil),
+		WithNDJSONBatches(),
+	)
+	if got, want := o.BatchTimeout(3), 2*time.Second; got != want {
+		t.Fatalf("ndjson batch timeout mismatch: got %s want %s", got, want)
+	}
+}
+
 type errTransport struct{ err error }
 
 func (et errTransport) RoundTrip(
@@ -0,0 +1,39 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/fragpit/yandex-go-dev-metrics/pkg/retry"
+)
+
+// ObserverOption configures the FileObserver and the HTTPObserver, the
+// delivery options applying to the HTTPObserver only.
+type ObserverOption func(*observerConfig)
+
+type observerConfig struct {
+	version    int
+	timeout    time.Duration
+	backoff    []time.Duration
+	authToken  string
+	hmacKey    []byte
+	hmacKeyID  string
+	deadLetter string
+	ndjson     bool
+}
+
+func newObserverConfig(opts []ObserverOption) observerConfig {
+	c := observerConfig{
+		version: SchemaVersion,
+		timeout: DefaultTimeout,
+		backoff: retry.ExponentialBackoff(DefaultRetryWait, DefaultRetries),
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return c
+}
+
+func (c observerConfig) encoder() encoder {
+	return encoder{version: c.version}
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// SchemaV1 events have the timestamp, the metric IDs and the client IP
+	// address only.
+	SchemaV1 = 1
+	// SchemaV2 events add the version, the metric values, the transport,
+	// the client and the outcome of the request, and the security events.
+	SchemaV2 = 2
+
+	// SchemaVersion is the schema version of the events of the Auditor.
+	SchemaVersion = SchemaV2
+)
+
+// ValidateSchemaVersion reports an error unless v is a known schema
+// version.
+func ValidateSchemaVersion(v int) error {
+	if v != SchemaV1 && v != SchemaV2 {
+		return fmt.Errorf("unsupported audit schema version: %d", v)
+	}
+
+	return nil
+}
+
+// eventV1 is the encoding of the events in the version 1 schema.
+type eventV1 struct {
+	Timestamp int64    `json:"ts"`
+	Metrics   []string `json:"metrics"`
+	IPAddress string   `json:"ip_address"`
+}
+
+// WithSchemaVersion writes the events in the schema version, for consumers
+// of the older one. Security events are skipped in the version 1 schema.
+func WithSchemaVersion(v int) ObserverOption {
+	return func(c *observerConfig) {
+		c.version = v
+	}
+}
+
+// encoder writes the events in a schema version.
+type encoder struct {
+	version int
+}
+
+// skip reports whether the event has no encoding in the schema version.
+func (e encoder) skip(event Event) bool {
+	return e.version == SchemaV1 && event.Type != ""
+}
+
+// marshal returns the JSON encoding of the event in the schema version.
+func (e encoder) marshal(event Event) ([]byte, error) {
+	var v any = event
+	if e.version == SchemaV1 {
+		v = eventV1{
+			Timestamp: event.Timestamp,
+			Metrics:   event.Metrics,
+			IPAddress: event.IPAddress,
+		}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit event: %w", err)
+	}
+
+	return append(data, '\n'), nil
+}
+
+// marshalBatch returns the concatenated encodings of the events that have
+// one in the schema version.
+func (e encoder) marshalBatch(events []Event) ([]byte, error) {
+	var buf []byte
+	for _, event := range events {
+		if e.skip(event) {
+			continue
+		}
+
+		data, err := e.marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, data...)
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+func TestFileObserver_SchemaVersions(t *testing.T) {
+	value := 0.5
+	update := Event{
+		Timestamp: 1700000000,
+		Metrics:   []string{"load"},
+		IPAddress: "10.0.0.1",
+		Version:   SchemaV2,
+		Values:    []*model.Metrics{{ID: "load", MType: "gauge", Value: &value}},
+		Transport: TransportHTTP,
+		Route:     "/updates/",
+		Outcome:   OutcomeSuccess,
+	}
+	rejected := Event{
+		Timestamp: 1700000001,
+		IPAddress: "10.0.0.2",
+		Version:   SchemaV2,
+		Outcome:   OutcomeRejected,
+		Type:      EventAccessDenied,
+		Reason:    "access forbidden for ip",
+	}
+
+	tests := []struct {
+		name string
+		opts []ObserverOption
+		want string
+	}{
+		{
+			name: "version 2",
+			want: `{"ts":1700000000,"metrics":["load"],"ip_address":"10.0.0.1",` +
+				`"version":2,"values":[{"id":"load","type":"gauge","value":0.5}],` +
+				`"transport":"http","route":"/updates/","outcome":"success"}` + "\n" +
+				`{"ts":1700000001,"metrics":null,"ip_address":"10.0.0.2",` +
+				`"version":2,"outcome":"rejected","type":"access_denied",` +
+				`"reason":"access forbidden for ip"}` + "\n",
+		},
+		{
+			name: "version 1",
+			opts: []ObserverOption{WithSchemaVersion(SchemaV1)},
+			want: `{"ts":1700000000,"metrics":["load"],"ip_address":"10.0.0.1"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			obs := NewFileObserver(path, tt.opts...)
+
+			for _, event := range []Event{update, rejected} {
+				require.NoError(t, obs.Notify(context.Background(), event))
+			}
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(data))
+		})
+	}
+}
+
+func TestValidateSchemaVersion(t *testing.T) {
+	assert.NoError(t, ValidateSchemaVersion(SchemaV1))
+	assert.NoError(t, ValidateSchemaVersion(SchemaV2))
+	assert.Error(t, ValidateSchemaVersion(3))
+}
@@ -19,8 +19,7 @@ func BenchmarkCacher_saveMetrics(b *testing.B) {
 	metrics := make(map[string]model.Metric, count)
 	for i := 0; i < count; i++ {
 		name := "Test" + strconv.Itoa(i)
-		metric, _ := model.NewMetric(name, model.GaugeType)
-		_ = metric.SetValue("100.0")
+		metric, _ := model.ParseMetric(name, model.GaugeType, "100.0")
 		metrics[name] = metric
 	}
 
@@ -44,8 +44,7 @@ func TestCacher_Run(t *testing.T) {
 	)
 	cacher := NewCacher(logger, storage, tmpFile.Name(), 50*time.Millisecond)
 
-	m1, _ := model.NewMetric("test_gauge", model.GaugeType)
-	_ = m1.SetValue("42.5")
+	m1, _ := model.ParseMetric("test_gauge", model.GaugeType, "42.5")
 	_ = storage.SetOrUpdateMetric(context.Background(), m1)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
@@ -77,10 +76,8 @@ func TestCacher_Restore(t *testing.T) {
 				tmpFile, _ := os.CreateTemp("", "metrics-*.json")
 				defer tmpFile.Close()
 
-				m1, _ := model.NewMetric("gauge1", model.GaugeType)
-				_ = m1.SetValue("10.5")
-				m2, _ := model.NewMetric("counter1", model.CounterType)
-				_ = m2.SetValue("100")
+				m1, _ := model.ParseMetric("gauge1", model.GaugeType, "10.5")
+				m2, _ := model.ParseMetric("counter1", model.CounterType, "100")
 
 				data, _ := json.Marshal([]model.Metrics{*m1.ToJSON(), *m2.ToJSON()})
 				_, _ = tmpFile.Write(data)
@@ -148,8 +145,7 @@ func TestCacher_saveMetrics(t *testing.T) {
 		{
 			name: "save metrics successfully",
 			setup: func(s *memstorage.MemoryStorage) {
-				m1, _ := model.NewMetric("gauge1", model.GaugeType)
-				_ = m1.SetValue("10.5")
+				m1, _ := model.ParseMetric("gauge1", model.GaugeType, "10.5")
 				_ = s.SetOrUpdateMetric(context.Background(), m1)
 			},
 			expectError: false,
@@ -3,15 +3,22 @@ package config
 import (
 	"fmt"
 	"log/slog"
+	"maps"
 	"net"
 	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/keyring"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/tlsconfig"
 )
 
 type envParser[T any] func(string) (T, error)
@@ -64,6 +71,13 @@ type AgentConfig struct {
 	SecretKey         string `mapstructure:"secret_key"`
 	RateLimit         int    `mapstructure:"rate_limit"`
 	CryptoKey         string `mapstructure:"crypto_key"`
+	TLSCA             string `mapstructure:"tls_ca"`
+	TLSCert           string `mapstructure:"tls_cert"`
+	TLSKey            string `mapstructure:"tls_key"`
+	TLSServerName     string `mapstructure:"tls_server_name"`
+	APIKey            string `mapstructure:"api_key"`
+	SecretKeyID       string `mapstructure:"secret_key_id"`
+	CryptoKeyID       string `mapstructure:"crypto_key_id"`
 }
 
 func NewAgentConfig() (*AgentConfig, error) {
@@ -118,6 +132,48 @@ func NewAgentConfig() (*AgentConfig, error) {
 		"путь к публичному ключу для шифрования сообщений",
 	)
 
+	pflag.String(
+		"tls-ca",
+		"",
+		"путь к сертификатам CA для проверки сервера (по умолчанию системные)",
+	)
+
+	pflag.String(
+		"tls-cert",
+		"",
+		"путь к клиентскому сертификату для mTLS",
+	)
+
+	pflag.String(
+		"tls-key",
+		"",
+		"путь к ключу клиентского сертификата для mTLS",
+	)
+
+	pflag.String(
+		"tls-server-name",
+		"",
+		"имя сервера для проверки его сертификата (по умолчанию хост из адреса)",
+	)
+
+	pflag.String(
+		"api-key",
+		"",
+		"API-ключ для авторизации на сервере",
+	)
+
+	pflag.String(
+		"secret-key-id",
+		"",
+		"ID секретного ключа в наборе ключей сервера (по умолчанию сервер перебирает все ключи)",
+	)
+
+	pflag.String(
+		"crypto-key-id",
+		"",
+		"ID ключа шифрования в наборе ключей сервера (по умолчанию сервер перебирает все ключи)",
+	)
+
 	cfgPath := pflag.StringP(
 		"config",
 		"c",
@@ -148,8 +204,15 @@ func NewAgentConfig() (*AgentConfig, error) {
 	v.RegisterAlias("secret_key", "secret-key")
 	v.RegisterAlias("rate_limit", "rate-limit")
 	v.RegisterAlias("crypto_key", "crypto-key")
-
-	if !strings.HasPrefix(v.GetString("address"), "http://") {
+	v.RegisterAlias("tls_ca", "tls-ca")
+	v.RegisterAlias("tls_cert", "tls-cert")
+	v.RegisterAlias("tls_key", "tls-key")
+	v.RegisterAlias("tls_server_name", "tls-server-name")
+	v.RegisterAlias("api_key", "api-key")
+	v.RegisterAlias("secret_key_id", "secret-key-id")
+	v.RegisterAlias("crypto_key_id", "crypto-key-id")
+
+	if !strings.Contains(v.GetString("address"), "://") {
 		v.Set("address", "http://"+v.GetString("address"))
 	}
 
@@ -174,6 +237,10 @@ func NewAgentConfig() (*AgentConfig, error) {
 		return nil, fmt.Errorf("either address or grpc-server-address must be set")
 	}
 
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, fmt.Errorf("both tls-cert and tls-key must be set")
+	}
+
 	return cfg, nil
 }
 
@@ -188,22 +255,91 @@ func (c *AgentConfig) Debug() {
 		slog.Int("report_interval", c.ReportInterval),
 		slog.Int("rate_limit", c.RateLimit),
 		slog.String("crypto_key", c.CryptoKey),
+		slog.String("tls_ca", c.TLSCA),
+		slog.String("tls_cert", c.TLSCert),
+		slog.String("tls_server_name", c.TLSServerName),
+		slog.Bool("api_key", c.APIKey != ""),
+		slog.String("secret_key_id", c.SecretKeyID),
+		slog.String("crypto_key_id", c.CryptoKeyID),
 	)
 }
 
 type ServerConfig struct {
-	LogLevel      string        `mapstructure:"log_level"`
-	Address       string        `mapstructure:"address"`
-	GRPCAddress   string        `mapstructure:"grpc_server_address"`
-	StoreInterval time.Duration `mapstructure:"store_interval"`
-	FileStorePath string        `mapstructure:"file_storage_path"`
-	Restore       bool          `mapstructure:"restore"`
-	DatabaseDSN   string        `mapstructure:"database_dsn"`
-	SecretKey     string        `mapstructure:"secret_key"`
-	AuditFile     string        `mapstructure:"audit_file"`
-	AuditURL      string        `mapstructure:"audit_url"`
-	CryptoKey     string        `mapstructure:"crypto_key"`
-	TrustedSubnet string        `mapstructure:"trusted_subnet"`
+	LogLevel         string            `mapstructure:"log_level"`
+	Address          string            `mapstructure:"address"`
+	GRPCAddress      string            `mapstructure:"grpc_server_address"`
+	StoreInterval    time.Duration     `mapstructure:"store_interval"`
+	FileStorePath    string            `mapstructure:"file_storage_path"`
+	Restore          bool              `mapstructure:"restore"`
+	DatabaseDSN      string            `mapstructure:"database_dsn"`
+	SecretKey        string            `mapstructure:"secret_key"`
+	AuditFile        string            `mapstructure:"audit_file"`
+	AuditURL         string            `mapstructure:"audit_url"`
+	AuditSchema      int               `mapstructure:"audit_schema_version"`
+	AuditQueueSize   int               `mapstructure:"audit_queue_size"`
+	AuditBatchSize   int               `mapstructure:"audit_batch_size"`
+	AuditOverflow    string            `mapstructure:"audit_overflow"`
+	AuditSpillDir    string            `mapstructure:"audit_spill_dir"`
+	AuditHTTPTimeout time.Duration     `mapstructure:"audit_http_timeout"`
+	AuditHTTPRetries int               `mapstructure:"audit_http_retries"`
+	AuditHTTPToken   string            `mapstructure:"audit_http_token"`
+	AuditHTTPKey     string            `mapstructure:"audit_http_key"`
+	AuditHTTPKeyID   string            `mapstructure:"audit_http_key_id"`
+	AuditDeadLetter  string            `mapstructure:"audit_dead_letter_file"`
+	AuditHTTPNDJSON  bool              `mapstructure:"audit_http_ndjson"`
+	CryptoKey        string            `mapstructure:"crypto_key"`
+	TrustedSubnet    string            `mapstructure:"trusted_subnet"`
+	StrictValidation bool              `mapstructure:"strict_validation"`
+	InfluxTags       string            `mapstructure:"influx_tags"`
+	InfluxTypes      map[string]string `mapstructure:"influx_types"`
+	GraphiteAddress  string            `mapstructure:"graphite_address"`
+	GraphitePickle   string            `mapstructure:"graphite_pickle_address"`
+	GraphiteRules    []string          `mapstructure:"graphite_rules"`
+	OTLPTags         string            `mapstructure:"otlp_tags"`
+	OTLPPrefix       []string          `mapstructure:"otlp_resource_prefix"`
+	RemoteWriteTags  string            `mapstructure:"remote_write_tags"`
+	MQTTBroker       string            `mapstructure:"mqtt_broker"`
+	MQTTTopics       []string          `mapstructure:"mqtt_topics"`
+	MQTTClientID     string            `mapstructure:"mqtt_client_id"`
+	MQTTUsername     string            `mapstructure:"mqtt_username"`
+	MQTTPassword     string            `mapstructure:"mqtt_password"`
+	TLSCert          string            `mapstructure:"tls_cert"`
+	TLSKey           string            `mapstructure:"tls_key"`
+	TLSMinVersion    string            `mapstructure:"tls_min_version"`
+	TLSClientCA      string            `mapstructure:"tls_client_ca"`
+	GRPCClients      []string          `mapstructure:"grpc_allowed_clients"`
+	APIKeysFile      string            `mapstructure:"api_keys_file"`
+	SignatureMaxSkew time.Duration     `mapstructure:"signature_max_skew"`
+	LegacySignatures bool              `mapstructure:"legacy_signatures"`
+	KeysFile         string            `mapstructure:"keys_file"`
+	KeyGracePeriod   time.Duration     `mapstructure:"key_grace_period"`
+	AllowCIDRs       []string          `mapstructure:"allow_cidrs"`
+	DenyCIDRs        []string          `mapstructure:"deny_cidrs"`
+	ReadAllowCIDRs   []string          `mapstructure:"read_allow_cidrs"`
+	ReadDenyCIDRs    []string          `mapstructure:"read_deny_cidrs"`
+	WriteAllowCIDRs  []string          `mapstructure:"write_allow_cidrs"`
+	WriteDenyCIDRs   []string          `mapstructure:"write_deny_cidrs"`
+	TrustedProxies   []string          `mapstructure:"trusted_proxies"`
+	// Webhooks are the JSON webhook sources by name, set in the config
+	// file only. Names are lowercased by the config loader.
+	Webhooks map[string]WebhookSource `mapstructure:"webhooks"`
+}
+
+// WebhookSource configures a JSON webhook source served at
+// POST /ingest/{source}.
+type WebhookSource struct {
+	Secret string        `mapstructure:"secret"`
+	Header string        `mapstructure:"header"`
+	Scheme string        `mapstructure:"scheme"`
+	Rules  []WebhookRule `mapstructure:"rules"`
+}
+
+// WebhookRule maps the fields of a webhook payload to a metric.
+type WebhookRule struct {
+	Each  string `mapstructure:"each"`
+	Name  string `mapstructure:"name"`
+	Type  string `mapstructure:"type"`
+	Value string `mapstructure:"value"`
 }
 
 func NewServerConfig() (*ServerConfig, error) {
@@ -265,6 +401,78 @@ func NewServerConfig() (*ServerConfig, error) {
 		"URL для отправки аудита (по умолчанию не используется)",
 	)
 
+	pflag.Int(
+		"audit-schema-version",
+		audit.SchemaVersion,
+		"версия JSON-схемы событий аудита в файле и по URL (1 или 2)",
+	)
+
+	pflag.Int(
+		"audit-queue-size",
+		audit.DefaultQueueSize,
+		"размер очереди событий аудита каждого получателя",
+	)
+
+	pflag.Int(
+		"audit-batch-size",
+		audit.DefaultBatchSize,
+		"максимальное число событий аудита в одной записи в файл или запросе",
+	)
+
+	pflag.String(
+		"audit-overflow",
+		string(audit.OverflowBlock),
+		"поведение при переполнении очереди аудита: block, drop-oldest или spill",
+	)
+
+	pflag.String(
+		"audit-spill-dir",
+		"",
+		"каталог для событий аудита, не поместившихся в очередь (для spill)",
+	)
+
+	pflag.Duration(
+		"audit-http-timeout",
+		audit.DefaultTimeout,
+		"таймаут одной попытки отправки событий аудита по URL",
+	)
+
+	pflag.Int(
+		"audit-http-retries",
+		audit.DefaultRetries,
+		"число повторных попыток отправки аудита по URL с экспоненциальной задержкой",
+	)
+
+	pflag.String(
+		"audit-http-token",
+		"",
+		"токен для заголовка Authorization при отправке аудита по URL",
+	)
+
+	pflag.String(
+		"audit-http-key",
+		"",
+		"ключ HMAC-подписи запросов с событиями аудита",
+	)
+
+	pflag.String(
+		"audit-http-key-id",
+		"",
+		"идентификатор ключа HMAC-подписи запросов с событиями аудита",
+	)
+
+	pflag.String(
+		"audit-dead-letter-file",
+		"",
+		"файл для событий аудита, которые не удалось отправить по URL",
+	)
+
+	pflag.Bool(
+		"audit-http-ndjson",
+		false,
+		"отправлять пачки событий аудита одним запросом в формате NDJSON",
+	)
+
 	pflag.String(
 		"crypto-key",
 		"",
@@ -285,6 +493,192 @@ func NewServerConfig() (*ServerConfig, error) {
 		"доверенная подсеть (по умолчанию не ипользуется)",
 	)
 
+	pflag.Bool(
+		"strict-validation",
+		false,
+		"строгая проверка входящих метрик",
+	)
+
+	pflag.String(
+		"influx-tags",
+		"identity",
+		"обработка тегов line protocol: identity, prefix или drop",
+	)
+
+	pflag.StringToString(
+		"influx-types",
+		nil,
+		"типы полей line protocol, например bytes_sent=gauge,requests=counter",
+	)
+
+	pflag.String(
+		"graphite-address",
+		"",
+		"адрес приема метрик Graphite plaintext (по умолчанию не используется)",
+	)
+
+	pflag.String(
+		"graphite-pickle-address",
+		"",
+		"адрес приема метрик Graphite pickle (по умолчанию не используется)",
+	)
+
+	pflag.StringSlice(
+		"graphite-rules",
+		nil,
+		"правила типов метрик Graphite, например stats_counts.*=counter",
+	)
+
+	pflag.String(
+		"otlp-tags",
+		"identity",
+		"обработка атрибутов OTLP: identity, prefix или drop",
+	)
+
+	pflag.StringSlice(
+		"otlp-resource-prefix",
+		nil,
+		"атрибуты ресурса OTLP для префикса имени метрики, например service.name",
+	)
+
+	pflag.String(
+		"remote-write-tags",
+		"identity",
+		"обработка меток Prometheus remote write: identity, prefix или drop",
+	)
+
+	pflag.String(
+		"mqtt-broker",
+		"",
+		"адрес MQTT брокера host:port (по умолчанию не используется)",
+	)
+
+	pflag.StringSlice(
+		"mqtt-topics",
+		nil,
+		"фильтры топиков MQTT, например sensors/#,meters/+/total=counter",
+	)
+
+	pflag.String(
+		"mqtt-client-id",
+		"",
+		"идентификатор клиента MQTT (по умолчанию назначается брокером)",
+	)
+
+	pflag.String(
+		"mqtt-username",
+		"",
+		"имя пользователя MQTT",
+	)
+
+	pflag.String(
+		"mqtt-password",
+		"",
+		"пароль MQTT",
+	)
+
+	pflag.String(
+		"tls-cert",
+		"",
+		"путь к сертификату сервера, включает TLS для HTTP и gRPC (по умолчанию не используется)",
+	)
+
+	pflag.String(
+		"tls-key",
+		"",
+		"путь к ключу сертификата сервера",
+	)
+
+	pflag.String(
+		"tls-min-version",
+		tlsconfig.DefaultMinVersion,
+		"минимальная версия TLS: 1.2 или 1.3",
+	)
+
+	pflag.String(
+		"tls-client-ca",
+		"",
+		"путь к сертификатам CA для проверки клиентов, включает mTLS",
+	)
+
+	pflag.StringSlice(
+		"grpc-allowed-clients",
+		nil,
+		"CN клиентских сертификатов, которым разрешён доступ к gRPC API",
+	)
+
+	pflag.String(
+		"api-keys-file",
+		"",
+		"путь к JSON-файлу с хешами API-ключей, включает авторизацию по ключам",
+	)
+
+	pflag.Duration(
+		"signature-max-skew",
+		signing.DefaultMaxSkew,
+		"допустимое расхождение времени подписи запроса и часов сервера",
+	)
+
+	pflag.Bool(
+		"legacy-signatures",
+		true,
+		"принимать подписи HashSHA256 старых агентов",
+	)
+
+	pflag.String(
+		"keys-file",
+		"",
+		"путь к JSON-файлу с набором ключей подписи и шифрования по ID, перечитывается по SIGHUP",
+	)
+
+	pflag.Duration(
+		"key-grace-period",
+		keyring.DefaultGracePeriod,
+		"время, в течение которого удалённый или заменённый ключ ещё принимается",
+	)
+
+	pflag.StringSlice(
+		"allow-cidrs",
+		nil,
+		"разрешённые подсети клиентов (IPv4 и IPv6), по умолчанию разрешены все",
+	)
+
+	pflag.StringSlice(
+		"deny-cidrs",
+		nil,
+		"запрещённые подсети клиентов, имеют приоритет над разрешёнными",
+	)
+
+	pflag.StringSlice(
+		"read-allow-cidrs",
+		nil,
+		"подсети, которым дополнительно разрешено чтение метрик",
+	)
+
+	pflag.StringSlice(
+		"read-deny-cidrs",
+		nil,
+		"подсети, которым запрещено чтение метрик",
+	)
+
+	pflag.StringSlice(
+		"write-allow-cidrs",
+		nil,
+		"подсети, которым дополнительно разрешена запись метрик",
+	)
+
+	pflag.StringSlice(
+		"write-deny-cidrs",
+		nil,
+		"подсети, которым запрещена запись метрик",
+	)
+
+	pflag.StringSlice(
+		"trusted-proxies",
+		nil,
+		"подсети доверенных прокси, чьим заголовкам X-Forwarded-For и X-Real-IP можно верить",
+	)
+
 	pflag.Parse()
 
 	if *cfgPath != "" {
@@ -309,8 +703,51 @@ func NewServerConfig() (*ServerConfig, error) {
 	v.RegisterAlias("secret_key", "secret-key")
 	v.RegisterAlias("audit_file", "audit-file")
 	v.RegisterAlias("audit_url", "audit-url")
+	v.RegisterAlias("audit_schema_version", "audit-schema-version")
+	v.RegisterAlias("audit_queue_size", "audit-queue-size")
+	v.RegisterAlias("audit_batch_size", "audit-batch-size")
+	v.RegisterAlias("audit_overflow", "audit-overflow")
+	v.RegisterAlias("audit_spill_dir", "audit-spill-dir")
+	v.RegisterAlias("audit_http_timeout", "audit-http-timeout")
+	v.RegisterAlias("audit_http_retries", "audit-http-retries")
+	v.RegisterAlias("audit_http_token", "audit-http-token")
+	v.RegisterAlias("audit_http_key", "audit-http-key")
+	v.RegisterAlias("audit_http_key_id", "audit-http-key-id")
+	v.RegisterAlias("audit_dead_letter_file", "audit-dead-letter-file")
+	v.RegisterAlias("audit_http_ndjson", "audit-http-ndjson")
 	v.RegisterAlias("crypto_key", "crypto-key")
 	v.RegisterAlias("trusted_subnet", "trusted-subnet")
+	v.RegisterAlias("strict_validation", "strict-validation")
+	v.RegisterAlias("influx_tags", "influx-tags")
+	v.RegisterAlias("influx_types", "influx-types")
+	v.RegisterAlias("graphite_address", "graphite-address")
+	v.RegisterAlias("graphite_pickle_address", "graphite-pickle-address")
+	v.RegisterAlias("graphite_rules", "graphite-rules")
+	v.RegisterAlias("otlp_tags", "otlp-tags")
+	v.RegisterAlias("otlp_resource_prefix", "otlp-resource-prefix")
+	v.RegisterAlias("remote_write_tags", "remote-write-tags")
+	v.RegisterAlias("mqtt_broker", "mqtt-broker")
+	v.RegisterAlias("mqtt_topics", "mqtt-topics")
+	v.RegisterAlias("mqtt_client_id", "mqtt-client-id")
+	v.RegisterAlias("mqtt_username", "mqtt-username")
+	v.RegisterAlias("mqtt_password", "mqtt-password")
+	v.RegisterAlias("tls_cert", "tls-cert")
+	v.RegisterAlias("tls_key", "tls-key")
+	v.RegisterAlias("tls_min_version", "tls-min-version")
+	v.RegisterAlias("tls_client_ca", "tls-client-ca")
+	v.RegisterAlias("grpc_allowed_clients", "grpc-allowed-clients")
+	v.RegisterAlias("api_keys_file", "api-keys-file")
+	v.RegisterAlias("signature_max_skew", "signature-max-skew")
+	v.RegisterAlias("legacy_signatures", "legacy-signatures")
+	v.RegisterAlias("keys_file", "keys-file")
+	v.RegisterAlias("key_grace_period", "key-grace-period")
+	v.RegisterAlias("allow_cidrs", "allow-cidrs")
+	v.RegisterAlias("deny_cidrs", "deny-cidrs")
+	v.RegisterAlias("read_allow_cidrs", "read-allow-cidrs")
+	v.RegisterAlias("read_deny_cidrs", "read-deny-cidrs")
+	v.RegisterAlias("write_allow_cidrs", "write-allow-cidrs")
+	v.RegisterAlias("write_deny_cidrs", "write-deny-cidrs")
+	v.RegisterAlias("trusted_proxies", "trusted-proxies")
 
 	cfg := &ServerConfig{}
 	if err := v.Unmarshal(&cfg); err != nil {
@@ -321,10 +758,63 @@ func NewServerConfig() (*ServerConfig, error) {
 		return nil, fmt.Errorf("invalid audit URL: %s", cfg.AuditURL)
 	}
 
+	if err := audit.ValidateSchemaVersion(cfg.AuditSchema); err != nil {
+		return nil, err
+	}
+
+	if cfg.AuditQueueSize <= 0 {
+		return nil, fmt.Errorf("invalid audit queue size: %d", cfg.AuditQueueSize)
+	}
+
+	if cfg.AuditBatchSize <= 0 {
+		return nil, fmt.Errorf("invalid audit batch size: %d", cfg.AuditBatchSize)
+	}
+
+	overflow, err := audit.ParseOverflow(cfg.AuditOverflow)
+	if err != nil {
+		return nil, err
+	}
+	if overflow == audit.OverflowSpill && cfg.AuditSpillDir == "" {
+		return nil, fmt.Errorf(
+			"audit spill dir is required for the %s overflow policy",
+			overflow,
+		)
+	}
+
+	if cfg.AuditHTTPTimeout <= 0 {
+		return nil, fmt.Errorf(
+			"audit http timeout must be positive: %s",
+			cfg.AuditHTTPTimeout,
+		)
+	}
+
+	if cfg.AuditHTTPRetries < 0 {
+		return nil, fmt.Errorf(
+			"invalid audit http retries: %d",
+			cfg.AuditHTTPRetries,
+		)
+	}
+
 	if cfg.TrustedSubnet != "" && !validateSubnet(cfg.TrustedSubnet) {
 		return nil, fmt.Errorf("failed to parse subnet: %s", cfg.TrustedSubnet)
 	}
 
+	for _, cidrs := range [][]string{
+		cfg.AllowCIDRs,
+		cfg.DenyCIDRs,
+		cfg.ReadAllowCIDRs,
+		cfg.ReadDenyCIDRs,
+		cfg.WriteAllowCIDRs,
+		cfg.WriteDenyCIDRs,
+		cfg.TrustedProxies,
+	} {
+		for _, cidr := range cidrs {
+			if !validateSubnet(cidr) {
+				return nil, fmt.Errorf("failed to parse subnet: %s", cidr)
+			}
+		}
+	}
+
 	if cfg.Address != "" && !validateHostPort(cfg.Address, true) {
 		return nil, fmt.Errorf(
 			"failed to validate listen address: %s",
@@ -332,6 +822,22 @@ func NewServerConfig() (*ServerConfig, error) {
 		)
 	}
 
+	for _, addr := range []string{cfg.GraphiteAddress, cfg.GraphitePickle} {
+		if addr != "" && !validateHostPort(addr, true) {
+			return nil, fmt.Errorf(
+				"failed to validate graphite address: %s",
+				addr,
+			)
+		}
+	}
+
+	if cfg.MQTTBroker != "" && !validateHostPort(cfg.MQTTBroker, false) {
+		return nil, fmt.Errorf(
+			"failed to validate mqtt broker address: %s",
+			cfg.MQTTBroker,
+		)
+	}
+
 	if cfg.GRPCAddress != "" && !validateHostPort(cfg.GRPCAddress, true) {
 		return nil, fmt.Errorf(
 			"failed to validate grpc address: %s",
@@ -339,6 +845,36 @@ func NewServerConfig() (*ServerConfig, error) {
 		)
 	}
 
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, fmt.Errorf("both tls-cert and tls-key must be set")
+	}
+
+	if cfg.TLSClientCA != "" && cfg.TLSCert == "" {
+		return nil, fmt.Errorf("tls-client-ca requires tls-cert and tls-key")
+	}
+
+	if len(cfg.GRPCClients) > 0 && cfg.TLSClientCA == "" {
+		return nil, fmt.Errorf("grpc-allowed-clients requires tls-client-ca")
+	}
+
+	if cfg.SignatureMaxSkew <= 0 {
+		return nil, fmt.Errorf(
+			"signature max skew must be positive: %s",
+			cfg.SignatureMaxSkew,
+		)
+	}
+
+	if cfg.KeyGracePeriod < 0 {
+		return nil, fmt.Errorf(
+			"key grace period must not be negative: %s",
+			cfg.KeyGracePeriod,
+		)
+	}
+
+	if _, err := tlsconfig.ParseVersion(cfg.TLSMinVersion); err != nil {
+		return nil, fmt.Errorf("failed to validate tls min version: %w", err)
+	}
+
 	return cfg, nil
 }
 
@@ -355,8 +891,48 @@ func (c *ServerConfig) Debug() {
 		slog.String("database_dsn", c.DatabaseDSN),
 		slog.String("audit_file", c.AuditFile),
 		slog.String("audit_url", c.AuditURL),
+		slog.Int("audit_schema_version", c.AuditSchema),
+		slog.Int("audit_queue_size", c.AuditQueueSize),
+		slog.Int("audit_batch_size", c.AuditBatchSize),
+		slog.String("audit_overflow", c.AuditOverflow),
+		slog.String("audit_spill_dir", c.AuditSpillDir),
+		slog.Duration("audit_http_timeout", c.AuditHTTPTimeout),
+		slog.Int("audit_http_retries", c.AuditHTTPRetries),
+		slog.String("audit_http_key_id", c.AuditHTTPKeyID),
+		slog.String("audit_dead_letter_file", c.AuditDeadLetter),
+		slog.Bool("audit_http_ndjson", c.AuditHTTPNDJSON),
 		slog.String("crypto_key", c.CryptoKey),
 		slog.String("trusted_subnet", c.TrustedSubnet),
+		slog.Bool("strict_validation", c.StrictValidation),
+		slog.String("influx_tags", c.InfluxTags),
+		slog.Any("influx_types", c.InfluxTypes),
+		slog.String("graphite_address", c.GraphiteAddress),
+		slog.String("graphite_pickle_address", c.GraphitePickle),
+		slog.Any("graphite_rules", c.GraphiteRules),
+		slog.String("otlp_tags", c.OTLPTags),
+		slog.Any("otlp_resource_prefix", c.OTLPPrefix),
+		slog.String("remote_write_tags", c.RemoteWriteTags),
+		slog.Any("webhooks", slices.Sorted(maps.Keys(c.Webhooks))),
+		slog.String("mqtt_broker", c.MQTTBroker),
+		slog.Any("mqtt_topics", c.MQTTTopics),
+		slog.String("mqtt_client_id", c.MQTTClientID),
+		slog.String("mqtt_username", c.MQTTUsername),
+		slog.String("tls_cert", c.TLSCert),
+		slog.String("tls_min_version", c.TLSMinVersion),
+		slog.String("tls_client_ca", c.TLSClientCA),
+		slog.Any("grpc_allowed_clients", c.GRPCClients),
+		slog.String("api_keys_file", c.APIKeysFile),
+		slog.Duration("signature_max_skew", c.SignatureMaxSkew),
+		slog.Bool("legacy_signatures", c.LegacySignatures),
+		slog.String("keys_file", c.KeysFile),
+		slog.Duration("key_grace_period", c.KeyGracePeriod),
+		slog.Any("allow_cidrs", c.AllowCIDRs),
+		slog.Any("deny_cidrs", c.DenyCIDRs),
+		slog.Any("read_allow_cidrs", c.ReadAllowCIDRs),
+		slog.Any("read_deny_cidrs", c.ReadDenyCIDRs),
+		slog.Any("write_allow_cidrs", c.WriteAllowCIDRs),
+		slog.Any("write_deny_cidrs", c.WriteDenyCIDRs),
+		slog.Any("trusted_proxies", c.TrustedProxies),
 	)
 }
 
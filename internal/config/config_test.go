@@ -9,6 +9,8 @@ import (
 	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
 )
 
 func TestValidateURL(t *testing.T) {
@@ -101,6 +103,13 @@ func TestNewAgentConfig_WithFlags(t *testing.T) {
 		"-l", "3",
 		"-k", "c2VjcmV0MTIz",
 		"--crypto-key", "/tmp/test.pem",
+		"--tls-ca", "/etc/metrics/ca.pem",
+		"--tls-cert", "/etc/metrics/agent.pem",
+		"--tls-key", "/etc/metrics/agent-key.pem",
+		"--tls-server-name", "metrics.local",
+		"--api-key", "agent-key",
+		"--secret-key-id", "2025-10",
+		"--crypto-key-id", "2025-11",
 	}
 
 	cfg, err := NewAgentConfig()
@@ -114,6 +123,58 @@ func TestNewAgentConfig_WithFlags(t *testing.T) {
 	assert.Equal(t, 3, cfg.RateLimit)
 	assert.Equal(t, "c2VjcmV0MTIz", cfg.SecretKey)
 	assert.Equal(t, "/tmp/test.pem", cfg.CryptoKey)
+	assert.Equal(t, "/etc/metrics/ca.pem", cfg.TLSCA)
+	assert.Equal(t, "/etc/metrics/agent.pem", cfg.TLSCert)
+	assert.Equal(t, "/etc/metrics/agent-key.pem", cfg.TLSKey)
+	assert.Equal(t, "metrics.local", cfg.TLSServerName)
+	assert.Equal(t, "agent-key", cfg.APIKey)
+	assert.Equal(t, "2025-10", cfg.SecretKeyID)
+	assert.Equal(t, "2025-11", cfg.CryptoKeyID)
+}
+
+func TestNewAgentConfig_TLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantURL string
+		errText string
+	}{
+		{
+			name:    "https address",
+			args:    []string{"-a", "https://metrics.local:8443"},
+			wantURL: "https://metrics.local:8443",
+		},
+		{
+			name:    "address without scheme",
+			args:    []string{"-a", "metrics.local:8080"},
+			wantURL: "http://metrics.local:8080",
+		},
+		{
+			name:    "certificate without key",
+			args:    []string{"--tls-cert", "/etc/metrics/agent.pem"},
+			errText: "both tls-cert and tls-key must be set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
+			oldArgs := os.Args
+			defer func() { os.Args = oldArgs }()
+
+			os.Args = append([]string{"cmd"}, tt.args...)
+
+			cfg, err := NewAgentConfig()
+			if tt.errText != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errText)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantURL, cfg.ServerURL)
+		})
+	}
 }
 
 func TestNewAgentConfig_WithEnvVars(t *testing.T) {
@@ -303,7 +364,50 @@ func TestNewServerConfig_WithFlags(t *testing.T) {
 		"-k", "serverkey",
 		"--audit-file", "/tmp/audit.log",
 		"--audit-url", "http://audit.example.com",
+		"--audit-schema-version", "1",
+		"--audit-queue-size", "64",
+		"--audit-batch-size", "16",
+		"--audit-overflow", "spill",
+		"--audit-spill-dir", "/tmp/audit-spill",
+		"--audit-http-timeout", "2s",
+		"--audit-http-retries", "5",
+		"--audit-http-token", "audit-token",
+		"--audit-http-key", "audit-key",
+		"--audit-http-key-id", "2026",
+		"--audit-dead-letter-file", "/tmp/audit.dead",
+		"--audit-http-ndjson",
 		"--crypto-key", "/tmp/test.pem",
+		"--strict-validation",
+		"--influx-tags", "prefix",
+		"--influx-types", "requests=counter,bytes=gauge",
+		"--graphite-address", ":2003",
+		"--graphite-pickle-address", ":2004",
+		"--graphite-rules", "stats_counts.*=counter,*.requests=counter",
+		"--otlp-tags", "drop",
+		"--otlp-resource-prefix", "service.namespace,service.name",
+		"--remote-write-tags", "prefix",
+		"--mqtt-broker", "broker.local:1883",
+		"--mqtt-topics", "sensors/#,meters/+/total=counter",
+		"--mqtt-client-id", "metrics",
+		"--mqtt-username", "user",
+		"--mqtt-password", "pass",
+		"--tls-cert", "/etc/metrics/server.pem",
+		"--tls-key", "/etc/metrics/server-key.pem",
+		"--tls-min-version", "1.3",
+		"--tls-client-ca", "/etc/metrics/ca.pem",
+		"--grpc-allowed-clients", "agent-1,agent-2",
+		"--api-keys-file", "/etc/metrics/api-keys.json",
+		"--signature-max-skew", "2m",
+		"--legacy-signatures=false",
+		"--keys-file", "/etc/metrics/keys.json",
+		"--key-grace-period", "30m",
+		"--allow-cidrs", "10.0.0.0/8,2001:db8::/32",
+		"--deny-cidrs", "10.0.0.13/32",
+		"--read-allow-cidrs", "10.1.0.0/16",
+		"--read-deny-cidrs", "10.1.1.0/24",
+		"--write-allow-cidrs", "10.2.0.0/16",
+		"--write-deny-cidrs", "10.2.1.0/24",
+		"--trusted-proxies", "172.16.0.0/12",
 	}
 
 	cfg, err := NewServerConfig()
@@ -319,7 +423,66 @@ func TestNewServerConfig_WithFlags(t *testing.T) {
 	assert.Equal(t, "serverkey", cfg.SecretKey)
 	assert.Equal(t, "/tmp/audit.log", cfg.AuditFile)
 	assert.Equal(t, "http://audit.example.com", cfg.AuditURL)
+	assert.Equal(t, 1, cfg.AuditSchema)
+	assert.Equal(t, 64, cfg.AuditQueueSize)
+	assert.Equal(t, 16, cfg.AuditBatchSize)
+	assert.Equal(t, "spill", cfg.AuditOverflow)
+	assert.Equal(t, "/tmp/audit-spill", cfg.AuditSpillDir)
+	assert.Equal(t, 2*time.Second, cfg.AuditHTTPTimeout)
+	assert.Equal(t, 5, cfg.AuditHTTPRetries)
+	assert.Equal(t, "audit-token", cfg.AuditHTTPToken)
+	assert.Equal(t, "audit-key", cfg.AuditHTTPKey)
+	assert.Equal(t, "2026", cfg.AuditHTTPKeyID)
+	assert.Equal(t, "/tmp/audit.dead", cfg.AuditDeadLetter)
+	assert.True(t, cfg.AuditHTTPNDJSON)
 	assert.Equal(t, "/tmp/test.pem", cfg.CryptoKey)
+	assert.True(t, cfg.StrictValidation)
+	assert.Equal(t, "prefix", cfg.InfluxTags)
+	assert.Equal(
+		t,
+		map[string]string{"requests": "counter", "bytes": "gauge"},
+		cfg.InfluxTypes,
+	)
+	assert.Equal(t, ":2003", cfg.GraphiteAddress)
+	assert.Equal(t, ":2004", cfg.GraphitePickle)
+	assert.Equal(
+		t,
+		[]string{"stats_counts.*=counter", "*.requests=counter"},
+		cfg.GraphiteRules,
+	)
+	assert.Equal(t, "drop", cfg.OTLPTags)
+	assert.Equal(
+		t,
+		[]string{"service.namespace", "service.name"},
+		cfg.OTLPPrefix,
+	)
+	assert.Equal(t, "prefix", cfg.RemoteWriteTags)
+	assert.Equal(t, "broker.local:1883", cfg.MQTTBroker)
+	assert.Equal(
+		t,
+		[]string{"sensors/#", "meters/+/total=counter"},
+		cfg.MQTTTopics,
+	)
+	assert.Equal(t, "metrics", cfg.MQTTClientID)
+	assert.Equal(t, "user", cfg.MQTTUsername)
+	assert.Equal(t, "pass", cfg.MQTTPassword)
+	assert.Equal(t, "/etc/metrics/server.pem", cfg.TLSCert)
+	assert.Equal(t, "/etc/metrics/server-key.pem", cfg.TLSKey)
+	assert.Equal(t, "1.3", cfg.TLSMinVersion)
+	assert.Equal(t, "/etc/metrics/ca.pem", cfg.TLSClientCA)
+	assert.Equal(t, []string{"agent-1", "agent-2"}, cfg.GRPCClients)
+	assert.Equal(t, "/etc/metrics/api-keys.json", cfg.APIKeysFile)
+	assert.Equal(t, 2*time.Minute, cfg.SignatureMaxSkew)
+	assert.False(t, cfg.LegacySignatures)
+	assert.Equal(t, "/etc/metrics/keys.json", cfg.KeysFile)
+	assert.Equal(t, 30*time.Minute, cfg.KeyGracePeriod)
+	assert.Equal(t, []string{"10.0.0.0/8", "2001:db8::/32"}, cfg.AllowCIDRs)
+	assert.Equal(t, []string{"10.0.0.13/32"}, cfg.DenyCIDRs)
+	assert.Equal(t, []string{"10.1.0.0/16"}, cfg.ReadAllowCIDRs)
+	assert.Equal(t, []string{"10.1.1.0/24"}, cfg.ReadDenyCIDRs)
+	assert.Equal(t, []string{"10.2.0.0/16"}, cfg.WriteAllowCIDRs)
+	assert.Equal(t, []string{"10.2.1.0/24"}, cfg.WriteDenyCIDRs)
+	assert.Equal(t, []string{"172.16.0.0/12"}, cfg.TrustedProxies)
 }
 
 func TestNewServerConfig_WithEnvVars(t *testing.T) {
@@ -410,6 +573,71 @@ func TestNewServerConfig_InvalidAuditURL(t *testing.T) {
 	assert.Contains(t, err.Error(), "invalid audit URL")
 }
 
+func TestNewServerConfig_InvalidAuditSchemaVersion(t *testing.T) {
+	pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = []string{"cmd", "--audit-schema-version", "3"}
+
+	cfg, err := NewServerConfig()
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+	assert.Contains(t, err.Error(), "unsupported audit schema version")
+}
+
+func TestNewServerConfig_InvalidAuditQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "zero queue size",
+			args:    []string{"--audit-queue-size", "0"},
+			wantErr: "invalid audit queue size",
+		},
+		{
+			name:    "zero batch size",
+			args:    []string{"--audit-batch-size", "0"},
+			wantErr: "invalid audit batch size",
+		},
+		{
+			name:    "unknown overflow",
+			args:    []string{"--audit-overflow", "drop"},
+			wantErr: "unknown audit overflow policy",
+		},
+		{
+			name:    "spill without dir",
+			args:    []string{"--audit-overflow", "spill"},
+			wantErr: "audit spill dir is required",
+		},
+		{
+			name:    "zero http timeout",
+			args:    []string{"--audit-http-timeout", "0s"},
+			wantErr: "audit http timeout must be positive",
+		},
+		{
+			name:    "negative http retries",
+			args:    []string{"--audit-http-retries", "-1"},
+			wantErr: "invalid audit http retries",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
+			oldArgs := os.Args
+			defer func() { os.Args = oldArgs }()
+			os.Args = append([]string{"cmd"}, tt.args...)
+
+			cfg, err := NewServerConfig()
+			assert.Error(t, err)
+			assert.Nil(t, cfg)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
 func TestNewServerConfig_EmptyAuditURL(t *testing.T) {
 	pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
 	oldArgs := os.Args
@@ -419,6 +647,12 @@ func TestNewServerConfig_EmptyAuditURL(t *testing.T) {
 	cfg, err := NewServerConfig()
 	require.NoError(t, err)
 	assert.Empty(t, cfg.AuditURL)
+	assert.Equal(t, audit.SchemaVersion, cfg.AuditSchema)
+	assert.Equal(t, audit.DefaultQueueSize, cfg.AuditQueueSize)
+	assert.Equal(t, audit.DefaultBatchSize, cfg.AuditBatchSize)
+	assert.Equal(t, string(audit.OverflowBlock), cfg.AuditOverflow)
+	assert.Equal(t, audit.DefaultTimeout, cfg.AuditHTTPTimeout)
+	assert.Equal(t, audit.DefaultRetries, cfg.AuditHTTPRetries)
 }
 
 func TestNewServerConfig_TrustedSubnet(t *testing.T) {
@@ -476,6 +710,149 @@ func TestNewServerConfig_TrustedSubnet(t *testing.T) {
 
 }
 
+func TestNewServerConfig_AccessPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		errText string
+	}{
+		{name: "disabled"},
+		{
+			name: "ipv4 and ipv6",
+			args: []string{
+				"--allow-cidrs", "192.168.0.0/16,fd00::/8",
+				"--trusted-proxies", "::1/128",
+			},
+		},
+		{
+			name:    "invalid deny cidr",
+			args:    []string{"--deny-cidrs", "192.168.0.1"},
+			errText: "failed to parse subnet: 192.168.0.1",
+		},
+		{
+			name:    "invalid write cidr",
+			args:    []string{"--write-allow-cidrs", "fd00::/129"},
+			errText: "failed to parse subnet: fd00::/129",
+		},
+		{
+			name:    "invalid trusted proxy",
+			args:    []string{"--trusted-proxies", "proxy"},
+			errText: "failed to parse subnet: proxy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
+			oldArgs := os.Args
+			defer func() { os.Args = oldArgs }()
+
+			os.Args = append([]string{"cmd"}, tt.args...)
+
+			_, err := NewServerConfig()
+			if tt.errText != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errText)
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestNewServerConfig_TLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		errText string
+	}{
+		{name: "disabled"},
+		{
+			name: "server certificate",
+			args: []string{
+				"--tls-cert", "/etc/metrics/server.pem",
+				"--tls-key", "/etc/metrics/server-key.pem",
+			},
+		},
+		{
+			name:    "key without certificate",
+			args:    []string{"--tls-key", "/etc/metrics/server-key.pem"},
+			errText: "both tls-cert and tls-key must be set",
+		},
+		{
+			name:    "client ca without certificate",
+			args:    []string{"--tls-client-ca", "/etc/metrics/ca.pem"},
+			errText: "tls-client-ca requires tls-cert and tls-key",
+		},
+		{
+			name: "allowed grpc clients without client ca",
+			args: []string{
+				"--tls-cert", "/etc/metrics/server.pem",
+				"--tls-key", "/etc/metrics/server-key.pem",
+				"--grpc-allowed-clients", "agent-1",
+			},
+			errText: "grpc-allowed-clients requires tls-client-ca",
+		},
+		{
+			name:    "invalid min version",
+			args:    []string{"--tls-min-version", "1.5"},
+			errText: "failed to validate tls min version",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
+			oldArgs := os.Args
+			defer func() { os.Args = oldArgs }()
+
+			os.Args = append([]string{"cmd"}, tt.args...)
+
+			cfg, err := NewServerConfig()
+			if tt.errText != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errText)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "1.2", cfg.TLSMinVersion)
+		})
+	}
+}
+
+func TestNewServerConfig_Webhooks(t *testing.T) {
+	pflag.CommandLine = pflag.NewFlagSet(os.Args[0], pflag.ContinueOnError)
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	os.Args = []string{"cmd", "-c", "testdata/server_webhooks.json"}
+
+	cfg, err := NewServerConfig()
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]WebhookSource{
+		"ci": {
+			Secret: "ci-secret",
+			Rules: []WebhookRule{{
+				Each:  "$.jobs[*]",
+				Name:  "ci.{$.name}.duration",
+				Value: "$.duration",
+			}},
+		},
+		"queue": {
+			Secret: "queue-token",
+			Header: "X-Queue-Token",
+			Scheme: "token",
+			Rules: []WebhookRule{{
+				Name:  "queue.size",
+				Type:  "gauge",
+				Value: "$.size",
+			}},
+		},
+	}, cfg.Webhooks)
+}
+
 func TestGetEnvOrDefault(t *testing.T) {
 	l := slog.New(slog.DiscardHandler)
 	slog.SetDefault(l)
@@ -0,0 +1,419 @@
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/repository"
+)
+
+const (
+	// defaultBatchSize is the number of metrics stored in one batch.
+	defaultBatchSize = 500
+	// defaultFlushInterval bounds the time a metric waits for its batch.
+	defaultFlushInterval = time.Second
+	// shutdownTimeout bounds the final flush after cancellation.
+	shutdownTimeout = 5 * time.Second
+	// maxLineLength is the longest accepted plaintext line.
+	maxLineLength = 64 * 1024
+	// maxPickleLength is the largest accepted pickle payload, as in carbon.
+	maxPickleLength = 1024 * 1024
+)
+
+// Listener receives Graphite plaintext and pickle protocol payloads over TCP
+// and stores them in batches. Malformed lines are logged and skipped, the
+// protocols have no way to report errors to the sender.
+type Listener struct {
+	address       string
+	pickleAddress string
+	repo          repository.Repository
+	mapping       *ingest.Graphite
+	validator     *model.Validator
+	logger        *slog.Logger
+	batchSize     int
+	flushInterval time.Duration
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// Option configures a Listener.
+type Option func(*Listener) error
+
+// WithPickleAddress enables the pickle protocol listener on the address.
+func WithPickleAddress(address string) Option {
+	return func(l *Listener) error {
+		l.pickleAddress = address
+		return nil
+	}
+}
+
+// WithRules sets the rules mapping paths to metric types, each in the form
+// pattern=type.
+func WithRules(rules []string) Option {
+	return func(l *Listener) error {
+		mapping, err := ingest.NewGraphite(ingest.WithGraphiteRules(rules))
+		if err != nil {
+			return err
+		}
+		l.mapping = mapping
+		return nil
+	}
+}
+
+// WithStrictValidation enables strict validation of incoming metrics.
+func WithStrictValidation(strict bool) Option {
+	return func(l *Listener) error {
+		l.validator = model.NewValidator(strict)
+		return nil
+	}
+}
+
+// WithLogger sets the logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(l *Listener) error {
+		l.logger = logger
+		return nil
+	}
+}
+
+// WithBatching sets the batch size and the longest time a metric waits
+// before its batch is stored.
+func WithBatching(size int, interval time.Duration) Option {
+	return func(l *Listener) error {
+		if size < 1 || interval <= 0 {
+			return fmt.Errorf("invalid batching %d/%s", size, interval)
+		}
+		l.batchSize = size
+		l.flushInterval = interval
+		return nil
+	}
+}
+
+// New creates a new Listener. The plaintext listener is disabled when
+// address is empty.
+func New(
+	address string,
+	repo repository.Repository,
+	opts ...Option,
+) (*Listener, error) {
+	mapping, err := ingest.NewGraphite()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		address:       address,
+		repo:          repo,
+		mapping:       mapping,
+		validator:     model.NewValidator(false),
+		logger:        slog.Default(),
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		conns:         make(map[net.Conn]struct{}),
+	}
+
+	for _, opt := range opts {
+		if err := opt(l); err != nil {
+			return nil, err
+		}
+	}
+
+	if l.address == "" && l.pickleAddress == "" {
+		return nil, errors.New("no graphite listen address")
+	}
+
+	return l, nil
+}
+
+// Run accepts connections until ctx is cancelled. On cancellation the
+// listeners and open connections are closed and the metrics received so far
+// are stored before Run returns.
+func (l *Listener) Run(ctx context.Context) error {
+	type server struct {
+		ln    net.Listener
+		serve func(net.Conn, chan<- *model.Metrics)
+	}
+
+	var servers []server
+	closeAll := func() {
+		for _, srv := range servers {
+			srv.ln.Close()
+		}
+	}
+
+	for _, s := range []struct {
+		address string
+		serve   func(net.Conn, chan<- *model.Metrics)
+	}{
+		{l.address, l.servePlaintext},
+		{l.pickleAddress, l.servePickle},
+	} {
+		if s.address == "" {
+			continue
+		}
+
+		ln, err := net.Listen("tcp", s.address)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("failed to listen on %s: %w", s.address, err)
+		}
+		servers = append(servers, server{ln: ln, serve: s.serve})
+
+		l.logger.Info(
+			"graphite listener started",
+			slog.String("address", ln.Addr().String()),
+		)
+	}
+
+	in := make(chan *model.Metrics, l.batchSize)
+	batcherDone := make(chan struct{})
+	go func() {
+		l.batch(ctx, in)
+		close(batcherDone)
+	}()
+
+	var conns sync.WaitGroup
+	var eg errgroup.Group
+	for _, srv := range servers {
+		eg.Go(func() error {
+			return l.accept(srv.ln, srv.serve, in, &conns)
+		})
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- eg.Wait()
+	}()
+
+	var err error
+	select {
+	case err = <-errChan:
+		closeAll()
+	case <-ctx.Done():
+		closeAll()
+		<-errChan
+	}
+
+	l.closeConns()
+	conns.Wait()
+	close(in)
+	<-batcherDone
+
+	l.logger.Info("graphite listener shut down gracefully")
+
+	return err
+}
+
+// accept serves the connections of ln until it is closed.
+func (l *Listener) accept(
+	ln net.Listener,
+	serve func(net.Conn, chan<- *model.Metrics),
+	in chan<- *model.Metrics,
+	conns *sync.WaitGroup,
+) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		l.mu.Lock()
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+
+		conns.Add(1)
+		go func() {
+			defer conns.Done()
+			defer func() {
+				l.mu.Lock()
+				delete(l.conns, conn)
+				l.mu.Unlock()
+				conn.Close()
+			}()
+
+			serve(conn, in)
+		}()
+	}
+}
+
+func (l *Listener) closeConns() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for conn := range l.conns {
+		conn.Close()
+	}
+}
+
+// servePlaintext reads path value timestamp lines.
+func (l *Listener) servePlaintext(conn net.Conn, in chan<- *model.Metrics) {
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 0, 4096), maxLineLength)
+
+	for sc.Scan() {
+		line := sc.Text()
+		if line == "" {
+			continue
+		}
+
+		s, err := ingest.ParseGraphiteLine(line)
+		if err != nil {
+			l.logger.Warn(
+				"skipping graphite line",
+				slog.String("remote_addr", conn.RemoteAddr().String()),
+				slog.Any("error", err),
+			)
+			continue
+		}
+
+		l.send(s, in)
+	}
+
+	if err := sc.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		l.logger.Warn(
+			"graphite connection failed",
+			slog.String("remote_addr", conn.RemoteAddr().String()),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// servePickle reads pickle payloads, each prefixed by its length as a 32-bit
+// big-endian integer.
+func (l *Listener) servePickle(conn net.Conn, in chan<- *model.Metrics) {
+	r := bufio.NewReader(conn)
+	header := make([]byte, 4)
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				l.logger.Warn(
+					"graphite connection failed",
+					slog.String("remote_addr", conn.RemoteAddr().String()),
+					slog.Any("error", err),
+				)
+			}
+			return
+		}
+
+		n := binary.BigEndian.Uint32(header)
+		if n > maxPickleLength {
+			l.logger.Warn(
+				"graphite pickle payload too large",
+				slog.String("remote_addr", conn.RemoteAddr().String()),
+				slog.Int("length", int(n)),
+			)
+			return
+		}
+
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			l.logger.Warn(
+				"graphite connection failed",
+				slog.String("remote_addr", conn.RemoteAddr().String()),
+				slog.Any("error", err),
+			)
+			return
+		}
+
+		samples, err := ingest.ParsePickle(payload)
+		if err != nil {
+			l.logger.Warn(
+				"skipping graphite pickle payload",
+				slog.String("remote_addr", conn.RemoteAddr().String()),
+				slog.Any("error", err),
+			)
+			continue
+		}
+
+		for _, s := range samples {
+			l.send(s, in)
+		}
+	}
+}
+
+func (l *Listener) send(s ingest.Sample, in chan<- *model.Metrics) {
+	m, err := l.mapping.Metric(s)
+	if err != nil {
+		l.logger.Warn("skipping graphite sample", slog.Any("error", err))
+		return
+	}
+
+	in <- m
+}
+
+// batch collects metrics from in and stores them when the batch is full or
+// the flush interval passes, until in is closed.
+func (l *Listener) batch(ctx context.Context, in <-chan *model.Metrics) {
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	buf := make([]*model.Metrics, 0, l.batchSize)
+	for {
+		select {
+		case m, ok := <-in:
+			if !ok {
+				l.flush(ctx, buf)
+				return
+			}
+
+			buf = append(buf, m)
+			if len(buf) >= l.batchSize {
+				l.flush(ctx, buf)
+				buf = make([]*model.Metrics, 0, l.batchSize)
+			}
+		case <-ticker.C:
+			if len(buf) > 0 {
+				l.flush(ctx, buf)
+				buf = make([]*model.Metrics, 0, l.batchSize)
+			}
+		}
+	}
+}
+
+// flush stores a batch in best-effort mode, so a single bad metric does not
+// drop the rest. The flush outlives the cancellation of ctx.
+func (l *Listener) flush(ctx context.Context, metrics []*model.Metrics) {
+	if len(metrics) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+
+	res, err := repository.ApplyBatch(
+		ctx,
+		l.repo,
+		l.validator,
+		metrics,
+		model.BatchBestEffort,
+	)
+	if err != nil {
+		l.logger.Error("failed to store graphite metrics", slog.Any("error", err))
+		return
+	}
+
+	if res.Rejected > 0 {
+		l.logger.Warn(
+			"graphite metrics rejected",
+			slog.Int("applied", res.Applied),
+			slog.Int("rejected", res.Rejected),
+		)
+	}
+}
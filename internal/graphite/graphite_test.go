@@ -0,0 +1,193 @@
+package graphite
+
+import (
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	return addr
+}
+
+// dial connects to addr once the listener is up.
+func dial(t *testing.T, addr string) net.Conn {
+	t.Helper()
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		var err error
+		conn, err = net.Dial("tcp", addr)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return conn
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "plaintext", address: ":2003"},
+		{name: "pickle only", opts: []Option{WithPickleAddress(":2004")}},
+		{name: "no address", wantErr: true},
+		{
+			name:    "invalid rule",
+			address: ":2003",
+			opts:    []Option{WithRules([]string{"a.*=histogram"})},
+			wantErr: true,
+		},
+		{
+			name:    "invalid batching",
+			address: ":2003",
+			opts:    []Option{WithBatching(0, time.Second)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.address, memstorage.NewMemoryStorage(), tt.opts...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestListener_Run(t *testing.T) {
+	repo := memstorage.NewMemoryStorage()
+	addr, pickleAddr := freeAddr(t), freeAddr(t)
+
+	l, err := New(
+		addr,
+		repo,
+		WithPickleAddress(pickleAddr),
+		WithRules([]string{"stats_counts.*=counter"}),
+		WithLogger(slog.New(slog.DiscardHandler)),
+		// only the shutdown flushes
+		WithBatching(100, time.Hour),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Run(ctx)
+	}()
+
+	conn := dial(t, addr)
+	_, err = conn.Write([]byte(
+		"servers.web1.cpu 12.5 1700000000\n" +
+			"garbage\n" +
+			"stats_counts.requests 2 -1\n" +
+			"stats_counts.requests 3 -1\n",
+	))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	// pickle.dumps([("servers.web1.mem", (1700000000, 1024))], protocol=2)
+	payload := []byte("\x80\x02]q\x00X\x10\x00\x00\x00servers.web1.memq\x01J\x00\xf1SeM\x00\x04\x86q\x02\x86q\x03a.")
+	header := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+
+	pconn := dial(t, pickleAddr)
+	_, err = pconn.Write(append(header, payload...))
+	require.NoError(t, err)
+
+	// give the server time to read before it is shut down
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.conns) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, 0, repo.Len(), "nothing stored before the flush")
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener did not shut down")
+	}
+	pconn.Close()
+
+	want := map[string]string{
+		"servers.web1.cpu":      "12.5",
+		"stats_counts.requests": "5",
+		"servers.web1.mem":      "1024",
+	}
+	for id, v := range want {
+		m, err := repo.GetMetric(context.Background(), id)
+		require.NoError(t, err, id)
+		assert.Equal(t, v, m.GetValue(), id)
+	}
+	assert.Equal(t, len(want), repo.Len())
+}
+
+func TestListener_Run_FlushOnBatchSize(t *testing.T) {
+	repo := memstorage.NewMemoryStorage()
+	addr := freeAddr(t)
+
+	l, err := New(
+		addr,
+		repo,
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithBatching(2, time.Hour),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = l.Run(ctx)
+	}()
+
+	conn := dial(t, addr)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("a 1 -1\nb 2 -1\n"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return repo.Len() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestListener_Run_ListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	l, err := New(
+		ln.Addr().String(),
+		memstorage.NewMemoryStorage(),
+		WithLogger(slog.New(slog.DiscardHandler)),
+	)
+	require.NoError(t, err)
+
+	assert.Error(t, l.Run(context.Background()))
+}
@@ -0,0 +1,193 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/netpolicy"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
+)
+
+// rejection is the error of a call rejected for security reasons. The
+// client receives its status, the audit interceptors record its event.
+type rejection struct {
+	status *status.Status
+	event  audit.Event
+}
+
+// reject returns the rejection of the call of ctx with the code and the
+// message, the message being the reason of the security event of the type.
+func reject(
+	ctx context.Context,
+	code codes.Code,
+	typ audit.EventType,
+	msg string,
+) *rejection {
+	event := callEvent(ctx)
+	event.Outcome = audit.OutcomeRejected
+	event.Type = typ
+	event.Reason = msg
+
+	return &rejection{status: status.New(code, msg), event: event}
+}
+
+// withKeyID sets the key the rejected call was signed with.
+func (r *rejection) withKeyID(id string) *rejection {
+	r.event.KeyID = id
+	return r
+}
+
+func (r *rejection) Error() string {
+	return r.status.Err().Error()
+}
+
+// GRPCStatus returns the status sent to the client.
+func (r *rejection) GRPCStatus() *status.Status {
+	return r.status
+}
+
+// auditUnaryInterceptor records the calls rejected by the next interceptors
+// or the handler as security events.
+func auditUnaryInterceptor(auditor *audit.Auditor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		resp, err := handler(ctx, req)
+		auditRejection(ctx, auditor, info.FullMethod, err)
+		return resp, err
+	}
+}
+
+// auditStreamInterceptor is the streaming counterpart of
+// auditUnaryInterceptor.
+func auditStreamInterceptor(auditor *audit.Auditor) grpc.StreamServerInterceptor {
+	return func(srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		err := handler(srv, ss)
+		auditRejection(ss.Context(), auditor, info.FullMethod, err)
+		return err
+	}
+}
+
+// auditRejection logs the event of err if the call was rejected.
+func auditRejection(
+	ctx context.Context,
+	auditor *audit.Auditor,
+	method string,
+	err error,
+) {
+	var r *rejection
+	if !errors.As(err, &r) {
+		return
+	}
+
+	event := r.event
+	if event.Route == "" {
+		event.Route = method
+	}
+
+	runAudit(auditor, event)
+}
+
+// auditUpdate records the update of the metrics of the batch result by the
+// call of ctx.
+func auditUpdate(
+	ctx context.Context,
+	auditor *audit.Auditor,
+	res *model.BatchResult,
+	outcome audit.Outcome,
+) {
+	if !auditor.Enabled() || res.Applied == 0 {
+		return
+	}
+
+	event := callEvent(ctx)
+	event.Outcome = outcome
+	for _, it := range res.Results {
+		if it.Applied() {
+			event.Values = append(event.Values, it.Metrics)
+			if !slices.Contains(event.Metrics, it.ID) {
+				event.Metrics = append(event.Metrics, it.ID)
+			}
+		}
+	}
+
+	runAudit(auditor, event)
+}
+
+// callEvent describes the call of ctx for the audit: its method and its
+// client, the client address being the one resolved by the access policy
+// if any.
+func callEvent(ctx context.Context) audit.Event {
+	method, _ := grpc.Method(ctx)
+
+	event := audit.Event{
+		IPAddress: peerIP(ctx),
+		Transport: audit.TransportGRPC,
+		Route:     method,
+		UserAgent: metadataValue(ctx, "user-agent"),
+		RequestID: metadataValue(ctx, "x-request-id"),
+		Identity:  PeerIdentity(ctx),
+		APIKey:    apikey.Name(ctx),
+		KeyID:     metadataValue(ctx, strings.ToLower(signing.HeaderKeyID)),
+	}
+	if ip, ok := netpolicy.FromContext(ctx); ok {
+		event.IPAddress = ip.String()
+	}
+
+	return event
+}
+
+// runAudit logs the event in the call goroutine, the observers of the
+// server queueing it.
+func runAudit(auditor *audit.Auditor, event audit.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), audit.DefaultTimeout)
+	defer cancel()
+
+	if err := auditor.LogEvent(ctx, event); err != nil {
+		slog.Error("failed to log audit event", slog.Any("error", err))
+	}
+}
+
+// metadataValue returns the first value of the metadata key of the call.
+func metadataValue(ctx context.Context, key string) string {
+	if v := metadata.ValueFromIncomingContext(ctx, key); len(v) > 0 {
+		return v[0]
+	}
+
+	return ""
+}
+
+// peerIP returns the address of the connection of the call without the
+// port.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
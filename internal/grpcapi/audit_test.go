@@ -0,0 +1,210 @@
+package grpcapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/netpolicy"
+	pb "github.com/fragpit/yandex-go-dev-metrics/internal/proto"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+// eventObserver passes the audit events to a channel.
+type eventObserver chan audit.Event
+
+func (o eventObserver) Notify(_ context.Context, event audit.Event) error {
+	o <- event
+	return nil
+}
+
+func TestAuditUnaryInterceptor(t *testing.T) {
+	policy, err := netpolicy.New(
+		netpolicy.WithRules([]string{"192.168.1.0/24"}, nil),
+	)
+	require.NoError(t, err)
+
+	access := accessUnaryInterceptor(policy)
+	auth := authUnaryInterceptor(newTestAPIKeys(t))
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		handlerErr error
+		wantCode   codes.Code
+		wantEvent  *audit.Event
+	}{
+		{
+			name:     "forbidden ip",
+			ctx:      addrContext("10.0.0.1:5555"),
+			wantCode: codes.PermissionDenied,
+			wantEvent: &audit.Event{
+				IPAddress: "10.0.0.1",
+				Type:      audit.EventAccessDenied,
+				Reason:    "access forbidden for ip 10.0.0.1",
+			},
+		},
+		{
+			name:     "no api key",
+			ctx:      addrContext("192.168.1.1:5555"),
+			wantCode: codes.Unauthenticated,
+			wantEvent: &audit.Event{
+				IPAddress: "192.168.1.1",
+				Type:      audit.EventAuthFailed,
+				Reason:    "api key required",
+			},
+		},
+		{
+			name: "missing scope",
+			ctx: metadata.NewIncomingContext(
+				addrContext("192.168.1.1:5555"),
+				metadata.Pairs("x-api-key", "read-key"),
+			),
+			wantCode: codes.PermissionDenied,
+			wantEvent: &audit.Event{
+				IPAddress: "192.168.1.1",
+				APIKey:    "reader",
+				Type:      audit.EventAccessDenied,
+				Reason:    "api key reader lacks scope write",
+			},
+		},
+		{
+			name: "handler error",
+			ctx: metadata.NewIncomingContext(
+				addrContext("192.168.1.1:5555"),
+				metadata.Pairs("x-api-key", "write-key"),
+			),
+			handlerErr: status.Error(codes.Internal, "failed"),
+			wantCode:   codes.Internal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(eventObserver, 1)
+			a := audit.NewAuditor()
+			a.Add(events)
+
+			info := &grpc.UnaryServerInfo{
+				FullMethod: pb.Metrics_UpdateMetrics_FullMethodName,
+			}
+			handler := func(ctx context.Context, req any) (any, error) {
+				return nil, tt.handlerErr
+			}
+			chain := func(ctx context.Context, req any) (any, error) {
+				return access(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+					return auth(ctx, req, info, handler)
+				})
+			}
+
+			_, err := auditUnaryInterceptor(a)(tt.ctx, nil, info, chain)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+
+			if tt.wantEvent == nil {
+				select {
+				case event := <-events:
+					t.Fatalf("unexpected audit event: %+v", event)
+				case <-time.After(50 * time.Millisecond):
+				}
+				return
+			}
+
+			select {
+			case event := <-events:
+				assert.NotZero(t, event.Timestamp)
+				want := *tt.wantEvent
+				want.Timestamp = event.Timestamp
+				want.Version = audit.SchemaVersion
+				want.Transport = audit.TransportGRPC
+				want.Route = pb.Metrics_UpdateMetrics_FullMethodName
+				want.Outcome = audit.OutcomeRejected
+				assert.Equal(t, want, event)
+			case <-time.After(5 * time.Second):
+				t.Fatal("audit event was not logged")
+			}
+		})
+	}
+}
+
+func TestReject_KeyID(t *testing.T) {
+	err := reject(
+		context.Background(),
+		codes.Unauthenticated,
+		audit.EventSignatureInvalid,
+		"invalid signature",
+	).withKeyID("2025")
+
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	assert.Equal(t, codes.Unauthenticated, st.Code())
+	assert.Equal(t, "invalid signature", st.Message())
+	assert.Equal(t, "2025", err.event.KeyID)
+	assert.Equal(t, audit.EventSignatureInvalid, err.event.Type)
+}
+
+func TestMetricsService_UpdateMetrics_Audit(t *testing.T) {
+	events := make(eventObserver, 1)
+	a := audit.NewAuditor()
+	a.Add(events)
+
+	repo := memstorage.NewMemoryStorage()
+	require.NoError(t, repo.Initialize([]model.Metric{
+		model.NewCounter("requests", 1),
+	}))
+
+	svc := &MetricsService{
+		repo:      repo,
+		validator: model.NewValidator(false),
+		auditor:   a,
+	}
+
+	ctx := metadata.NewIncomingContext(
+		addrContext("192.168.1.1:5555"),
+		metadata.Pairs("user-agent", "agent/1.0", "x-request-id", "req-1"),
+	)
+
+	counter, gauge := pb.Metric_MTYPE_COUNTER, pb.Metric_MTYPE_GAUGE
+	req := pb.UpdateMetricsRequest_builder{
+		Mode: pb.UpdateMetricsRequest_BATCH_MODE_BEST_EFFORT.Enum(),
+		Metrics: []*pb.Metric{
+			pb.Metric_builder{
+				Id:    proto.String("requests"),
+				Type:  &counter,
+				Delta: proto.Int64(2),
+			}.Build(),
+			pb.Metric_builder{
+				Id:    proto.String("requests"),
+				Type:  &gauge,
+				Value: proto.Float64(1),
+			}.Build(),
+		},
+	}.Build()
+
+	_, err := svc.UpdateMetrics(ctx, req)
+	require.NoError(t, err)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, []string{"requests"}, event.Metrics)
+		assert.Equal(t, "192.168.1.1", event.IPAddress)
+		assert.Equal(t, audit.TransportGRPC, event.Transport)
+		assert.Equal(t, "agent/1.0", event.UserAgent)
+		assert.Equal(t, "req-1", event.RequestID)
+		assert.Equal(t, audit.OutcomePartial, event.Outcome)
+		require.Len(t, event.Values, 1)
+		assert.Equal(t, "counter", event.Values[0].MType)
+		assert.Equal(t, int64(3), *event.Values[0].Delta)
+	case <-time.After(5 * time.Second):
+		t.Fatal("audit event was not logged")
+	}
+}
@@ -0,0 +1,169 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	pb "github.com/fragpit/yandex-go-dev-metrics/internal/proto"
+)
+
+// otlpExportMethod is the full name of the OTLP metrics export method.
+const otlpExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+// methodScopes maps the methods to the scope they require. Other methods
+// require the admin scope.
+var methodScopes = map[string]apikey.Scope{
+	pb.Metrics_UpdateMetrics_FullMethodName: apikey.ScopeWrite,
+	otlpExportMethod:                        apikey.ScopeWrite,
+}
+
+// authUnaryInterceptor admits the calls carrying an API key of the store
+// with the scope of the method.
+func authUnaryInterceptor(keys *apikey.Store) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		ctx, err := authenticate(ctx, keys, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// authStreamInterceptor is the streaming counterpart of
+// authUnaryInterceptor.
+func authStreamInterceptor(keys *apikey.Store) grpc.StreamServerInterceptor {
+	return func(srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := authenticate(ss.Context(), keys, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authServerStream carries the authenticated key in the stream context.
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate returns the context carrying the API key of the call, sent
+// in the authorization metadata as a bearer token or in x-api-key.
+func authenticate(
+	ctx context.Context,
+	keys *apikey.Store,
+	method string,
+) (context.Context, error) {
+	key := presentedKey(ctx)
+	if key == "" {
+		return nil, reject(
+			ctx,
+			codes.Unauthenticated,
+			audit.EventAuthFailed,
+			"api key required",
+		)
+	}
+
+	k, ok := keys.Lookup(key)
+	if !ok {
+		slog.Warn("invalid api key", slog.String("method", method))
+		return nil, reject(
+			ctx,
+			codes.Unauthenticated,
+			audit.EventAuthFailed,
+			"invalid api key",
+		)
+	}
+
+	ctx = apikey.NewContext(ctx, k)
+
+	scope, ok := methodScopes[method]
+	if !ok {
+		scope = apikey.ScopeAdmin
+	}
+
+	if !k.Has(scope) {
+		slog.Warn(
+			"api key lacks scope",
+			slog.String("api_key", k.Name),
+			slog.String("scope", string(scope)),
+			slog.String("method", method),
+		)
+		return nil, reject(
+			ctx,
+			codes.PermissionDenied,
+			audit.EventAccessDenied,
+			fmt.Sprintf("api key %s lacks scope %s", k.Name, scope),
+		)
+	}
+
+	return ctx, nil
+}
+
+// authorizeMetrics checks that the API key of the call may write the
+// metrics.
+func authorizeMetrics(ctx context.Context, metrics []*model.Metrics) error {
+	k, ok := apikey.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	for _, m := range metrics {
+		if m != nil && !k.Allows(m.ID) {
+			slog.Warn(
+				"metric outside of api key prefix",
+				slog.String("api_key", k.Name),
+				slog.String("metric_id", m.ID),
+			)
+			return reject(
+				ctx,
+				codes.PermissionDenied,
+				audit.EventAccessDenied,
+				fmt.Sprintf("metric %s is not allowed for the api key", m.ID),
+			)
+		}
+	}
+
+	return nil
+}
+
+func presentedKey(ctx context.Context) string {
+	if v := metadata.ValueFromIncomingContext(ctx, "x-api-key"); len(v) > 0 {
+		return v[0]
+	}
+
+	v := metadata.ValueFromIncomingContext(ctx, "authorization")
+	if len(v) == 0 {
+		return ""
+	}
+
+	scheme, token, ok := strings.Cut(v[0], " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,178 @@
+package grpcapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	pb "github.com/fragpit/yandex-go-dev-metrics/internal/proto"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+func newTestAPIKeys(t *testing.T) *apikey.Store {
+	t.Helper()
+
+	s, err := apikey.NewStore([]apikey.Key{
+		{Name: "reader", Hash: apikey.Hash("read-key"), Scopes: []apikey.Scope{apikey.ScopeRead}},
+		{Name: "writer", Hash: apikey.Hash("write-key"), Scopes: []apikey.Scope{apikey.ScopeWrite}},
+		{
+			Name:   "hosts",
+			Hash:   apikey.Hash("hosts-key"),
+			Scopes: []apikey.Scope{apikey.ScopeWrite},
+			Prefix: "hosts.",
+		},
+	})
+	require.NoError(t, err)
+
+	return s
+}
+
+func keyContext(key, value string) context.Context {
+	return metadata.NewIncomingContext(
+		context.Background(),
+		metadata.Pairs(key, value),
+	)
+}
+
+func TestAuthUnaryInterceptor(t *testing.T) {
+	interceptor := authUnaryInterceptor(newTestAPIKeys(t))
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		return apikey.Name(ctx), nil
+	}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		method   string
+		wantCode codes.Code
+		wantKey  string
+	}{
+		{
+			name:     "no key",
+			ctx:      context.Background(),
+			method:   pb.Metrics_UpdateMetrics_FullMethodName,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "unknown key",
+			ctx:      keyContext("x-api-key", "wrong"),
+			method:   pb.Metrics_UpdateMetrics_FullMethodName,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "not a bearer token",
+			ctx:      keyContext("authorization", "Basic write-key"),
+			method:   pb.Metrics_UpdateMetrics_FullMethodName,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "missing scope",
+			ctx:      keyContext("authorization", "Bearer read-key"),
+			method:   pb.Metrics_UpdateMetrics_FullMethodName,
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "bearer token",
+			ctx:      keyContext("authorization", "Bearer write-key"),
+			method:   pb.Metrics_UpdateMetrics_FullMethodName,
+			wantCode: codes.OK,
+			wantKey:  "writer",
+		},
+		{
+			name:     "api key metadata",
+			ctx:      keyContext("x-api-key", "write-key"),
+			method:   otlpExportMethod,
+			wantCode: codes.OK,
+			wantKey:  "writer",
+		},
+		{
+			name:     "unknown method requires admin",
+			ctx:      keyContext("x-api-key", "write-key"),
+			method:   "/test.Service/Method",
+			wantCode: codes.PermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &grpc.UnaryServerInfo{FullMethod: tt.method}
+			resp, err := interceptor(tt.ctx, nil, info, handler)
+
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode == codes.OK {
+				assert.Equal(t, tt.wantKey, resp)
+			}
+		})
+	}
+}
+
+// testServerStream is a server stream with a context only.
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestAuthStreamInterceptor(t *testing.T) {
+	interceptor := authStreamInterceptor(newTestAPIKeys(t))
+	info := &grpc.StreamServerInfo{FullMethod: pb.Metrics_UpdateMetrics_FullMethodName}
+
+	var name string
+	handler := func(srv any, ss grpc.ServerStream) error {
+		name = apikey.Name(ss.Context())
+		return nil
+	}
+
+	err := interceptor(nil, &testServerStream{ctx: context.Background()}, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ss := &testServerStream{ctx: keyContext("x-api-key", "write-key")}
+	require.NoError(t, interceptor(nil, ss, info, handler))
+	assert.Equal(t, "writer", name)
+}
+
+func TestMetricsService_UpdateMetrics_Prefix(t *testing.T) {
+	keys := newTestAPIKeys(t)
+	k, ok := keys.Lookup("hosts-key")
+	require.True(t, ok)
+	ctx := apikey.NewContext(context.Background(), k)
+
+	gauge := pb.Metric_MTYPE_GAUGE
+	request := func(ids ...string) *pb.UpdateMetricsRequest {
+		metrics := make([]*pb.Metric, 0, len(ids))
+		for _, id := range ids {
+			metrics = append(metrics, pb.Metric_builder{
+				Id:    proto.String(id),
+				Type:  &gauge,
+				Value: proto.Float64(1),
+			}.Build())
+		}
+		return pb.UpdateMetricsRequest_builder{Metrics: metrics}.Build()
+	}
+
+	repo := memstorage.NewMemoryStorage()
+	s := &MetricsService{repo: repo, validator: model.NewValidator(false)}
+
+	_, err := s.UpdateMetrics(ctx, request("hosts.a.cpu", "cpu"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = repo.GetMetric(ctx, "hosts.a.cpu")
+	assert.Error(t, err)
+
+	_, err = s.UpdateMetrics(ctx, request("hosts.a.cpu"))
+	require.NoError(t, err)
+	_, err = repo.GetMetric(ctx, "hosts.a.cpu")
+	assert.NoError(t, err)
+}
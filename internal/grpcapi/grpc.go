@@ -2,15 +2,25 @@ package grpcapi
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"time"
 
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/netpolicy"
 	pb "github.com/fragpit/yandex-go-dev-metrics/internal/proto"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/repository"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
 )
 
 const (
@@ -18,21 +28,121 @@ const (
 )
 
 type GRPCAPI struct {
-	address       string
-	repo          repository.Repository
-	trustedSubnet *net.IPNet
+	address        string
+	repo           repository.Repository
+	policy         *netpolicy.Policy
+	validator      *model.Validator
+	otlp           *ingest.OTLP
+	tlsConfig      *tls.Config
+	allowedClients map[string]struct{}
+	apiKeys        *apikey.Store
+	verifier       *signing.Verifier
+	// legacySignatures admits the unsigned calls of older clients when
+	// signatures are verified.
+	legacySignatures bool
+	auditor          *audit.Auditor
 }
 
 type Option func(*GRPCAPI) error
 
+// WithTrustedSubnet only admits clients from the subnet. It is a shortcut
+// for WithAccessPolicy with a single allowed CIDR.
 func WithTrustedSubnet(subnet string) Option {
 	return func(g *GRPCAPI) error {
-		_, sNet, err := net.ParseCIDR(subnet)
+		p, err := netpolicy.New(netpolicy.WithRules([]string{subnet}, nil))
 		if err != nil {
 			return fmt.Errorf("failed to parse trusted subnet: %w", err)
 		}
 
-		g.trustedSubnet = sNet
+		g.policy = p
+		return nil
+	}
+}
+
+// WithAccessPolicy only admits the clients the policy allows, checking the
+// metric updates against its write rules.
+func WithAccessPolicy(p *netpolicy.Policy) Option {
+	return func(g *GRPCAPI) error {
+		g.policy = p
+		return nil
+	}
+}
+
+// WithStrictValidation enables strict validation of incoming metrics.
+func WithStrictValidation(strict bool) Option {
+	return func(g *GRPCAPI) error {
+		g.validator = model.NewValidator(strict)
+		return nil
+	}
+}
+
+// WithOTLP sets the mapping of OTLP metrics exports to metrics. The mapping
+// keeps the state of cumulative series and may be shared with the HTTP API.
+func WithOTLP(o *ingest.OTLP) Option {
+	return func(g *GRPCAPI) error {
+		g.otlp = o
+		return nil
+	}
+}
+
+// WithTLSConfig serves the API over TLS with the configuration. Client
+// certificates are verified when it sets client CAs.
+func WithTLSConfig(c *tls.Config) Option {
+	return func(g *GRPCAPI) error {
+		g.tlsConfig = c
+		return nil
+	}
+}
+
+// WithAllowedClients only admits clients whose verified certificate has one
+// of the common names. It requires a TLS configuration verifying client
+// certificates and complements the trusted subnet check when both are set.
+func WithAllowedClients(names []string) Option {
+	return func(g *GRPCAPI) error {
+		if len(names) == 0 {
+			return nil
+		}
+
+		g.allowedClients = make(map[string]struct{}, len(names))
+		for _, name := range names {
+			g.allowedClients[name] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithAPIKeys requires calls to carry an API key of the store with the
+// scope of the method: write for metric updates, admin for the others.
+func WithAPIKeys(s *apikey.Store) Option {
+	return func(g *GRPCAPI) error {
+		g.apiKeys = s
+		return nil
+	}
+}
+
+// WithSignatureVerifier requires unary calls to carry a version 2 signature
+// in their metadata.
+func WithSignatureVerifier(v *signing.Verifier) Option {
+	return func(g *GRPCAPI) error {
+		g.verifier = v
+		return nil
+	}
+}
+
+// WithLegacySignatures admits or rejects the unsigned calls of older
+// clients when signatures are verified, admitted by default.
+func WithLegacySignatures(enabled bool) Option {
+	return func(g *GRPCAPI) error {
+		g.legacySignatures = enabled
+		return nil
+	}
+}
+
+// WithAuditor records the metric updates and the calls rejected for
+// security reasons: invalid credentials, signatures and forbidden clients.
+func WithAuditor(a *audit.Auditor) Option {
+	return func(g *GRPCAPI) error {
+		g.auditor = a
 		return nil
 	}
 }
@@ -43,37 +153,104 @@ func NewGRPCAPI(
 	opts ...Option,
 ) (*GRPCAPI, error) {
 	g := &GRPCAPI{
-		address: address,
-		repo:    repo,
+		address:   address,
+		repo:      repo,
+		validator: model.NewValidator(false),
+
+		legacySignatures: true,
 	}
 
+	otlp, err := ingest.NewOTLP()
+	if err != nil {
+		return nil, err
+	}
+	g.otlp = otlp
+
 	for _, opt := range opts {
 		if err := opt(g); err != nil {
 			return nil, err
 		}
 	}
 
+	if g.allowedClients != nil &&
+		(g.tlsConfig == nil || g.tlsConfig.ClientCAs == nil) {
+		return nil, errors.New(
+			"allowed clients require client certificate verification",
+		)
+	}
+
 	return g, nil
 }
 
 func (g *GRPCAPI) Run(ctx context.Context) error {
-	slog.Info("grpc api server started", "address", g.address)
+	slog.Info(
+		"grpc api server started",
+		"address", g.address,
+		"tls", g.tlsConfig != nil,
+	)
 
-	listener, err := net.Listen("tcp4", g.address)
+	listener, err := net.Listen("tcp", g.address)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", g.address, err)
 	}
 
-	var opts []grpc.ServerOption
-	if g.trustedSubnet != nil {
-		opts = append(
-			opts,
-			grpc.UnaryInterceptor(verifySubnetInterceptor(g.trustedSubnet)),
+	var interceptors []grpc.UnaryServerInterceptor
+	var streamInterceptors []grpc.StreamServerInterceptor
+	if g.auditor != nil {
+		interceptors = append(interceptors, auditUnaryInterceptor(g.auditor))
+		streamInterceptors = append(
+			streamInterceptors,
+			auditStreamInterceptor(g.auditor),
+		)
+	}
+	if g.policy != nil {
+		interceptors = append(interceptors, accessUnaryInterceptor(g.policy))
+		streamInterceptors = append(
+			streamInterceptors,
+			accessStreamInterceptor(g.policy),
+		)
+	}
+	if g.allowedClients != nil {
+		interceptors = append(
+			interceptors,
+			verifyClientInterceptor(g.allowedClients),
+		)
+	}
+	if g.verifier != nil {
+		interceptors = append(
+			interceptors,
+			verifySignatureInterceptor(g.verifier, g.legacySignatures),
+		)
+	}
+
+	if g.apiKeys != nil {
+		interceptors = append(interceptors, authUnaryInterceptor(g.apiKeys))
+		streamInterceptors = append(
+			streamInterceptors,
+			authStreamInterceptor(g.apiKeys),
 		)
 	}
 
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	}
+	if g.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(g.tlsConfig)))
+	}
+
 	gs := grpc.NewServer(opts...)
-	pb.RegisterMetricsServer(gs, &MetricsService{repo: g.repo})
+	pb.RegisterMetricsServer(gs, &MetricsService{
+		repo:      g.repo,
+		validator: g.validator,
+		auditor:   g.auditor,
+	})
+	colmetricspb.RegisterMetricsServiceServer(gs, &OTLPService{
+		repo:      g.repo,
+		validator: g.validator,
+		otlp:      g.otlp,
+		auditor:   g.auditor,
+	})
 
 	errChan := make(chan error, 1)
 	go func() {
@@ -1,11 +1,27 @@
 package grpcapi
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"net"
+	"net/netip"
 	"testing"
+	"time"
 
-	"github.com/fragpit/yandex-go-dev-metrics/internal/repository"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/netpolicy"
+	pb "github.com/fragpit/yandex-go-dev-metrics/internal/proto"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/repository"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/tlsconfig"
 )
 
 func TestNewGRPCAPI(t *testing.T) {
@@ -20,7 +36,6 @@ func TestNewGRPCAPI(t *testing.T) {
 		fields            fields
 		wantErr           bool
 		wantTrustedSubnet bool
-		wantSubnetString  string
 	}{
 		{
 			name: "no options",
@@ -43,7 +58,26 @@ func TestNewGRPCAPI(t *testing.T) {
 			},
 			wantErr:           false,
 			wantTrustedSubnet: true,
-			wantSubnetString:  "192.168.1.0/24",
+		},
+		{
+			name: "allowed clients without tls",
+			fields: fields{
+				address: "localhost:9092",
+				opts: []Option{
+					WithAllowedClients([]string{"agent-1"}),
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "allowed clients with client ca",
+			fields: fields{
+				address: "localhost:9093",
+				opts: []Option{
+					WithTLSConfig(&tls.Config{ClientCAs: x509.NewCertPool()}),
+					WithAllowedClients([]string{"agent-1"}),
+				},
+			},
 		},
 		{
 			name: "with invalid trusted subnet option",
@@ -78,14 +112,111 @@ func TestNewGRPCAPI(t *testing.T) {
 			assert.Equal(t, tt.fields.repo, got.repo)
 
 			if tt.wantTrustedSubnet {
-				if assert.NotNil(t, got.trustedSubnet) {
-					assert.Equal(t, tt.wantSubnetString, got.trustedSubnet.String())
-					ip := net.ParseIP("192.168.1.10")
-					assert.True(t, got.trustedSubnet.Contains(ip))
+				if assert.NotNil(t, got.policy) {
+					ip := netip.MustParseAddr("192.168.1.10")
+					assert.True(t, got.policy.Allows(ip, netpolicy.KindAny))
+					ip = netip.MustParseAddr("10.0.0.1")
+					assert.False(t, got.policy.Allows(ip, netpolicy.KindAny))
 				}
 			} else {
-				assert.Nil(t, got.trustedSubnet)
+				assert.Nil(t, got.policy)
 			}
 		})
 	}
 }
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+func TestGRPCAPI_Run_MutualTLS(t *testing.T) {
+	serverConfig, err := tlsconfig.NewServer(
+		"testdata/server.pem",
+		"testdata/server-key.pem",
+		tlsconfig.WithClientCA("testdata/ca.pem"),
+	)
+	require.NoError(t, err)
+
+	addr := freeAddr(t)
+	g, err := NewGRPCAPI(
+		addr,
+		memstorage.NewMemoryStorage(),
+		WithTLSConfig(serverConfig),
+		WithAllowedClients([]string{"agent-1"}),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- g.Run(ctx) }()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp4", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	update := func(t *testing.T, opts ...tlsconfig.Option) error {
+		t.Helper()
+
+		opts = append([]tlsconfig.Option{tlsconfig.WithRootCA("testdata/ca.pem")}, opts...)
+		clientConfig, err := tlsconfig.NewClient(opts...)
+		require.NoError(t, err)
+
+		conn, err := grpc.NewClient(
+			addr,
+			grpc.WithTransportCredentials(credentials.NewTLS(clientConfig)),
+		)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err = pb.NewMetricsClient(conn).UpdateMetrics(
+			ctx,
+			pb.UpdateMetricsRequest_builder{
+				Metrics: []*pb.Metric{pb.Metric_builder{
+					Id:    proto.String("requests"),
+					Type:  pb.Metric_MTYPE_COUNTER.Enum(),
+					Delta: proto.Int64(1),
+				}.Build()},
+			}.Build(),
+		)
+		return err
+	}
+
+	t.Run("allowed client", func(t *testing.T) {
+		err := update(t, tlsconfig.WithClientCertificate(
+			"testdata/agent-1.pem",
+			"testdata/agent-1-key.pem",
+		))
+		assert.NoError(t, err)
+	})
+
+	t.Run("client not allowed", func(t *testing.T) {
+		err := update(t, tlsconfig.WithClientCertificate(
+			"testdata/agent-2.pem",
+			"testdata/agent-2-key.pem",
+		))
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("no client certificate", func(t *testing.T) {
+		err := update(t)
+		assert.Error(t, err)
+	})
+}
@@ -2,44 +2,230 @@ package grpcapi
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
-	"net"
+	"log/slog"
+	"net/http"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/netpolicy"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/tlsconfig"
 )
 
-func verifySubnetInterceptor(
-	trustedSubnet *net.IPNet,
+// accessUnaryInterceptor admits the calls whose client the access policy
+// allows to call the method.
+func accessUnaryInterceptor(
+	policy *netpolicy.Policy,
 ) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context,
 		req any,
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (any, error) {
-		xRealIPKey := "x-real-ip"
-		ip := metadata.ValueFromIncomingContext(ctx, xRealIPKey)
-		if ip == nil {
-			return nil, status.Error(codes.Unauthenticated, "x-real-ip not set")
+		ctx, err := checkAccess(ctx, policy, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// accessStreamInterceptor is the streaming counterpart of
+// accessUnaryInterceptor.
+func accessStreamInterceptor(
+	policy *netpolicy.Policy,
+) grpc.StreamServerInterceptor {
+	return func(srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := checkAccess(ss.Context(), policy, info.FullMethod)
+		if err != nil {
+			return err
 		}
 
-		clientIP := net.ParseIP(ip[0])
-		if clientIP == nil {
-			return nil, status.Error(
+		return handler(srv, &authServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// checkAccess returns the context carrying the client address of the call,
+// the peer address or the address forwarded by a trusted proxy in the
+// x-forwarded-for or x-real-ip metadata. Methods updating metrics are
+// checked against the write rules.
+func checkAccess(
+	ctx context.Context,
+	policy *netpolicy.Policy,
+	method string,
+) (context.Context, error) {
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remoteAddr = p.Addr.String()
+	}
+
+	var realIP string
+	if v := metadata.ValueFromIncomingContext(ctx, "x-real-ip"); len(v) > 0 {
+		realIP = v[0]
+	}
+
+	clientIP, err := policy.Client(
+		remoteAddr,
+		metadata.ValueFromIncomingContext(ctx, "x-forwarded-for"),
+		realIP,
+	)
+	if err != nil {
+		return nil, reject(
+			ctx,
+			codes.Unauthenticated,
+			audit.EventAccessDenied,
+			err.Error(),
+		)
+	}
+
+	ctx = netpolicy.NewContext(ctx, clientIP)
+
+	kind := netpolicy.KindAny
+	if methodScopes[method] == apikey.ScopeWrite {
+		kind = netpolicy.KindWrite
+	}
+
+	if !policy.Allows(clientIP, kind) {
+		return nil, reject(
+			ctx,
+			codes.PermissionDenied,
+			audit.EventAccessDenied,
+			fmt.Sprintf("access forbidden for ip %s", clientIP),
+		)
+	}
+
+	return ctx, nil
+}
+
+// verifyClientInterceptor admits the clients whose verified certificate has
+// one of the allowed common names.
+func verifyClientInterceptor(
+	allowed map[string]struct{},
+) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		cert := tlsconfig.PeerCertificate(peerTLSState(ctx))
+		if cert == nil {
+			return nil, reject(
+				ctx,
 				codes.Unauthenticated,
-				"failed to parse x-real-ip",
+				audit.EventAuthFailed,
+				"client certificate required",
+			)
+		}
+
+		if _, ok := allowed[cert.Subject.CommonName]; !ok {
+			return nil, reject(
+				ctx,
+				codes.PermissionDenied,
+				audit.EventAccessDenied,
+				fmt.Sprintf("access forbidden for client %s", cert.Subject),
 			)
 		}
 
-		if !trustedSubnet.Contains(clientIP) {
-			return nil, status.Error(
+		return handler(ctx, req)
+	}
+}
+
+// verifySignatureInterceptor admits the calls carrying a valid version 2
+// signature in their metadata. The call is signed as a POST request to the
+// full method name with the deterministic encoding of the request. Unsigned
+// calls of older clients pass when legacy is set.
+func verifySignatureInterceptor(
+	v *signing.Verifier,
+	legacy bool,
+) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		get := func(key string) string {
+			if v := md.Get(key); len(v) > 0 {
+				return v[0]
+			}
+			return ""
+		}
+
+		if !signing.Present(get) && legacy {
+			return handler(ctx, req)
+		}
+
+		sig, err := signing.Parse(get)
+		if err != nil {
+			return nil, reject(
+				ctx,
 				codes.Unauthenticated,
-				fmt.Sprintf("access forbidden for ip %s", clientIP),
+				audit.EventSignatureInvalid,
+				err.Error(),
 			)
 		}
 
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return nil, status.Error(codes.Internal, "request is not a message")
+		}
+
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to encode request")
+		}
+
+		if err := v.Verify(http.MethodPost, info.FullMethod, sig, body); err != nil {
+			slog.Error(
+				"invalid request signature",
+				slog.Any("error", err),
+				slog.String("method", info.FullMethod),
+			)
+			return nil, reject(
+				ctx,
+				codes.Unauthenticated,
+				audit.EventSignatureInvalid,
+				err.Error(),
+			).withKeyID(sig.KeyID)
+		}
+
 		return handler(ctx, req)
 	}
 }
+
+// PeerIdentity returns the subject of the verified client certificate of
+// the call, or an empty string without one.
+func PeerIdentity(ctx context.Context) string {
+	return tlsconfig.PeerIdentity(peerTLSState(ctx))
+}
+
+// peerTLSState returns the TLS state of the connection of the call, nil
+// for plaintext connections.
+func peerTLSState(ctx context.Context) *tls.ConnectionState {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+
+	return &info.State
+}
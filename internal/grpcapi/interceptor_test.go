@@ -2,28 +2,155 @@ package grpcapi
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"net"
+	"net/http"
+	"net/netip"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/netpolicy"
+	pb "github.com/fragpit/yandex-go-dev-metrics/internal/proto"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
 )
 
-func mustCIDR(t *testing.T, cidr string) *net.IPNet {
-	t.Helper()
-	_, ipnet, err := net.ParseCIDR(cidr)
-	if err != nil {
-		t.Fatalf("failed to parse cidr: %v", err)
+// addrContext returns a context of a call from the address with the
+// metadata key-value pairs.
+func addrContext(addr string, kv ...string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort(addr)),
+	})
+	if len(kv) > 0 {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(kv...))
 	}
-	return ipnet
+	return ctx
 }
 
-func TestVerifySubnetInterceptor(t *testing.T) {
-	trusted := mustCIDR(t, "192.168.1.0/24")
+func TestAccessUnaryInterceptor(t *testing.T) {
+	policy, err := netpolicy.New(
+		netpolicy.WithRules([]string{"192.168.1.0/24", "2001:db8::/32"}, nil),
+		netpolicy.WithWriteRules([]string{"192.168.1.0/28"}, nil),
+		netpolicy.WithTrustedProxies([]string{"10.0.0.0/8"}),
+	)
+	require.NoError(t, err)
+
+	interceptor := accessUnaryInterceptor(policy)
 
-	interceptor := verifySubnetInterceptor(trusted)
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		method   string
+		wantCode codes.Code
+		wantIP   string
+	}{
+		{
+			name:     "no peer",
+			ctx:      context.Background(),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "ip not allowed",
+			ctx:      addrContext("172.16.0.1:5555"),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "spoofed x-real-ip",
+			ctx:      addrContext("172.16.0.1:5555", "x-real-ip", "192.168.1.10"),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:   "ip allowed",
+			ctx:    addrContext("192.168.1.200:5555"),
+			wantIP: "192.168.1.200",
+		},
+		{
+			name:   "ipv6 allowed",
+			ctx:    addrContext("[2001:db8::1]:5555"),
+			wantIP: "2001:db8::1",
+		},
+		{
+			name:   "forwarded by trusted proxy",
+			ctx:    addrContext("10.0.0.1:5555", "x-forwarded-for", "192.168.1.10"),
+			wantIP: "192.168.1.10",
+		},
+		{
+			name:     "bad forwarded ip",
+			ctx:      addrContext("10.0.0.1:5555", "x-real-ip", "not-an-ip"),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:   "write allowed",
+			ctx:    addrContext("192.168.1.2:5555"),
+			method: pb.Metrics_UpdateMetrics_FullMethodName,
+			wantIP: "192.168.1.2",
+		},
+		{
+			name:     "write denied",
+			ctx:      addrContext("192.168.1.200:5555"),
+			method:   pb.Metrics_UpdateMetrics_FullMethodName,
+			wantCode: codes.PermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "/test.Service/Method"
+			}
+
+			var gotIP netip.Addr
+			handler := func(ctx context.Context, req any) (any, error) {
+				gotIP, _ = netpolicy.FromContext(ctx)
+				return "ok", nil
+			}
+
+			resp, err := interceptor(
+				tt.ctx,
+				nil,
+				&grpc.UnaryServerInfo{FullMethod: method},
+				handler,
+			)
+			if tt.wantCode != codes.OK {
+				assert.Equal(t, tt.wantCode, status.Code(err))
+				assert.Nil(t, resp)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "ok", resp)
+			assert.Equal(t, tt.wantIP, gotIP.String())
+		})
+	}
+}
+
+// peerContext returns a context of a call over TLS with a verified client
+// certificate for the common name.
+func peerContext(cn string) context.Context {
+	cert := &x509.Certificate{
+		Subject: pkix.Name{CommonName: cn, Organization: []string{"metrics"}},
+	}
+
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{cert}},
+		}},
+	})
+}
+
+func TestVerifyClientInterceptor(t *testing.T) {
+	interceptor := verifyClientInterceptor(map[string]struct{}{"agent-1": {}})
 
 	handler := func(ctx context.Context, req any) (any, error) {
 		return "ok", nil
@@ -32,87 +159,146 @@ func TestVerifySubnetInterceptor(t *testing.T) {
 	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
 
 	tests := []struct {
-		name       string
-		ctx        context.Context
-		wantErr    bool
-		wantCode   codes.Code
-		hitHandler bool
+		name     string
+		ctx      context.Context
+		wantCode codes.Code
 	}{
 		{
-			name:     "missing header",
+			name:     "plaintext",
 			ctx:      context.Background(),
-			wantErr:  true,
 			wantCode: codes.Unauthenticated,
 		},
 		{
-			name: "bad ip value",
-			ctx: metadata.NewIncomingContext(
-				context.Background(),
-				metadata.Pairs("x-real-ip", "not-an-ip"),
-			),
-			wantErr:  true,
+			name: "no client certificate",
+			ctx: peer.NewContext(context.Background(), &peer.Peer{
+				AuthInfo: credentials.TLSInfo{},
+			}),
 			wantCode: codes.Unauthenticated,
 		},
 		{
-			name: "ip not in subnet",
-			ctx: metadata.NewIncomingContext(
-				context.Background(),
-				metadata.Pairs("x-real-ip", "10.0.0.1"),
-			),
-			wantErr:  true,
-			wantCode: codes.Unauthenticated,
+			name:     "client not allowed",
+			ctx:      peerContext("agent-2"),
+			wantCode: codes.PermissionDenied,
 		},
 		{
-			name: "ip in subnet",
-			ctx: metadata.NewIncomingContext(
-				context.Background(),
-				metadata.Pairs("x-real-ip", "192.168.1.10"),
-			),
-			wantErr:    false,
-			wantCode:   codes.OK,
-			hitHandler: true,
+			name:     "client allowed",
+			ctx:      peerContext("agent-1"),
+			wantCode: codes.OK,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			hit := false
-			wrappedHandler := func(ctx context.Context, req any) (any, error) {
-				hit = true
-				return handler(ctx, req)
-			}
+			resp, err := interceptor(tt.ctx, nil, info, handler)
 
-			resp, err := interceptor(tt.ctx, nil, info, wrappedHandler)
-
-			if tt.wantErr {
-				if err == nil {
-					t.Fatalf("expected error, got nil, resp=%v", resp)
-				}
-				st, ok := status.FromError(err)
-				if !ok {
-					t.Fatalf("expected status error, got %T", err)
-				}
-				if st.Code() != tt.wantCode {
-					t.Fatalf("unexpected code: got %v want %v", st.Code(), tt.wantCode)
-				}
-				if hit {
-					t.Fatalf("handler should not be called on error")
-				}
-				return
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode == codes.OK {
+				assert.Equal(t, "ok", resp)
 			}
+		})
+	}
+}
 
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if resp != "ok" {
-				t.Fatalf("unexpected response: %v", resp)
-			}
-			if tt.hitHandler && !hit {
-				t.Fatalf("expected handler to be called")
-			}
-			if !tt.hitHandler && hit {
-				t.Fatalf("did not expect handler to be called")
-			}
+func TestPeerIdentity(t *testing.T) {
+	assert.Equal(t, "CN=agent-1,O=metrics", PeerIdentity(peerContext("agent-1")))
+	assert.Empty(t, PeerIdentity(context.Background()))
+}
+
+func TestVerifySignatureInterceptor(t *testing.T) {
+	key := []byte("secret")
+	v, err := signing.NewVerifier(key)
+	require.NoError(t, err)
+
+	interceptor := verifySignatureInterceptor(v, false)
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: pb.Metrics_UpdateMetrics_FullMethodName}
+
+	req := pb.UpdateMetricsRequest_builder{
+		Metrics: []*pb.Metric{
+			pb.Metric_builder{
+				Id:    proto.String("cpu"),
+				Type:  pb.Metric_MTYPE_GAUGE.Enum(),
+				Value: proto.Float64(1),
+			}.Build(),
+		},
+	}.Build()
+
+	signedContext := func(t *testing.T, method string, msg proto.Message) context.Context {
+		t.Helper()
+
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+		require.NoError(t, err)
+		sig, err := signing.NewSigner(key).Sign(http.MethodPost, method, body)
+		require.NoError(t, err)
+
+		return metadata.NewIncomingContext(
+			context.Background(),
+			metadata.New(sig.Headers()),
+		)
+	}
+
+	replayed := signedContext(t, info.FullMethod, req)
+	_, err = interceptor(replayed, req, info, handler)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		legacy   bool
+		wantCode codes.Code
+	}{
+		{
+			name:     "unsigned",
+			ctx:      context.Background(),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "unsigned legacy",
+			ctx:      context.Background(),
+			legacy:   true,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "signed",
+			ctx:      signedContext(t, info.FullMethod, req),
+			wantCode: codes.OK,
+		},
+		{
+			name:     "replayed",
+			ctx:      replayed,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "other method",
+			ctx:      signedContext(t, "/test.Service/Method", req),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "other method legacy",
+			ctx:      signedContext(t, "/test.Service/Method", req),
+			legacy:   true,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name: "other request",
+			ctx: signedContext(
+				t,
+				info.FullMethod,
+				pb.UpdateMetricsRequest_builder{}.Build(),
+			),
+			wantCode: codes.Unauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := verifySignatureInterceptor(v, tt.legacy)
+			_, err := interceptor(tt.ctx, req, info, handler)
+			assert.Equal(t, tt.wantCode, status.Code(err))
 		})
 	}
 }
@@ -5,6 +5,13 @@ import (
 	"fmt"
 	"log/slog"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
 	pb "github.com/fragpit/yandex-go-dev-metrics/internal/proto"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/repository"
@@ -12,47 +19,202 @@ import (
 
 type MetricsService struct {
 	pb.UnimplementedMetricsServer
-
-	repo repository.Repository
+	repo      repository.Repository
+	validator *model.Validator
+	auditor   *audit.Auditor
 }
 
+// UpdateMetrics applies a batch of metrics and reports the outcome of every
+// metric. A rejected atomic batch is returned as an error status carrying
+// the per-metric details instead.
 func (m *MetricsService) UpdateMetrics(
 	ctx context.Context,
 	in *pb.UpdateMetricsRequest,
 ) (*pb.UpdateMetricsResponse, error) {
-	pbMetrics := in.GetMetrics()
+	mode := batchModeFromProto(in.GetMode())
+	metrics := metricsFromProto(in.GetMetrics())
 
-	metrics := make([]model.Metric, 0, len(pbMetrics))
-	for _, m := range pbMetrics {
-		var metric model.Metric
+	if err := authorizeMetrics(ctx, metrics); err != nil {
+		return nil, err
+	}
+
+	res, err := repository.ApplyBatch(
+		ctx,
+		m.repo,
+		m.validator,
+		metrics,
+		mode,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update metrics: %w", err)
+	}
+
+	outcome := audit.OutcomeSuccess
+	if res.Rejected > 0 {
+		outcome = audit.OutcomePartial
+	}
+	auditUpdate(ctx, m.auditor, res, outcome)
+
+	if res.Rejected > 0 {
+		slog.Error(
+			"metrics rejected in batch",
+			slog.String("mode", string(mode)),
+			slog.Int("applied", res.Applied),
+			slog.Int("rejected", res.Rejected),
+		)
+
+		if mode == model.BatchAtomic {
+			return nil, rejectionStatus(res)
+		}
+	}
+
+	slog.Info("metrics updated", "count", res.Applied)
+	return batchResultToProto(res), nil
+}
+
+func batchModeFromProto(mode pb.UpdateMetricsRequest_BatchMode) model.BatchMode {
+	if mode == pb.UpdateMetricsRequest_BATCH_MODE_BEST_EFFORT {
+		return model.BatchBestEffort
+	}
+
+	return model.BatchAtomic
+}
+
+// metricsFromProto converts protobuf metrics to their JSON form, keeping the
+// presence of the delta and value fields so they can be validated.
+func metricsFromProto(in []*pb.Metric) []*model.Metrics {
+	out := make([]*model.Metrics, 0, len(in))
+	for _, m := range in {
+		jm := &model.Metrics{ID: m.GetId()}
 
 		switch m.GetType() {
 		case pb.Metric_MTYPE_COUNTER:
-			metric = &model.CounterMetric{
-				ID:    m.GetId(),
-				Value: int64(m.GetDelta()),
-			}
+			jm.MType = string(model.CounterType)
 		case pb.Metric_MTYPE_GAUGE:
-			metric = &model.GaugeMetric{
-				ID:    m.GetId(),
-				Value: float64(m.GetValue()),
-			}
+			jm.MType = string(model.GaugeType)
 		default:
-			return nil, fmt.Errorf(
-				"unknown metric type %s for %s",
-				m.GetType(),
-				m.GetId(),
+			jm.MType = m.GetType().String()
+		}
+
+		if m.HasDelta() {
+			delta := m.GetDelta()
+			jm.Delta = &delta
+		}
+
+		if m.HasValue() {
+			value := m.GetValue()
+			jm.Value = &value
+		}
+
+		out = append(out, jm)
+	}
+
+	return out
+}
+
+// rejectionStatus converts a rejected atomic batch to an error status.
+// Invalid metrics produce InvalidArgument with a BadRequest detail, type
+// conflicts produce FailedPrecondition with a PreconditionFailure detail.
+func rejectionStatus(res *model.BatchResult) error {
+	br := &errdetails.BadRequest{}
+	pf := &errdetails.PreconditionFailure{}
+	for _, it := range res.Results {
+		subject := fmt.Sprintf("metrics[%d]", it.Index)
+
+		switch it.Status {
+		case model.BatchItemInvalid:
+			field := subject
+			if it.Field != "" {
+				field += "." + it.Field
+			}
+
+			br.FieldViolations = append(
+				br.FieldViolations,
+				&errdetails.BadRequest_FieldViolation{
+					Field:       field,
+					Description: it.Reason,
+				},
+			)
+		case model.BatchItemTypeConflict:
+			pf.Violations = append(
+				pf.Violations,
+				&errdetails.PreconditionFailure_Violation{
+					Type:        "TYPE_CONFLICT",
+					Subject:     subject,
+					Description: it.Reason,
+				},
 			)
 		}
+	}
 
-		metrics = append(metrics, metric)
+	st := status.New(codes.FailedPrecondition, "batch aborted")
+	var detail protoadapt.MessageV1 = pf
+	if len(br.FieldViolations) > 0 {
+		st = status.New(codes.InvalidArgument, "validation failed")
+		detail = br
 	}
 
-	if err := m.repo.SetOrUpdateMetricBatch(ctx, metrics); err != nil {
-		return nil, fmt.Errorf("failed to update metrics: %w", err)
+	detailed, err := st.WithDetails(detail)
+	if err != nil {
+		return st.Err()
 	}
 
-	slog.Info("metrics updated", "count", len(metrics))
+	return detailed.Err()
+}
+
+// batchResultToProto converts a batch result to the gRPC response.
+func batchResultToProto(res *model.BatchResult) *pb.UpdateMetricsResponse {
+	results := make([]*pb.MetricResult, 0, len(res.Results))
+	for _, it := range res.Results {
+		results = append(results, pb.MetricResult_builder{
+			Index:  proto.Uint32(uint32(it.Index)),
+			Status: itemStatusToProto(it.Status).Enum(),
+			Metric: metricToProto(it.Metrics),
+			Field:  proto.String(it.Field),
+			Reason: proto.String(it.Reason),
+		}.Build())
+	}
+
+	return pb.UpdateMetricsResponse_builder{
+		Results:  results,
+		Applied:  proto.Uint32(uint32(res.Applied)),
+		Rejected: proto.Uint32(uint32(res.Rejected)),
+	}.Build()
+}
+
+func itemStatusToProto(s model.BatchItemStatus) pb.MetricResult_Status {
+	switch s {
+	case model.BatchItemApplied:
+		return pb.MetricResult_STATUS_APPLIED
+	case model.BatchItemInvalid:
+		return pb.MetricResult_STATUS_INVALID
+	case model.BatchItemTypeConflict:
+		return pb.MetricResult_STATUS_TYPE_CONFLICT
+	case model.BatchItemSkipped:
+		return pb.MetricResult_STATUS_SKIPPED
+	default:
+		return pb.MetricResult_STATUS_UNSPECIFIED
+	}
+}
+
+// metricToProto converts a metric from its JSON form to protobuf.
+func metricToProto(m *model.Metrics) *pb.Metric {
+	if m == nil {
+		return nil
+	}
+
+	mtype := pb.Metric_MTYPE_UNSPECIFIED
+	switch model.MetricType(m.MType) {
+	case model.CounterType:
+		mtype = pb.Metric_MTYPE_COUNTER
+	case model.GaugeType:
+		mtype = pb.Metric_MTYPE_GAUGE
+	}
 
-	return &pb.UpdateMetricsResponse{}, nil
+	return pb.Metric_builder{
+		Id:    proto.String(m.ID),
+		Type:  mtype.Enum(),
+		Delta: m.Delta,
+		Value: m.Value,
+	}.Build()
 }
@@ -0,0 +1,171 @@
+package grpcapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	pb "github.com/fragpit/yandex-go-dev-metrics/internal/proto"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+func TestMetricsService_UpdateMetrics(t *testing.T) {
+	counter := pb.Metric_MTYPE_COUNTER
+	gauge := pb.Metric_MTYPE_GAUGE
+
+	bestEffort := pb.UpdateMetricsRequest_BATCH_MODE_BEST_EFFORT
+
+	tests := []struct {
+		name           string
+		strict         bool
+		mode           *pb.UpdateMetricsRequest_BatchMode
+		metrics        []*pb.Metric
+		wantCode       codes.Code
+		wantStatus     []pb.MetricResult_Status
+		wantViolations []string
+	}{
+		{
+			name:   "valid batch",
+			strict: true,
+			metrics: []*pb.Metric{
+				pb.Metric_builder{
+					Id:    proto.String("c"),
+					Type:  &counter,
+					Delta: proto.Int64(1),
+				}.Build(),
+				pb.Metric_builder{
+					Id:    proto.String("g"),
+					Type:  &gauge,
+					Value: proto.Float64(1.5),
+				}.Build(),
+			},
+			wantCode: codes.OK,
+			wantStatus: []pb.MetricResult_Status{
+				pb.MetricResult_STATUS_APPLIED,
+				pb.MetricResult_STATUS_APPLIED,
+			},
+		},
+		{
+			name:   "missing value accepted in lenient mode",
+			strict: false,
+			metrics: []*pb.Metric{
+				pb.Metric_builder{Id: proto.String("g"), Type: &gauge}.Build(),
+			},
+			wantCode:   codes.OK,
+			wantStatus: []pb.MetricResult_Status{pb.MetricResult_STATUS_APPLIED},
+		},
+		{
+			name:   "per item violations in strict mode",
+			strict: true,
+			metrics: []*pb.Metric{
+				pb.Metric_builder{
+					Id:    proto.String("c"),
+					Type:  &counter,
+					Delta: proto.Int64(1),
+				}.Build(),
+				pb.Metric_builder{Id: proto.String("g"), Type: &gauge}.Build(),
+				pb.Metric_builder{
+					Id:    proto.String(""),
+					Type:  &counter,
+					Delta: proto.Int64(1),
+				}.Build(),
+			},
+			wantCode:       codes.InvalidArgument,
+			wantViolations: []string{"metrics[1].value", "metrics[2].id"},
+		},
+		{
+			name:   "per item results in best effort mode",
+			strict: true,
+			mode:   &bestEffort,
+			metrics: []*pb.Metric{
+				pb.Metric_builder{
+					Id:    proto.String("c"),
+					Type:  &counter,
+					Delta: proto.Int64(1),
+				}.Build(),
+				pb.Metric_builder{Id: proto.String("g"), Type: &gauge}.Build(),
+			},
+			wantCode: codes.OK,
+			wantStatus: []pb.MetricResult_Status{
+				pb.MetricResult_STATUS_APPLIED,
+				pb.MetricResult_STATUS_INVALID,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := memstorage.NewMemoryStorage()
+			svc := &MetricsService{
+				repo:      repo,
+				validator: model.NewValidator(tt.strict),
+			}
+
+			req := pb.UpdateMetricsRequest_builder{
+				Metrics: tt.metrics,
+				Mode:    tt.mode,
+			}.Build()
+			resp, err := svc.UpdateMetrics(context.Background(), req)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+
+			if tt.wantCode == codes.OK {
+				var statuses []pb.MetricResult_Status
+				for _, r := range resp.GetResults() {
+					statuses = append(statuses, r.GetStatus())
+				}
+				assert.Equal(t, tt.wantStatus, statuses)
+				assert.Equal(t, int(resp.GetApplied()), repo.Len())
+				return
+			}
+
+			assert.Zero(t, repo.Len())
+
+			st, _ := status.FromError(err)
+			require.Len(t, st.Details(), 1)
+			br, ok := st.Details()[0].(*errdetails.BadRequest)
+			require.True(t, ok)
+
+			var fields []string
+			for _, v := range br.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+			}
+			assert.Equal(t, tt.wantViolations, fields)
+		})
+	}
+}
+
+func TestMetricsService_UpdateMetrics_TypeConflict(t *testing.T) {
+	repo := memstorage.NewMemoryStorage()
+	require.NoError(t, repo.Initialize([]model.Metric{model.NewGauge("m", 1)}))
+
+	svc := &MetricsService{repo: repo, validator: model.NewValidator(false)}
+
+	counter := pb.Metric_MTYPE_COUNTER
+	req := pb.UpdateMetricsRequest_builder{
+		Metrics: []*pb.Metric{
+			pb.Metric_builder{
+				Id:    proto.String("m"),
+				Type:  &counter,
+				Delta: proto.Int64(1),
+			}.Build(),
+		},
+	}.Build()
+
+	_, err := svc.UpdateMetrics(context.Background(), req)
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	st, _ := status.FromError(err)
+	require.Len(t, st.Details(), 1)
+	pf, ok := st.Details()[0].(*errdetails.PreconditionFailure)
+	require.True(t, ok)
+	require.Len(t, pf.GetViolations(), 1)
+	assert.Equal(t, "TYPE_CONFLICT", pf.GetViolations()[0].GetType())
+	assert.Equal(t, "metrics[0]", pf.GetViolations()[0].GetSubject())
+}
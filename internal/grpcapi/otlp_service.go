@@ -0,0 +1,75 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/repository"
+)
+
+// OTLPService implements the OTLP/gRPC metrics service.
+type OTLPService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	repo      repository.Repository
+	validator *model.Validator
+	otlp      *ingest.OTLP
+	auditor   *audit.Auditor
+}
+
+// Export applies an OTLP metrics export in best-effort mode. Data points
+// that cannot be converted or stored are reported in the partial success of
+// the response.
+func (s *OTLPService) Export(
+	ctx context.Context,
+	in *colmetricspb.ExportMetricsServiceRequest,
+) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	metrics, commit, rejected, convErr := s.otlp.Metrics(in.GetResourceMetrics())
+	if err := authorizeMetrics(ctx, metrics); err != nil {
+		commit.Apply(nil)
+		return nil, err
+	}
+
+	var res *model.BatchResult
+	if len(metrics) > 0 {
+		var err error
+		res, err = repository.ApplyBatch(
+			ctx,
+			s.repo,
+			s.validator,
+			metrics,
+			model.BatchBestEffort,
+		)
+		if err != nil {
+			commit.Apply(nil)
+			return nil, fmt.Errorf("failed to update metrics: %w", err)
+		}
+		commit.Apply(res)
+	}
+
+	partial := ingest.PartialSuccess(rejected, convErr, res)
+	if res != nil {
+		outcome := audit.OutcomeSuccess
+		if partial != nil {
+			outcome = audit.OutcomePartial
+		}
+		auditUpdate(ctx, s.auditor, res, outcome)
+	}
+
+	out := &colmetricspb.ExportMetricsServiceResponse{}
+	if partial != nil {
+		slog.Warn(
+			"otlp data points rejected",
+			slog.Int64("rejected", partial.GetRejectedDataPoints()),
+			slog.String("error", partial.GetErrorMessage()),
+		)
+		out.PartialSuccess = partial
+	}
+
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package grpcapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+func cumulativeSum(name string, v int64) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+				Name: name,
+				Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					IsMonotonic:            true,
+					DataPoints: []*metricspb.NumberDataPoint{{
+						StartTimeUnixNano: 1,
+						Value:             &metricspb.NumberDataPoint_AsInt{AsInt: v},
+					}},
+				}},
+			}}}},
+		}},
+	}
+}
+
+func TestOTLPService_Export(t *testing.T) {
+	repo := memstorage.NewMemoryStorage()
+	require.NoError(t, repo.Initialize([]model.Metric{model.NewGauge("g", 1)}))
+
+	otlp, err := ingest.NewOTLP()
+	require.NoError(t, err)
+
+	svc := &OTLPService{
+		repo:      repo,
+		validator: model.NewValidator(false),
+		otlp:      otlp,
+	}
+
+	tests := []struct {
+		name         string
+		req          *colmetricspb.ExportMetricsServiceRequest
+		wantRejected int64
+		wantID       string
+		wantValue    string
+	}{
+		{
+			name:      "first cumulative point",
+			req:       cumulativeSum("c", 10),
+			wantID:    "c",
+			wantValue: "10",
+		},
+		{
+			name:      "next cumulative point adds the increase",
+			req:       cumulativeSum("c", 25),
+			wantID:    "c",
+			wantValue: "25",
+		},
+		{
+			name:         "type conflict is a partial success",
+			req:          cumulativeSum("g", 1),
+			wantRejected: 1,
+			wantID:       "g",
+			wantValue:    "1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := svc.Export(context.Background(), tt.req)
+			require.NoError(t, err)
+			assert.Equal(
+				t,
+				tt.wantRejected,
+				resp.GetPartialSuccess().GetRejectedDataPoints(),
+			)
+
+			m, err := repo.GetMetric(context.Background(), tt.wantID)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantValue, m.GetValue())
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package ingest
+
+import (
+	"sync"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+// Commit settles the series state of a conversion once its updates are
+// stored. The mappings that keep state between requests advance it while
+// converting, so that concurrent requests build on each other, and give the
+// updates that were not stored back to their series: a request that failed
+// or was rejected converts to the same updates when sent again.
+type Commit struct {
+	mu *sync.Mutex
+	// rollbacks give back the update of every metric to its series, nil
+	// for the updates without state.
+	rollbacks []func()
+}
+
+// Apply gives back the updates that were not applied in res, all of them
+// when res is nil as nothing was stored.
+func (c *Commit) Apply(res *model.BatchResult) {
+	if c == nil {
+		return
+	}
+
+	applied := make([]bool, len(c.rollbacks))
+	if res != nil {
+		for _, it := range res.Results {
+			if it.Applied() && it.Index >= 0 && it.Index < len(applied) {
+				applied[it.Index] = true
+			}
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, rollback := range c.rollbacks {
+		if !applied[i] && rollback != nil {
+			rollback()
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+var (
+	ErrInvalidGraphiteLine = errors.New("invalid graphite line")
+	ErrInvalidRule         = errors.New("invalid graphite rule")
+)
+
+// Sample is a Graphite data point. Tags are set for tagged series such as
+// cpu.load;host=web1.
+type Sample struct {
+	Path  string
+	Tags  []Tag
+	Value float64
+	// Time is zero when the sender asked for the receive time.
+	Time time.Time
+}
+
+// ParseGraphiteLine parses a plaintext protocol line: path value [timestamp].
+// A timestamp of -1, or none, stands for the receive time.
+func ParseGraphiteLine(line string) (Sample, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return Sample{}, fmt.Errorf("%w: %q", ErrInvalidGraphiteLine, line)
+	}
+
+	s, err := parseGraphitePath(fields[0])
+	if err != nil {
+		return Sample{}, err
+	}
+
+	v, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return Sample{}, fmt.Errorf(
+			"%w: invalid value %q",
+			ErrInvalidGraphiteLine,
+			fields[1],
+		)
+	}
+	s.Value = v
+
+	if len(fields) == 3 {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return Sample{}, fmt.Errorf(
+				"%w: invalid timestamp %q",
+				ErrInvalidGraphiteLine,
+				fields[2],
+			)
+		}
+		s.Time = graphiteTime(ts)
+	}
+
+	return s, nil
+}
+
+// parseGraphitePath splits a series name into the path and its tags.
+func parseGraphitePath(p string) (Sample, error) {
+	name, rest, tagged := strings.Cut(p, ";")
+	if name == "" || strings.Contains(name, "..") {
+		return Sample{}, fmt.Errorf("%w: invalid path %q", ErrInvalidGraphiteLine, p)
+	}
+
+	s := Sample{Path: name}
+	if !tagged {
+		return s, nil
+	}
+
+	for _, kv := range strings.Split(rest, ";") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" || v == "" {
+			return Sample{}, fmt.Errorf("%w: invalid tag %q", ErrInvalidGraphiteLine, kv)
+		}
+		s.Tags = append(s.Tags, Tag{Key: k, Value: v})
+	}
+
+	return s, nil
+}
+
+func graphiteTime(ts float64) time.Time {
+	if ts < 0 {
+		return time.Time{}
+	}
+
+	sec, frac := math.Modf(ts)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
+
+// GraphiteRule maps the paths matching a pattern to a metric type. Pattern
+// segments are matched one to one against the dotted path segments and may
+// use the wildcards of path.Match, as in stats_counts.*.requests.
+type GraphiteRule struct {
+	segments []string
+	Type     model.MetricType
+}
+
+// ParseGraphiteRule parses a rule in the form pattern=type.
+func ParseGraphiteRule(s string) (GraphiteRule, error) {
+	pattern, t, ok := strings.Cut(s, "=")
+	if !ok || pattern == "" || !model.ValidateType(t) {
+		return GraphiteRule{}, fmt.Errorf("%w: %q", ErrInvalidRule, s)
+	}
+
+	segments := strings.Split(pattern, ".")
+	for _, seg := range segments {
+		if _, err := path.Match(seg, ""); err != nil {
+			return GraphiteRule{}, fmt.Errorf("%w: %q: %w", ErrInvalidRule, s, err)
+		}
+	}
+
+	return GraphiteRule{segments: segments, Type: model.MetricType(t)}, nil
+}
+
+// Match reports whether the dotted path matches the rule pattern.
+func (r GraphiteRule) Match(p string) bool {
+	segments := strings.Split(p, ".")
+	if len(segments) != len(r.segments) {
+		return false
+	}
+
+	for i, seg := range segments {
+		if ok, _ := path.Match(r.segments[i], seg); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Graphite maps Graphite samples to metric updates.
+//
+// The type of a path is taken from the first matching rule, gauge if none
+// matches. Counter samples carry the delta since the previous sample, as
+// the per-interval counts statsd flushes do. Tags of tagged series are
+// folded into the name like TagsIdentity does.
+type Graphite struct {
+	rules []GraphiteRule
+}
+
+// GraphiteOption configures a Graphite mapping.
+type GraphiteOption func(*Graphite) error
+
+// WithGraphiteRules sets the path to type rules, each in the form
+// pattern=type.
+func WithGraphiteRules(rules []string) GraphiteOption {
+	return func(g *Graphite) error {
+		for _, s := range rules {
+			r, err := ParseGraphiteRule(s)
+			if err != nil {
+				return err
+			}
+			g.rules = append(g.rules, r)
+		}
+		return nil
+	}
+}
+
+// NewGraphite creates a new Graphite mapping.
+func NewGraphite(opts ...GraphiteOption) (*Graphite, error) {
+	g := &Graphite{}
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+// TypeOf returns the metric type of a path.
+func (g *Graphite) TypeOf(p string) model.MetricType {
+	for _, r := range g.rules {
+		if r.Match(p) {
+			return r.Type
+		}
+	}
+
+	return model.GaugeType
+}
+
+// Metric converts a sample to a metric update.
+func (g *Graphite) Metric(s Sample) (*model.Metrics, error) {
+	id := MetricName(s.Path, s.Tags, TagsIdentity)
+
+	t := g.TypeOf(s.Path)
+	if t == model.GaugeType {
+		v := s.Value
+		return &model.Metrics{ID: id, MType: string(t), Value: &v}, nil
+	}
+
+	if s.Value != math.Trunc(s.Value) || math.Abs(s.Value) >= math.MaxInt64 {
+		return nil, fmt.Errorf(
+			"%w: %s: counter value %v is not an integer",
+			ErrInvalidFieldType,
+			s.Path,
+			s.Value,
+		)
+	}
+	delta := int64(s.Value)
+
+	return &model.Metrics{ID: id, MType: string(t), Delta: &delta}, nil
+}
@@ -0,0 +1,139 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+func TestParseGraphiteLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Sample
+		wantErr bool
+	}{
+		{
+			name: "plain",
+			in:   "servers.web1.cpu 12.5 1700000000",
+			want: Sample{Path: "servers.web1.cpu", Value: 12.5, Time: time.Unix(1700000000, 0)},
+		},
+		{
+			name: "receive time",
+			in:   "servers.web1.cpu 1 -1",
+			want: Sample{Path: "servers.web1.cpu", Value: 1},
+		},
+		{
+			name: "no timestamp",
+			in:   "a.b 3",
+			want: Sample{Path: "a.b", Value: 3},
+		},
+		{
+			name: "tagged",
+			in:   "disk.used;host=web1;mount=/ 10 1700000000",
+			want: Sample{
+				Path:  "disk.used",
+				Tags:  []Tag{{Key: "host", Value: "web1"}, {Key: "mount", Value: "/"}},
+				Value: 10,
+				Time:  time.Unix(1700000000, 0),
+			},
+		},
+		{name: "missing value", in: "a.b", wantErr: true},
+		{name: "too many fields", in: "a.b 1 2 3", wantErr: true},
+		{name: "bad value", in: "a.b x 1", wantErr: true},
+		{name: "not finite", in: "a.b +Inf 1", wantErr: true},
+		{name: "bad timestamp", in: "a.b 1 now", wantErr: true},
+		{name: "empty segment", in: "a..b 1 1", wantErr: true},
+		{name: "bad tag", in: "a.b;host 1 1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGraphiteLine(tt.in)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidGraphiteLine)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseGraphiteRule(t *testing.T) {
+	for _, in := range []string{"a.*", "a.*=histogram", "=counter", "a.[=counter"} {
+		_, err := ParseGraphiteRule(in)
+		assert.ErrorIs(t, err, ErrInvalidRule, in)
+	}
+
+	r, err := ParseGraphiteRule("stats_counts.*.requests=counter")
+	require.NoError(t, err)
+	assert.Equal(t, model.CounterType, r.Type)
+	assert.True(t, r.Match("stats_counts.web.requests"))
+	assert.False(t, r.Match("stats_counts.requests"))
+	assert.False(t, r.Match("stats_counts.web.api.requests"))
+	assert.False(t, r.Match("stats.web.requests"))
+}
+
+func TestGraphite_Metric(t *testing.T) {
+	g, err := NewGraphite(WithGraphiteRules([]string{
+		"stats_counts.*=counter",
+		"stats_counts.timers=gauge",
+	}))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		in      Sample
+		want    *model.Metrics
+		wantErr bool
+	}{
+		{
+			name: "gauge by default",
+			in:   Sample{Path: "servers.web1.cpu", Value: 1.5},
+			want: &model.Metrics{ID: "servers.web1.cpu", MType: "gauge", Value: float64Ptr(1.5)},
+		},
+		{
+			name: "counter by rule",
+			in:   Sample{Path: "stats_counts.requests", Value: 4},
+			want: &model.Metrics{ID: "stats_counts.requests", MType: "counter", Delta: int64Ptr(4)},
+		},
+		{
+			name: "first rule wins",
+			in:   Sample{Path: "stats_counts.timers", Value: 4},
+			want: &model.Metrics{ID: "stats_counts.timers", MType: "counter", Delta: int64Ptr(4)},
+		},
+		{
+			name: "tags folded",
+			in: Sample{
+				Path:  "disk.used",
+				Tags:  []Tag{{Key: "mount", Value: "/"}, {Key: "host", Value: "web1"}},
+				Value: 10,
+			},
+			want: &model.Metrics{ID: "disk.used.host:web1.mount:_", MType: "gauge", Value: float64Ptr(10)},
+		},
+		{
+			name:    "fractional counter",
+			in:      Sample{Path: "stats_counts.requests", Value: 0.5},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.Metric(tt.in)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidFieldType)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
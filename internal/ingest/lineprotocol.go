@@ -0,0 +1,369 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+var (
+	ErrInvalidLine      = errors.New("invalid line protocol")
+	ErrInvalidPrecision = errors.New("invalid precision")
+	ErrInvalidFieldType = errors.New("invalid field type")
+)
+
+// ParsePrecision parses the timestamp precision of a write request. Both the
+// InfluxDB 1.x (n, u, ms, s, m, h) and 2.x (ns, us, ms, s) spellings are
+// accepted, an empty string selects nanoseconds.
+func ParsePrecision(s string) (time.Duration, error) {
+	switch s {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us", "µ", "µs":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrInvalidPrecision, s)
+	}
+}
+
+// Field is a field of a point. Value holds a float64, int64, uint64, string
+// or bool.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// Point is a parsed line of line protocol.
+type Point struct {
+	Measurement string
+	Tags        []Tag
+	Fields      []Field
+	// Time is zero when the line carries no timestamp.
+	Time time.Time
+}
+
+// ParseLines parses line protocol. Empty lines and comments are skipped, the
+// first malformed line fails the whole input.
+func ParseLines(data []byte, precision time.Duration) ([]Point, error) {
+	var points []Point
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := parseLine(line, precision)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w: %w", n, ErrInvalidLine, err)
+		}
+		points = append(points, p)
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
+
+// parseLine parses a single line: measurement[,tags] fields [timestamp].
+func parseLine(line string, precision time.Duration) (Point, error) {
+	var p Point
+
+	name, i := scanToken(line, 0, ", ")
+	if name == "" {
+		return p, errors.New("missing measurement")
+	}
+	p.Measurement = name
+
+	for i < len(line) && line[i] == ',' {
+		var key, value string
+		key, i = scanToken(line, i+1, "=, ")
+		if i >= len(line) || line[i] != '=' || key == "" {
+			return p, errors.New("malformed tag")
+		}
+
+		value, i = scanToken(line, i+1, ", ")
+		if value == "" {
+			return p, fmt.Errorf("tag %q has no value", key)
+		}
+		p.Tags = append(p.Tags, Tag{Key: key, Value: value})
+	}
+
+	if i >= len(line) || line[i] != ' ' {
+		return p, errors.New("missing fields")
+	}
+	i = skipSpaces(line, i)
+
+	for {
+		var key string
+		key, i = scanToken(line, i, "=, ")
+		if i >= len(line) || line[i] != '=' || key == "" {
+			return p, errors.New("malformed field")
+		}
+
+		value, next, err := scanFieldValue(line, i+1)
+		if err != nil {
+			return p, fmt.Errorf("field %q: %w", key, err)
+		}
+		p.Fields = append(p.Fields, Field{Key: key, Value: value})
+
+		i = next
+		if i >= len(line) || line[i] != ',' {
+			break
+		}
+		i++
+	}
+
+	i = skipSpaces(line, i)
+	if i < len(line) {
+		ts, err := strconv.ParseInt(line[i:], 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid timestamp %q", line[i:])
+		}
+		p.Time = time.Unix(0, ts*int64(precision))
+	}
+
+	return p, nil
+}
+
+// scanToken reads an unescaped token starting at i up to one of stops. A
+// backslash escapes commas, equal signs, spaces and itself.
+func scanToken(s string, i int, stops string) (string, int) {
+	var sb strings.Builder
+	for i < len(s) {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) && strings.IndexByte(`,= \`, s[i+1]) >= 0 {
+			sb.WriteByte(s[i+1])
+			i += 2
+			continue
+		}
+		if strings.IndexByte(stops, c) >= 0 {
+			break
+		}
+		sb.WriteByte(c)
+		i++
+	}
+
+	return sb.String(), i
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+
+	return i
+}
+
+// scanFieldValue reads a field value starting at i and returns it typed by
+// its suffix: 1i is an integer, 1u an unsigned integer, "a" a string, t or
+// false a boolean and anything else a float.
+func scanFieldValue(s string, i int) (any, int, error) {
+	if i < len(s) && s[i] == '"' {
+		var sb strings.Builder
+		for i++; i < len(s); i++ {
+			c := s[i]
+			switch {
+			case c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\'):
+				sb.WriteByte(s[i+1])
+				i++
+			case c == '"':
+				return sb.String(), i + 1, nil
+			default:
+				sb.WriteByte(c)
+			}
+		}
+
+		return nil, i, errors.New("unterminated string")
+	}
+
+	start := i
+	for i < len(s) && s[i] != ',' && s[i] != ' ' {
+		i++
+	}
+	raw := s[start:i]
+
+	switch raw {
+	case "":
+		return nil, i, errors.New("missing value")
+	case "t", "T", "true", "True", "TRUE":
+		return true, i, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, i, nil
+	}
+
+	switch raw[len(raw)-1] {
+	case 'i':
+		v, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return nil, i, fmt.Errorf("invalid integer %q", raw)
+		}
+		return v, i, nil
+	case 'u':
+		v, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return nil, i, fmt.Errorf("invalid unsigned integer %q", raw)
+		}
+		return v, i, nil
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+		return nil, i, fmt.Errorf("invalid float %q", raw)
+	}
+
+	return v, i, nil
+}
+
+// LineProtocol maps line protocol points to metric updates.
+//
+// A field becomes the metric measurement_field, or just measurement for a
+// field named value, qualified by the tags according to the tag mode.
+// Integer fields are counters carrying a delta, float and boolean fields are
+// gauges, string fields are skipped. The type mapping overrides the type by
+// field key or by measurement_field.
+type LineProtocol struct {
+	tags  TagMode
+	types map[string]model.MetricType
+}
+
+// LineOption configures a LineProtocol.
+type LineOption func(*LineProtocol) error
+
+// WithTagMode sets how tags are folded into metric names.
+func WithTagMode(mode string) LineOption {
+	return func(lp *LineProtocol) error {
+		m, err := ParseTagMode(mode)
+		if err != nil {
+			return err
+		}
+		lp.tags = m
+		return nil
+	}
+}
+
+// WithFieldTypes sets the metric type of fields by field key or by
+// measurement_field.
+func WithFieldTypes(types map[string]string) LineOption {
+	return func(lp *LineProtocol) error {
+		for k, t := range types {
+			if !model.ValidateType(t) {
+				return fmt.Errorf("%w: %q for %q", ErrInvalidFieldType, t, k)
+			}
+			lp.types[k] = model.MetricType(t)
+		}
+		return nil
+	}
+}
+
+// NewLineProtocol creates a new LineProtocol.
+func NewLineProtocol(opts ...LineOption) (*LineProtocol, error) {
+	lp := &LineProtocol{
+		tags:  TagsIdentity,
+		types: make(map[string]model.MetricType),
+	}
+
+	for _, opt := range opts {
+		if err := opt(lp); err != nil {
+			return nil, err
+		}
+	}
+
+	return lp, nil
+}
+
+// Metrics converts points to metric updates in input order.
+func (lp *LineProtocol) Metrics(points []Point) ([]*model.Metrics, error) {
+	var metrics []*model.Metrics
+	for _, p := range points {
+		for _, f := range p.Fields {
+			base := p.Measurement + "_" + f.Key
+			if f.Key == "value" {
+				base = p.Measurement
+			}
+
+			m, err := lp.metric(MetricName(base, p.Tags, lp.tags), base, f)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", base, err)
+			}
+			if m != nil {
+				metrics = append(metrics, m)
+			}
+		}
+	}
+
+	return metrics, nil
+}
+
+func (lp *LineProtocol) metric(id, base string, f Field) (*model.Metrics, error) {
+	var (
+		value   float64
+		delta   int64
+		integer bool
+	)
+	switch v := f.Value.(type) {
+	case string:
+		return nil, nil
+	case bool:
+		if v {
+			value = 1
+		}
+	case float64:
+		value = v
+	case int64:
+		value, delta, integer = float64(v), v, true
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: %d overflows a counter", ErrInvalidFieldType, v)
+		}
+		value, delta, integer = float64(v), int64(v), true
+	}
+
+	t, ok := lp.types[f.Key]
+	if !ok {
+		t, ok = lp.types[base]
+	}
+	if !ok {
+		t = model.GaugeType
+		if integer {
+			t = model.CounterType
+		}
+	}
+
+	if t == model.GaugeType {
+		return &model.Metrics{ID: id, MType: string(t), Value: &value}, nil
+	}
+
+	if !integer {
+		if value != math.Trunc(value) || math.Abs(value) >= math.MaxInt64 {
+			return nil, fmt.Errorf(
+				"%w: counter value %v is not an integer",
+				ErrInvalidFieldType,
+				value,
+			)
+		}
+		delta = int64(value)
+	}
+
+	return &model.Metrics{ID: id, MType: string(t), Delta: &delta}, nil
+}
@@ -0,0 +1,191 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+func TestParsePrecision(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "", want: time.Nanosecond},
+		{in: "ns", want: time.Nanosecond},
+		{in: "u", want: time.Microsecond},
+		{in: "us", want: time.Microsecond},
+		{in: "ms", want: time.Millisecond},
+		{in: "s", want: time.Second},
+		{in: "h", want: time.Hour},
+		{in: "d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePrecision(tt.in)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidPrecision)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		precision time.Duration
+		want      []Point
+		wantErr   bool
+	}{
+		{
+			name: "full line",
+			in:   `cpu,host=web1,cpu=cpu0 usage_idle=98.5,procs=12i,total=7u,up=t,state="ok" 1700000000`,
+			want: []Point{{
+				Measurement: "cpu",
+				Tags:        []Tag{{Key: "host", Value: "web1"}, {Key: "cpu", Value: "cpu0"}},
+				Fields: []Field{
+					{Key: "usage_idle", Value: 98.5},
+					{Key: "procs", Value: int64(12)},
+					{Key: "total", Value: uint64(7)},
+					{Key: "up", Value: true},
+					{Key: "state", Value: "ok"},
+				},
+				Time: time.Unix(1700000000, 0),
+			}},
+			precision: time.Second,
+		},
+		{
+			name: "escapes comments and blank lines",
+			in: "# comment\n\n" +
+				`disk\ io,path=/mnt\,a free=1,msg="say \"hi\", bye"` + "\n" +
+				"mem value=-2.5e3\r\n",
+			want: []Point{
+				{
+					Measurement: "disk io",
+					Tags:        []Tag{{Key: "path", Value: "/mnt,a"}},
+					Fields: []Field{
+						{Key: "free", Value: 1.0},
+						{Key: "msg", Value: `say "hi", bye`},
+					},
+				},
+				{
+					Measurement: "mem",
+					Fields:      []Field{{Key: "value", Value: -2500.0}},
+				},
+			},
+			precision: time.Nanosecond,
+		},
+		{name: "no fields", in: "cpu,host=a", wantErr: true},
+		{name: "empty field value", in: "cpu usage=", wantErr: true},
+		{name: "bad integer", in: "cpu usage=1.5i", wantErr: true},
+		{name: "not finite", in: "cpu usage=NaN", wantErr: true},
+		{name: "unterminated string", in: `cpu msg="oops`, wantErr: true},
+		{name: "bad timestamp", in: "cpu usage=1 soon", wantErr: true},
+		{name: "tag without value", in: "cpu,host= usage=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLines([]byte(tt.in), tt.precision)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidLine)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLineProtocol_Metrics(t *testing.T) {
+	points, err := ParseLines([]byte(
+		"net,host=a bytes_recv=100i,drop_rate=0.5,up=true,name=\"eth0\"\n"+
+			"temp value=21.5\n"+
+			"req count=3",
+	), time.Nanosecond)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		opts    []LineOption
+		want    []*model.Metrics
+		wantErr error
+	}{
+		{
+			name: "by field type",
+			want: []*model.Metrics{
+				{ID: "net_bytes_recv.host:a", MType: "counter", Delta: int64Ptr(100)},
+				{ID: "net_drop_rate.host:a", MType: "gauge", Value: float64Ptr(0.5)},
+				{ID: "net_up.host:a", MType: "gauge", Value: float64Ptr(1)},
+				{ID: "temp", MType: "gauge", Value: float64Ptr(21.5)},
+				{ID: "req_count", MType: "gauge", Value: float64Ptr(3)},
+			},
+		},
+		{
+			name: "mapping and prefix tags",
+			opts: []LineOption{
+				WithTagMode("prefix"),
+				WithFieldTypes(map[string]string{
+					"bytes_recv": "gauge",
+					"req_count":  "counter",
+				}),
+			},
+			want: []*model.Metrics{
+				{ID: "a.net_bytes_recv", MType: "gauge", Value: float64Ptr(100)},
+				{ID: "a.net_drop_rate", MType: "gauge", Value: float64Ptr(0.5)},
+				{ID: "a.net_up", MType: "gauge", Value: float64Ptr(1)},
+				{ID: "temp", MType: "gauge", Value: float64Ptr(21.5)},
+				{ID: "req_count", MType: "counter", Delta: int64Ptr(3)},
+			},
+		},
+		{
+			name:    "fractional counter",
+			opts:    []LineOption{WithFieldTypes(map[string]string{"drop_rate": "counter"})},
+			wantErr: ErrInvalidFieldType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lp, err := NewLineProtocol(tt.opts...)
+			require.NoError(t, err)
+
+			got, err := lp.Metrics(points)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewLineProtocol_InvalidOptions(t *testing.T) {
+	_, err := NewLineProtocol(WithTagMode("labels"))
+	assert.ErrorIs(t, err, ErrInvalidTagMode)
+
+	_, err = NewLineProtocol(WithFieldTypes(map[string]string{"a": "histogram"}))
+	assert.ErrorIs(t, err, ErrInvalidFieldType)
+}
+
+func int64Ptr(v int64) *int64 {
+	return &v
+}
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
@@ -0,0 +1,251 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+var (
+	ErrInvalidSubscription = errors.New("invalid mqtt subscription")
+	ErrInvalidMessage      = errors.New("invalid mqtt message")
+)
+
+// MQTTSubscription is a topic filter and the type of the metrics published
+// to the matching topics.
+type MQTTSubscription struct {
+	Filter string
+	Type   model.MetricType
+}
+
+// ParseMQTTSubscription parses a subscription in the form filter[=type],
+// as in sensors/+/temperature or meters/#=counter. The type defaults to
+// gauge.
+func ParseMQTTSubscription(s string) (MQTTSubscription, error) {
+	filter, t, ok := strings.Cut(s, "=")
+	if !ok {
+		t = string(model.GaugeType)
+	}
+	if !model.ValidateType(t) {
+		return MQTTSubscription{}, fmt.Errorf("%w: %q", ErrInvalidSubscription, s)
+	}
+
+	if err := validateTopicFilter(filter); err != nil {
+		return MQTTSubscription{}, fmt.Errorf("%w: %q: %w", ErrInvalidSubscription, s, err)
+	}
+
+	return MQTTSubscription{Filter: filter, Type: model.MetricType(t)}, nil
+}
+
+func validateTopicFilter(filter string) error {
+	if filter == "" {
+		return errors.New("empty topic filter")
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		switch {
+		case level == "#" && i != len(levels)-1:
+			return errors.New("# must be the last level")
+		case level != "#" && level != "+" && strings.ContainsAny(level, "#+"):
+			return errors.New("wildcards must occupy a whole level")
+		}
+	}
+
+	return nil
+}
+
+// MatchTopic reports whether a topic matches a topic filter. As the MQTT
+// specification requires, wildcards in the first level do not match the
+// topics starting with $, such as $SYS/broker/uptime.
+func MatchTopic(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") &&
+		(strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+	for i, level := range fl {
+		if level == "#" {
+			return true
+		}
+		if i >= len(tl) {
+			return false
+		}
+		if level != "+" && level != tl[i] {
+			return false
+		}
+	}
+
+	return len(fl) == len(tl)
+}
+
+// MQTT maps MQTT messages to metric updates.
+//
+// The metric name is the topic with its levels joined by dots, so
+// sensors/kitchen/temperature becomes sensors.kitchen.temperature. A
+// payload holding a plain number, a boolean or a JSON number updates that
+// metric. A JSON object updates one metric per numeric or boolean field,
+// named after the topic and the field path, as in
+// sensors.kitchen.climate.humidity; the other fields are skipped.
+//
+// The type comes from the first subscription matching the topic. Counter
+// payloads carry the increase since the previous message, so they must be
+// integers.
+type MQTT struct {
+	subs []MQTTSubscription
+}
+
+// NewMQTT creates a new MQTT mapping of the subscriptions, each in the
+// form filter[=type].
+func NewMQTT(subscriptions []string) (*MQTT, error) {
+	if len(subscriptions) == 0 {
+		return nil, fmt.Errorf("%w: no topic filters", ErrInvalidSubscription)
+	}
+
+	m := &MQTT{}
+	for _, s := range subscriptions {
+		sub, err := ParseMQTTSubscription(s)
+		if err != nil {
+			return nil, err
+		}
+		m.subs = append(m.subs, sub)
+	}
+
+	return m, nil
+}
+
+// Subscriptions returns the subscriptions in the configured order.
+func (m *MQTT) Subscriptions() []MQTTSubscription {
+	return slices.Clone(m.subs)
+}
+
+// TypeOf returns the metric type of a topic, gauge if no subscription
+// matches it.
+func (m *MQTT) TypeOf(topic string) model.MetricType {
+	for _, sub := range m.subs {
+		if MatchTopic(sub.Filter, topic) {
+			return sub.Type
+		}
+	}
+
+	return model.GaugeType
+}
+
+// Metrics converts a message to metric updates.
+func (m *MQTT) Metrics(topic string, payload []byte) ([]*model.Metrics, error) {
+	name := strings.ReplaceAll(strings.Trim(topic, "/"), "/", ".")
+	if name == "" {
+		return nil, fmt.Errorf("%w: empty topic", ErrInvalidMessage)
+	}
+	mtype := m.TypeOf(topic)
+
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 || payload[0] != '{' {
+		v, err := mqttValue(payload)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidMessage, topic, err)
+		}
+
+		metric, err := mqttMetric(name, mtype, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidMessage, topic, err)
+		}
+		return []*model.Metrics{metric}, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidMessage, topic, err)
+	}
+
+	var metrics []*model.Metrics
+	var walk func(prefix string, obj map[string]any) error
+	walk = func(prefix string, obj map[string]any) error {
+		for _, key := range slices.Sorted(maps.Keys(obj)) {
+			id := prefix + "." + key
+
+			var v float64
+			switch f := obj[key].(type) {
+			case map[string]any:
+				if err := walk(id, f); err != nil {
+					return err
+				}
+				continue
+			case json.Number:
+				n, err := f.Float64()
+				if err != nil {
+					return err
+				}
+				v = n
+			case bool:
+				if f {
+					v = 1
+				}
+			default:
+				continue
+			}
+
+			metric, err := mqttMetric(id, mtype, v)
+			if err != nil {
+				return err
+			}
+			metrics = append(metrics, metric)
+		}
+		return nil
+	}
+	if err := walk(name, doc); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidMessage, topic, err)
+	}
+
+	return metrics, nil
+}
+
+// mqttValue parses a plain payload: a number or a boolean.
+func mqttValue(payload []byte) (float64, error) {
+	s := string(payload)
+	switch strings.ToLower(s) {
+	case "true":
+		return 1, nil
+	case "false":
+		return 0, nil
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("payload %q is not a number", s)
+	}
+
+	return v, nil
+}
+
+func mqttMetric(name string, t model.MetricType, v float64) (*model.Metrics, error) {
+	id := model.SanitizeID(name)
+	if t == model.GaugeType {
+		return &model.Metrics{ID: id, MType: string(t), Value: &v}, nil
+	}
+
+	if v != math.Trunc(v) || math.Abs(v) >= math.MaxInt64 {
+		return nil, fmt.Errorf(
+			"%w: %s: counter value %v is not an integer",
+			ErrInvalidFieldType,
+			name,
+			v,
+		)
+	}
+	delta := int64(v)
+
+	return &model.Metrics{ID: id, MType: string(t), Delta: &delta}, nil
+}
@@ -0,0 +1,153 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+func TestParseMQTTSubscription(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    MQTTSubscription
+		wantErr bool
+	}{
+		{in: "sensors/+/temp", want: MQTTSubscription{Filter: "sensors/+/temp", Type: model.GaugeType}},
+		{in: "meters/#=counter", want: MQTTSubscription{Filter: "meters/#", Type: model.CounterType}},
+		{in: "#=gauge", want: MQTTSubscription{Filter: "#", Type: model.GaugeType}},
+		{in: "", wantErr: true},
+		{in: "a/#/b", wantErr: true},
+		{in: "a/b+", wantErr: true},
+		{in: "a/b=histogram", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseMQTTSubscription(tt.in)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidSubscription)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{filter: "a/b", topic: "a/b", want: true},
+		{filter: "a/b", topic: "a/c"},
+		{filter: "a/+", topic: "a/b", want: true},
+		{filter: "a/+", topic: "a/b/c"},
+		{filter: "a/+/c", topic: "a//c", want: true},
+		{filter: "a/#", topic: "a", want: true},
+		{filter: "a/#", topic: "a/b/c", want: true},
+		{filter: "#", topic: "a/b", want: true},
+		{filter: "#", topic: "$SYS/uptime"},
+		{filter: "+/uptime", topic: "$SYS/uptime"},
+		{filter: "$SYS/#", topic: "$SYS/uptime", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter+" "+tt.topic, func(t *testing.T) {
+			assert.Equal(t, tt.want, MatchTopic(tt.filter, tt.topic))
+		})
+	}
+}
+
+func TestMQTT_Metrics(t *testing.T) {
+	m, err := NewMQTT([]string{"meters/#=counter", "sensors/#"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		topic   string
+		payload string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "plain number",
+			topic:   "sensors/kitchen/temperature",
+			payload: " 21.5\n",
+			want:    map[string]string{"gauge sensors.kitchen.temperature": "21.5"},
+		},
+		{
+			name:    "boolean",
+			topic:   "sensors/door/open",
+			payload: "true",
+			want:    map[string]string{"gauge sensors.door.open": "1"},
+		},
+		{
+			name:    "json object",
+			topic:   "sensors/kitchen",
+			payload: `{"temp":21.5,"unit":"C","climate":{"humidity":40},"ok":false,"tags":[1]}`,
+			want: map[string]string{
+				"gauge sensors.kitchen.temp":             "21.5",
+				"gauge sensors.kitchen.climate.humidity": "40",
+				"gauge sensors.kitchen.ok":               "0",
+			},
+		},
+		{
+			name:    "counter",
+			topic:   "meters/water",
+			payload: "3",
+			want:    map[string]string{"counter meters.water": "3"},
+		},
+		{
+			name:    "unmatched topic is a gauge",
+			topic:   "other/room 1",
+			payload: "2",
+			want:    map[string]string{"gauge other.room_1": "2"},
+		},
+		{
+			name:    "fractional counter",
+			topic:   "meters/water",
+			payload: "0.5",
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			topic:   "sensors/kitchen/temperature",
+			payload: "warm",
+			wantErr: true,
+		},
+		{
+			name:    "infinity",
+			topic:   "sensors/kitchen/temperature",
+			payload: "+Inf",
+			wantErr: true,
+		},
+		{
+			name:    "malformed json",
+			topic:   "sensors/kitchen",
+			payload: `{"temp":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := m.Metrics(tt.topic, []byte(tt.payload))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidMessage)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, values(t, metrics))
+		})
+	}
+
+	_, err = NewMQTT(nil)
+	assert.ErrorIs(t, err, ErrInvalidSubscription)
+}
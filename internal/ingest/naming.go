@@ -0,0 +1,78 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+var ErrInvalidTagMode = errors.New("invalid tag mode")
+
+// TagMode defines how the tags (labels, attributes) of foreign protocols are
+// folded into metric names, the storage has no separate dimensions.
+type TagMode string
+
+const (
+	// TagsIdentity appends the tags sorted by key to the name, so every tag
+	// combination is a separate metric: cpu_usage.cpu:cpu0.host:web1.
+	TagsIdentity TagMode = "identity"
+	// TagsPrefix prepends the tag values sorted by key to the name:
+	// cpu0.web1.cpu_usage.
+	TagsPrefix TagMode = "prefix"
+	// TagsDrop ignores the tags, metrics differing only in tags collapse.
+	TagsDrop TagMode = "drop"
+)
+
+// ParseTagMode parses a tag mode. An empty string selects TagsIdentity.
+func ParseTagMode(s string) (TagMode, error) {
+	switch m := TagMode(s); m {
+	case "":
+		return TagsIdentity, nil
+	case TagsIdentity, TagsPrefix, TagsDrop:
+		return m, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidTagMode, s)
+	}
+}
+
+// Tag is a key and value pair qualifying a metric.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// MetricName builds the metric name of base qualified by tags. The result
+// only holds characters accepted by strict validation.
+func MetricName(base string, tags []Tag, mode TagMode) string {
+	if len(tags) == 0 || mode == TagsDrop {
+		return model.SanitizeID(base)
+	}
+
+	sorted := slices.Clone(tags)
+	slices.SortFunc(sorted, func(a, b Tag) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	var sb strings.Builder
+	switch mode {
+	case TagsPrefix:
+		for _, t := range sorted {
+			sb.WriteString(t.Value)
+			sb.WriteByte('.')
+		}
+		sb.WriteString(base)
+	default:
+		sb.WriteString(base)
+		for _, t := range sorted {
+			sb.WriteByte('.')
+			sb.WriteString(t.Key)
+			sb.WriteByte(':')
+			sb.WriteString(t.Value)
+		}
+	}
+
+	return model.SanitizeID(sb.String())
+}
@@ -0,0 +1,46 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTagMode(t *testing.T) {
+	m, err := ParseTagMode("")
+	require.NoError(t, err)
+	assert.Equal(t, TagsIdentity, m)
+
+	m, err = ParseTagMode("prefix")
+	require.NoError(t, err)
+	assert.Equal(t, TagsPrefix, m)
+
+	_, err = ParseTagMode("labels")
+	assert.ErrorIs(t, err, ErrInvalidTagMode)
+}
+
+func TestMetricName(t *testing.T) {
+	tags := []Tag{{Key: "host", Value: "web 1"}, {Key: "cpu", Value: "cpu0"}}
+
+	tests := []struct {
+		name string
+		tags []Tag
+		mode TagMode
+		want string
+	}{
+		{name: "no tags", mode: TagsIdentity, want: "cpu_usage"},
+		{name: "identity", tags: tags, mode: TagsIdentity, want: "cpu_usage.cpu:cpu0.host:web_1"},
+		{name: "prefix", tags: tags, mode: TagsPrefix, want: "cpu0.web_1.cpu_usage"},
+		{name: "drop", tags: tags, mode: TagsDrop, want: "cpu_usage"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MetricName("cpu_usage", tt.tags, tt.mode))
+		})
+	}
+
+	// the caller's tag order is left alone
+	assert.Equal(t, "host", tags[0].Key)
+}
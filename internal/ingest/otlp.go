@@ -0,0 +1,525 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+var ErrUnsupportedMetric = errors.New("unsupported otlp metric")
+
+// streamTTL is how long the state of a series outlives its last data point.
+const streamTTL = time.Hour
+
+// OTLP maps OpenTelemetry metrics to metric updates.
+//
+// Monotonic sums become counters. The storage adds deltas, so cumulative
+// sums are converted by keeping the last value of every series: the first
+// point of a series and the first point after a reset carry the whole value
+// since the start time. Fractions of double sums are carried over to the
+// next point. Non-monotonic sums and gauges become gauges, non-monotonic
+// delta sums hold their running total.
+//
+// Histograms and summaries are flattened like Prometheus does: name_count
+// is a counter, name_sum a gauge holding the total, explicit buckets are
+// counters named name_bucket with an le tag counting the observations up to
+// the bound, and summary quantiles are gauges with a quantile tag.
+// Exponential histograms keep their count and sum only.
+//
+// Data point attributes are folded into the name by the tag mode, the
+// values of the resource prefix attributes are prepended to it. The updates
+// that are not stored are given back to their series, see Commit.
+type OTLP struct {
+	tags   TagMode
+	prefix []string
+
+	mu      sync.Mutex
+	streams map[string]*stream
+	swept   time.Time
+}
+
+// stream is the state of a series kept between requests.
+type stream struct {
+	start uint64
+	last  float64
+	total float64
+	carry float64
+	seen  time.Time
+}
+
+// OTLPOption configures an OTLP mapping.
+type OTLPOption func(*OTLP) error
+
+// WithOTLPTagMode sets how data point attributes are folded into metric
+// names.
+func WithOTLPTagMode(mode string) OTLPOption {
+	return func(o *OTLP) error {
+		m, err := ParseTagMode(mode)
+		if err != nil {
+			return err
+		}
+		o.tags = m
+		return nil
+	}
+}
+
+// WithResourcePrefix sets the resource attributes, such as service.name,
+// whose values are prepended to metric names in the given order. Missing
+// attributes are skipped.
+func WithResourcePrefix(keys []string) OTLPOption {
+	return func(o *OTLP) error {
+		o.prefix = slices.Clone(keys)
+		return nil
+	}
+}
+
+// NewOTLP creates a new OTLP mapping.
+func NewOTLP(opts ...OTLPOption) (*OTLP, error) {
+	o := &OTLP{
+		tags:    TagsIdentity,
+		streams: make(map[string]*stream),
+		swept:   time.Now(),
+	}
+
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return o, nil
+}
+
+// otlpBatch collects the updates converted from one export request.
+type otlpBatch struct {
+	o        *OTLP
+	resource string
+	prefix   string
+	metrics  []*model.Metrics
+	rejected int64
+	err      error
+	// rollbacks give back the update of every metric to its series, nil
+	// for the gauges.
+	rollbacks []func()
+}
+
+func (b *otlpBatch) reject(name string, err error) {
+	b.rejected++
+	if b.err == nil {
+		b.err = fmt.Errorf("%s: %w", name, err)
+	}
+}
+
+// Metrics converts the resource metrics of an export request to metric
+// updates. Data points that cannot be converted are counted as rejected,
+// the returned error describes the first of them. The returned Commit is
+// applied with the result of storing the updates.
+func (o *OTLP) Metrics(
+	rms []*metricspb.ResourceMetrics,
+) ([]*model.Metrics, *Commit, int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.sweep(time.Now())
+
+	var b otlpBatch
+	b.o = o
+	for _, rm := range rms {
+		attrs := rm.GetResource().GetAttributes()
+		b.resource = seriesKey("", attributeTags(attrs))
+		b.prefix = o.resourcePrefix(attrs)
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				b.add(m)
+			}
+		}
+	}
+
+	commit := &Commit{mu: &o.mu, rollbacks: b.rollbacks}
+
+	return b.metrics, commit, b.rejected, b.err
+}
+
+// PartialSuccess merges the data points rejected on conversion and on
+// storing into the partial success of an export response, nil when none
+// were.
+func PartialSuccess(
+	rejected int64,
+	convErr error,
+	res *model.BatchResult,
+) *colmetricspb.ExportMetricsPartialSuccess {
+	var msg string
+	if convErr != nil {
+		msg = convErr.Error()
+	}
+
+	if res != nil {
+		for _, it := range res.Results {
+			if it.Applied() || it.Status == model.BatchItemSkipped {
+				continue
+			}
+			rejected++
+			if msg == "" {
+				msg = it.ID + ": " + it.Reason
+			}
+		}
+	}
+
+	if rejected == 0 {
+		return nil
+	}
+
+	return &colmetricspb.ExportMetricsPartialSuccess{
+		RejectedDataPoints: rejected,
+		ErrorMessage:       msg,
+	}
+}
+
+// resourcePrefix returns the values of the prefix attributes joined by dots
+// and followed by one, or an empty string.
+func (o *OTLP) resourcePrefix(attrs []*commonpb.KeyValue) string {
+	var parts []string
+	for _, key := range o.prefix {
+		for _, kv := range attrs {
+			if kv.GetKey() != key {
+				continue
+			}
+			if v, ok := anyValueString(kv.GetValue()); ok && v != "" {
+				parts = append(parts, v)
+			}
+			break
+		}
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+
+	return strings.Join(parts, ".") + "."
+}
+
+func (b *otlpBatch) add(m *metricspb.Metric) {
+	if m.GetName() == "" {
+		b.reject("<unnamed>", ErrUnsupportedMetric)
+		return
+	}
+	name := b.prefix + m.GetName()
+
+	switch d := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dp := range d.Gauge.GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			v, err := numberValue(dp)
+			if err != nil {
+				b.reject(name, err)
+				continue
+			}
+			b.gauge(name, attributeTags(dp.GetAttributes()), v)
+		}
+	case *metricspb.Metric_Sum:
+		b.addSum(name, d.Sum)
+	case *metricspb.Metric_Histogram:
+		cumulative, err := isCumulative(d.Histogram.GetAggregationTemporality())
+		if err != nil {
+			b.reject(name, err)
+			return
+		}
+		for _, dp := range d.Histogram.GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			b.addHistogram(name, dp, cumulative)
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		h := d.ExponentialHistogram
+		cumulative, err := isCumulative(h.GetAggregationTemporality())
+		if err != nil {
+			b.reject(name, err)
+			return
+		}
+		for _, dp := range h.GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			tags := attributeTags(dp.GetAttributes())
+			start := dp.GetStartTimeUnixNano()
+			b.counter(name+"_count", tags, start, float64(dp.GetCount()), cumulative)
+			b.total(name+"_sum", tags, dp.GetSum(), cumulative)
+		}
+	case *metricspb.Metric_Summary:
+		for _, dp := range d.Summary.GetDataPoints() {
+			if noValue(dp.GetFlags()) {
+				continue
+			}
+			tags := attributeTags(dp.GetAttributes())
+			start := dp.GetStartTimeUnixNano()
+			b.counter(name+"_count", tags, start, float64(dp.GetCount()), true)
+			b.gauge(name+"_sum", tags, dp.GetSum())
+			for _, q := range dp.GetQuantileValues() {
+				qtags := withTag(tags, "quantile", formatFloat(q.GetQuantile()))
+				b.gauge(name, qtags, q.GetValue())
+			}
+		}
+	default:
+		b.reject(name, ErrUnsupportedMetric)
+	}
+}
+
+func (b *otlpBatch) addSum(name string, sum *metricspb.Sum) {
+	cumulative, err := isCumulative(sum.GetAggregationTemporality())
+	if err != nil {
+		b.reject(name, err)
+		return
+	}
+
+	for _, dp := range sum.GetDataPoints() {
+		if noValue(dp.GetFlags()) {
+			continue
+		}
+		v, err := numberValue(dp)
+		if err != nil {
+			b.reject(name, err)
+			continue
+		}
+
+		tags := attributeTags(dp.GetAttributes())
+		if sum.GetIsMonotonic() {
+			b.counter(name, tags, dp.GetStartTimeUnixNano(), v, cumulative)
+		} else {
+			b.total(name, tags, v, cumulative)
+		}
+	}
+}
+
+func (b *otlpBatch) addHistogram(
+	name string,
+	dp *metricspb.HistogramDataPoint,
+	cumulative bool,
+) {
+	tags := attributeTags(dp.GetAttributes())
+	start := dp.GetStartTimeUnixNano()
+
+	b.counter(name+"_count", tags, start, float64(dp.GetCount()), cumulative)
+	b.total(name+"_sum", tags, dp.GetSum(), cumulative)
+
+	bounds := dp.GetExplicitBounds()
+	var count uint64
+	for i, n := range dp.GetBucketCounts() {
+		count += n
+		le := "inf"
+		if i < len(bounds) {
+			le = formatFloat(bounds[i])
+		}
+		btags := withTag(tags, "le", le)
+		b.counter(name+"_bucket", btags, start, float64(count), cumulative)
+	}
+}
+
+func (b *otlpBatch) gauge(name string, tags []Tag, v float64) {
+	b.emit(&model.Metrics{
+		ID:    MetricName(name, tags, b.o.tags),
+		MType: string(model.GaugeType),
+		Value: &v,
+	}, nil)
+}
+
+// total stores the value of a cumulative series as is and the running total
+// of a delta series.
+func (b *otlpBatch) total(name string, tags []Tag, v float64, cumulative bool) {
+	if cumulative {
+		b.gauge(name, tags, v)
+		return
+	}
+
+	st := b.o.stream(b.resource+seriesKey(name, tags), 0)
+	st.total += v
+	total := st.total
+	b.emit(&model.Metrics{
+		ID:    MetricName(name, tags, b.o.tags),
+		MType: string(model.GaugeType),
+		Value: &total,
+	}, func() {
+		st.total -= v
+	})
+}
+
+// counter stores the increase of a series since its previous point.
+func (b *otlpBatch) counter(
+	name string,
+	tags []Tag,
+	start uint64,
+	v float64,
+	cumulative bool,
+) {
+	key := b.resource + seriesKey(name, tags)
+	_, known := b.o.streams[key]
+	st := b.o.stream(key, start)
+
+	inc := v
+	if cumulative {
+		reset := start != 0 && st.start != 0 && start != st.start
+		if reset || v < st.last {
+			st.carry = 0
+		} else if known {
+			inc = v - st.last
+		}
+		st.start, st.last = start, v
+	}
+
+	inc += st.carry
+	whole := math.Trunc(inc)
+	if math.Abs(whole) >= math.MaxInt64 {
+		b.reject(name, fmt.Errorf("%w: %v overflows a counter", ErrInvalidFieldType, v))
+		return
+	}
+	st.carry = inc - whole
+
+	delta := int64(whole)
+	b.emit(&model.Metrics{
+		ID:    MetricName(name, tags, b.o.tags),
+		MType: string(model.CounterType),
+		Delta: &delta,
+	}, func() {
+		// the increase of a cumulative series is carried over to its next
+		// point, the point of a delta series is taken back
+		st.carry += whole
+		if !cumulative {
+			st.carry -= v
+		}
+	})
+}
+
+// emit appends an update, rollback giving it back to its series if it is
+// not stored.
+func (b *otlpBatch) emit(m *model.Metrics, rollback func()) {
+	b.metrics = append(b.metrics, m)
+	b.rollbacks = append(b.rollbacks, rollback)
+}
+
+// stream returns the state of a series, creating it if needed.
+func (o *OTLP) stream(key string, start uint64) *stream {
+	st, ok := o.streams[key]
+	if !ok {
+		st = &stream{start: start}
+		o.streams[key] = st
+	}
+	st.seen = time.Now()
+
+	return st
+}
+
+// sweep drops the series not seen for streamTTL.
+func (o *OTLP) sweep(now time.Time) {
+	if now.Sub(o.swept) < streamTTL {
+		return
+	}
+	o.swept = now
+
+	for key, st := range o.streams {
+		if now.Sub(st.seen) > streamTTL {
+			delete(o.streams, key)
+		}
+	}
+}
+
+func isCumulative(t metricspb.AggregationTemporality) (bool, error) {
+	switch t {
+	case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE:
+		return true, nil
+	case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: temporality %s", ErrUnsupportedMetric, t)
+	}
+}
+
+func noValue(flags uint32) bool {
+	mask := uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)
+	return flags&mask != 0
+}
+
+func numberValue(dp *metricspb.NumberDataPoint) (float64, error) {
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt), nil
+	case *metricspb.NumberDataPoint_AsDouble:
+		if math.IsNaN(v.AsDouble) || math.IsInf(v.AsDouble, 0) {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidFieldType, v.AsDouble)
+		}
+		return v.AsDouble, nil
+	default:
+		return 0, fmt.Errorf("%w: data point without value", ErrUnsupportedMetric)
+	}
+}
+
+// attributeTags converts attributes to tags. Array, map and bytes values
+// have no textual form and are skipped.
+func attributeTags(attrs []*commonpb.KeyValue) []Tag {
+	tags := make([]Tag, 0, len(attrs))
+	for _, kv := range attrs {
+		v, ok := anyValueString(kv.GetValue())
+		if !ok || kv.GetKey() == "" || v == "" {
+			continue
+		}
+		tags = append(tags, Tag{Key: kv.GetKey(), Value: v})
+	}
+
+	return tags
+}
+
+func anyValueString(v *commonpb.AnyValue) (string, bool) {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue, true
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue), true
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10), true
+	case *commonpb.AnyValue_DoubleValue:
+		return formatFloat(v.DoubleValue), true
+	default:
+		return "", false
+	}
+}
+
+func withTag(tags []Tag, key, value string) []Tag {
+	return append(slices.Clip(tags), Tag{Key: key, Value: value})
+}
+
+// seriesKey identifies a series independently of the tag mode.
+func seriesKey(name string, tags []Tag) string {
+	sorted := slices.Clone(tags)
+	slices.SortFunc(sorted, func(a, b Tag) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, t := range sorted {
+		sb.WriteByte(0)
+		sb.WriteString(t.Key)
+		sb.WriteByte('=')
+		sb.WriteString(t.Value)
+	}
+	sb.WriteByte(0)
+
+	return sb.String()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
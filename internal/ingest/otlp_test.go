@@ -0,0 +1,420 @@
+package ingest
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+const (
+	cumulative = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	delta      = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+)
+
+func attr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   k,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}},
+	}
+}
+
+func resourceMetrics(
+	resource []*commonpb.KeyValue,
+	metrics ...*metricspb.Metric,
+) []*metricspb.ResourceMetrics {
+	return []*metricspb.ResourceMetrics{{
+		Resource:     &resourcepb.Resource{Attributes: resource},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+	}}
+}
+
+func intPoint(start uint64, v int64, attrs ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: start,
+		Value:             &metricspb.NumberDataPoint_AsInt{AsInt: v},
+	}
+}
+
+func doublePoint(start uint64, v float64, attrs ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{
+		Attributes:        attrs,
+		StartTimeUnixNano: start,
+		Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: v},
+	}
+}
+
+func sum(
+	name string,
+	temporality metricspb.AggregationTemporality,
+	monotonic bool,
+	points ...*metricspb.NumberDataPoint,
+) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name: name,
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: temporality,
+			IsMonotonic:            monotonic,
+			DataPoints:             points,
+		}},
+	}
+}
+
+// values returns the value of every converted metric by id.
+func values(t *testing.T, metrics []*model.Metrics) map[string]string {
+	t.Helper()
+
+	out := make(map[string]string, len(metrics))
+	for _, m := range metrics {
+		mm, err := model.MetricFromJSON(m)
+		require.NoError(t, err)
+		out[string(mm.GetType())+" "+mm.GetID()] = mm.GetValue()
+	}
+
+	return out
+}
+
+func TestOTLP_Metrics(t *testing.T) {
+	le := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name         string
+		opts         []OTLPOption
+		in           []*metricspb.ResourceMetrics
+		want         map[string]string
+		wantRejected int64
+	}{
+		{
+			name: "gauge with resource prefix",
+			opts: []OTLPOption{WithResourcePrefix([]string{"service.name", "missing"})},
+			in: resourceMetrics(
+				[]*commonpb.KeyValue{attr("service.name", "checkout")},
+				&metricspb.Metric{
+					Name: "queue.size",
+					Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+						DataPoints: []*metricspb.NumberDataPoint{
+							doublePoint(0, 1.5, attr("queue", "orders")),
+						},
+					}},
+				},
+			),
+			want: map[string]string{"gauge checkout.queue.size.queue:orders": "1.5"},
+		},
+		{
+			name: "prefix tag mode",
+			opts: []OTLPOption{WithOTLPTagMode("prefix")},
+			in: resourceMetrics(nil, sum(
+				"requests", delta, true,
+				intPoint(0, 3, attr("method", "GET")),
+			)),
+			want: map[string]string{"counter GET.requests": "3"},
+		},
+		{
+			name: "non-monotonic cumulative sum is a gauge",
+			in: resourceMetrics(nil, sum(
+				"connections", cumulative, false,
+				intPoint(1, -2),
+			)),
+			want: map[string]string{"gauge connections": "-2"},
+		},
+		{
+			name: "histogram",
+			in: resourceMetrics(nil, &metricspb.Metric{
+				Name: "latency",
+				Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+					AggregationTemporality: cumulative,
+					DataPoints: []*metricspb.HistogramDataPoint{{
+						StartTimeUnixNano: 1,
+						Count:             6,
+						Sum:               le(2.25),
+						ExplicitBounds:    []float64{0.1, 0.5},
+						BucketCounts:      []uint64{1, 3, 2},
+					}},
+				}},
+			}),
+			want: map[string]string{
+				"counter latency_count":         "6",
+				"gauge latency_sum":             "2.25",
+				"counter latency_bucket.le:0.1": "1",
+				"counter latency_bucket.le:0.5": "4",
+				"counter latency_bucket.le:inf": "6",
+			},
+		},
+		{
+			name: "summary",
+			in: resourceMetrics(nil, &metricspb.Metric{
+				Name: "rpc",
+				Data: &metricspb.Metric_Summary{Summary: &metricspb.Summary{
+					DataPoints: []*metricspb.SummaryDataPoint{{
+						Count: 4,
+						Sum:   10,
+						QuantileValues: []*metricspb.SummaryDataPoint_ValueAtQuantile{
+							{Quantile: 0.99, Value: 7},
+						},
+					}},
+				}},
+			}),
+			want: map[string]string{
+				"counter rpc_count":       "4",
+				"gauge rpc_sum":           "10",
+				"gauge rpc.quantile:0.99": "7",
+			},
+		},
+		{
+			name: "no recorded value is skipped",
+			in: resourceMetrics(nil, sum(
+				"requests", delta, true,
+				&metricspb.NumberDataPoint{
+					Flags: uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK),
+				},
+			)),
+			want: map[string]string{},
+		},
+		{
+			name: "invalid points are rejected",
+			in: resourceMetrics(nil,
+				sum("nan", delta, false, doublePoint(0, math.NaN())),
+				sum("unspecified", 0, true, intPoint(0, 1)),
+				&metricspb.Metric{Name: "empty"},
+				sum("ok", delta, true, intPoint(0, 1)),
+			),
+			want:         map[string]string{"counter ok": "1"},
+			wantRejected: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := NewOTLP(tt.opts...)
+			require.NoError(t, err)
+
+			metrics, _, rejected, err := o.Metrics(tt.in)
+			assert.Equal(t, tt.wantRejected, rejected)
+			if tt.wantRejected > 0 {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, values(t, metrics))
+		})
+	}
+}
+
+func TestOTLP_Metrics_Streams(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps [][]*metricspb.ResourceMetrics
+		want  []string
+	}{
+		{
+			name: "cumulative int sum",
+			steps: [][]*metricspb.ResourceMetrics{
+				resourceMetrics(nil, sum("c", cumulative, true, intPoint(1, 10))),
+				resourceMetrics(nil, sum("c", cumulative, true, intPoint(1, 15))),
+				resourceMetrics(nil, sum("c", cumulative, true, intPoint(1, 15))),
+				// restart of the sender
+				resourceMetrics(nil, sum("c", cumulative, true, intPoint(2, 3))),
+				// reset without a new start time
+				resourceMetrics(nil, sum("c", cumulative, true, intPoint(2, 1))),
+			},
+			want: []string{"10", "5", "0", "3", "1"},
+		},
+		{
+			name: "cumulative double sum carries fractions",
+			steps: [][]*metricspb.ResourceMetrics{
+				resourceMetrics(nil, sum("c", cumulative, true, doublePoint(1, 1.5))),
+				resourceMetrics(nil, sum("c", cumulative, true, doublePoint(1, 2.7))),
+				resourceMetrics(nil, sum("c", cumulative, true, doublePoint(1, 3.1))),
+			},
+			want: []string{"1", "1", "1"},
+		},
+		{
+			name: "delta sum",
+			steps: [][]*metricspb.ResourceMetrics{
+				resourceMetrics(nil, sum("c", delta, true, intPoint(0, 4))),
+				resourceMetrics(nil, sum("c", delta, true, intPoint(0, 4))),
+			},
+			want: []string{"4", "4"},
+		},
+		{
+			name: "non-monotonic delta sum totals",
+			steps: [][]*metricspb.ResourceMetrics{
+				resourceMetrics(nil, sum("g", delta, false, intPoint(0, 4))),
+				resourceMetrics(nil, sum("g", delta, false, intPoint(0, -1))),
+			},
+			want: []string{"4", "3"},
+		},
+		{
+			name: "series are kept apart by resource",
+			steps: [][]*metricspb.ResourceMetrics{
+				resourceMetrics(
+					[]*commonpb.KeyValue{attr("host", "a")},
+					sum("c", cumulative, true, intPoint(1, 10)),
+				),
+				resourceMetrics(
+					[]*commonpb.KeyValue{attr("host", "b")},
+					sum("c", cumulative, true, intPoint(1, 12)),
+				),
+			},
+			want: []string{"10", "12"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := NewOTLP()
+			require.NoError(t, err)
+
+			var got []string
+			for _, step := range tt.steps {
+				metrics, commit, rejected, err := o.Metrics(step)
+				require.NoError(t, err)
+				require.Zero(t, rejected)
+				require.Len(t, metrics, 1)
+				commit.Apply(batchResult(model.BatchItemApplied))
+
+				mm, err := model.MetricFromJSON(metrics[0])
+				require.NoError(t, err)
+				got = append(got, mm.GetValue())
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// batchResult reports the metrics of a batch stored with the statuses.
+func batchResult(statuses ...model.BatchItemStatus) *model.BatchResult {
+	res := &model.BatchResult{Mode: model.BatchBestEffort}
+	for i, status := range statuses {
+		res.Results = append(res.Results, &model.BatchItemResult{
+			Index:  i,
+			Status: status,
+		})
+	}
+
+	return res
+}
+
+func TestOTLP_Metrics_Commit(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []*metricspb.Metric
+		want  []string
+	}{
+		{
+			name: "cumulative sum",
+			steps: []*metricspb.Metric{
+				sum("c", cumulative, true, intPoint(1, 10)),
+				sum("c", cumulative, true, intPoint(1, 15)),
+				sum("c", cumulative, true, intPoint(1, 15)),
+			},
+			want: []string{"10", "5", "5"},
+		},
+		{
+			name: "cumulative double sum",
+			steps: []*metricspb.Metric{
+				sum("c", cumulative, true, doublePoint(1, 1.5)),
+				sum("c", cumulative, true, doublePoint(1, 2.7)),
+				sum("c", cumulative, true, doublePoint(1, 2.7)),
+			},
+			want: []string{"1", "1", "1"},
+		},
+		{
+			name: "non-monotonic delta sum",
+			steps: []*metricspb.Metric{
+				sum("g", delta, false, intPoint(0, 4)),
+				sum("g", delta, false, intPoint(0, -1)),
+				sum("g", delta, false, intPoint(0, -1)),
+			},
+			want: []string{"4", "3", "3"},
+		},
+	}
+
+	// the second step is rejected on storing and sent again
+	statuses := []model.BatchItemStatus{
+		model.BatchItemApplied,
+		model.BatchItemInvalid,
+		model.BatchItemApplied,
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := NewOTLP()
+			require.NoError(t, err)
+
+			var got []string
+			for i, step := range tt.steps {
+				metrics, commit, _, err := o.Metrics(resourceMetrics(nil, step))
+				require.NoError(t, err)
+				require.Len(t, metrics, 1)
+				commit.Apply(batchResult(statuses[i]))
+
+				mm, err := model.MetricFromJSON(metrics[0])
+				require.NoError(t, err)
+				got = append(got, mm.GetValue())
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOTLP_Metrics_Concurrent(t *testing.T) {
+	o, err := NewOTLP()
+	require.NoError(t, err)
+
+	export := func(v int64, status model.BatchItemStatus) int64 {
+		metrics, commit, _, err := o.Metrics(resourceMetrics(nil,
+			sum("c", cumulative, true, intPoint(1, v)),
+		))
+		if !assert.NoError(t, err) || !assert.Len(t, metrics, 1) {
+			return 0
+		}
+		commit.Apply(batchResult(status))
+
+		if status != model.BatchItemApplied {
+			return 0
+		}
+		return *metrics[0].Delta
+	}
+
+	// an export converted after a rejected one builds on it
+	var stored atomic.Int64
+	first, firstCommit, _, err := o.Metrics(resourceMetrics(nil,
+		sum("c", cumulative, true, intPoint(1, 4)),
+	))
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+	stored.Add(export(6, model.BatchItemApplied))
+	firstCommit.Apply(batchResult(model.BatchItemInvalid))
+	assert.Equal(t, int64(2), stored.Load())
+
+	// concurrent exports of the same point, half of them rejected on
+	// storing, add the increase once
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := model.BatchItemApplied
+			if i%2 == 0 {
+				status = model.BatchItemInvalid
+			}
+			stored.Add(export(10, status))
+		}()
+	}
+	wg.Wait()
+
+	stored.Add(export(10, model.BatchItemApplied))
+	assert.Equal(t, int64(10), stored.Load())
+}
@@ -0,0 +1,478 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPickle = errors.New("invalid pickle payload")
+
+// ParsePickle parses a payload of the Graphite pickle protocol, a pickled
+// list of (path, (timestamp, value)) tuples without the length header.
+func ParsePickle(data []byte) ([]Sample, error) {
+	obj, err := unpickle(data)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := obj.(*[]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: payload is not a list", ErrInvalidPickle)
+	}
+
+	samples := make([]Sample, 0, len(*list))
+	for i, item := range *list {
+		s, err := pickleSample(item)
+		if err != nil {
+			return nil, fmt.Errorf("%w: item %d: %w", ErrInvalidPickle, i, err)
+		}
+		samples = append(samples, s)
+	}
+
+	return samples, nil
+}
+
+func pickleSample(item any) (Sample, error) {
+	pair, ok := pickleSequence(item)
+	if !ok || len(pair) != 2 {
+		return Sample{}, errors.New("not a (path, (timestamp, value)) tuple")
+	}
+
+	p, ok := pair[0].(string)
+	if !ok {
+		return Sample{}, errors.New("path is not a string")
+	}
+
+	point, ok := pickleSequence(pair[1])
+	if !ok || len(point) != 2 {
+		return Sample{}, errors.New("not a (timestamp, value) tuple")
+	}
+
+	ts, ok := pickleNumber(point[0])
+	if !ok {
+		return Sample{}, errors.New("timestamp is not a number")
+	}
+
+	v, ok := pickleNumber(point[1])
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return Sample{}, errors.New("value is not a finite number")
+	}
+
+	s, err := parseGraphitePath(p)
+	if err != nil {
+		return Sample{}, err
+	}
+	s.Value = v
+	s.Time = graphiteTime(ts)
+
+	return s, nil
+}
+
+func pickleSequence(v any) ([]any, bool) {
+	switch s := v.(type) {
+	case []any:
+		return s, true
+	case *[]any:
+		return *s, true
+	default:
+		return nil, false
+	}
+}
+
+func pickleNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// pickleMark is pushed by MARK and consumed by the opcodes building
+// collections.
+type pickleMark struct{}
+
+// unpickle decodes the subset of the pickle format, protocols 0 to 5, that
+// carbon clients emit: lists, tuples, strings, numbers, booleans and None.
+// Opcodes that instantiate objects or call functions are rejected, so
+// untrusted payloads cannot execute code. Lists are returned as *[]any so
+// memoized references observe later appends, tuples as []any.
+func unpickle(data []byte) (any, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+
+	var stack []any
+	memo := make(map[int]any)
+
+	pop := func() (any, error) {
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("%w: stack underflow", ErrInvalidPickle)
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v, nil
+	}
+	popMark := func() ([]any, error) {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if _, ok := stack[i].(pickleMark); ok {
+				items := append([]any(nil), stack[i+1:]...)
+				stack = stack[:i]
+				return items, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: missing mark", ErrInvalidPickle)
+	}
+	popN := func(n int) ([]any, error) {
+		if len(stack) < n {
+			return nil, fmt.Errorf("%w: stack underflow", ErrInvalidPickle)
+		}
+		items := append([]any(nil), stack[len(stack)-n:]...)
+		stack = stack[:len(stack)-n]
+		return items, nil
+	}
+	top := func() (any, error) {
+		if len(stack) == 0 {
+			return nil, fmt.Errorf("%w: stack underflow", ErrInvalidPickle)
+		}
+		return stack[len(stack)-1], nil
+	}
+	readN := func(n uint64) ([]byte, error) {
+		if n > uint64(len(data)) {
+			return nil, fmt.Errorf("%w: length %d out of range", ErrInvalidPickle, n)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPickle, err)
+		}
+		return buf, nil
+	}
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidPickle, err)
+		}
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+	readUint := func(size int) (uint64, error) {
+		buf, err := readN(uint64(size))
+		if err != nil {
+			return 0, err
+		}
+		var v uint64
+		for i := size - 1; i >= 0; i-- {
+			v = v<<8 | uint64(buf[i])
+		}
+		return v, nil
+	}
+	appendTo := func(list any, items ...any) error {
+		l, ok := list.(*[]any)
+		if !ok {
+			return fmt.Errorf("%w: append to a non-list", ErrInvalidPickle)
+		}
+		*l = append(*l, items...)
+		return nil
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: missing stop", ErrInvalidPickle)
+		}
+
+		switch op {
+		case 0x80: // PROTO
+			if _, err := readN(1); err != nil {
+				return nil, err
+			}
+		case 0x95: // FRAME
+			if _, err := readN(8); err != nil {
+				return nil, err
+			}
+		case '.': // STOP
+			return pop()
+		case '(': // MARK
+			stack = append(stack, pickleMark{})
+		case '0': // POP
+			if _, err := pop(); err != nil {
+				return nil, err
+			}
+		case '1': // POP_MARK
+			if _, err := popMark(); err != nil {
+				return nil, err
+			}
+		case '2': // DUP
+			v, err := top()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, v)
+		case 'N': // NONE
+			stack = append(stack, nil)
+		case 0x88: // NEWTRUE
+			stack = append(stack, true)
+		case 0x89: // NEWFALSE
+			stack = append(stack, false)
+		case 'I': // INT
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			switch line {
+			case "01":
+				stack = append(stack, true)
+			case "00":
+				stack = append(stack, false)
+			default:
+				v, err := strconv.ParseInt(line, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %w", ErrInvalidPickle, err)
+				}
+				stack = append(stack, v)
+			}
+		case 'L': // LONG
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			v, err := strconv.ParseInt(strings.TrimSuffix(line, "L"), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidPickle, err)
+			}
+			stack = append(stack, v)
+		case 'J': // BININT
+			v, err := readUint(4)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(int32(uint32(v))))
+		case 'K': // BININT1
+			v, err := readUint(1)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(v))
+		case 'M': // BININT2
+			v, err := readUint(2)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, int64(v))
+		case 0x8a: // LONG1
+			n, err := readUint(1)
+			if err != nil {
+				return nil, err
+			}
+			buf, err := readN(n)
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeLong(buf)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, v)
+		case 'F': // FLOAT
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			v, err := strconv.ParseFloat(line, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidPickle, err)
+			}
+			stack = append(stack, v)
+		case 'G': // BINFLOAT
+			buf, err := readN(8)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, math.Float64frombits(binary.BigEndian.Uint64(buf)))
+		case 'S': // STRING
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			if len(line) < 2 || line[0] != line[len(line)-1] ||
+				(line[0] != '\'' && line[0] != '"') {
+				return nil, fmt.Errorf("%w: malformed string", ErrInvalidPickle)
+			}
+			stack = append(stack, line[1:len(line)-1])
+		case 'V': // UNICODE
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, line)
+		case 'T', 'X', 'B': // BINSTRING, BINUNICODE, BINBYTES
+			n, err := readUint(4)
+			if err != nil {
+				return nil, err
+			}
+			buf, err := readN(n)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, string(buf))
+		case 'U', 0x8c, 'C': // SHORT_BINSTRING, SHORT_BINUNICODE, SHORT_BINBYTES
+			n, err := readUint(1)
+			if err != nil {
+				return nil, err
+			}
+			buf, err := readN(n)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, string(buf))
+		case 0x8d, 0x8e: // BINUNICODE8, BINBYTES8
+			n, err := readUint(8)
+			if err != nil {
+				return nil, err
+			}
+			buf, err := readN(n)
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, string(buf))
+		case ']': // EMPTY_LIST
+			stack = append(stack, &[]any{})
+		case 'l': // LIST
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, &items)
+		case ')': // EMPTY_TUPLE
+			stack = append(stack, []any{})
+		case 't': // TUPLE
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, items)
+		case 0x85, 0x86, 0x87: // TUPLE1, TUPLE2, TUPLE3
+			items, err := popN(int(op - 0x84))
+			if err != nil {
+				return nil, err
+			}
+			stack = append(stack, items)
+		case 'a': // APPEND
+			v, err := pop()
+			if err != nil {
+				return nil, err
+			}
+			list, err := top()
+			if err != nil {
+				return nil, err
+			}
+			if err := appendTo(list, v); err != nil {
+				return nil, err
+			}
+		case 'e': // APPENDS
+			items, err := popMark()
+			if err != nil {
+				return nil, err
+			}
+			list, err := top()
+			if err != nil {
+				return nil, err
+			}
+			if err := appendTo(list, items...); err != nil {
+				return nil, err
+			}
+		case 'p', 'q', 'r', 0x94: // PUT, BINPUT, LONG_BINPUT, MEMOIZE
+			var idx uint64
+			switch op {
+			case 'p':
+				line, err := readLine()
+				if err != nil {
+					return nil, err
+				}
+				idx, err = strconv.ParseUint(line, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %w", ErrInvalidPickle, err)
+				}
+			case 'q':
+				idx, err = readUint(1)
+			case 'r':
+				idx, err = readUint(4)
+			default:
+				idx = uint64(len(memo))
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, err := top()
+			if err != nil {
+				return nil, err
+			}
+			memo[int(idx)] = v
+		case 'g', 'h', 'j': // GET, BINGET, LONG_BINGET
+			var idx uint64
+			switch op {
+			case 'g':
+				line, err := readLine()
+				if err != nil {
+					return nil, err
+				}
+				idx, err = strconv.ParseUint(line, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %w", ErrInvalidPickle, err)
+				}
+			case 'h':
+				idx, err = readUint(1)
+			default:
+				idx, err = readUint(4)
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, ok := memo[int(idx)]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown memo %d", ErrInvalidPickle, idx)
+			}
+			stack = append(stack, v)
+		default:
+			return nil, fmt.Errorf("%w: unsupported opcode 0x%02x", ErrInvalidPickle, op)
+		}
+	}
+}
+
+// decodeLong decodes a little-endian two's complement integer of LONG1.
+func decodeLong(buf []byte) (int64, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	be := make([]byte, len(buf))
+	for i, b := range buf {
+		be[len(buf)-1-i] = b
+	}
+
+	v := new(big.Int).SetBytes(be)
+	if buf[len(buf)-1]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(buf)*8)))
+	}
+
+	if !v.IsInt64() {
+		return 0, fmt.Errorf("%w: integer overflows int64", ErrInvalidPickle)
+	}
+
+	return v.Int64(), nil
+}
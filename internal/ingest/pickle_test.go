@@ -0,0 +1,110 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePickle(t *testing.T) {
+	// pickle.dumps([("servers.web1.cpu", (1700000000, 12.5)),
+	//   ("stats_counts.requests;env=prod", (1700000000.5, 42)),
+	//   ("big", (-1, 2**40))], protocol=p)
+	want := []Sample{
+		{
+			Path:  "servers.web1.cpu",
+			Value: 12.5,
+			Time:  time.Unix(1700000000, 0),
+		},
+		{
+			Path:  "stats_counts.requests",
+			Tags:  []Tag{{Key: "env", Value: "prod"}},
+			Value: 42,
+			Time:  time.Unix(1700000000, int64(time.Second/2)),
+		},
+		{
+			Path:  "big",
+			Value: 1 << 40,
+		},
+	}
+
+	tests := []struct {
+		name    string
+		in      string
+		want    []Sample
+		wantErr bool
+	}{
+		{
+			name: "protocol 0",
+			in:   "(lp0\x0a(Vservers.web1.cpu\x0ap1\x0a(I1700000000\x0aF12.5\x0atp2\x0atp3\x0aa(Vstats_counts.requests;env=prod\x0ap4\x0a(F1700000000.5\x0aI42\x0atp5\x0atp6\x0aa(Vbig\x0ap7\x0a(I-1\x0aL1099511627776L\x0atp8\x0atp9\x0aa.",
+			want: want,
+		},
+		{
+			name: "protocol 2",
+			in:   "\x80\x02]q\x00(X\x10\x00\x00\x00servers.web1.cpuq\x01J\x00\xf1SeG@)\x00\x00\x00\x00\x00\x00\x86q\x02\x86q\x03X\x1e\x00\x00\x00stats_counts.requests;env=prodq\x04GA\xd9T\xfc@ \x00\x00K*\x86q\x05\x86q\x06X\x03\x00\x00\x00bigq\x07J\xff\xff\xff\xff\x8a\x06\x00\x00\x00\x00\x00\x01\x86q\x08\x86q\x09e.",
+			want: want,
+		},
+		{
+			name: "protocol 4",
+			in:   "\x80\x04\x95q\x00\x00\x00\x00\x00\x00\x00]\x94(\x8c\x10servers.web1.cpu\x94J\x00\xf1SeG@)\x00\x00\x00\x00\x00\x00\x86\x94\x86\x94\x8c\x1estats_counts.requests;env=prod\x94GA\xd9T\xfc@ \x00\x00K*\x86\x94\x86\x94\x8c\x03big\x94J\xff\xff\xff\xff\x8a\x06\x00\x00\x00\x00\x00\x01\x86\x94\x86\x94e.",
+			want: want,
+		},
+		{
+			// pickle.dumps([("a", (1, 1))] * 2, protocol=2) reuses the memo
+			name: "memo references",
+			in:   "\x80\x02]q\x00(X\x01\x00\x00\x00aq\x01K\x01K\x01\x86q\x02\x86q\x03h\x03e.",
+			want: []Sample{
+				{Path: "a", Value: 1, Time: time.Unix(1, 0)},
+				{Path: "a", Value: 1, Time: time.Unix(1, 0)},
+			},
+		},
+		{
+			// pickle.dumps([("neg", (1, -2**40))], protocol=2)
+			name: "negative long",
+			in:   "\x80\x02]q\x00X\x03\x00\x00\x00negq\x01K\x01\x8a\x06\x00\x00\x00\x00\x00\xff\x86q\x02\x86q\x03a.",
+			want: []Sample{
+				{Path: "neg", Value: -(1 << 40), Time: time.Unix(1, 0)},
+			},
+		},
+		{
+			name:    "code execution",
+			in:      "cos\nsystem\n(S'ls'\ntR.",
+			wantErr: true,
+		},
+		{
+			name:    "not a list",
+			in:      "K\x01.",
+			wantErr: true,
+		},
+		{
+			name:    "truncated",
+			in:      "\x80\x02]q\x00(X\x10\x00\x00\x00serv",
+			wantErr: true,
+		},
+		{
+			name:    "length out of range",
+			in:      "\x80\x02]X\xff\xff\xff\x7f",
+			wantErr: true,
+		},
+		{
+			name:    "missing stop",
+			in:      "\x80\x02]",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePickle([]byte(tt.in))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidPickle)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package ingest
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+var ErrInvalidWriteRequest = errors.New("invalid remote write request")
+
+const (
+	// nameLabel holds the metric name of a Prometheus series.
+	nameLabel = "__name__"
+	// counterSuffix marks the Prometheus series that are counters.
+	counterSuffix = "_total"
+)
+
+// TimeSeries is a series of a Prometheus remote write request.
+type TimeSeries struct {
+	// Name is the value of the __name__ label, Labels holds the others.
+	Name    string
+	Labels  []Tag
+	Samples []TimeSample
+}
+
+// TimeSample is a sample of a series, Timestamp is in milliseconds.
+type TimeSample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// ParseWriteRequest decodes a prometheus.WriteRequest protobuf message.
+// Metadata, exemplars and native histograms are ignored.
+func ParseWriteRequest(data []byte) ([]TimeSeries, error) {
+	var series []TimeSeries
+	err := walkMessage(data, func(num protowire.Number, b []byte) error {
+		if num != 1 {
+			return nil
+		}
+
+		ts, err := parseTimeSeries(b)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidWriteRequest, err)
+	}
+
+	return series, nil
+}
+
+func parseTimeSeries(data []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := walkMessage(data, func(num protowire.Number, b []byte) error {
+		switch num {
+		case 1:
+			var l Tag
+			err := walkMessage(b, func(num protowire.Number, b []byte) error {
+				switch num {
+				case 1:
+					l.Key = string(b)
+				case 2:
+					l.Value = string(b)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if l.Key == nameLabel {
+				ts.Name = l.Value
+			} else {
+				ts.Labels = append(ts.Labels, l)
+			}
+		case 2:
+			s, err := parseSample(b)
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return TimeSeries{}, err
+	}
+
+	if ts.Name == "" {
+		return TimeSeries{}, errors.New("series without metric name")
+	}
+
+	return ts, nil
+}
+
+func parseSample(data []byte) (TimeSample, error) {
+	var s TimeSample
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return s, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			s.Value = math.Float64frombits(v)
+			data = data[n:]
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			s.Timestamp = int64(v)
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return s, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+
+	return s, nil
+}
+
+// walkMessage calls fn with the value of every length-delimited field of a
+// protobuf message and skips the other fields.
+func walkMessage(data []byte, fn func(protowire.Number, []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		b, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if err := fn(num, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoteWrite maps Prometheus remote write series to metric updates.
+//
+// Series named *_total are counters. The storage adds deltas, so the last
+// value of every counter series is kept and the increase since it is
+// stored: the first sample of a series and the first sample after a reset
+// carry the whole value. Other series are gauges set to their newest
+// sample. Labels are folded into the name by the tag mode.
+//
+// Samples are applied in timestamp order. Only the samples newer than the
+// newest sample accepted for the series so far are applied, among samples
+// with the same timestamp in one request the last one wins. NaN and
+// infinite samples, including staleness markers, are skipped. The updates
+// that are not stored are given back to their series, see Commit.
+type RemoteWrite struct {
+	tags TagMode
+
+	mu     sync.Mutex
+	series map[string]*promSeries
+	swept  time.Time
+}
+
+// promSeries is the state of a series kept between requests.
+type promSeries struct {
+	timestamp int64
+	last      float64
+	carry     float64
+	seen      time.Time
+}
+
+// RemoteWriteOption configures a RemoteWrite mapping.
+type RemoteWriteOption func(*RemoteWrite) error
+
+// WithRemoteWriteTagMode sets how labels are folded into metric names.
+func WithRemoteWriteTagMode(mode string) RemoteWriteOption {
+	return func(rw *RemoteWrite) error {
+		m, err := ParseTagMode(mode)
+		if err != nil {
+			return err
+		}
+		rw.tags = m
+		return nil
+	}
+}
+
+// NewRemoteWrite creates a new RemoteWrite mapping.
+func NewRemoteWrite(opts ...RemoteWriteOption) (*RemoteWrite, error) {
+	rw := &RemoteWrite{
+		tags:   TagsIdentity,
+		series: make(map[string]*promSeries),
+		swept:  time.Now(),
+	}
+
+	for _, opt := range opts {
+		if err := opt(rw); err != nil {
+			return nil, err
+		}
+	}
+
+	return rw, nil
+}
+
+// Metrics converts series to metric updates, one per series with new
+// samples, in the order the series first appear. The returned Commit is
+// applied with the result of storing the updates.
+func (rw *RemoteWrite) Metrics(
+	series []TimeSeries,
+) ([]*model.Metrics, *Commit, error) {
+	type group struct {
+		ts      TimeSeries
+		samples []TimeSample
+	}
+
+	// the same series may be sent more than once in a request
+	var keys []string
+	groups := make(map[string]*group)
+	for _, ts := range series {
+		key := seriesKey(ts.Name, ts.Labels)
+		g, ok := groups[key]
+		if !ok {
+			g = &group{ts: ts}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.samples = append(g.samples, ts.Samples...)
+	}
+
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.sweep(time.Now())
+
+	var metrics []*model.Metrics
+	commit := &Commit{mu: &rw.mu}
+	for _, key := range keys {
+		g := groups[key]
+
+		m, rollback, err := rw.metric(key, g.ts, newestSamples(g.samples))
+		if err != nil {
+			// the updates converted so far are not stored
+			for _, rollback := range commit.rollbacks {
+				rollback()
+			}
+			return nil, nil, fmt.Errorf("%s: %w", g.ts.Name, err)
+		}
+		if m != nil {
+			metrics = append(metrics, m)
+			commit.rollbacks = append(commit.rollbacks, rollback)
+		}
+	}
+
+	return metrics, commit, nil
+}
+
+// newestSamples sorts samples by timestamp, keeping the last of the finite
+// samples sharing a timestamp.
+func newestSamples(samples []TimeSample) []TimeSample {
+	finite := make([]TimeSample, 0, len(samples))
+	for _, s := range samples {
+		if !math.IsNaN(s.Value) && !math.IsInf(s.Value, 0) {
+			finite = append(finite, s)
+		}
+	}
+
+	slices.SortStableFunc(finite, func(a, b TimeSample) int {
+		return cmp.Compare(a.Timestamp, b.Timestamp)
+	})
+
+	out := finite[:0]
+	for i, s := range finite {
+		if i+1 < len(finite) && finite[i+1].Timestamp == s.Timestamp {
+			continue
+		}
+		out = append(out, s)
+	}
+
+	return out
+}
+
+// metric returns the update of a series with the rollback giving it back,
+// nil when there are no new samples.
+func (rw *RemoteWrite) metric(
+	key string,
+	ts TimeSeries,
+	samples []TimeSample,
+) (*model.Metrics, func(), error) {
+	st, known := rw.series[key]
+	if known {
+		i := 0
+		for i < len(samples) && samples[i].Timestamp <= st.timestamp {
+			i++
+		}
+		samples = samples[i:]
+	}
+	if len(samples) == 0 {
+		return nil, nil, nil
+	}
+
+	if !known {
+		st = &promSeries{}
+		rw.series[key] = st
+	}
+	st.seen = time.Now()
+	prev := *st
+
+	id := MetricName(ts.Name, ts.Labels, rw.tags)
+	newest := samples[len(samples)-1]
+
+	if !strings.HasSuffix(ts.Name, counterSuffix) {
+		st.timestamp = newest.Timestamp
+		v := newest.Value
+		m := &model.Metrics{ID: id, MType: string(model.GaugeType), Value: &v}
+		return m, st.rollback(prev, 0), nil
+	}
+
+	inc := st.carry
+	for _, s := range samples {
+		if known && s.Value >= st.last {
+			inc += s.Value - st.last
+		} else {
+			inc += s.Value
+		}
+		st.last = s.Value
+		known = true
+	}
+
+	whole := math.Trunc(inc)
+	if math.Abs(whole) >= math.MaxInt64 {
+		return nil, nil, fmt.Errorf(
+			"%w: %v overflows a counter",
+			ErrInvalidFieldType,
+			newest.Value,
+		)
+	}
+	st.carry = inc - whole
+	st.timestamp = newest.Timestamp
+
+	delta := int64(whole)
+	m := &model.Metrics{ID: id, MType: string(model.CounterType), Delta: &delta}
+	return m, st.rollback(prev, whole), nil
+}
+
+// rollback returns the function giving back an update that took the series
+// from prev to its current state and increased a counter by inc. The state is
+// restored if no other update has changed it since, the increase is carried
+// over to the next sample otherwise.
+func (st *promSeries) rollback(prev promSeries, inc float64) func() {
+	next := *st
+	return func() {
+		if st.timestamp == next.timestamp &&
+			st.last == next.last &&
+			st.carry == next.carry {
+			st.timestamp, st.last, st.carry = prev.timestamp, prev.last, prev.carry
+			return
+		}
+		st.carry += inc
+	}
+}
+
+// sweep drops the series not seen for streamTTL.
+func (rw *RemoteWrite) sweep(now time.Time) {
+	if now.Sub(rw.swept) < streamTTL {
+		return
+	}
+	rw.swept = now
+
+	for key, st := range rw.series {
+		if now.Sub(st.seen) > streamTTL {
+			delete(rw.series, key)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package ingest
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+// appendSeries appends a prometheus.TimeSeries to a WriteRequest.
+func appendSeries(b []byte, labels []Tag, samples ...TimeSample) []byte {
+	var ts []byte
+	for _, l := range labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.Key)
+		lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.Value)
+
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, lb)
+	}
+	for _, s := range samples {
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(s.Value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(s.Timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sb)
+	}
+
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, ts)
+}
+
+func TestParseWriteRequest(t *testing.T) {
+	var req []byte
+	req = appendSeries(
+		req,
+		[]Tag{{Key: "__name__", Value: "up"}, {Key: "job", Value: "node"}},
+		TimeSample{Value: 1, Timestamp: 1000},
+		TimeSample{Value: 0, Timestamp: 2000},
+	)
+	// metadata is skipped
+	req = protowire.AppendTag(req, 3, protowire.BytesType)
+	req = protowire.AppendBytes(req, []byte{0x08, 0x01})
+
+	got, err := ParseWriteRequest(req)
+	require.NoError(t, err)
+	assert.Equal(t, []TimeSeries{{
+		Name:   "up",
+		Labels: []Tag{{Key: "job", Value: "node"}},
+		Samples: []TimeSample{
+			{Value: 1, Timestamp: 1000},
+			{Value: 0, Timestamp: 2000},
+		},
+	}}, got)
+
+	_, err = ParseWriteRequest(appendSeries(nil, []Tag{{Key: "job", Value: "node"}}))
+	assert.ErrorIs(t, err, ErrInvalidWriteRequest)
+
+	_, err = ParseWriteRequest([]byte{0x0a, 0x05, 0x01})
+	assert.ErrorIs(t, err, ErrInvalidWriteRequest)
+}
+
+func TestRemoteWrite_Metrics(t *testing.T) {
+	series := func(name string, samples ...TimeSample) TimeSeries {
+		return TimeSeries{
+			Name:    name,
+			Labels:  []Tag{{Key: "instance", Value: "a"}},
+			Samples: samples,
+		}
+	}
+
+	tests := []struct {
+		name  string
+		steps [][]TimeSeries
+		want  []map[string]string
+	}{
+		{
+			name: "gauge takes the newest sample",
+			steps: [][]TimeSeries{{
+				series("temp", TimeSample{Value: 3, Timestamp: 3}, TimeSample{Value: 1, Timestamp: 1}),
+			}},
+			want: []map[string]string{{"gauge temp.instance:a": "3"}},
+		},
+		{
+			name: "duplicates keep the last sample",
+			steps: [][]TimeSeries{{
+				series("temp", TimeSample{Value: 1, Timestamp: 5}),
+				series("temp", TimeSample{Value: 2, Timestamp: 5}),
+			}},
+			want: []map[string]string{{"gauge temp.instance:a": "2"}},
+		},
+		{
+			name: "stale samples are skipped",
+			steps: [][]TimeSeries{
+				{series("temp", TimeSample{Value: 5, Timestamp: 10})},
+				{series("temp", TimeSample{Value: 4, Timestamp: 9})},
+				{series("temp", TimeSample{Value: math.Float64frombits(0x7ff0000000000002), Timestamp: 11})},
+				{series("temp", TimeSample{Value: 6, Timestamp: 12})},
+			},
+			want: []map[string]string{
+				{"gauge temp.instance:a": "5"},
+				{},
+				{},
+				{"gauge temp.instance:a": "6"},
+			},
+		},
+		{
+			name: "counter deltas",
+			steps: [][]TimeSeries{
+				{series("reqs_total", TimeSample{Value: 10, Timestamp: 1})},
+				{series("reqs_total", TimeSample{Value: 12, Timestamp: 3}, TimeSample{Value: 11, Timestamp: 2})},
+				// out of order, already covered
+				{series("reqs_total", TimeSample{Value: 11, Timestamp: 2})},
+				// reset
+				{series("reqs_total", TimeSample{Value: 4, Timestamp: 4})},
+			},
+			want: []map[string]string{
+				{"counter reqs_total.instance:a": "10"},
+				{"counter reqs_total.instance:a": "2"},
+				{},
+				{"counter reqs_total.instance:a": "4"},
+			},
+		},
+		{
+			name: "counter fractions are carried",
+			steps: [][]TimeSeries{
+				{series("cpu_seconds_total", TimeSample{Value: 0.6, Timestamp: 1})},
+				{series("cpu_seconds_total", TimeSample{Value: 1.2, Timestamp: 2})},
+			},
+			want: []map[string]string{
+				{"counter cpu_seconds_total.instance:a": "0"},
+				{"counter cpu_seconds_total.instance:a": "1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw, err := NewRemoteWrite()
+			require.NoError(t, err)
+
+			for i, step := range tt.steps {
+				metrics, commit, err := rw.Metrics(step)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want[i], values(t, metrics), "step %d", i)
+				commit.Apply(batchResult(slices.Repeat(
+					[]model.BatchItemStatus{model.BatchItemApplied},
+					len(metrics),
+				)...))
+			}
+		})
+	}
+}
+
+func TestRemoteWrite_Metrics_Commit(t *testing.T) {
+	rw, err := NewRemoteWrite()
+	require.NoError(t, err)
+
+	step := func(samples ...TimeSample) []TimeSeries {
+		return []TimeSeries{
+			{Name: "reqs_total", Samples: samples},
+			{Name: "temp", Samples: samples},
+		}
+	}
+
+	metrics, commit, err := rw.Metrics(step(TimeSample{Value: 10, Timestamp: 1}))
+	require.NoError(t, err)
+	commit.Apply(batchResult(model.BatchItemApplied, model.BatchItemApplied))
+
+	// the counter is rejected on storing and sent again with the gauge
+	metrics, commit, err = rw.Metrics(step(TimeSample{Value: 15, Timestamp: 2}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"counter reqs_total": "5",
+		"gauge temp":         "15",
+	}, values(t, metrics))
+	commit.Apply(batchResult(model.BatchItemInvalid, model.BatchItemApplied))
+
+	metrics, _, err = rw.Metrics(step(TimeSample{Value: 15, Timestamp: 2}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"counter reqs_total": "5"}, values(t, metrics))
+}
+
+func TestRemoteWrite_Metrics_Concurrent(t *testing.T) {
+	rw, err := NewRemoteWrite()
+	require.NoError(t, err)
+
+	write := func(s TimeSample, status model.BatchItemStatus) int64 {
+		metrics, commit, err := rw.Metrics([]TimeSeries{
+			{Name: "reqs_total", Samples: []TimeSample{s}},
+		})
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		if len(metrics) == 0 {
+			return 0
+		}
+		commit.Apply(batchResult(status))
+
+		if status != model.BatchItemApplied {
+			return 0
+		}
+		return *metrics[0].Delta
+	}
+
+	// a write converted after a rejected one builds on it
+	var stored atomic.Int64
+	first, firstCommit, err := rw.Metrics([]TimeSeries{
+		{Name: "reqs_total", Samples: []TimeSample{{Value: 10, Timestamp: 1}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+	stored.Add(write(TimeSample{Value: 12, Timestamp: 2}, model.BatchItemApplied))
+	firstCommit.Apply(batchResult(model.BatchItemInvalid))
+	assert.Equal(t, int64(2), stored.Load())
+
+	// concurrent writes of the same samples, half of them rejected on
+	// storing, add the increase once
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := model.BatchItemApplied
+			if i%2 == 0 {
+				status = model.BatchItemInvalid
+			}
+			s := TimeSample{Value: float64(12 + i%5), Timestamp: int64(2 + i%5)}
+			stored.Add(write(s, status))
+		}()
+	}
+	wg.Wait()
+
+	stored.Add(write(TimeSample{Value: 20, Timestamp: 10}, model.BatchItemApplied))
+	assert.Equal(t, int64(20), stored.Load())
+}
+
+func TestRemoteWrite_TagMode(t *testing.T) {
+	rw, err := NewRemoteWrite(WithRemoteWriteTagMode("drop"))
+	require.NoError(t, err)
+
+	metrics, _, err := rw.Metrics([]TimeSeries{{
+		Name:    "up",
+		Labels:  []Tag{{Key: "job", Value: "node"}},
+		Samples: []TimeSample{{Value: 1, Timestamp: 1}},
+	}})
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "up", metrics[0].ID)
+	assert.Equal(t, string(model.GaugeType), metrics[0].MType)
+
+	_, err = NewRemoteWrite(WithRemoteWriteTagMode("bogus"))
+	assert.ErrorIs(t, err, ErrInvalidTagMode)
+}
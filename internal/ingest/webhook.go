@@ -0,0 +1,507 @@
+package ingest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+var (
+	ErrInvalidSelector  = errors.New("invalid selector")
+	ErrInvalidWebhook   = errors.New("invalid webhook")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidPayload   = errors.New("invalid webhook payload")
+)
+
+const (
+	// DefaultSignatureHeader carries the webhook signature unless a source
+	// sets another header.
+	DefaultSignatureHeader = "X-Webhook-Signature"
+
+	// SchemeHMAC expects the hex HMAC-SHA256 of the body, optionally
+	// prefixed by sha256= as GitHub sends it.
+	SchemeHMAC = "hmac-sha256"
+	// SchemeToken expects the shared secret itself.
+	SchemeToken = "token"
+)
+
+// Selector is a JSONPath-like selector. It starts at the root $ and steps
+// into object fields with .name or ['name'], into array elements with [n]
+// and into all elements or fields with [*] or .*.
+type Selector struct {
+	raw   string
+	steps []selectorStep
+}
+
+type selectorStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// ParseSelector parses a selector such as $.build.jobs[0].duration.
+func ParseSelector(s string) (Selector, error) {
+	if !strings.HasPrefix(s, "$") {
+		return Selector{}, fmt.Errorf(
+			"%w: %q must start with $",
+			ErrInvalidSelector,
+			s,
+		)
+	}
+
+	sel := Selector{raw: s}
+	for i := 1; i < len(s); {
+		switch s[i] {
+		case '.':
+			j := i + 1
+			for j < len(s) && s[j] != '.' && s[j] != '[' {
+				j++
+			}
+			key := s[i+1 : j]
+			if key == "" {
+				return Selector{}, fmt.Errorf(
+					"%w: %q: empty field",
+					ErrInvalidSelector,
+					s,
+				)
+			}
+			sel.steps = append(sel.steps, selectorStep{key: key, wildcard: key == "*"})
+			i = j
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return Selector{}, fmt.Errorf(
+					"%w: %q: unclosed [",
+					ErrInvalidSelector,
+					s,
+				)
+			}
+			inner := s[i+1 : i+end]
+			i += end + 1
+
+			switch {
+			case inner == "*":
+				sel.steps = append(sel.steps, selectorStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') &&
+				inner[len(inner)-1] == inner[0]:
+				sel.steps = append(sel.steps, selectorStep{key: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil || n < 0 {
+					return Selector{}, fmt.Errorf(
+						"%w: %q: invalid index %q",
+						ErrInvalidSelector,
+						s,
+						inner,
+					)
+				}
+				sel.steps = append(sel.steps, selectorStep{index: n, isIndex: true})
+			}
+		default:
+			return Selector{}, fmt.Errorf(
+				"%w: %q: unexpected %q",
+				ErrInvalidSelector,
+				s,
+				s[i],
+			)
+		}
+	}
+
+	return sel, nil
+}
+
+// String returns the selector as written.
+func (s Selector) String() string {
+	return s.raw
+}
+
+// Select returns the values the selector matches in a decoded JSON
+// document, none when a step does not apply.
+func (s Selector) Select(doc any) []any {
+	cur := []any{doc}
+	for _, st := range s.steps {
+		var next []any
+		for _, v := range cur {
+			switch v := v.(type) {
+			case map[string]any:
+				if st.wildcard {
+					// fields in key order, so results are stable
+					for _, k := range slices.Sorted(maps.Keys(v)) {
+						next = append(next, v[k])
+					}
+				} else if e, ok := v[st.key]; ok && !st.isIndex {
+					next = append(next, e)
+				}
+			case []any:
+				if st.wildcard {
+					next = append(next, v...)
+				} else if st.isIndex && st.index < len(v) {
+					next = append(next, v[st.index])
+				}
+			}
+		}
+		cur = next
+	}
+
+	return cur
+}
+
+// WebhookRule extracts metrics from a webhook payload.
+//
+// Each optionally selects the elements, such as $.jobs[*], the other
+// selectors are then relative to every element. Name is a template where
+// {selector} placeholders are replaced by the selected values, as in
+// ci.{$.pipeline}.duration. Type is gauge, counter or a selector of one of
+// them, gauge when empty. Value selects a number, a numeric string or a
+// boolean.
+type WebhookRule struct {
+	Each  string
+	Name  string
+	Type  string
+	Value string
+}
+
+// WebhookSource configures the ingestion of one webhook source.
+type WebhookSource struct {
+	// Secret enables signature verification when set.
+	Secret string
+	// Header carries the signature, DefaultSignatureHeader when empty.
+	Header string
+	// Scheme is SchemeHMAC or SchemeToken, SchemeHMAC when empty.
+	Scheme string
+	Rules  []WebhookRule
+}
+
+// Webhook maps the JSON payloads of a webhook source to metric updates.
+type Webhook struct {
+	secret []byte
+	header string
+	scheme string
+	rules  []webhookRule
+}
+
+type webhookRule struct {
+	each  *Selector
+	name  []namePart
+	mtype string
+	typeS *Selector
+	value Selector
+}
+
+// namePart is a literal or, when sel is set, a placeholder of a name
+// template.
+type namePart struct {
+	literal string
+	sel     *Selector
+}
+
+// NewWebhook compiles the rules of a webhook source.
+func NewWebhook(src WebhookSource) (*Webhook, error) {
+	wh := &Webhook{
+		secret: []byte(src.Secret),
+		header: src.Header,
+		scheme: src.Scheme,
+	}
+	if wh.header == "" {
+		wh.header = DefaultSignatureHeader
+	}
+	if wh.scheme == "" {
+		wh.scheme = SchemeHMAC
+	}
+	if wh.scheme != SchemeHMAC && wh.scheme != SchemeToken {
+		return nil, fmt.Errorf(
+			"%w: unknown scheme %q",
+			ErrInvalidWebhook,
+			wh.scheme,
+		)
+	}
+
+	if len(src.Rules) == 0 {
+		return nil, fmt.Errorf("%w: no rules", ErrInvalidWebhook)
+	}
+
+	for i, r := range src.Rules {
+		rule, err := compileRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rule %d: %w", ErrInvalidWebhook, i, err)
+		}
+		wh.rules = append(wh.rules, rule)
+	}
+
+	return wh, nil
+}
+
+func compileRule(r WebhookRule) (webhookRule, error) {
+	var rule webhookRule
+
+	if r.Each != "" {
+		sel, err := ParseSelector(r.Each)
+		if err != nil {
+			return rule, err
+		}
+		rule.each = &sel
+	}
+
+	name, err := parseNameTemplate(r.Name)
+	if err != nil {
+		return rule, err
+	}
+	rule.name = name
+
+	switch {
+	case strings.HasPrefix(r.Type, "$"):
+		sel, err := ParseSelector(r.Type)
+		if err != nil {
+			return rule, err
+		}
+		rule.typeS = &sel
+	case r.Type == "":
+		rule.mtype = string(model.GaugeType)
+	case model.ValidateType(r.Type):
+		rule.mtype = r.Type
+	default:
+		return rule, fmt.Errorf("unknown type %q", r.Type)
+	}
+
+	if r.Value == "" {
+		return rule, errors.New("missing value selector")
+	}
+	rule.value, err = ParseSelector(r.Value)
+	if err != nil {
+		return rule, err
+	}
+
+	return rule, nil
+}
+
+func parseNameTemplate(s string) ([]namePart, error) {
+	if s == "" {
+		return nil, errors.New("missing name")
+	}
+
+	var parts []namePart
+	for s != "" {
+		start := strings.IndexByte(s, '{')
+		if start < 0 {
+			parts = append(parts, namePart{literal: s})
+			break
+		}
+		if start > 0 {
+			parts = append(parts, namePart{literal: s[:start]})
+		}
+
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in name %q", s)
+		}
+		sel, err := ParseSelector(s[start+1 : start+end])
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, namePart{sel: &sel})
+		s = s[start+end+1:]
+	}
+
+	return parts, nil
+}
+
+// SignatureHeader returns the header carrying the signature.
+func (wh *Webhook) SignatureHeader() string {
+	return wh.header
+}
+
+// Verify checks the signature of a payload. Any signature is accepted when
+// the source has no secret.
+func (wh *Webhook) Verify(signature string, body []byte) error {
+	if len(wh.secret) == 0 {
+		return nil
+	}
+
+	if wh.scheme == SchemeToken {
+		if subtle.ConstantTimeCompare([]byte(signature), wh.secret) != 1 {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, wh.secret)
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Metrics extracts metric updates from a JSON payload. Rules whose value
+// or name placeholders match nothing are skipped, payloads of other event
+// kinds often lack the fields.
+func (wh *Webhook) Metrics(payload []byte) ([]*model.Metrics, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+
+	var metrics []*model.Metrics
+	for _, r := range wh.rules {
+		elems := []any{doc}
+		if r.each != nil {
+			elems = r.each.Select(doc)
+		}
+
+		for _, elem := range elems {
+			m, err := r.metric(elem)
+			if err != nil {
+				return nil, err
+			}
+			if m != nil {
+				metrics = append(metrics, m)
+			}
+		}
+	}
+
+	return metrics, nil
+}
+
+func (r webhookRule) metric(elem any) (*model.Metrics, error) {
+	var sb strings.Builder
+	for _, p := range r.name {
+		if p.sel == nil {
+			sb.WriteString(p.literal)
+			continue
+		}
+
+		v, ok := selectOne(*p.sel, elem)
+		if !ok {
+			return nil, nil
+		}
+		s, ok := scalarString(v)
+		if !ok {
+			return nil, fmt.Errorf(
+				"%w: %s is not a scalar",
+				ErrInvalidPayload,
+				p.sel,
+			)
+		}
+		sb.WriteString(s)
+	}
+	id := model.SanitizeID(sb.String())
+
+	mtype := r.mtype
+	if r.typeS != nil {
+		v, ok := selectOne(*r.typeS, elem)
+		if !ok {
+			return nil, nil
+		}
+		s, _ := v.(string)
+		if !model.ValidateType(s) {
+			return nil, fmt.Errorf(
+				"%w: %s: unknown type %v",
+				ErrInvalidPayload,
+				id,
+				v,
+			)
+		}
+		mtype = s
+	}
+
+	raw, ok := selectOne(r.value, elem)
+	if !ok {
+		return nil, nil
+	}
+	v, err := numericValue(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidPayload, id, err)
+	}
+
+	if mtype == string(model.GaugeType) {
+		return &model.Metrics{ID: id, MType: mtype, Value: &v}, nil
+	}
+
+	if v != math.Trunc(v) || math.Abs(v) >= math.MaxInt64 {
+		return nil, fmt.Errorf(
+			"%w: %s: counter value %v is not an integer",
+			ErrInvalidPayload,
+			id,
+			v,
+		)
+	}
+	delta := int64(v)
+	if n, ok := raw.(json.Number); ok {
+		// keep the precision of large integers
+		if d, err := n.Int64(); err == nil {
+			delta = d
+		}
+	}
+
+	return &model.Metrics{ID: id, MType: mtype, Delta: &delta}, nil
+}
+
+// selectOne returns the first value a selector matches, null counting as
+// no match.
+func selectOne(sel Selector, doc any) (any, bool) {
+	vs := sel.Select(doc)
+	if len(vs) == 0 || vs[0] == nil {
+		return nil, false
+	}
+
+	return vs[0], true
+}
+
+func scalarString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	default:
+		return "", false
+	}
+}
+
+func numericValue(v any) (float64, error) {
+	var (
+		f   float64
+		err error
+	)
+	switch v := v.(type) {
+	case json.Number:
+		f, err = v.Float64()
+	case string:
+		f, err = strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case bool:
+		if v {
+			f = 1
+		}
+	default:
+		return 0, fmt.Errorf("value %v is not a number", v)
+	}
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("value %v is not a number", v)
+	}
+
+	return f, nil
+}
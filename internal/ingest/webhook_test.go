@@ -0,0 +1,266 @@
+package ingest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelector_Select(t *testing.T) {
+	doc := map[string]any{
+		"build": map[string]any{
+			"id": "b1",
+			"jobs": []any{
+				map[string]any{"name": "lint", "duration": json.Number("12")},
+				map[string]any{"name": "test", "duration": json.Number("40")},
+			},
+		},
+		"queue size": json.Number("3"),
+		"labels":     map[string]any{"b": "2", "a": "1"},
+	}
+
+	tests := []struct {
+		sel     string
+		want    []any
+		wantErr bool
+	}{
+		{sel: "$", want: []any{doc}},
+		{sel: "$.build.id", want: []any{"b1"}},
+		{sel: "$.build.jobs[1].name", want: []any{"test"}},
+		{sel: "$.build.jobs[*].duration", want: []any{json.Number("12"), json.Number("40")}},
+		{sel: "$['queue size']", want: []any{json.Number("3")}},
+		{sel: "$.labels.*", want: []any{"1", "2"}},
+		{sel: "$.build.jobs[5]"},
+		{sel: "$.missing.field"},
+		{sel: "$.build.id[0]"},
+		{sel: "build.id", wantErr: true},
+		{sel: "$..id", wantErr: true},
+		{sel: "$.jobs[", wantErr: true},
+		{sel: "$.jobs[x]", wantErr: true},
+		{sel: "$x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sel, func(t *testing.T) {
+			sel, err := ParseSelector(tt.sel)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidSelector)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.sel, sel.String())
+			assert.Equal(t, tt.want, sel.Select(doc))
+		})
+	}
+}
+
+func TestNewWebhook(t *testing.T) {
+	valid := WebhookRule{Name: "n", Value: "$.v"}
+
+	tests := []struct {
+		name    string
+		src     WebhookSource
+		wantErr bool
+	}{
+		{name: "valid", src: WebhookSource{Rules: []WebhookRule{valid}}},
+		{
+			name: "token scheme",
+			src:  WebhookSource{Secret: "s", Scheme: SchemeToken, Rules: []WebhookRule{valid}},
+		},
+		{name: "no rules", wantErr: true},
+		{
+			name:    "unknown scheme",
+			src:     WebhookSource{Scheme: "md5", Rules: []WebhookRule{valid}},
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			src:     WebhookSource{Rules: []WebhookRule{{Value: "$.v"}}},
+			wantErr: true,
+		},
+		{
+			name:    "missing value",
+			src:     WebhookSource{Rules: []WebhookRule{{Name: "n"}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			src:     WebhookSource{Rules: []WebhookRule{{Name: "n", Type: "histogram", Value: "$.v"}}},
+			wantErr: true,
+		},
+		{
+			name:    "unclosed placeholder",
+			src:     WebhookSource{Rules: []WebhookRule{{Name: "ci.{$.x", Value: "$.v"}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid each",
+			src:     WebhookSource{Rules: []WebhookRule{{Each: "jobs", Name: "n", Value: "$.v"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWebhook(tt.src)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidWebhook)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWebhook_Verify(t *testing.T) {
+	body := []byte(`{"v":1}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	sum := hex.EncodeToString(mac.Sum(nil))
+
+	rules := []WebhookRule{{Name: "n", Value: "$.v"}}
+
+	tests := []struct {
+		name      string
+		src       WebhookSource
+		signature string
+		wantErr   bool
+	}{
+		{name: "no secret", src: WebhookSource{}, signature: ""},
+		{name: "hmac", src: WebhookSource{Secret: "secret"}, signature: sum},
+		{name: "hmac with prefix", src: WebhookSource{Secret: "secret"}, signature: "sha256=" + sum},
+		{name: "hmac mismatch", src: WebhookSource{Secret: "other"}, signature: sum, wantErr: true},
+		{name: "hmac not hex", src: WebhookSource{Secret: "secret"}, signature: "zz", wantErr: true},
+		{name: "hmac missing", src: WebhookSource{Secret: "secret"}, wantErr: true},
+		{
+			name:      "token",
+			src:       WebhookSource{Secret: "secret", Scheme: SchemeToken},
+			signature: "secret",
+		},
+		{
+			name:      "token mismatch",
+			src:       WebhookSource{Secret: "secret", Scheme: SchemeToken},
+			signature: "secreT",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.src.Rules = rules
+			wh, err := NewWebhook(tt.src)
+			require.NoError(t, err)
+
+			err = wh.Verify(tt.signature, body)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidSignature)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWebhook_Metrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []WebhookRule
+		payload string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "templated names per element",
+			rules: []WebhookRule{{
+				Each:  "$.jobs[*]",
+				Name:  "ci.{$.name}.duration",
+				Value: "$.duration",
+			}},
+			payload: `{"jobs":[{"name":"lint","duration":12.5},{"name":"unit tests","duration":"40"}]}`,
+			want: map[string]string{
+				"gauge ci.lint.duration":       "12.5",
+				"gauge ci.unit_tests.duration": "40",
+			},
+		},
+		{
+			name: "type from payload",
+			rules: []WebhookRule{{
+				Name:  "queue.{$.queue}",
+				Type:  "$.kind",
+				Value: "$.size",
+			}},
+			payload: `{"queue":"jobs","kind":"counter","size":9007199254740993}`,
+			want:    map[string]string{"counter queue.jobs": "9007199254740993"},
+		},
+		{
+			name:    "boolean value",
+			rules:   []WebhookRule{{Name: "deploy.ok", Value: "$.success"}},
+			payload: `{"success":true}`,
+			want:    map[string]string{"gauge deploy.ok": "1"},
+		},
+		{
+			name: "rules without a match are skipped",
+			rules: []WebhookRule{
+				{Name: "builds", Type: "counter", Value: "$.build.count"},
+				{Name: "queue.{$.queue}", Value: "$.size"},
+				{Name: "nulls", Value: "$.nothing"},
+			},
+			payload: `{"size":3,"nothing":null}`,
+			want:    map[string]string{},
+		},
+		{
+			name:    "non-numeric value",
+			rules:   []WebhookRule{{Name: "n", Value: "$.v"}},
+			payload: `{"v":"fast"}`,
+			wantErr: true,
+		},
+		{
+			name:    "fractional counter",
+			rules:   []WebhookRule{{Name: "n", Type: "counter", Value: "$.v"}},
+			payload: `{"v":1.5}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown type from payload",
+			rules:   []WebhookRule{{Name: "n", Type: "$.t", Value: "$.v"}},
+			payload: `{"t":"histogram","v":1}`,
+			wantErr: true,
+		},
+		{
+			name:    "object in name",
+			rules:   []WebhookRule{{Name: "n.{$.o}", Value: "$.v"}},
+			payload: `{"o":{},"v":1}`,
+			wantErr: true,
+		},
+		{
+			name:    "malformed payload",
+			rules:   []WebhookRule{{Name: "n", Value: "$.v"}},
+			payload: `{"v":`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh, err := NewWebhook(WebhookSource{Rules: tt.rules})
+			require.NoError(t, err)
+
+			metrics, err := wh.Metrics([]byte(tt.payload))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidPayload)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, values(t, metrics))
+		})
+	}
+}
@@ -0,0 +1,322 @@
+// Package keyring holds the HMAC secrets and RSA private keys the server
+// accepts, identified by key IDs so that keys can be rotated without
+// restarting every client at once.
+//
+// The secret-key and crypto-key settings add a key with the DefaultID. More
+// keys are listed in a JSON key set file:
+//
+//	{
+//	  "secrets": {"2025-10": "<secret>"},
+//	  "private_keys": {"2025-10": "/etc/metrics/private-2025-10.pem"}
+//	}
+//
+// Relative private key paths are resolved from the directory of the file.
+// Clients name the key they use in the X-Signature-Key-Id and
+// X-Encryption-Key-Id headers, the server tries every key of the set when
+// they do not.
+//
+// Keys are read again by Reload, on SIGHUP for the server. A key that a
+// reload removes or replaces keeps being accepted for the grace period, so
+// that a new key can be rolled out to the clients one by one.
+package keyring
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultID identifies the keys of the secret-key and crypto-key settings.
+const DefaultID = "default"
+
+// DefaultGracePeriod is the time a removed or replaced key is accepted for
+// unless set otherwise.
+const DefaultGracePeriod = time.Hour
+
+// HeaderEncryptionKeyID names the private key of an encrypted body. gRPC
+// metadata uses its lowercase form.
+const HeaderEncryptionKeyID = "X-Encryption-Key-Id"
+
+// ErrInvalidKeySet reports a malformed key set file.
+var ErrInvalidKeySet = errors.New("invalid key set")
+
+// Ring is a set of keys of type K by ID. Keys removed or replaced by Set
+// are retired: they are still returned by Lookup for the grace period.
+type Ring[K any] struct {
+	mu      sync.RWMutex
+	active  map[string]K
+	retired []retiredKey[K]
+	grace   time.Duration
+	equal   func(a, b K) bool
+	now     func() time.Time
+}
+
+type retiredKey[K any] struct {
+	id    string
+	key   K
+	until time.Time
+}
+
+// NewRing creates an empty ring, equal telling whether two keys are the
+// same.
+func NewRing[K any](equal func(a, b K) bool, grace time.Duration) *Ring[K] {
+	return &Ring[K]{
+		active: make(map[string]K),
+		grace:  grace,
+		equal:  equal,
+		now:    time.Now,
+	}
+}
+
+// NewSecrets creates an empty ring of HMAC secrets.
+func NewSecrets(grace time.Duration) *Ring[[]byte] {
+	return NewRing(bytes.Equal, grace)
+}
+
+// NewPrivateKeys creates an empty ring of RSA private keys.
+func NewPrivateKeys(grace time.Duration) *Ring[*rsa.PrivateKey] {
+	return NewRing(func(a, b *rsa.PrivateKey) bool { return a.Equal(b) }, grace)
+}
+
+// Set replaces the active keys, retiring the ones that are removed or
+// changed.
+func (r *Ring[K]) Set(keys map[string]K) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+
+	retired := r.retired[:0]
+	for _, k := range r.retired {
+		if now.Before(k.until) && !r.isActive(keys, k.id, k.key) {
+			retired = append(retired, k)
+		}
+	}
+
+	if r.grace > 0 {
+		for id, key := range r.active {
+			if !r.isActive(keys, id, key) {
+				retired = append(retired, retiredKey[K]{
+					id:    id,
+					key:   key,
+					until: now.Add(r.grace),
+				})
+			}
+		}
+	}
+
+	r.retired = retired
+	r.active = make(map[string]K, len(keys))
+	for id, key := range keys {
+		r.active[id] = key
+	}
+}
+
+func (r *Ring[K]) isActive(keys map[string]K, id string, key K) bool {
+	k, ok := keys[id]
+	return ok && r.equal(k, key)
+}
+
+// Lookup returns the keys to try for the key ID: the active key with the
+// ID, then the retired ones. Every key is returned for an empty ID, the
+// active ones first.
+func (r *Ring[K]) Lookup(id string) []K {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var keys []K
+	if id == "" {
+		for _, id := range slices.Sorted(maps.Keys(r.active)) {
+			keys = append(keys, r.active[id])
+		}
+	} else if k, ok := r.active[id]; ok {
+		keys = append(keys, k)
+	}
+
+	now := r.now()
+	for _, k := range r.retired {
+		if (id == "" || k.id == id) && now.Before(k.until) {
+			keys = append(keys, k.key)
+		}
+	}
+
+	return keys
+}
+
+// Len returns the number of active keys.
+func (r *Ring[K]) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.active)
+}
+
+// IDs returns the sorted IDs of the active keys.
+func (r *Ring[K]) IDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(r.active))
+}
+
+// Config sets where the keys are read from.
+type Config struct {
+	// SecretKey is the HMAC secret added with the DefaultID.
+	SecretKey []byte
+	// CryptoKey is the path of the PEM private key added with the
+	// DefaultID.
+	CryptoKey string
+	// File is the path of the key set file.
+	File string
+	// GracePeriod is the time a removed or replaced key is still accepted
+	// for.
+	GracePeriod time.Duration
+}
+
+// Keys are the HMAC secrets and RSA private keys of the server.
+type Keys struct {
+	Secrets     *Ring[[]byte]
+	PrivateKeys *Ring[*rsa.PrivateKey]
+
+	mu  sync.Mutex
+	cfg Config
+}
+
+// Load reads the keys of the configuration.
+func Load(cfg Config) (*Keys, error) {
+	k := &Keys{
+		Secrets:     NewSecrets(cfg.GracePeriod),
+		PrivateKeys: NewPrivateKeys(cfg.GracePeriod),
+		cfg:         cfg,
+	}
+
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Reload reads the keys again. The current keys are kept on error.
+func (k *Keys) Reload() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	secrets := make(map[string][]byte)
+	privateKeys := make(map[string]*rsa.PrivateKey)
+
+	if len(k.cfg.SecretKey) > 0 {
+		secrets[DefaultID] = k.cfg.SecretKey
+	}
+
+	if k.cfg.CryptoKey != "" {
+		key, err := ReadPrivateKey(k.cfg.CryptoKey)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to read private key from file %s: %w",
+				k.cfg.CryptoKey,
+				err,
+			)
+		}
+		privateKeys[DefaultID] = key
+	}
+
+	if k.cfg.File != "" {
+		if err := readFile(k.cfg.File, secrets, privateKeys); err != nil {
+			return err
+		}
+	}
+
+	k.Secrets.Set(secrets)
+	k.PrivateKeys.Set(privateKeys)
+
+	return nil
+}
+
+// keySetFile is the content of a key set file.
+type keySetFile struct {
+	Secrets     map[string]string `json:"secrets"`
+	PrivateKeys map[string]string `json:"private_keys"`
+}
+
+// readFile adds the keys of the key set file at path.
+func readFile(
+	path string,
+	secrets map[string][]byte,
+	privateKeys map[string]*rsa.PrivateKey,
+) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read key set: %w", err)
+	}
+
+	var f keySetFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidKeySet, err)
+	}
+
+	for id, secret := range f.Secrets {
+		if id == "" || secret == "" {
+			return fmt.Errorf("%w: secret id and value are required", ErrInvalidKeySet)
+		}
+		if _, ok := secrets[id]; ok {
+			return fmt.Errorf("%w: duplicate secret id %q", ErrInvalidKeySet, id)
+		}
+		secrets[id] = []byte(secret)
+	}
+
+	for id, keyPath := range f.PrivateKeys {
+		if id == "" || keyPath == "" {
+			return fmt.Errorf("%w: private key id and path are required", ErrInvalidKeySet)
+		}
+		if _, ok := privateKeys[id]; ok {
+			return fmt.Errorf("%w: duplicate private key id %q", ErrInvalidKeySet, id)
+		}
+
+		if !filepath.IsAbs(keyPath) {
+			keyPath = filepath.Join(filepath.Dir(path), keyPath)
+		}
+		key, err := ReadPrivateKey(keyPath)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to read private key %q from file %s: %w",
+				id,
+				keyPath,
+				err,
+			)
+		}
+		privateKeys[id] = key
+	}
+
+	return nil
+}
+
+// ReadPrivateKey reads a PKCS #1 RSA private key from the PEM file at path.
+func ReadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	privateKeyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	privateKeyPEM, _ := pem.Decode(privateKeyBytes)
+	if privateKeyPEM == nil {
+		return nil, errors.New("invalid key format")
+	}
+
+	privateKey, err := x509.ParsePKCS1PrivateKey(privateKeyPEM.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key: %w", err)
+	}
+
+	return privateKey, nil
+}
@@ -0,0 +1,204 @@
+package keyring
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	clock := time.Unix(1700000000, 0)
+
+	r := NewSecrets(time.Hour)
+	r.now = func() time.Time { return clock }
+
+	r.Set(map[string][]byte{"a": []byte("1"), "b": []byte("2")})
+	assert.Equal(t, [][]byte{[]byte("1")}, r.Lookup("a"))
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, r.Lookup(""))
+	assert.Empty(t, r.Lookup("c"))
+
+	// b is removed and a replaced, both stay accepted for the grace period
+	r.Set(map[string][]byte{"a": []byte("3"), "c": []byte("4")})
+	assert.Equal(t, []string{"a", "c"}, r.IDs())
+	assert.Equal(t, [][]byte{[]byte("3"), []byte("1")}, r.Lookup("a"))
+	assert.Equal(t, [][]byte{[]byte("2")}, r.Lookup("b"))
+	assert.Len(t, r.Lookup(""), 4)
+
+	// an unchanged key is not retired
+	r.Set(map[string][]byte{"a": []byte("3"), "c": []byte("4")})
+	assert.Len(t, r.Lookup(""), 4)
+
+	clock = clock.Add(time.Hour)
+	assert.Equal(t, [][]byte{[]byte("3")}, r.Lookup("a"))
+	assert.Empty(t, r.Lookup("b"))
+
+	r.Set(nil)
+	assert.Equal(t, 0, r.Len())
+	assert.Len(t, r.Lookup(""), 2)
+}
+
+func TestRing_NoGracePeriod(t *testing.T) {
+	r := NewSecrets(0)
+	r.Set(map[string][]byte{"a": []byte("1")})
+	r.Set(map[string][]byte{"a": []byte("2")})
+
+	assert.Equal(t, [][]byte{[]byte("2")}, r.Lookup("a"))
+}
+
+// writePrivateKey writes a new private key to dir and returns it.
+func writePrivateKey(t *testing.T, dir, name string) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+
+	return key
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	key := writePrivateKey(t, dir, "private-2025.pem")
+
+	tests := []struct {
+		name        string
+		cfg         Config
+		file        string
+		wantSecrets []string
+		wantKeys    []string
+		wantErr     error
+	}{
+		{
+			name:        "settings only",
+			cfg:         Config{SecretKey: []byte("secret"), CryptoKey: "testdata/private.pem"},
+			wantSecrets: []string{DefaultID},
+			wantKeys:    []string{DefaultID},
+		},
+		{
+			name:        "settings and file",
+			cfg:         Config{SecretKey: []byte("secret")},
+			file:        `{"secrets":{"2025":"new"},"private_keys":{"2025":"private-2025.pem"}}`,
+			wantSecrets: []string{"2025", DefaultID},
+			wantKeys:    []string{"2025"},
+		},
+		{
+			name: "nothing",
+		},
+		{
+			name:    "duplicate id",
+			cfg:     Config{SecretKey: []byte("secret")},
+			file:    `{"secrets":{"default":"other"}}`,
+			wantErr: ErrInvalidKeySet,
+		},
+		{
+			name:    "empty secret",
+			file:    `{"secrets":{"2025":""}}`,
+			wantErr: ErrInvalidKeySet,
+		},
+		{
+			name:    "invalid json",
+			file:    `{"secrets":[]}`,
+			wantErr: ErrInvalidKeySet,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			if tt.file != "" {
+				cfg.File = filepath.Join(dir, "keys.json")
+				require.NoError(t, os.WriteFile(cfg.File, []byte(tt.file), 0o600))
+			}
+
+			k, err := Load(cfg)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSecrets, k.Secrets.IDs())
+			assert.Equal(t, tt.wantKeys, k.PrivateKeys.IDs())
+			if tt.file != "" {
+				assert.True(t, key.Equal(k.PrivateKeys.Lookup("2025")[0]))
+			}
+		})
+	}
+
+	_, err := Load(Config{CryptoKey: "testdata/invalid_key.pem"})
+	assert.ErrorContains(t, err, "invalid key format")
+}
+
+func TestKeys_Reload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "keys.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"secrets":{"old":"1"}}`), 0o600))
+
+	k, err := Load(Config{File: file, GracePeriod: time.Hour})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"secrets":{"new":"2"}}`), 0o600))
+	require.NoError(t, k.Reload())
+	assert.Equal(t, []string{"new"}, k.Secrets.IDs())
+	assert.Equal(t, [][]byte{[]byte("1")}, k.Secrets.Lookup("old"))
+
+	// a broken file keeps the current keys
+	require.NoError(t, os.WriteFile(file, []byte(`{`), 0o600))
+	assert.Error(t, k.Reload())
+	assert.Equal(t, []string{"new"}, k.Secrets.IDs())
+}
+
+func TestReadPrivateKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyPath string
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name:    "valid RSA key",
+			keyPath: "testdata/private.pem",
+			wantErr: false,
+		},
+		{
+			name:    "file not found",
+			keyPath: "testdata/nonexistent_key.pem",
+			wantErr: true,
+			errMsg:  "failed to read file",
+		},
+		{
+			name:    "invalid PEM format",
+			keyPath: "testdata/invalid_key.pem",
+			wantErr: true,
+			errMsg:  "invalid key format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ReadPrivateKey(tt.keyPath)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, key)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, key)
+			}
+		})
+	}
+}
@@ -99,6 +99,21 @@ func (mr *MockRepositoryMockRecorder) Initialize(arg0 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Initialize", reflect.TypeOf((*MockRepository)(nil).Initialize), arg0)
 }
 
+// ListMetrics mocks base method.
+func (m *MockRepository) ListMetrics(ctx context.Context, q *model.MetricQuery) (*model.MetricPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetrics", ctx, q)
+	ret0, _ := ret[0].(*model.MetricPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMetrics indicates an expected call of ListMetrics.
+func (mr *MockRepositoryMockRecorder) ListMetrics(ctx, q any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetrics", reflect.TypeOf((*MockRepository)(nil).ListMetrics), ctx, q)
+}
+
 // Ping mocks base method.
 func (m *MockRepository) Ping(ctx context.Context) error {
 	m.ctrl.T.Helper()
@@ -142,15 +157,16 @@ func (mr *MockRepositoryMockRecorder) SetOrUpdateMetric(ctx, metric any) *gomock
 }
 
 // SetOrUpdateMetricBatch mocks base method.
-func (m *MockRepository) SetOrUpdateMetricBatch(ctx context.Context, metrics []model.Metric) error {
+func (m *MockRepository) SetOrUpdateMetricBatch(ctx context.Context, metrics []model.Metric, mode model.BatchMode) ([]*model.BatchItemResult, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SetOrUpdateMetricBatch", ctx, metrics)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "SetOrUpdateMetricBatch", ctx, metrics, mode)
+	ret0, _ := ret[0].([]*model.BatchItemResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // SetOrUpdateMetricBatch indicates an expected call of SetOrUpdateMetricBatch.
-func (mr *MockRepositoryMockRecorder) SetOrUpdateMetricBatch(ctx, metrics any) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) SetOrUpdateMetricBatch(ctx, metrics, mode any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOrUpdateMetricBatch", reflect.TypeOf((*MockRepository)(nil).SetOrUpdateMetricBatch), ctx, metrics)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetOrUpdateMetricBatch", reflect.TypeOf((*MockRepository)(nil).SetOrUpdateMetricBatch), ctx, metrics, mode)
 }
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BatchMode selects how a batch update treats metrics that cannot be applied.
+type BatchMode string
+
+const (
+	// BatchAtomic applies the whole batch or nothing.
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort applies every metric that can be applied and reports
+	// the rest.
+	BatchBestEffort BatchMode = "best-effort"
+)
+
+var ErrInvalidBatchMode = errors.New("invalid batch mode")
+
+// ParseBatchMode parses a batch mode, an empty string selects BatchAtomic.
+func ParseBatchMode(s string) (BatchMode, error) {
+	switch BatchMode(s) {
+	case "", BatchAtomic:
+		return BatchAtomic, nil
+	case BatchBestEffort:
+		return BatchBestEffort, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrInvalidBatchMode, s)
+	}
+}
+
+// BatchItemStatus is the outcome of a single metric of a batch update.
+type BatchItemStatus string
+
+const (
+	// BatchItemApplied means the metric was stored.
+	BatchItemApplied BatchItemStatus = "applied"
+	// BatchItemInvalid means the metric was rejected by validation.
+	BatchItemInvalid BatchItemStatus = "invalid"
+	// BatchItemTypeConflict means the metric is already stored with another
+	// type.
+	BatchItemTypeConflict BatchItemStatus = "type_conflict"
+	// BatchItemSkipped means the metric itself is fine, but it was not stored
+	// because an atomic batch was aborted by another metric.
+	BatchItemSkipped BatchItemStatus = "skipped"
+)
+
+// BatchItemResult reports what happened to a single metric of a batch.
+//
+// The embedded Metrics carries the resulting stored value for applied
+// metrics and the submitted payload otherwise.
+type BatchItemResult struct {
+	Index  int             `json:"index"`
+	Status BatchItemStatus `json:"status"`
+	Field  string          `json:"field,omitempty"`
+	Reason string          `json:"reason,omitempty"`
+	*Metrics
+}
+
+// Applied reports whether the metric was stored.
+func (r *BatchItemResult) Applied() bool {
+	return r.Status == BatchItemApplied
+}
+
+// NewAppliedResult creates the result of a stored metric with its resulting
+// value.
+func NewAppliedResult(i int, m Metric) *BatchItemResult {
+	return &BatchItemResult{
+		Index:   i,
+		Status:  BatchItemApplied,
+		Metrics: m.ToJSON(),
+	}
+}
+
+// NewConflictResult creates the result of a metric rejected because it is
+// stored with another type.
+func NewConflictResult(i int, m Metric) *BatchItemResult {
+	return &BatchItemResult{
+		Index:   i,
+		Status:  BatchItemTypeConflict,
+		Field:   "type",
+		Reason:  ErrTypeMismatch.Error(),
+		Metrics: m.ToJSON(),
+	}
+}
+
+// NewSkippedResult creates the result of a metric that was not stored because
+// its atomic batch was aborted.
+func NewSkippedResult(i int, m *Metrics) *BatchItemResult {
+	return &BatchItemResult{
+		Index:   i,
+		Status:  BatchItemSkipped,
+		Reason:  "batch aborted",
+		Metrics: m,
+	}
+}
+
+// NewInvalidResult creates the result of a metric rejected by validation.
+func NewInvalidResult(ve *ValidationError, m *Metrics) *BatchItemResult {
+	return &BatchItemResult{
+		Index:   ve.Index,
+		Status:  BatchItemInvalid,
+		Field:   ve.Field,
+		Reason:  ve.Reason,
+		Metrics: m,
+	}
+}
+
+// BatchResult is the outcome of a batch update.
+type BatchResult struct {
+	Mode     BatchMode          `json:"mode"`
+	Applied  int                `json:"applied"`
+	Rejected int                `json:"rejected"`
+	Results  []*BatchItemResult `json:"results"`
+}
+
+// NewBatchResult builds a BatchResult from per-item results ordered by index.
+func NewBatchResult(mode BatchMode, items []*BatchItemResult) *BatchResult {
+	res := &BatchResult{Mode: mode, Results: items}
+	for _, it := range items {
+		if it.Applied() {
+			res.Applied++
+		} else {
+			res.Rejected++
+		}
+	}
+
+	return res
+}
+
+// Has reports whether any metric of the batch has the given status.
+func (r *BatchResult) Has(status BatchItemStatus) bool {
+	for _, it := range r.Results {
+		if it.Status == status {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBatchMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    BatchMode
+		wantErr bool
+	}{
+		{name: "empty defaults to atomic", in: "", want: BatchAtomic},
+		{name: "atomic", in: "atomic", want: BatchAtomic},
+		{name: "best effort", in: "best-effort", want: BatchBestEffort},
+		{name: "unknown", in: "partial", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseBatchMode(tt.in)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidBatchMode)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewBatchResult(t *testing.T) {
+	value := 1.0
+	items := []*BatchItemResult{
+		NewAppliedResult(0, NewCounter("c", 3)),
+		NewConflictResult(1, NewCounter("g", 1)),
+		NewInvalidResult(
+			&ValidationError{Index: 2, Field: "id", Reason: ErrEmptyID.Error()},
+			&Metrics{MType: "gauge", Value: &value},
+		),
+	}
+
+	res := NewBatchResult(BatchBestEffort, items)
+	assert.Equal(t, 1, res.Applied)
+	assert.Equal(t, 2, res.Rejected)
+	assert.True(t, res.Has(BatchItemTypeConflict))
+	assert.False(t, res.Has(BatchItemSkipped))
+
+	data, err := json.Marshal(res.Results[0])
+	require.NoError(t, err)
+	assert.JSONEq(
+		t,
+		`{"index":0,"status":"applied","id":"c","type":"counter","delta":3}`,
+		string(data),
+	)
+}
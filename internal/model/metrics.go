@@ -17,6 +17,7 @@ const (
 var (
 	ErrInvalidMetricType = errors.New("invalid metric type")
 	ErrMetricTypeNotSet  = errors.New("metric type is not set")
+	ErrTypeMismatch      = errors.New("metric already exist with another type")
 )
 
 // Metrics is a struct used for JSON serialization/deserialization of metrics.
@@ -28,11 +29,21 @@ type Metrics struct {
 }
 
 // Metric is an interface that defines methods for working with metrics.
+//
+// Implementations are immutable values: no method changes the receiver, and
+// Merge returns a new Metric instead of updating the existing one.
 type Metric interface {
 	GetID() string
 	GetType() MetricType
+	// GetValue returns the value formatted for the text APIs.
 	GetValue() string
-	SetValue(string) error
+	// Int64 returns the value as an integer, gauges are truncated.
+	Int64() int64
+	// Float64 returns the value as a float.
+	Float64() float64
+	// Merge combines the metric with a newer update of the same metric and
+	// returns the result. Counters are summed, gauges are replaced.
+	Merge(other Metric) (Metric, error)
 	ToJSON() *Metrics
 }
 
@@ -42,34 +53,47 @@ type CounterMetric struct {
 	Value int64
 }
 
+// NewCounter creates a counter metric with the given delta.
+func NewCounter(id string, delta int64) CounterMetric {
+	return CounterMetric{ID: id, Value: delta}
+}
+
 // GetID returns the ID of the counter metric.
-func (c *CounterMetric) GetID() string {
+func (c CounterMetric) GetID() string {
 	return c.ID
 }
 
 // GetType returns the type of the counter metric.
-func (c *CounterMetric) GetType() MetricType {
+func (c CounterMetric) GetType() MetricType {
 	return CounterType
 }
 
 // GetValue returns the value of the counter metric as a string.
-func (c *CounterMetric) GetValue() string {
+func (c CounterMetric) GetValue() string {
 	return strconv.FormatInt(c.Value, 10)
 }
 
-// SetValue sets the value of the counter metric from a string.
-func (c *CounterMetric) SetValue(value string) error {
-	parsedValue, err := strconv.ParseInt(value, 10, 64)
-	if err != nil {
-		return fmt.Errorf("error setting value: %w", err)
+// Int64 returns the value of the counter metric.
+func (c CounterMetric) Int64() int64 {
+	return c.Value
+}
+
+// Float64 returns the value of the counter metric converted to float.
+func (c CounterMetric) Float64() float64 {
+	return float64(c.Value)
+}
+
+// Merge adds the delta of other to the counter.
+func (c CounterMetric) Merge(other Metric) (Metric, error) {
+	if other.GetType() != CounterType {
+		return nil, ErrTypeMismatch
 	}
 
-	c.Value += parsedValue
-	return nil
+	return CounterMetric{ID: c.ID, Value: c.Value + other.Int64()}, nil
 }
 
 // ToJSON converts the counter metric to its JSON representation.
-func (c *CounterMetric) ToJSON() *Metrics {
+func (c CounterMetric) ToJSON() *Metrics {
 	return &Metrics{
 		ID:    c.ID,
 		MType: string(CounterType),
@@ -83,34 +107,47 @@ type GaugeMetric struct {
 	Value float64
 }
 
+// NewGauge creates a gauge metric with the given value.
+func NewGauge(id string, value float64) GaugeMetric {
+	return GaugeMetric{ID: id, Value: value}
+}
+
 // GetID returns the ID of the gauge metric.
-func (g *GaugeMetric) GetID() string {
+func (g GaugeMetric) GetID() string {
 	return g.ID
 }
 
 // GetType returns the type of the gauge metric.
-func (g *GaugeMetric) GetType() MetricType {
+func (g GaugeMetric) GetType() MetricType {
 	return GaugeType
 }
 
 // GetValue returns the value of the gauge metric as a string.
-func (g *GaugeMetric) GetValue() string {
+func (g GaugeMetric) GetValue() string {
 	return strconv.FormatFloat(g.Value, 'f', -1, 64)
 }
 
-// SetValue sets the value of the gauge metric from a string.
-func (g *GaugeMetric) SetValue(value string) error {
-	parsedValue, err := strconv.ParseFloat(value, 64)
-	if err != nil {
-		return fmt.Errorf("error setting value: %w", err)
+// Int64 returns the value of the gauge metric truncated to integer.
+func (g GaugeMetric) Int64() int64 {
+	return int64(g.Value)
+}
+
+// Float64 returns the value of the gauge metric.
+func (g GaugeMetric) Float64() float64 {
+	return g.Value
+}
+
+// Merge replaces the gauge value with the value of other.
+func (g GaugeMetric) Merge(other Metric) (Metric, error) {
+	if other.GetType() != GaugeType {
+		return nil, ErrTypeMismatch
 	}
 
-	g.Value = parsedValue
-	return nil
+	return GaugeMetric{ID: g.ID, Value: other.Float64()}, nil
 }
 
 // ToJSON converts the gauge metric to its JSON representation.
-func (g *GaugeMetric) ToJSON() *Metrics {
+func (g GaugeMetric) ToJSON() *Metrics {
 	return &Metrics{
 		ID:    g.ID,
 		MType: string(GaugeType),
@@ -118,13 +155,47 @@ func (g *GaugeMetric) ToJSON() *Metrics {
 	}
 }
 
-// NewMetric creates a new Metric instance based on the provided type.
+// NewMetric creates a new zero-valued Metric based on the provided type.
 func NewMetric(id string, metricType MetricType) (Metric, error) {
-	switch MetricType(metricType) {
+	switch metricType {
+	case CounterType:
+		return NewCounter(id, 0), nil
+	case GaugeType:
+		return NewGauge(id, 0), nil
+	default:
+		return nil, ErrInvalidMetricType
+	}
+}
+
+// ParseMetric creates a new Metric from its text representation, as used by
+// the plain-text API.
+func ParseMetric(id string, metricType MetricType, value string) (Metric, error) {
+	switch metricType {
+	case CounterType:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing value: %w", err)
+		}
+		return NewCounter(id, v), nil
+	case GaugeType:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing value: %w", err)
+		}
+		return NewGauge(id, v), nil
+	default:
+		return nil, ErrInvalidMetricType
+	}
+}
+
+// ValueOf returns a value copy of the metric, detached from any pointer the
+// caller may still hold.
+func ValueOf(m Metric) (Metric, error) {
+	switch m.GetType() {
 	case CounterType:
-		return &CounterMetric{ID: id}, nil
+		return NewCounter(m.GetID(), m.Int64()), nil
 	case GaugeType:
-		return &GaugeMetric{ID: id}, nil
+		return NewGauge(m.GetID(), m.Float64()), nil
 	default:
 		return nil, ErrInvalidMetricType
 	}
@@ -134,13 +205,13 @@ func NewMetric(id string, metricType MetricType) (Metric, error) {
 func MetricFromJSON(m *Metrics) (Metric, error) {
 	switch MetricType(m.MType) {
 	case CounterType:
-		counter := &CounterMetric{ID: m.ID}
+		counter := CounterMetric{ID: m.ID}
 		if m.Delta != nil {
 			counter.Value = *m.Delta
 		}
 		return counter, nil
 	case GaugeType:
-		gauge := &GaugeMetric{ID: m.ID}
+		gauge := GaugeMetric{ID: m.ID}
 		if m.Value != nil {
 			gauge.Value = *m.Value
 		}
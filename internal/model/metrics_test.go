@@ -51,99 +51,149 @@ func TestNewMetric(t *testing.T) {
 	}
 }
 
-func TestCounterMetric_SetValue(t *testing.T) {
+func TestParseMetric(t *testing.T) {
 	tests := []struct {
-		name     string
-		initial  string
-		setValue string
-		expected string
-		wantErr  bool
+		name       string
+		metricType MetricType
+		value      string
+		expected   string
+		wantErr    bool
 	}{
 		{
-			name:     "set valid value",
-			initial:  "0",
-			setValue: "100",
-			expected: "100",
-			wantErr:  false,
+			name:       "valid counter value",
+			metricType: CounterType,
+			value:      "100",
+			expected:   "100",
+		},
+		{
+			name:       "invalid counter value",
+			metricType: CounterType,
+			value:      "1.5",
+			wantErr:    true,
+		},
+		{
+			name:       "valid float gauge value",
+			metricType: GaugeType,
+			value:      "42.5",
+			expected:   "42.5",
 		},
 		{
-			name:     "add to existing value",
-			initial:  "50",
-			setValue: "30",
-			expected: "80",
-			wantErr:  false,
+			name:       "valid integer gauge value",
+			metricType: GaugeType,
+			value:      "100",
+			expected:   "100",
 		},
 		{
-			name:     "set invalid value",
-			initial:  "0",
-			setValue: "invalid",
-			expected: "0",
-			wantErr:  true,
+			name:       "invalid gauge value",
+			metricType: GaugeType,
+			value:      "invalid",
+			wantErr:    true,
+		},
+		{
+			name:       "invalid metric type",
+			metricType: MetricType("invalid"),
+			value:      "1",
+			wantErr:    true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			metric, err := NewMetric("test_counter", CounterType)
-			require.NoError(t, err)
-
-			_ = metric.SetValue(tt.initial)
-			err = metric.SetValue(tt.setValue)
+			metric, err := ParseMetric("test", tt.metricType, tt.value)
 
 			if tt.wantErr {
 				assert.Error(t, err)
+				assert.Nil(t, metric)
 			} else {
-				assert.NoError(t, err)
+				require.NoError(t, err)
+				assert.Equal(t, tt.metricType, metric.GetType())
 				assert.Equal(t, tt.expected, metric.GetValue())
 			}
 		})
 	}
 }
 
-func TestGaugeMetric_SetValue(t *testing.T) {
+func TestMetric_Accessors(t *testing.T) {
+	c := NewCounter("test_counter", 42)
+	assert.Equal(t, int64(42), c.Int64())
+	assert.Equal(t, 42.0, c.Float64())
+
+	g := NewGauge("test_gauge", 3.75)
+	assert.Equal(t, int64(3), g.Int64())
+	assert.Equal(t, 3.75, g.Float64())
+}
+
+func TestMetric_Merge(t *testing.T) {
 	tests := []struct {
 		name     string
-		setValue string
-		wantErr  bool
+		current  Metric
+		update   Metric
+		expected Metric
+		wantErr  error
 	}{
 		{
-			name:     "set valid float value",
-			setValue: "42.5",
-			wantErr:  false,
+			name:     "counters are summed",
+			current:  NewCounter("c", 50),
+			update:   NewCounter("c", 30),
+			expected: NewCounter("c", 80),
 		},
 		{
-			name:     "set valid integer value",
-			setValue: "100",
-			wantErr:  false,
+			name:     "counter accepts pointer update",
+			current:  NewCounter("c", 1),
+			update:   &CounterMetric{ID: "c", Value: 2},
+			expected: NewCounter("c", 3),
 		},
 		{
-			name:     "set invalid value",
-			setValue: "invalid",
-			wantErr:  true,
+			name:     "gauges are replaced",
+			current:  NewGauge("g", 10.5),
+			update:   NewGauge("g", 20.7),
+			expected: NewGauge("g", 20.7),
+		},
+		{
+			name:    "counter with gauge update",
+			current: NewCounter("m", 1),
+			update:  NewGauge("m", 1),
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:    "gauge with counter update",
+			current: NewGauge("m", 1),
+			update:  NewCounter("m", 1),
+			wantErr: ErrTypeMismatch,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			metric, err := NewMetric("test_gauge", GaugeType)
-			require.NoError(t, err)
+			before := tt.current.GetValue()
 
-			err = metric.SetValue(tt.setValue)
+			got, err := tt.current.Merge(tt.update)
 
-			if tt.wantErr {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-				assert.Equal(t, tt.setValue, metric.GetValue())
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
 			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+			assert.Equal(t, before, tt.current.GetValue(), "receiver must not change")
 		})
 	}
 }
 
+func TestValueOf(t *testing.T) {
+	p := &GaugeMetric{ID: "g", Value: 1}
+
+	v, err := ValueOf(p)
+	require.NoError(t, err)
+
+	p.Value = 2
+	assert.Equal(t, NewGauge("g", 1), v)
+}
+
 func TestMetric_ToJSON(t *testing.T) {
 	t.Run("counter to json", func(t *testing.T) {
-		metric, _ := NewMetric("test_counter", CounterType)
-		_ = metric.SetValue("100")
+		metric := NewCounter("test_counter", 100)
 
 		json := metric.ToJSON()
 		assert.Equal(t, "test_counter", json.ID)
@@ -154,8 +204,7 @@ func TestMetric_ToJSON(t *testing.T) {
 	})
 
 	t.Run("gauge to json", func(t *testing.T) {
-		metric, _ := NewMetric("test_gauge", GaugeType)
-		_ = metric.SetValue("42.5")
+		metric := NewGauge("test_gauge", 42.5)
 
 		json := metric.ToJSON()
 		assert.Equal(t, "test_gauge", json.ID)
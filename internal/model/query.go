@@ -0,0 +1,189 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultPageLimit is the page size used when a query sets no limit.
+	DefaultPageLimit = 100
+	// MaxPageLimit is the largest accepted page size.
+	MaxPageLimit = 1000
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort order")
+	ErrInvalidLimit  = fmt.Errorf("limit must be between 1 and %d", MaxPageLimit)
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidRegex  = errors.New("invalid regex")
+)
+
+// SortField is the field metrics are ordered by. Metrics with equal sort
+// field values are always ordered by ID.
+type SortField string
+
+const (
+	SortByID   SortField = "id"
+	SortByType SortField = "type"
+)
+
+// SortOrder defines the order of a query result.
+type SortOrder struct {
+	Field SortField
+	Desc  bool
+}
+
+// ParseSortOrder parses a sort order such as "id" or "-type". An empty string
+// selects ascending order by ID.
+func ParseSortOrder(s string) (SortOrder, error) {
+	var o SortOrder
+	if strings.HasPrefix(s, "-") {
+		o.Desc = true
+		s = s[1:]
+	}
+
+	switch SortField(s) {
+	case "", SortByID:
+		o.Field = SortByID
+	case SortByType:
+		o.Field = SortByType
+	default:
+		return SortOrder{}, fmt.Errorf("%w: %q", ErrInvalidSort, s)
+	}
+
+	return o, nil
+}
+
+// String returns the sort order in the form accepted by ParseSortOrder.
+func (o SortOrder) String() string {
+	if o.Desc {
+		return "-" + string(o.Field)
+	}
+
+	return string(o.Field)
+}
+
+// Cursor points at the last metric of a page; the next page starts right
+// after it.
+type Cursor struct {
+	ID   string     `json:"id"`
+	Type MetricType `json:"type"`
+}
+
+// CursorOf returns the cursor pointing at m.
+func CursorOf(m Metric) *Cursor {
+	return &Cursor{ID: m.GetID(), Type: m.GetType()}
+}
+
+// Encode returns the opaque string form of the cursor.
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor parses a cursor produced by Cursor.Encode.
+func ParseCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// MetricQuery selects, orders and pages metrics. Zero fields select
+// everything.
+type MetricQuery struct {
+	// Type keeps only metrics of the type.
+	Type MetricType
+	// Prefix keeps only metrics whose name starts with it.
+	Prefix string
+	// Regex keeps only metrics whose name matches the RE2 expression.
+	Regex string
+	// IDs keeps only metrics with the listed names.
+	IDs []string
+	// Sort orders the result.
+	Sort SortOrder
+	// Limit is the page size, zero returns all matching metrics.
+	Limit int
+	// After continues the listing after the cursor.
+	After *Cursor
+
+	re *regexp.Regexp
+}
+
+// Validate checks the query and prepares it for Match.
+func (q *MetricQuery) Validate() error {
+	if q.Type != "" && !ValidateType(string(q.Type)) {
+		return ErrInvalidMetricType
+	}
+
+	if q.Limit < 0 || q.Limit > MaxPageLimit {
+		return ErrInvalidLimit
+	}
+
+	if q.Sort.Field == "" {
+		q.Sort.Field = SortByID
+	}
+
+	q.re = nil
+	if q.Regex != "" {
+		re, err := regexp.Compile(q.Regex)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidRegex, err)
+		}
+		q.re = re
+	}
+
+	return nil
+}
+
+// Match reports whether m passes the filters of the query. The query must
+// be validated first.
+func (q *MetricQuery) Match(m Metric) bool {
+	if q.Type != "" && m.GetType() != q.Type {
+		return false
+	}
+
+	if !strings.HasPrefix(m.GetID(), q.Prefix) {
+		return false
+	}
+
+	if q.re != nil && !q.re.MatchString(m.GetID()) {
+		return false
+	}
+
+	return true
+}
+
+// Less reports whether the metric pointed at by a sorts before the one
+// pointed at by b in the order of the query.
+func (q *MetricQuery) Less(a, b *Cursor) bool {
+	less := a.ID < b.ID
+	if q.Sort.Field == SortByType && a.Type != b.Type {
+		less = a.Type < b.Type
+	}
+
+	if q.Sort.Desc {
+		return !less && *a != *b
+	}
+
+	return less
+}
+
+// MetricPage is a page of a query result.
+type MetricPage struct {
+	Metrics []Metric
+	// Next continues the listing, nil on the last page.
+	Next *Cursor
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSortOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    SortOrder
+		wantErr bool
+	}{
+		{name: "empty defaults to id", in: "", want: SortOrder{Field: SortByID}},
+		{name: "id", in: "id", want: SortOrder{Field: SortByID}},
+		{name: "desc id", in: "-id", want: SortOrder{Field: SortByID, Desc: true}},
+		{name: "desc type", in: "-type", want: SortOrder{Field: SortByType, Desc: true}},
+		{name: "unknown", in: "value", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSortOrder(tt.in)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidSort)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCursor(t *testing.T) {
+	c := CursorOf(NewGauge("cpu/load", 1))
+
+	got, err := ParseCursor(c.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, c, got)
+
+	for _, in := range []string{"%%%", "bm90IGpzb24", "e30"} {
+		_, err := ParseCursor(in)
+		assert.ErrorIs(t, err, ErrInvalidCursor, in)
+	}
+}
+
+func TestMetricQuery_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		q       MetricQuery
+		wantErr error
+	}{
+		{name: "empty", q: MetricQuery{}},
+		{name: "full", q: MetricQuery{Type: GaugeType, Regex: "^a", Limit: 10}},
+		{name: "invalid type", q: MetricQuery{Type: "histogram"}, wantErr: ErrInvalidMetricType},
+		{name: "negative limit", q: MetricQuery{Limit: -1}, wantErr: ErrInvalidLimit},
+		{name: "limit too large", q: MetricQuery{Limit: MaxPageLimit + 1}, wantErr: ErrInvalidLimit},
+		{name: "invalid regex", q: MetricQuery{Regex: "("}, wantErr: ErrInvalidRegex},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.q.Validate()
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, SortByID, tt.q.Sort.Field)
+		})
+	}
+}
+
+func TestMetricQuery_Match(t *testing.T) {
+	q := &MetricQuery{Type: GaugeType, Prefix: "cpu", Regex: `\d$`}
+	require.NoError(t, q.Validate())
+
+	assert.True(t, q.Match(NewGauge("cpu1", 1)))
+	assert.False(t, q.Match(NewCounter("cpu1", 1)))
+	assert.False(t, q.Match(NewGauge("mem1", 1)))
+	assert.False(t, q.Match(NewGauge("cpu_total", 1)))
+}
+
+func TestMetricQuery_Less(t *testing.T) {
+	a := &Cursor{ID: "a", Type: GaugeType}
+	b := &Cursor{ID: "b", Type: CounterType}
+
+	tests := []struct {
+		sort string
+		want bool
+	}{
+		{sort: "id", want: true},
+		{sort: "-id", want: false},
+		{sort: "type", want: false},
+		{sort: "-type", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			o, err := ParseSortOrder(tt.sort)
+			require.NoError(t, err)
+
+			q := &MetricQuery{Sort: o}
+			assert.Equal(t, tt.want, q.Less(a, b))
+			assert.Equal(t, !tt.want, q.Less(b, a))
+			assert.False(t, q.Less(a, a))
+		})
+	}
+}
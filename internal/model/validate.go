@@ -0,0 +1,199 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// MaxIDLength is the maximum accepted length of a metric name.
+const MaxIDLength = 255
+
+var (
+	ErrEmptyID         = errors.New("metric name is empty")
+	ErrIDTooLong       = fmt.Errorf("metric name is longer than %d", MaxIDLength)
+	ErrInvalidIDChars  = errors.New("metric name contains invalid characters")
+	ErrMissingDelta    = errors.New("counter metric requires delta")
+	ErrMissingValue    = errors.New("gauge metric requires value")
+	ErrUnexpectedDelta = errors.New("gauge metric must not carry delta")
+	ErrUnexpectedValue = errors.New("counter metric must not carry value")
+	ErrNotFinite       = errors.New("gauge value must be finite")
+)
+
+// ValidationError describes why a single metric of a request was rejected.
+type ValidationError struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id,omitempty"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+	Err    error  `json:"-"`
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("metric %d (%q): %s", e.Index, e.ID, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is a list of per-item validation errors of a batch.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Validator checks incoming metric payloads.
+//
+// In the default (lenient) mode only the name presence and the metric type
+// are checked, matching the behaviour the agents rely on. Strict mode also
+// validates the name charset and length, requires the value field matching
+// the type, rejects the field of the other type and non-finite gauges.
+type Validator struct {
+	strict bool
+}
+
+// NewValidator creates a new Validator.
+func NewValidator(strict bool) *Validator {
+	return &Validator{strict: strict}
+}
+
+// Strict reports whether the validator runs in strict mode.
+func (v *Validator) Strict() bool {
+	return v.strict
+}
+
+// ValidateID checks the metric name.
+func (v *Validator) ValidateID(id string) error {
+	if id == "" {
+		return ErrEmptyID
+	}
+
+	if !v.strict {
+		return nil
+	}
+
+	if len(id) > MaxIDLength {
+		return ErrIDTooLong
+	}
+
+	for i := 0; i < len(id); i++ {
+		if !isIDChar(id[i]) {
+			return ErrInvalidIDChars
+		}
+	}
+
+	return nil
+}
+
+// Validate checks a metric update payload. The returned error is a
+// *ValidationError with index 0.
+func (v *Validator) Validate(m *Metrics) error {
+	field, err := v.validate(m)
+	if err != nil {
+		return newValidationError(0, m, field, err)
+	}
+
+	return nil
+}
+
+// ValidateBatch checks every metric of a batch update and returns the errors
+// of all offending items, or nil if the whole batch is valid.
+func (v *Validator) ValidateBatch(ms []*Metrics) ValidationErrors {
+	var errs ValidationErrors
+	for i, m := range ms {
+		if field, err := v.validate(m); err != nil {
+			errs = append(errs, newValidationError(i, m, field, err))
+		}
+	}
+
+	return errs
+}
+
+// validate returns the offending field name together with the error.
+func (v *Validator) validate(m *Metrics) (string, error) {
+	if m == nil {
+		return "", ErrEmptyID
+	}
+
+	if err := v.ValidateID(m.ID); err != nil {
+		return "id", err
+	}
+
+	if !ValidateType(m.MType) {
+		return "type", ErrInvalidMetricType
+	}
+
+	if !v.strict {
+		return "", nil
+	}
+
+	switch MetricType(m.MType) {
+	case CounterType:
+		if m.Delta == nil {
+			return "delta", ErrMissingDelta
+		}
+		if m.Value != nil {
+			return "value", ErrUnexpectedValue
+		}
+	case GaugeType:
+		if m.Value == nil {
+			return "value", ErrMissingValue
+		}
+		if m.Delta != nil {
+			return "delta", ErrUnexpectedDelta
+		}
+		if math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0) {
+			return "value", ErrNotFinite
+		}
+	}
+
+	return "", nil
+}
+
+func newValidationError(
+	i int,
+	m *Metrics,
+	field string,
+	err error,
+) *ValidationError {
+	ve := &ValidationError{
+		Index:  i,
+		Field:  field,
+		Reason: err.Error(),
+		Err:    err,
+	}
+	if m != nil {
+		ve.ID = m.ID
+	}
+
+	return ve
+}
+
+// isIDChar reports whether c is allowed in a metric name in strict mode.
+func isIDChar(c byte) bool {
+	return c >= 'a' && c <= 'z' ||
+		c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '-' || c == ':'
+}
+
+// SanitizeID replaces the characters strict mode rejects with underscores,
+// so names built from foreign protocols pass validation in either mode.
+func SanitizeID(id string) string {
+	b := []byte(id)
+	for i := range b {
+		if !isIDChar(b[i]) {
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
@@ -1,9 +1,12 @@
 package model
 
 import (
+	"math"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestValidateType(t *testing.T) {
@@ -41,3 +44,160 @@ func TestValidateType(t *testing.T) {
 		})
 	}
 }
+
+func TestValidator_Validate(t *testing.T) {
+	delta := int64(1)
+	value := 1.5
+	nan := math.NaN()
+	inf := math.Inf(1)
+
+	tests := []struct {
+		name      string
+		metric    *Metrics
+		lenient   error
+		strict    error
+		wantField string
+	}{
+		{
+			name:   "valid counter",
+			metric: &Metrics{ID: "c", MType: "counter", Delta: &delta},
+		},
+		{
+			name:   "valid gauge",
+			metric: &Metrics{ID: "g.1:x-y", MType: "gauge", Value: &value},
+		},
+		{
+			name:      "empty id",
+			metric:    &Metrics{MType: "counter", Delta: &delta},
+			lenient:   ErrEmptyID,
+			strict:    ErrEmptyID,
+			wantField: "id",
+		},
+		{
+			name:      "invalid type",
+			metric:    &Metrics{ID: "m", MType: "histogram"},
+			lenient:   ErrInvalidMetricType,
+			strict:    ErrInvalidMetricType,
+			wantField: "type",
+		},
+		{
+			name:      "invalid id chars",
+			metric:    &Metrics{ID: "bad name", MType: "counter", Delta: &delta},
+			strict:    ErrInvalidIDChars,
+			wantField: "id",
+		},
+		{
+			name: "id too long",
+			metric: &Metrics{
+				ID:    strings.Repeat("a", MaxIDLength+1),
+				MType: "counter",
+				Delta: &delta,
+			},
+			strict:    ErrIDTooLong,
+			wantField: "id",
+		},
+		{
+			name:      "counter without delta",
+			metric:    &Metrics{ID: "c", MType: "counter"},
+			strict:    ErrMissingDelta,
+			wantField: "delta",
+		},
+		{
+			name:      "counter with value",
+			metric:    &Metrics{ID: "c", MType: "counter", Delta: &delta, Value: &value},
+			strict:    ErrUnexpectedValue,
+			wantField: "value",
+		},
+		{
+			name:      "gauge without value",
+			metric:    &Metrics{ID: "g", MType: "gauge"},
+			strict:    ErrMissingValue,
+			wantField: "value",
+		},
+		{
+			name:      "gauge with delta",
+			metric:    &Metrics{ID: "g", MType: "gauge", Delta: &delta, Value: &value},
+			strict:    ErrUnexpectedDelta,
+			wantField: "delta",
+		},
+		{
+			name:      "gauge nan",
+			metric:    &Metrics{ID: "g", MType: "gauge", Value: &nan},
+			strict:    ErrNotFinite,
+			wantField: "value",
+		},
+		{
+			name:      "gauge inf",
+			metric:    &Metrics{ID: "g", MType: "gauge", Value: &inf},
+			strict:    ErrNotFinite,
+			wantField: "value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewValidator(false).Validate(tt.metric)
+			if tt.lenient == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.lenient)
+			}
+
+			err = NewValidator(true).Validate(tt.metric)
+			if tt.strict == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, tt.strict)
+
+			var ve *ValidationError
+			require.ErrorAs(t, err, &ve)
+			assert.Equal(t, tt.wantField, ve.Field)
+			assert.Equal(t, tt.strict.Error(), ve.Reason)
+		})
+	}
+}
+
+func TestValidator_ValidateBatch(t *testing.T) {
+	delta := int64(1)
+	value := 1.5
+
+	batch := []*Metrics{
+		{ID: "ok", MType: "counter", Delta: &delta},
+		{ID: "", MType: "gauge", Value: &value},
+		{ID: "g", MType: "gauge", Delta: &delta},
+		{ID: "ok2", MType: "gauge", Value: &value},
+	}
+
+	errs := NewValidator(true).ValidateBatch(batch)
+	require.Len(t, errs, 2)
+
+	assert.Equal(t, 1, errs[0].Index)
+	assert.ErrorIs(t, errs[0], ErrEmptyID)
+
+	assert.Equal(t, 2, errs[1].Index)
+	assert.Equal(t, "g", errs[1].ID)
+	assert.ErrorIs(t, errs[1], ErrMissingValue)
+
+	assert.Nil(t, NewValidator(true).ValidateBatch(batch[:1]))
+}
+
+func TestSanitizeID(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "cpu.usage_idle:0", want: "cpu.usage_idle:0"},
+		{in: "disk used/percent", want: "disk_used_percent"},
+		{in: "a,b=c", want: "a_b_c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := SanitizeID(tt.in)
+			assert.Equal(t, tt.want, got)
+			assert.NoError(t, NewValidator(true).ValidateID(got))
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MQTT 3.1.1 control packet types.
+const (
+	packetConnect    byte = 1
+	packetConnack    byte = 2
+	packetPublish    byte = 3
+	packetPuback     byte = 4
+	packetSubscribe  byte = 8
+	packetSuback     byte = 9
+	packetPingreq    byte = 12
+	packetPingresp   byte = 13
+	packetDisconnect byte = 14
+)
+
+const (
+	protocolLevel311 byte = 4
+
+	connectCleanSession byte = 0x02
+	connectPassword     byte = 0x40
+	connectUsername     byte = 0x80
+
+	// subscribeFlags are the reserved flags of a SUBSCRIBE packet.
+	subscribeFlags byte = 0x02
+	// subscribeFailure is the SUBACK return code of a rejected filter.
+	subscribeFailure byte = 0x80
+
+	// maxRemainingBytes is the longest encoding of a remaining length.
+	maxRemainingBytes = 4
+)
+
+// maxPacketSize bounds the packets read from the broker.
+const maxPacketSize = 1 << 20
+
+var errMalformedPacket = errors.New("malformed mqtt packet")
+
+// packet is a control packet: the type and flags of the fixed header and
+// the rest of the packet.
+type packet struct {
+	typ   byte
+	flags byte
+	body  []byte
+}
+
+// readPacket reads a control packet.
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+
+	var length, shift int
+	for i := 0; ; i++ {
+		if i == maxRemainingBytes {
+			return packet{}, fmt.Errorf("%w: remaining length", errMalformedPacket)
+		}
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		length |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	if length > maxPacketSize {
+		return packet{}, fmt.Errorf(
+			"%w: packet of %d bytes is too large",
+			errMalformedPacket,
+			length,
+		)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+
+	return packet{typ: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// writePacket writes a control packet.
+func writePacket(w io.Writer, typ, flags byte, body []byte) error {
+	buf := make([]byte, 0, len(body)+1+maxRemainingBytes)
+	buf = append(buf, typ<<4|flags)
+
+	n := len(body)
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			break
+		}
+	}
+	buf = append(buf, body...)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errMalformedPacket
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errMalformedPacket
+	}
+
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// connectBody builds a CONNECT packet starting a clean session.
+func connectBody(clientID, username, password string, keepAlive uint16) []byte {
+	flags := connectCleanSession
+	if username != "" {
+		flags |= connectUsername
+		if password != "" {
+			flags |= connectPassword
+		}
+	}
+
+	b := appendString(nil, "MQTT")
+	b = append(b, protocolLevel311, flags)
+	b = binary.BigEndian.AppendUint16(b, keepAlive)
+	b = appendString(b, clientID)
+	if flags&connectUsername != 0 {
+		b = appendString(b, username)
+	}
+	if flags&connectPassword != 0 {
+		b = appendString(b, password)
+	}
+
+	return b
+}
+
+// subscribeBody builds a SUBSCRIBE packet for the filters at QoS 1.
+func subscribeBody(id uint16, filters []string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, id)
+	for _, f := range filters {
+		b = appendString(b, f)
+		b = append(b, 1)
+	}
+
+	return b
+}
+
+// publish is a received PUBLISH packet.
+type publish struct {
+	topic   string
+	qos     byte
+	retain  bool
+	id      uint16
+	payload []byte
+}
+
+func parsePublish(p packet) (publish, error) {
+	msg := publish{
+		qos:    p.flags >> 1 & 0x03,
+		retain: p.flags&0x01 != 0,
+	}
+	if msg.qos > 2 {
+		return publish{}, fmt.Errorf("%w: qos %d", errMalformedPacket, msg.qos)
+	}
+
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return publish{}, err
+	}
+	msg.topic = topic
+
+	if msg.qos > 0 {
+		if len(rest) < 2 {
+			return publish{}, errMalformedPacket
+		}
+		msg.id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	msg.payload = rest
+
+	return msg, nil
+}
@@ -0,0 +1,39 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacket_RoundTrip(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 16383, 16384, 200000} {
+		client, server := net.Pipe()
+
+		body := make([]byte, size)
+		for i := range body {
+			body[i] = byte(i)
+		}
+
+		go func() {
+			writePacket(client, packetPublish, 0x03, body)
+			client.Close()
+		}()
+
+		p, err := readPacket(bufio.NewReader(server))
+		require.NoError(t, err, size)
+		assert.Equal(t, packetPublish, p.typ)
+		assert.Equal(t, byte(0x03), p.flags)
+		assert.Equal(t, body, p.body)
+		server.Close()
+	}
+
+	_, err := readPacket(bufio.NewReader(
+		bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01}),
+	))
+	assert.ErrorIs(t, err, errMalformedPacket)
+}
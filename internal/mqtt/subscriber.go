@@ -0,0 +1,436 @@
+// Package mqtt subscribes to an MQTT broker and stores the published
+// readings as metrics.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/repository"
+	"github.com/fragpit/yandex-go-dev-metrics/pkg/retry"
+)
+
+const (
+	// defaultKeepAlive is the keep alive interval sent to the broker.
+	defaultKeepAlive = 30 * time.Second
+	// dialTimeout bounds connecting and the CONNECT and SUBSCRIBE
+	// handshakes.
+	dialTimeout = 10 * time.Second
+	// storeTimeout bounds storing the metrics of a message.
+	storeTimeout = 5 * time.Second
+	// subscribeID is the packet identifier of the SUBSCRIBE packet, the
+	// only packet the client sends that needs one.
+	subscribeID = 1
+)
+
+// ErrConnectionRefused is returned by Run when the broker refuses the
+// connection for a reason reconnecting does not fix, such as bad
+// credentials.
+var ErrConnectionRefused = errors.New("mqtt connection refused")
+
+// connackErrors are the CONNACK return codes of MQTT 3.1.1.
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Subscriber is an MQTT 3.1.1 client subscribing to the configured topic
+// filters. Messages are mapped to metrics by ingest.MQTT and stored in
+// best-effort mode.
+//
+// Subscriptions use QoS 1 and a clean session: messages are acknowledged
+// after their metrics are stored, the messages published while the client
+// is disconnected are lost. A lost connection is re-established with the
+// backoff of the retrier and the subscriptions are renewed.
+type Subscriber struct {
+	broker    string
+	repo      repository.Repository
+	mapping   *ingest.MQTT
+	validator *model.Validator
+	logger    *slog.Logger
+	clientID  string
+	username  string
+	password  string
+	keepAlive time.Duration
+	retrier   *retry.Retrier
+}
+
+// Option configures a Subscriber.
+type Option func(*Subscriber) error
+
+// WithClientID sets the client identifier, generated by the broker when
+// empty.
+func WithClientID(id string) Option {
+	return func(s *Subscriber) error {
+		s.clientID = id
+		return nil
+	}
+}
+
+// WithCredentials sets the user name and password sent to the broker.
+func WithCredentials(username, password string) Option {
+	return func(s *Subscriber) error {
+		if username == "" && password != "" {
+			return errors.New("mqtt password without user name")
+		}
+		s.username = username
+		s.password = password
+		return nil
+	}
+}
+
+// WithKeepAlive sets the keep alive interval.
+func WithKeepAlive(d time.Duration) Option {
+	return func(s *Subscriber) error {
+		if d < time.Second || d > 0xffff*time.Second {
+			return fmt.Errorf("invalid mqtt keep alive %s", d)
+		}
+		s.keepAlive = d
+		return nil
+	}
+}
+
+// WithBackoff sets the waits between reconnection attempts.
+func WithBackoff(backoff []time.Duration) Option {
+	return func(s *Subscriber) error {
+		s.retrier = retry.NewRetrier(isRetryable, retry.WithBackoff(backoff))
+		return nil
+	}
+}
+
+// WithStrictValidation enables strict validation of incoming metrics.
+func WithStrictValidation(strict bool) Option {
+	return func(s *Subscriber) error {
+		s.validator = model.NewValidator(strict)
+		return nil
+	}
+}
+
+// WithLogger sets the logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Subscriber) error {
+		s.logger = logger
+		return nil
+	}
+}
+
+// New creates a new Subscriber of the broker at host:port. Subscriptions
+// are in the form filter[=type], see ingest.ParseMQTTSubscription.
+func New(
+	broker string,
+	subscriptions []string,
+	repo repository.Repository,
+	opts ...Option,
+) (*Subscriber, error) {
+	if broker == "" {
+		return nil, errors.New("no mqtt broker address")
+	}
+
+	mapping, err := ingest.NewMQTT(subscriptions)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subscriber{
+		broker:    broker,
+		repo:      repo,
+		mapping:   mapping,
+		validator: model.NewValidator(false),
+		logger:    slog.Default(),
+		keepAlive: defaultKeepAlive,
+		retrier:   retry.NewRetrier(isRetryable),
+	}
+
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func isRetryable(err error) bool {
+	return !errors.Is(err, ErrConnectionRefused)
+}
+
+// Run keeps a session with the broker until ctx is cancelled, reconnecting
+// whenever the connection is lost. It fails only when the broker refuses
+// the connection for good.
+func (s *Subscriber) Run(ctx context.Context) error {
+	for {
+		err := s.retrier.Do(ctx, s.session)
+		if ctx.Err() != nil {
+			s.logger.Info("mqtt subscriber shut down gracefully")
+			return nil
+		}
+		if errors.Is(err, ErrConnectionRefused) {
+			return err
+		}
+
+		s.logger.Warn(
+			"mqtt broker unavailable, reconnecting",
+			slog.String("broker", s.broker),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// session connects, subscribes and handles messages until the connection
+// is lost or ctx is cancelled.
+func (s *Subscriber) session(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.broker)
+	if err != nil {
+		return err
+	}
+
+	c := &sessionConn{conn: conn}
+	stop := context.AfterFunc(ctx, func() {
+		c.write(packetDisconnect, 0, nil)
+		conn.Close()
+	})
+	defer func() {
+		if stop() {
+			conn.Close()
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	if err := s.handshake(ctx, c, r); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	s.logger.Info(
+		"mqtt subscriber connected",
+		slog.String("broker", s.broker),
+	)
+
+	pingDone := make(chan struct{})
+	defer close(pingDone)
+	go s.ping(c, pingDone)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(s.keepAlive * 3 / 2))
+		p, err := readPacket(r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("mqtt connection lost: %w", err)
+		}
+
+		switch p.typ {
+		case packetPublish:
+			if err := s.handlePublish(ctx, c, p); err != nil {
+				return err
+			}
+		case packetPingresp:
+			// the read deadline is renewed by any packet
+		default:
+			s.logger.Debug("skipping mqtt packet", slog.Int("type", int(p.typ)))
+		}
+	}
+}
+
+// handshake connects and subscribes.
+func (s *Subscriber) handshake(
+	ctx context.Context,
+	c *sessionConn,
+	r *bufio.Reader,
+) error {
+	c.conn.SetDeadline(time.Now().Add(dialTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	keepAlive := uint16(s.keepAlive / time.Second)
+	if err := c.write(
+		packetConnect,
+		0,
+		connectBody(s.clientID, s.username, s.password, keepAlive),
+	); err != nil {
+		return err
+	}
+
+	p, err := readPacket(r)
+	if err != nil {
+		return err
+	}
+	if p.typ != packetConnack || len(p.body) != 2 {
+		return fmt.Errorf("%w: expected connack", errMalformedPacket)
+	}
+	if code := p.body[1]; code != 0 {
+		reason, ok := connackErrors[code]
+		if !ok {
+			reason = fmt.Sprintf("return code %d", code)
+		}
+		if code == 3 {
+			return errors.New(reason)
+		}
+		return fmt.Errorf("%w: %s", ErrConnectionRefused, reason)
+	}
+
+	subs := s.mapping.Subscriptions()
+	filters := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		filters = append(filters, sub.Filter)
+	}
+
+	if err := c.write(
+		packetSubscribe,
+		subscribeFlags,
+		subscribeBody(subscribeID, filters),
+	); err != nil {
+		return err
+	}
+
+	// the broker may deliver retained messages before the SUBACK
+	for {
+		p, err = readPacket(r)
+		if err != nil {
+			return err
+		}
+		if p.typ == packetSuback {
+			break
+		}
+		if p.typ == packetPublish {
+			if err := s.handlePublish(ctx, c, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	codes := p.body[min(2, len(p.body)):]
+	if len(codes) != len(filters) {
+		return fmt.Errorf("%w: suback", errMalformedPacket)
+	}
+
+	var rejected []string
+	for i, code := range codes {
+		if code == subscribeFailure {
+			rejected = append(rejected, filters[i])
+		}
+	}
+	if len(rejected) == len(filters) {
+		return fmt.Errorf("%w: subscriptions rejected", ErrConnectionRefused)
+	}
+	if len(rejected) > 0 {
+		s.logger.Warn(
+			"mqtt subscriptions rejected",
+			slog.String("filters", strings.Join(rejected, ",")),
+		)
+	}
+
+	return nil
+}
+
+// ping sends a PINGREQ every keep alive interval until done is closed.
+func (s *Subscriber) ping(c *sessionConn, done <-chan struct{}) {
+	ticker := time.NewTicker(s.keepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.write(packetPingreq, 0, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handlePublish stores the metrics of a message and acknowledges it.
+// Malformed messages are logged and acknowledged too, redelivering them
+// would not help.
+func (s *Subscriber) handlePublish(
+	ctx context.Context,
+	c *sessionConn,
+	p packet,
+) error {
+	msg, err := parsePublish(p)
+	if err != nil {
+		return err
+	}
+
+	// a retained counter reading was counted when it was published
+	if msg.retain && s.mapping.TypeOf(msg.topic) == model.CounterType {
+		s.logger.Debug(
+			"skipping retained mqtt counter",
+			slog.String("topic", msg.topic),
+		)
+	} else {
+		s.store(ctx, msg)
+	}
+
+	if msg.qos == 1 {
+		return c.write(packetPuback, 0, binary.BigEndian.AppendUint16(nil, msg.id))
+	}
+
+	return nil
+}
+
+func (s *Subscriber) store(ctx context.Context, msg publish) {
+	metrics, err := s.mapping.Metrics(msg.topic, msg.payload)
+	if err != nil {
+		s.logger.Warn("skipping mqtt message", slog.Any("error", err))
+		return
+	}
+	if len(metrics) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+
+	res, err := repository.ApplyBatch(
+		ctx,
+		s.repo,
+		s.validator,
+		metrics,
+		model.BatchBestEffort,
+	)
+	if err != nil {
+		s.logger.Error("failed to store mqtt metrics", slog.Any("error", err))
+		return
+	}
+
+	if res.Rejected > 0 {
+		s.logger.Warn(
+			"mqtt metrics rejected",
+			slog.String("topic", msg.topic),
+			slog.Int("applied", res.Applied),
+			slog.Int("rejected", res.Rejected),
+		)
+	}
+}
+
+// sessionConn serializes the writes of the reader and the pinger.
+type sessionConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (c *sessionConn) write(typ, flags byte, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	return writePacket(c.conn, typ, flags, body)
+}
@@ -0,0 +1,328 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+// testBroker is an in-process MQTT broker serving one subscriber at a time.
+type testBroker struct {
+	ln         net.Listener
+	returnCode byte
+	sessions   chan *brokerSession
+}
+
+// brokerSession is a subscriber connection accepted by the test broker.
+type brokerSession struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	clientID string
+	username string
+	password string
+	filters  []string
+}
+
+func newTestBroker(t *testing.T, returnCode byte) *testBroker {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	b := &testBroker{
+		ln:         ln,
+		returnCode: returnCode,
+		sessions:   make(chan *brokerSession, 4),
+	}
+	go b.accept(t)
+
+	return b
+}
+
+func (b *testBroker) addr() string {
+	return b.ln.Addr().String()
+}
+
+func (b *testBroker) accept(t *testing.T) {
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		s := &brokerSession{conn: conn, r: bufio.NewReader(conn)}
+		if !s.handshake(t, b.returnCode) {
+			conn.Close()
+			continue
+		}
+		b.sessions <- s
+	}
+}
+
+func (s *brokerSession) handshake(t *testing.T, returnCode byte) bool {
+	p, err := readPacket(s.r)
+	if !assert.NoError(t, err) || !assert.Equal(t, packetConnect, p.typ) {
+		return false
+	}
+
+	proto, rest, err := readString(p.body)
+	require.NoError(t, err)
+	assert.Equal(t, "MQTT", proto)
+	assert.Equal(t, protocolLevel311, rest[0])
+	flags := rest[1]
+	assert.NotZero(t, flags&connectCleanSession)
+
+	s.clientID, rest, err = readString(rest[4:])
+	require.NoError(t, err)
+	if flags&connectUsername != 0 {
+		s.username, rest, err = readString(rest)
+		require.NoError(t, err)
+	}
+	if flags&connectPassword != 0 {
+		s.password, _, err = readString(rest)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, writePacket(s.conn, packetConnack, 0, []byte{0, returnCode}))
+	if returnCode != 0 {
+		return false
+	}
+
+	p, err = readPacket(s.r)
+	if !assert.NoError(t, err) || !assert.Equal(t, packetSubscribe, p.typ) {
+		return false
+	}
+	assert.Equal(t, subscribeFlags, p.flags)
+
+	id := p.body[:2]
+	codes := []byte{}
+	for rest := p.body[2:]; len(rest) > 0; {
+		var filter string
+		filter, rest, err = readString(rest)
+		require.NoError(t, err)
+		assert.Equal(t, byte(1), rest[0])
+		rest = rest[1:]
+
+		s.filters = append(s.filters, filter)
+		codes = append(codes, 1)
+	}
+
+	require.NoError(t, writePacket(s.conn, packetSuback, 0, append(id, codes...)))
+	return true
+}
+
+func (s *brokerSession) publish(
+	t *testing.T,
+	topic, payload string,
+	qos byte,
+	retain bool,
+	id uint16,
+) {
+	t.Helper()
+
+	flags := qos << 1
+	if retain {
+		flags |= 0x01
+	}
+
+	body := appendString(nil, topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+
+	require.NoError(t, writePacket(s.conn, packetPublish, flags, body))
+}
+
+// expect returns the next packet the subscriber sends, skipping pings.
+func (s *brokerSession) expect(t *testing.T, typ byte) packet {
+	t.Helper()
+
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		p, err := readPacket(s.r)
+		require.NoError(t, err)
+		if p.typ == packetPingreq {
+			require.NoError(t, writePacket(s.conn, packetPingresp, 0, nil))
+			continue
+		}
+
+		require.Equal(t, typ, p.typ)
+		return p
+	}
+}
+
+func (b *testBroker) session(t *testing.T) *brokerSession {
+	t.Helper()
+
+	select {
+	case s := <-b.sessions:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber did not connect")
+		return nil
+	}
+}
+
+func TestNew(t *testing.T) {
+	subs := []string{"sensors/#"}
+
+	tests := []struct {
+		name    string
+		broker  string
+		subs    []string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "valid", broker: "localhost:1883", subs: subs},
+		{
+			name:   "with options",
+			broker: "localhost:1883",
+			subs:   subs,
+			opts: []Option{
+				WithClientID("metrics"),
+				WithCredentials("user", "pass"),
+				WithKeepAlive(time.Minute),
+			},
+		},
+		{name: "no broker", subs: subs, wantErr: true},
+		{name: "no subscriptions", broker: "localhost:1883", wantErr: true},
+		{
+			name:    "invalid subscription",
+			broker:  "localhost:1883",
+			subs:    []string{"a/#/b"},
+			wantErr: true,
+		},
+		{
+			name:    "password without user",
+			broker:  "localhost:1883",
+			subs:    subs,
+			opts:    []Option{WithCredentials("", "pass")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid keep alive",
+			broker:  "localhost:1883",
+			subs:    subs,
+			opts:    []Option{WithKeepAlive(time.Millisecond)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.broker, tt.subs, memstorage.NewMemoryStorage(), tt.opts...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSubscriber_Run(t *testing.T) {
+	broker := newTestBroker(t, 0)
+
+	repo := memstorage.NewMemoryStorage()
+	require.NoError(t, repo.Initialize([]model.Metric{
+		model.NewCounter("meters.water", 10),
+	}))
+
+	s, err := New(
+		broker.addr(),
+		[]string{"meters/#=counter", "sensors/#"},
+		repo,
+		WithClientID("metrics"),
+		WithCredentials("user", "pass"),
+		WithBackoff([]time.Duration{10 * time.Millisecond}),
+		WithLogger(slog.New(slog.DiscardHandler)),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	session := broker.session(t)
+	assert.Equal(t, "metrics", session.clientID)
+	assert.Equal(t, "user", session.username)
+	assert.Equal(t, "pass", session.password)
+	assert.Equal(t, []string{"meters/#", "sensors/#"}, session.filters)
+
+	session.publish(t, "meters/water", "5", 1, true, 7)
+	session.publish(t, "sensors/kitchen", `{"temp":21.5,"humidity":40}`, 0, false, 0)
+	session.publish(t, "meters/water", "3", 1, false, 8)
+	session.publish(t, "meters/water", "0.5", 1, false, 9)
+
+	for _, id := range []uint16{7, 8, 9} {
+		p := session.expect(t, packetPuback)
+		assert.Equal(t, id, binary.BigEndian.Uint16(p.body))
+	}
+
+	value := func(id string) string {
+		m, err := repo.GetMetric(context.Background(), id)
+		if err != nil {
+			return ""
+		}
+		return m.GetValue()
+	}
+	assert.Equal(t, "13", value("meters.water"))
+	assert.Equal(t, "21.5", value("sensors.kitchen.temp"))
+	assert.Equal(t, "40", value("sensors.kitchen.humidity"))
+
+	// the subscriber reconnects and subscribes again
+	session.conn.Close()
+	session = broker.session(t)
+	assert.Equal(t, []string{"meters/#", "sensors/#"}, session.filters)
+
+	session.publish(t, "meters/water", "2", 1, false, 1)
+	session.expect(t, packetPuback)
+	assert.Equal(t, "15", value("meters.water"))
+
+	cancel()
+	session.expect(t, packetDisconnect)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscriber did not shut down")
+	}
+}
+
+func TestSubscriber_Run_Refused(t *testing.T) {
+	broker := newTestBroker(t, 4)
+
+	s, err := New(
+		broker.addr(),
+		[]string{"sensors/#"},
+		memstorage.NewMemoryStorage(),
+		WithBackoff([]time.Duration{10 * time.Millisecond}),
+		WithLogger(slog.New(slog.DiscardHandler)),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = s.Run(ctx)
+	assert.ErrorIs(t, err, ErrConnectionRefused)
+}
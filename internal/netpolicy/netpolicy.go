@@ -0,0 +1,254 @@
+// Package netpolicy decides which client addresses may reach the APIs.
+//
+// Rules list allowed and denied CIDRs, IPv4 or IPv6. An address passes the
+// rules when it is in none of the denied CIDRs and in one of the allowed
+// ones, any address passing when no CIDR is allowed. A Policy has rules
+// for every request and separate rules for reads and writes: a read passes
+// both the common and the read rules.
+//
+// The client is the remote address of the connection. The X-Forwarded-For
+// and X-Real-IP headers, or their gRPC metadata, are only honoured when the
+// connection comes from a trusted proxy.
+package netpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidAddress reports a client address that cannot be parsed.
+var ErrInvalidAddress = errors.New("invalid client address")
+
+// Kind is the kind of access of a request.
+type Kind int
+
+const (
+	// KindAny is checked against the common rules only.
+	KindAny Kind = iota
+	// KindRead reads metrics.
+	KindRead
+	// KindWrite updates metrics.
+	KindWrite
+)
+
+// Rules are the allowed and denied CIDRs.
+type Rules struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// ParseRules parses the allowed and denied CIDRs.
+func ParseRules(allow, deny []string) (Rules, error) {
+	var r Rules
+	var err error
+	if r.Allow, err = parsePrefixes(allow); err != nil {
+		return Rules{}, err
+	}
+	if r.Deny, err = parsePrefixes(deny); err != nil {
+		return Rules{}, err
+	}
+
+	return r, nil
+}
+
+// Allows reports whether the address passes the rules.
+func (r Rules) Allows(ip netip.Addr) bool {
+	if contains(r.Deny, ip) {
+		return false
+	}
+
+	return len(r.Allow) == 0 || contains(r.Allow, ip)
+}
+
+// Policy is the access policy of the APIs.
+type Policy struct {
+	common  Rules
+	read    Rules
+	write   Rules
+	proxies []netip.Prefix
+}
+
+// Option configures a Policy.
+type Option func(*Policy) error
+
+// WithRules sets the rules of every request.
+func WithRules(allow, deny []string) Option {
+	return func(p *Policy) error {
+		r, err := ParseRules(allow, deny)
+		if err != nil {
+			return err
+		}
+		p.common.Allow = append(p.common.Allow, r.Allow...)
+		p.common.Deny = append(p.common.Deny, r.Deny...)
+		return nil
+	}
+}
+
+// WithReadRules sets the rules of the reads.
+func WithReadRules(allow, deny []string) Option {
+	return func(p *Policy) error {
+		r, err := ParseRules(allow, deny)
+		if err != nil {
+			return fmt.Errorf("read rules: %w", err)
+		}
+		p.read = r
+		return nil
+	}
+}
+
+// WithWriteRules sets the rules of the writes.
+func WithWriteRules(allow, deny []string) Option {
+	return func(p *Policy) error {
+		r, err := ParseRules(allow, deny)
+		if err != nil {
+			return fmt.Errorf("write rules: %w", err)
+		}
+		p.write = r
+		return nil
+	}
+}
+
+// WithTrustedProxies sets the CIDRs of the proxies whose forwarded client
+// addresses are trusted.
+func WithTrustedProxies(cidrs []string) Option {
+	return func(p *Policy) error {
+		proxies, err := parsePrefixes(cidrs)
+		if err != nil {
+			return fmt.Errorf("trusted proxies: %w", err)
+		}
+		p.proxies = proxies
+		return nil
+	}
+}
+
+// New creates a policy, one that allows every address without options.
+func New(opts ...Option) (*Policy, error) {
+	p := &Policy{}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Allows reports whether the client may make a request of the kind.
+func (p *Policy) Allows(ip netip.Addr, kind Kind) bool {
+	if !p.common.Allows(ip) {
+		return false
+	}
+
+	switch kind {
+	case KindRead:
+		return p.read.Allows(ip)
+	case KindWrite:
+		return p.write.Allows(ip)
+	default:
+		return true
+	}
+}
+
+// Client returns the address of the client of a connection from
+// remoteAddr, a host:port or a bare address. When the connection comes
+// from a trusted proxy, the client is the rightmost address of the
+// X-Forwarded-For values that is not a trusted proxy, or the X-Real-IP
+// value without X-Forwarded-For.
+func (p *Policy) Client(
+	remoteAddr string,
+	forwardedFor []string,
+	realIP string,
+) (netip.Addr, error) {
+	remote, err := parseAddr(remoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	if !contains(p.proxies, remote) {
+		return remote, nil
+	}
+
+	var hops []string
+	for _, v := range forwardedFor {
+		for _, hop := range strings.Split(v, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	if len(hops) == 0 {
+		if realIP == "" {
+			return remote, nil
+		}
+		return parseAddr(realIP)
+	}
+
+	client := remote
+	for _, hop := range slices.Backward(hops) {
+		if client, err = parseAddr(hop); err != nil {
+			return netip.Addr{}, err
+		}
+		if !contains(p.proxies, client) {
+			break
+		}
+	}
+
+	return client, nil
+}
+
+type clientKey struct{}
+
+// NewContext returns a context carrying the client address.
+func NewContext(ctx context.Context, ip netip.Addr) context.Context {
+	return context.WithValue(ctx, clientKey{}, ip)
+}
+
+// FromContext returns the client address of the context.
+func FromContext(ctx context.Context) (netip.Addr, bool) {
+	ip, ok := ctx.Value(clientKey{}).(netip.Addr)
+	return ip, ok
+}
+
+// parseAddr parses a host:port or a bare address, IPv4-mapped IPv6
+// addresses becoming IPv4 ones.
+func parseAddr(s string) (netip.Addr, error) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+
+	ip, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("%w: %q", ErrInvalidAddress, s)
+	}
+
+	return ip.Unmap(), nil
+}
+
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, c := range cidrs {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(c))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", c, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func contains(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
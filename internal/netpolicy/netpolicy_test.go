@@ -0,0 +1,167 @@
+package netpolicy
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicy_Allows(t *testing.T) {
+	p, err := New(
+		WithRules([]string{"10.0.0.0/8", "2001:db8::/32"}, []string{"10.0.99.0/24"}),
+		WithReadRules(nil, []string{"10.0.1.0/24"}),
+		WithWriteRules([]string{"10.0.1.0/24", "2001:db8:1::/48"}, nil),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		ip        string
+		wantAny   bool
+		wantRead  bool
+		wantWrite bool
+	}{
+		{ip: "10.0.0.1", wantAny: true, wantRead: true},
+		{ip: "10.0.1.1", wantAny: true, wantWrite: true},
+		{ip: "10.0.99.1"},
+		{ip: "192.168.1.1"},
+		{ip: "2001:db8::1", wantAny: true, wantRead: true},
+		{ip: "2001:db8:1::1", wantAny: true, wantRead: true, wantWrite: true},
+		{ip: "2001:db9::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := netip.MustParseAddr(tt.ip)
+			assert.Equal(t, tt.wantAny, p.Allows(ip, KindAny))
+			assert.Equal(t, tt.wantRead, p.Allows(ip, KindRead))
+			assert.Equal(t, tt.wantWrite, p.Allows(ip, KindWrite))
+		})
+	}
+}
+
+func TestPolicy_AllowsEverything(t *testing.T) {
+	p, err := New()
+	require.NoError(t, err)
+
+	assert.True(t, p.Allows(netip.MustParseAddr("192.168.1.1"), KindWrite))
+	assert.True(t, p.Allows(netip.MustParseAddr("::1"), KindRead))
+}
+
+func TestPolicy_Client(t *testing.T) {
+	p, err := New(WithTrustedProxies([]string{"10.0.0.0/24", "fd00::/64"}))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		realIP       string
+		want         string
+		wantErr      error
+	}{
+		{
+			name:       "direct",
+			remoteAddr: "192.168.1.10:51234",
+			want:       "192.168.1.10",
+		},
+		{
+			name:         "forwarded headers of an untrusted peer",
+			remoteAddr:   "192.168.1.10:51234",
+			forwardedFor: []string{"10.1.1.1"},
+			realIP:       "10.1.1.2",
+			want:         "192.168.1.10",
+		},
+		{
+			name:       "ipv6",
+			remoteAddr: "[2001:db8::1]:51234",
+			want:       "2001:db8::1",
+		},
+		{
+			name:       "ipv4 mapped",
+			remoteAddr: "[::ffff:192.168.1.10]:51234",
+			want:       "192.168.1.10",
+		},
+		{
+			name:       "bare address",
+			remoteAddr: "192.168.1.10",
+			want:       "192.168.1.10",
+		},
+		{
+			name:         "proxy",
+			remoteAddr:   "10.0.0.1:51234",
+			forwardedFor: []string{"192.168.1.10"},
+			want:         "192.168.1.10",
+		},
+		{
+			name:         "proxy chain",
+			remoteAddr:   "10.0.0.1:51234",
+			forwardedFor: []string{"1.2.3.4, 192.168.1.10", "10.0.0.2"},
+			want:         "192.168.1.10",
+		},
+		{
+			name:         "only proxies",
+			remoteAddr:   "10.0.0.1:51234",
+			forwardedFor: []string{"10.0.0.3, 10.0.0.2"},
+			want:         "10.0.0.3",
+		},
+		{
+			name:       "proxy real ip",
+			remoteAddr: "[fd00::1]:51234",
+			realIP:     "2001:db8::5",
+			want:       "2001:db8::5",
+		},
+		{
+			name:       "proxy without headers",
+			remoteAddr: "10.0.0.1:51234",
+			want:       "10.0.0.1",
+		},
+		{
+			name:         "invalid forwarded address",
+			remoteAddr:   "10.0.0.1:51234",
+			forwardedFor: []string{"not-an-ip"},
+			wantErr:      ErrInvalidAddress,
+		},
+		{
+			name:       "invalid remote address",
+			remoteAddr: "pipe",
+			wantErr:    ErrInvalidAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.Client(tt.remoteAddr, tt.forwardedFor, tt.realIP)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, netip.MustParseAddr(tt.want), got)
+		})
+	}
+}
+
+func TestNew_InvalidCIDR(t *testing.T) {
+	_, err := New(WithRules([]string{"10.0.0.0/33"}, nil))
+	assert.Error(t, err)
+
+	_, err = New(WithWriteRules(nil, []string{"host"}))
+	assert.Error(t, err)
+
+	_, err = New(WithTrustedProxies([]string{"10.0.0.1"}))
+	assert.Error(t, err)
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	ip := netip.MustParseAddr("2001:db8::1")
+	got, ok := FromContext(NewContext(context.Background(), ip))
+	assert.True(t, ok)
+	assert.Equal(t, ip, got)
+}
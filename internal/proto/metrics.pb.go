@@ -65,6 +65,102 @@ func (x Metric_MType) Number() protoreflect.EnumNumber {
 	return protoreflect.EnumNumber(x)
 }
 
+// BatchMode задаёт поведение при отказе в отдельных метриках.
+type UpdateMetricsRequest_BatchMode int32
+
+const (
+	UpdateMetricsRequest_BATCH_MODE_UNSPECIFIED UpdateMetricsRequest_BatchMode = 0 // то же, что BATCH_MODE_ATOMIC
+	UpdateMetricsRequest_BATCH_MODE_ATOMIC      UpdateMetricsRequest_BatchMode = 1 // применить все метрики или ни одной
+	UpdateMetricsRequest_BATCH_MODE_BEST_EFFORT UpdateMetricsRequest_BatchMode = 2 // применить все метрики, какие возможно
+)
+
+// Enum value maps for UpdateMetricsRequest_BatchMode.
+var (
+	UpdateMetricsRequest_BatchMode_name = map[int32]string{
+		0: "BATCH_MODE_UNSPECIFIED",
+		1: "BATCH_MODE_ATOMIC",
+		2: "BATCH_MODE_BEST_EFFORT",
+	}
+	UpdateMetricsRequest_BatchMode_value = map[string]int32{
+		"BATCH_MODE_UNSPECIFIED": 0,
+		"BATCH_MODE_ATOMIC":      1,
+		"BATCH_MODE_BEST_EFFORT": 2,
+	}
+)
+
+func (x UpdateMetricsRequest_BatchMode) Enum() *UpdateMetricsRequest_BatchMode {
+	p := new(UpdateMetricsRequest_BatchMode)
+	*p = x
+	return p
+}
+
+func (x UpdateMetricsRequest_BatchMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (UpdateMetricsRequest_BatchMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_internal_proto_metrics_proto_enumTypes[1].Descriptor()
+}
+
+func (UpdateMetricsRequest_BatchMode) Type() protoreflect.EnumType {
+	return &file_internal_proto_metrics_proto_enumTypes[1]
+}
+
+func (x UpdateMetricsRequest_BatchMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Status задаёт исход применения метрики.
+type MetricResult_Status int32
+
+const (
+	MetricResult_STATUS_UNSPECIFIED   MetricResult_Status = 0
+	MetricResult_STATUS_APPLIED       MetricResult_Status = 1 // метрика сохранена
+	MetricResult_STATUS_INVALID       MetricResult_Status = 2 // метрика не прошла проверку
+	MetricResult_STATUS_TYPE_CONFLICT MetricResult_Status = 3 // метрика уже существует с другим типом
+	MetricResult_STATUS_SKIPPED       MetricResult_Status = 4 // атомарный батч отменён другой метрикой
+)
+
+// Enum value maps for MetricResult_Status.
+var (
+	MetricResult_Status_name = map[int32]string{
+		0: "STATUS_UNSPECIFIED",
+		1: "STATUS_APPLIED",
+		2: "STATUS_INVALID",
+		3: "STATUS_TYPE_CONFLICT",
+		4: "STATUS_SKIPPED",
+	}
+	MetricResult_Status_value = map[string]int32{
+		"STATUS_UNSPECIFIED":   0,
+		"STATUS_APPLIED":       1,
+		"STATUS_INVALID":       2,
+		"STATUS_TYPE_CONFLICT": 3,
+		"STATUS_SKIPPED":       4,
+	}
+)
+
+func (x MetricResult_Status) Enum() *MetricResult_Status {
+	p := new(MetricResult_Status)
+	*p = x
+	return p
+}
+
+func (x MetricResult_Status) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (MetricResult_Status) Descriptor() protoreflect.EnumDescriptor {
+	return file_internal_proto_metrics_proto_enumTypes[2].Descriptor()
+}
+
+func (MetricResult_Status) Type() protoreflect.EnumType {
+	return &file_internal_proto_metrics_proto_enumTypes[2]
+}
+
+func (x MetricResult_Status) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
 // Metric определяет единичную метрику.
 type Metric struct {
 	state                  protoimpl.MessageState `protogen:"opaque.v1"`
@@ -240,10 +336,13 @@ func (b0 Metric_builder) Build() *Metric {
 
 // UpdateMetricsRequest содержит список метрик для обновления.
 type UpdateMetricsRequest struct {
-	state              protoimpl.MessageState `protogen:"opaque.v1"`
-	xxx_hidden_Metrics *[]*Metric             `protobuf:"bytes,1,rep,name=metrics"`
-	unknownFields      protoimpl.UnknownFields
-	sizeCache          protoimpl.SizeCache
+	state                  protoimpl.MessageState         `protogen:"opaque.v1"`
+	xxx_hidden_Metrics     *[]*Metric                     `protobuf:"bytes,1,rep,name=metrics"`
+	xxx_hidden_Mode        UpdateMetricsRequest_BatchMode `protobuf:"varint,2,opt,name=mode,enum=metrics.UpdateMetricsRequest_BatchMode"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
 }
 
 func (x *UpdateMetricsRequest) Reset() {
@@ -280,14 +379,41 @@ func (x *UpdateMetricsRequest) GetMetrics() []*Metric {
 	return nil
 }
 
+func (x *UpdateMetricsRequest) GetMode() UpdateMetricsRequest_BatchMode {
+	if x != nil {
+		if protoimpl.X.Present(&(x.XXX_presence[0]), 1) {
+			return x.xxx_hidden_Mode
+		}
+	}
+	return UpdateMetricsRequest_BATCH_MODE_UNSPECIFIED
+}
+
 func (x *UpdateMetricsRequest) SetMetrics(v []*Metric) {
 	x.xxx_hidden_Metrics = &v
 }
 
+func (x *UpdateMetricsRequest) SetMode(v UpdateMetricsRequest_BatchMode) {
+	x.xxx_hidden_Mode = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 2)
+}
+
+func (x *UpdateMetricsRequest) HasMode() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *UpdateMetricsRequest) ClearMode() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_Mode = UpdateMetricsRequest_BATCH_MODE_UNSPECIFIED
+}
+
 type UpdateMetricsRequest_builder struct {
 	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
 
 	Metrics []*Metric
+	Mode    *UpdateMetricsRequest_BatchMode
 }
 
 func (b0 UpdateMetricsRequest_builder) Build() *UpdateMetricsRequest {
@@ -295,19 +421,228 @@ func (b0 UpdateMetricsRequest_builder) Build() *UpdateMetricsRequest {
 	b, x := &b0, m0
 	_, _ = b, x
 	x.xxx_hidden_Metrics = &b.Metrics
+	if b.Mode != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 2)
+		x.xxx_hidden_Mode = *b.Mode
+	}
+	return m0
+}
+
+// MetricResult описывает исход применения одной метрики батча.
+type MetricResult struct {
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Index       uint32                 `protobuf:"varint,1,opt,name=index"`
+	xxx_hidden_Status      MetricResult_Status    `protobuf:"varint,2,opt,name=status,enum=metrics.MetricResult_Status"`
+	xxx_hidden_Metric      *Metric                `protobuf:"bytes,3,opt,name=metric"`
+	xxx_hidden_Field       *string                `protobuf:"bytes,4,opt,name=field"`
+	xxx_hidden_Reason      *string                `protobuf:"bytes,5,opt,name=reason"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
+}
+
+func (x *MetricResult) Reset() {
+	*x = MetricResult{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricResult) ProtoMessage() {}
+
+func (x *MetricResult) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+func (x *MetricResult) GetIndex() uint32 {
+	if x != nil {
+		return x.xxx_hidden_Index
+	}
+	return 0
+}
+
+func (x *MetricResult) GetStatus() MetricResult_Status {
+	if x != nil {
+		if protoimpl.X.Present(&(x.XXX_presence[0]), 1) {
+			return x.xxx_hidden_Status
+		}
+	}
+	return MetricResult_STATUS_UNSPECIFIED
+}
+
+func (x *MetricResult) GetMetric() *Metric {
+	if x != nil {
+		return x.xxx_hidden_Metric
+	}
+	return nil
+}
+
+func (x *MetricResult) GetField() string {
+	if x != nil {
+		if x.xxx_hidden_Field != nil {
+			return *x.xxx_hidden_Field
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *MetricResult) GetReason() string {
+	if x != nil {
+		if x.xxx_hidden_Reason != nil {
+			return *x.xxx_hidden_Reason
+		}
+		return ""
+	}
+	return ""
+}
+
+func (x *MetricResult) SetIndex(v uint32) {
+	x.xxx_hidden_Index = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 0, 5)
+}
+
+func (x *MetricResult) SetStatus(v MetricResult_Status) {
+	x.xxx_hidden_Status = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 5)
+}
+
+func (x *MetricResult) SetMetric(v *Metric) {
+	x.xxx_hidden_Metric = v
+}
+
+func (x *MetricResult) SetField(v string) {
+	x.xxx_hidden_Field = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 3, 5)
+}
+
+func (x *MetricResult) SetReason(v string) {
+	x.xxx_hidden_Reason = &v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 4, 5)
+}
+
+func (x *MetricResult) HasIndex() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 0)
+}
+
+func (x *MetricResult) HasStatus() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *MetricResult) HasMetric() bool {
+	if x == nil {
+		return false
+	}
+	return x.xxx_hidden_Metric != nil
+}
+
+func (x *MetricResult) HasField() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 3)
+}
+
+func (x *MetricResult) HasReason() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 4)
+}
+
+func (x *MetricResult) ClearIndex() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 0)
+	x.xxx_hidden_Index = 0
+}
+
+func (x *MetricResult) ClearStatus() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_Status = MetricResult_STATUS_UNSPECIFIED
+}
+
+func (x *MetricResult) ClearMetric() {
+	x.xxx_hidden_Metric = nil
+}
+
+func (x *MetricResult) ClearField() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 3)
+	x.xxx_hidden_Field = nil
+}
+
+func (x *MetricResult) ClearReason() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 4)
+	x.xxx_hidden_Reason = nil
+}
+
+type MetricResult_builder struct {
+	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
+
+	Index  *uint32
+	Status *MetricResult_Status
+	// Итоговое значение сохранённой метрики, для остальных — переданное.
+	Metric *Metric
+	Field  *string
+	Reason *string
+}
+
+func (b0 MetricResult_builder) Build() *MetricResult {
+	m0 := &MetricResult{}
+	b, x := &b0, m0
+	_, _ = b, x
+	if b.Index != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 0, 5)
+		x.xxx_hidden_Index = *b.Index
+	}
+	if b.Status != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 5)
+		x.xxx_hidden_Status = *b.Status
+	}
+	x.xxx_hidden_Metric = b.Metric
+	if b.Field != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 3, 5)
+		x.xxx_hidden_Field = b.Field
+	}
+	if b.Reason != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 4, 5)
+		x.xxx_hidden_Reason = b.Reason
+	}
 	return m0
 }
 
-// UpdateMetricsResponse — пустой ответ для подтверждения успешного обновления.
+// UpdateMetricsResponse содержит исход применения каждой метрики батча.
 type UpdateMetricsResponse struct {
-	state         protoimpl.MessageState `protogen:"opaque.v1"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state                  protoimpl.MessageState `protogen:"opaque.v1"`
+	xxx_hidden_Results     *[]*MetricResult       `protobuf:"bytes,1,rep,name=results"`
+	xxx_hidden_Applied     uint32                 `protobuf:"varint,2,opt,name=applied"`
+	xxx_hidden_Rejected    uint32                 `protobuf:"varint,3,opt,name=rejected"`
+	XXX_raceDetectHookData protoimpl.RaceDetectHookData
+	XXX_presence           [1]uint32
+	unknownFields          protoimpl.UnknownFields
+	sizeCache              protoimpl.SizeCache
 }
 
 func (x *UpdateMetricsResponse) Reset() {
 	*x = UpdateMetricsResponse{}
-	mi := &file_internal_proto_metrics_proto_msgTypes[2]
+	mi := &file_internal_proto_metrics_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -319,7 +654,7 @@ func (x *UpdateMetricsResponse) String() string {
 func (*UpdateMetricsResponse) ProtoMessage() {}
 
 func (x *UpdateMetricsResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_proto_metrics_proto_msgTypes[2]
+	mi := &file_internal_proto_metrics_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -330,15 +665,88 @@ func (x *UpdateMetricsResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
+func (x *UpdateMetricsResponse) GetResults() []*MetricResult {
+	if x != nil {
+		if x.xxx_hidden_Results != nil {
+			return *x.xxx_hidden_Results
+		}
+	}
+	return nil
+}
+
+func (x *UpdateMetricsResponse) GetApplied() uint32 {
+	if x != nil {
+		return x.xxx_hidden_Applied
+	}
+	return 0
+}
+
+func (x *UpdateMetricsResponse) GetRejected() uint32 {
+	if x != nil {
+		return x.xxx_hidden_Rejected
+	}
+	return 0
+}
+
+func (x *UpdateMetricsResponse) SetResults(v []*MetricResult) {
+	x.xxx_hidden_Results = &v
+}
+
+func (x *UpdateMetricsResponse) SetApplied(v uint32) {
+	x.xxx_hidden_Applied = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 1, 3)
+}
+
+func (x *UpdateMetricsResponse) SetRejected(v uint32) {
+	x.xxx_hidden_Rejected = v
+	protoimpl.X.SetPresent(&(x.XXX_presence[0]), 2, 3)
+}
+
+func (x *UpdateMetricsResponse) HasApplied() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 1)
+}
+
+func (x *UpdateMetricsResponse) HasRejected() bool {
+	if x == nil {
+		return false
+	}
+	return protoimpl.X.Present(&(x.XXX_presence[0]), 2)
+}
+
+func (x *UpdateMetricsResponse) ClearApplied() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 1)
+	x.xxx_hidden_Applied = 0
+}
+
+func (x *UpdateMetricsResponse) ClearRejected() {
+	protoimpl.X.ClearPresent(&(x.XXX_presence[0]), 2)
+	x.xxx_hidden_Rejected = 0
+}
+
 type UpdateMetricsResponse_builder struct {
 	_ [0]func() // Prevents comparability and use of unkeyed literals for the builder.
 
+	Results  []*MetricResult
+	Applied  *uint32
+	Rejected *uint32
 }
 
 func (b0 UpdateMetricsResponse_builder) Build() *UpdateMetricsResponse {
 	m0 := &UpdateMetricsResponse{}
 	b, x := &b0, m0
 	_, _ = b, x
+	x.xxx_hidden_Results = &b.Results
+	if b.Applied != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 1, 3)
+		x.xxx_hidden_Applied = *b.Applied
+	}
+	if b.Rejected != nil {
+		protoimpl.X.SetPresentNonAtomic(&(x.XXX_presence[0]), 2, 3)
+		x.xxx_hidden_Rejected = *b.Rejected
+	}
 	return m0
 }
 
@@ -355,31 +763,58 @@ const file_internal_proto_metrics_proto_rawDesc = "" +
 	"\x05MType\x12\x15\n" +
 	"\x11MTYPE_UNSPECIFIED\x10\x00\x12\x0f\n" +
 	"\vMTYPE_GAUGE\x10\x01\x12\x11\n" +
-	"\rMTYPE_COUNTER\x10\x02\"A\n" +
+	"\rMTYPE_COUNTER\x10\x02\"\xda\x01\n" +
 	"\x14UpdateMetricsRequest\x12)\n" +
-	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\"\x17\n" +
-	"\x15UpdateMetricsResponse2Y\n" +
+	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\x12;\n" +
+	"\x04mode\x18\x02 \x01(\x0e2'.metrics.UpdateMetricsRequest.BatchModeR\x04mode\"Z\n" +
+	"\tBatchMode\x12\x1a\n" +
+	"\x16BATCH_MODE_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11BATCH_MODE_ATOMIC\x10\x01\x12\x1a\n" +
+	"\x16BATCH_MODE_BEST_EFFORT\x10\x02\"\xa9\x02\n" +
+	"\fMetricResult\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\rR\x05index\x124\n" +
+	"\x06status\x18\x02 \x01(\x0e2\x1c.metrics.MetricResult.StatusR\x06status\x12'\n" +
+	"\x06metric\x18\x03 \x01(\v2\x0f.metrics.MetricR\x06metric\x12\x14\n" +
+	"\x05field\x18\x04 \x01(\tR\x05field\x12\x16\n" +
+	"\x06reason\x18\x05 \x01(\tR\x06reason\"v\n" +
+	"\x06Status\x12\x16\n" +
+	"\x12STATUS_UNSPECIFIED\x10\x00\x12\x12\n" +
+	"\x0eSTATUS_APPLIED\x10\x01\x12\x12\n" +
+	"\x0eSTATUS_INVALID\x10\x02\x12\x18\n" +
+	"\x14STATUS_TYPE_CONFLICT\x10\x03\x12\x12\n" +
+	"\x0eSTATUS_SKIPPED\x10\x04\"~\n" +
+	"\x15UpdateMetricsResponse\x12/\n" +
+	"\aresults\x18\x01 \x03(\v2\x15.metrics.MetricResultR\aresults\x12\x18\n" +
+	"\aapplied\x18\x02 \x01(\rR\aapplied\x12\x1a\n" +
+	"\brejected\x18\x03 \x01(\rR\brejected2Y\n" +
 	"\aMetrics\x12N\n" +
 	"\rUpdateMetrics\x12\x1d.metrics.UpdateMetricsRequest\x1a\x1e.metrics.UpdateMetricsResponseB9Z7github.com/fragpit/yandex-go-dev-metrics/internal/protob\beditionsp\xe8\a"
 
-var file_internal_proto_metrics_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_internal_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_internal_proto_metrics_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_internal_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
 var file_internal_proto_metrics_proto_goTypes = []any{
-	(Metric_MType)(0),             // 0: metrics.Metric.MType
-	(*Metric)(nil),                // 1: metrics.Metric
-	(*UpdateMetricsRequest)(nil),  // 2: metrics.UpdateMetricsRequest
-	(*UpdateMetricsResponse)(nil), // 3: metrics.UpdateMetricsResponse
+	(Metric_MType)(0),                   // 0: metrics.Metric.MType
+	(UpdateMetricsRequest_BatchMode)(0), // 1: metrics.UpdateMetricsRequest.BatchMode
+	(MetricResult_Status)(0),            // 2: metrics.MetricResult.Status
+	(*Metric)(nil),                      // 3: metrics.Metric
+	(*UpdateMetricsRequest)(nil),        // 4: metrics.UpdateMetricsRequest
+	(*MetricResult)(nil),                // 5: metrics.MetricResult
+	(*UpdateMetricsResponse)(nil),       // 6: metrics.UpdateMetricsResponse
 }
 var file_internal_proto_metrics_proto_depIdxs = []int32{
 	0, // 0: metrics.Metric.type:type_name -> metrics.Metric.MType
-	1, // 1: metrics.UpdateMetricsRequest.metrics:type_name -> metrics.Metric
-	2, // 2: metrics.Metrics.UpdateMetrics:input_type -> metrics.UpdateMetricsRequest
-	3, // 3: metrics.Metrics.UpdateMetrics:output_type -> metrics.UpdateMetricsResponse
-	3, // [3:4] is the sub-list for method output_type
-	2, // [2:3] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	3, // 1: metrics.UpdateMetricsRequest.metrics:type_name -> metrics.Metric
+	1, // 2: metrics.UpdateMetricsRequest.mode:type_name -> metrics.UpdateMetricsRequest.BatchMode
+	2, // 3: metrics.MetricResult.status:type_name -> metrics.MetricResult.Status
+	3, // 4: metrics.MetricResult.metric:type_name -> metrics.Metric
+	5, // 5: metrics.UpdateMetricsResponse.results:type_name -> metrics.MetricResult
+	4, // 6: metrics.Metrics.UpdateMetrics:input_type -> metrics.UpdateMetricsRequest
+	6, // 7: metrics.Metrics.UpdateMetrics:output_type -> metrics.UpdateMetricsResponse
+	7, // [7:8] is the sub-list for method output_type
+	6, // [6:7] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_internal_proto_metrics_proto_init() }
@@ -392,8 +827,8 @@ func file_internal_proto_metrics_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_proto_metrics_proto_rawDesc), len(file_internal_proto_metrics_proto_rawDesc)),
-			NumEnums:      1,
-			NumMessages:   3,
+			NumEnums:      3,
+			NumMessages:   4,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
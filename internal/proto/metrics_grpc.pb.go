@@ -30,6 +30,8 @@ const (
 type MetricsClient interface {
 	// UpdateMetrics обновляет метрики на сервере.
 	// Этот метод подходит для отправки как единичных метрик, так и батчей.
+	// Отказ атомарного батча возвращается ошибкой InvalidArgument или
+	// FailedPrecondition с подробностями по каждой метрике.
 	UpdateMetrics(ctx context.Context, in *UpdateMetricsRequest, opts ...grpc.CallOption) (*UpdateMetricsResponse, error)
 }
 
@@ -59,6 +61,8 @@ func (c *metricsClient) UpdateMetrics(ctx context.Context, in *UpdateMetricsRequ
 type MetricsServer interface {
 	// UpdateMetrics обновляет метрики на сервере.
 	// Этот метод подходит для отправки как единичных метрик, так и батчей.
+	// Отказ атомарного батча возвращается ошибкой InvalidArgument или
+	// FailedPrecondition с подробностями по каждой метрике.
 	UpdateMetrics(context.Context, *UpdateMetricsRequest) (*UpdateMetricsResponse, error)
 	mustEmbedUnimplementedMetricsServer()
 }
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+// ApplyBatch validates a batch update, stores it according to mode and
+// returns the outcome of every metric in request order.
+//
+// Invalid metrics are never stored. In atomic mode a single invalid metric
+// aborts the whole batch before the storage is touched. The returned error
+// is reserved for storage failures; rejected metrics are reported in the
+// result.
+func ApplyBatch(
+	ctx context.Context,
+	repo Repository,
+	v *model.Validator,
+	in []*model.Metrics,
+	mode model.BatchMode,
+) (*model.BatchResult, error) {
+	results := make([]*model.BatchItemResult, len(in))
+	for _, ve := range v.ValidateBatch(in) {
+		results[ve.Index] = model.NewInvalidResult(ve, in[ve.Index])
+	}
+
+	var (
+		metrics []model.Metric
+		origIdx []int
+		invalid bool
+	)
+	for i, jm := range in {
+		if results[i] != nil {
+			invalid = true
+			continue
+		}
+
+		metric, err := model.MetricFromJSON(jm)
+		if err != nil {
+			return nil, fmt.Errorf("error converting metric %d: %w", i, err)
+		}
+
+		metrics = append(metrics, metric)
+		origIdx = append(origIdx, i)
+	}
+
+	if invalid && mode == model.BatchAtomic {
+		for _, i := range origIdx {
+			results[i] = model.NewSkippedResult(i, in[i])
+		}
+
+		return model.NewBatchResult(mode, results), nil
+	}
+
+	if len(metrics) > 0 {
+		stored, err := repo.SetOrUpdateMetricBatch(ctx, metrics, mode)
+		if err != nil {
+			return nil, err
+		}
+
+		for n, res := range stored {
+			res.Index = origIdx[n]
+			results[res.Index] = res
+		}
+	}
+
+	return model.NewBatchResult(mode, results), nil
+}
@@ -0,0 +1,83 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/repository"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+func TestApplyBatch(t *testing.T) {
+	delta := int64(1)
+	value := 2.5
+
+	batch := []*model.Metrics{
+		{ID: "c", MType: "counter", Delta: &delta},
+		{ID: "", MType: "gauge", Value: &value},
+		{ID: "g", MType: "counter", Delta: &delta},
+		{ID: "g2", MType: "gauge", Value: &value},
+	}
+
+	tests := []struct {
+		name    string
+		mode    model.BatchMode
+		want    []model.BatchItemStatus
+		applied int
+	}{
+		{
+			name: "atomic",
+			mode: model.BatchAtomic,
+			want: []model.BatchItemStatus{
+				model.BatchItemSkipped,
+				model.BatchItemInvalid,
+				model.BatchItemSkipped,
+				model.BatchItemSkipped,
+			},
+		},
+		{
+			name: "best effort",
+			mode: model.BatchBestEffort,
+			want: []model.BatchItemStatus{
+				model.BatchItemApplied,
+				model.BatchItemInvalid,
+				model.BatchItemTypeConflict,
+				model.BatchItemApplied,
+			},
+			applied: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := memstorage.NewMemoryStorage()
+			require.NoError(t, repo.Initialize([]model.Metric{
+				model.NewGauge("g", 1),
+			}))
+
+			res, err := repository.ApplyBatch(
+				context.Background(),
+				repo,
+				model.NewValidator(false),
+				batch,
+				tt.mode,
+			)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.mode, res.Mode)
+			assert.Equal(t, tt.applied, res.Applied)
+			assert.Equal(t, len(batch)-tt.applied, res.Rejected)
+			require.Len(t, res.Results, len(tt.want))
+			for i, want := range tt.want {
+				assert.Equal(t, i, res.Results[i].Index)
+				assert.Equal(t, want, res.Results[i].Status)
+			}
+
+			assert.Equal(t, 1+tt.applied, repo.Len())
+		})
+	}
+}
@@ -10,8 +10,16 @@ import (
 type Repository interface {
 	GetMetrics(ctx context.Context) (map[string]model.Metric, error)
 	GetMetric(ctx context.Context, name string) (model.Metric, error)
+	ListMetrics(
+		ctx context.Context,
+		q *model.MetricQuery,
+	) (*model.MetricPage, error)
 	SetOrUpdateMetric(ctx context.Context, metric model.Metric) error
-	SetOrUpdateMetricBatch(ctx context.Context, metrics []model.Metric) error
+	SetOrUpdateMetricBatch(
+		ctx context.Context,
+		metrics []model.Metric,
+		mode model.BatchMode,
+	) ([]*model.BatchItemResult, error)
 	Initialize([]model.Metric) error
 	Reset() error
 	Ping(ctx context.Context) error
@@ -0,0 +1,149 @@
+package router
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+)
+
+// apiKeyHeader carries the API key of clients that do not send it as a
+// bearer token.
+const apiKeyHeader = "X-API-Key"
+
+// authenticateMiddleware identifies the API key of the request. Requests
+// without a key pass on anonymously, routes requiring a scope reject them;
+// an unknown key is rejected right away.
+func (rt *Router) authenticateMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := presentedKey(r)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		k, ok := rt.apiKeys.Lookup(key)
+		if !ok {
+			rt.logger.Warn(
+				"invalid api key",
+				slog.String("path", r.URL.Path),
+				slog.String("remote_addr", r.RemoteAddr),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+			)
+			rt.auditRejection(r, audit.EventAuthFailed, "invalid api key", "")
+			rt.writeError(w, r, errUnauthorized("invalid api key"))
+			return
+		}
+
+		h.ServeHTTP(w, r.WithContext(apikey.NewContext(r.Context(), k)))
+	})
+}
+
+// requireScope admits the requests whose API key has the scope. It admits
+// every request when no keys are configured.
+func (rt *Router) requireScope(scope apikey.Scope) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if rt.apiKeys == nil {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k, ok := apikey.FromContext(r.Context())
+			if !ok {
+				rt.auditRejection(r, audit.EventAuthFailed, "api key required", "")
+				rt.writeError(w, r, errUnauthorized("api key required"))
+				return
+			}
+
+			if !k.Has(scope) {
+				rt.logger.Warn(
+					"api key lacks scope",
+					slog.String("api_key", k.Name),
+					slog.String("scope", string(scope)),
+					slog.String("path", r.URL.Path),
+				)
+				rt.auditRejection(
+					r,
+					audit.EventAccessDenied,
+					"api key lacks scope "+string(scope),
+					"",
+				)
+				rt.writeError(w, r, errForbidden())
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireAllMetrics rejects the API keys restricted to a metric prefix, for
+// the pages showing every metric.
+func (rt *Router) requireAllMetrics(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if k, ok := apikey.FromContext(r.Context()); ok && k.Restricted() {
+			rt.auditRejection(
+				r,
+				audit.EventAccessDenied,
+				"api key is restricted to metric prefixes",
+				"",
+			)
+			rt.writeError(w, r, errForbidden())
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// authorizeMetrics reports whether the API key of the request may access
+// the metrics, answering 403 if it may not.
+func (rt Router) authorizeMetrics(
+	w http.ResponseWriter,
+	req *http.Request,
+	ids ...string,
+) bool {
+	k, ok := apikey.FromContext(req.Context())
+	if !ok {
+		return true
+	}
+
+	for _, id := range ids {
+		if !k.Allows(id) {
+			rt.logger.Warn(
+				"metric outside of api key prefix",
+				slog.String("api_key", k.Name),
+				slog.String("metric_id", id),
+			)
+			reason := "metric " + id + " is not allowed for the api key"
+			rt.auditRejection(req, audit.EventAccessDenied, reason, "")
+			rt.writeError(w, req, newAPIError(
+				http.StatusForbidden,
+				codeForbidden,
+				reason,
+			))
+			return false
+		}
+	}
+
+	return true
+}
+
+// presentedKey returns the API key sent as a bearer token or in the
+// X-API-Key header.
+func presentedKey(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,452 @@
+package router
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+func newTestAPIKeys(t *testing.T) *apikey.Store {
+	t.Helper()
+
+	s, err := apikey.NewStore([]apikey.Key{
+		{Name: "reader", Hash: apikey.Hash("read-key"), Scopes: []apikey.Scope{apikey.ScopeRead}},
+		{Name: "writer", Hash: apikey.Hash("write-key"), Scopes: []apikey.Scope{apikey.ScopeWrite}},
+		{
+			Name:   "hosts",
+			Hash:   apikey.Hash("hosts-key"),
+			Scopes: []apikey.Scope{apikey.ScopeRead, apikey.ScopeWrite},
+			Prefix: "hosts.",
+		},
+		{Name: "admin", Hash: apikey.Hash("admin-key"), Scopes: []apikey.Scope{apikey.ScopeAdmin}},
+	})
+	require.NoError(t, err)
+
+	return s
+}
+
+func newAuthRouter(t *testing.T, a *audit.Auditor) *Router {
+	t.Helper()
+
+	repo := memstorage.NewMemoryStorage()
+	require.NoError(t, repo.Initialize([]model.Metric{
+		model.NewGauge("cpu", 1),
+		model.NewGauge("hosts.a.cpu", 2),
+		model.NewGauge("hosts.b.cpu", 3),
+	}))
+
+	r, err := NewRouter(
+		slog.New(slog.DiscardHandler),
+		a,
+		repo,
+		nil,
+		"",
+		"",
+		WithAPIKeys(newTestAPIKeys(t)),
+	)
+	require.NoError(t, err)
+
+	return r
+}
+
+func TestRouter_apiKeys(t *testing.T) {
+	r := newAuthRouter(t, audit.NewAuditor())
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		header   string
+		value    string
+		wantCode int
+	}{
+		{
+			name:     "public ping",
+			method:   http.MethodGet,
+			path:     "/ping",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "no key",
+			method:   http.MethodGet,
+			path:     "/value/gauge/cpu",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "unknown key",
+			method:   http.MethodGet,
+			path:     "/ping",
+			header:   "Authorization",
+			value:    "Bearer wrong",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "bearer read",
+			method:   http.MethodGet,
+			path:     "/value/gauge/cpu",
+			header:   "Authorization",
+			value:    "Bearer read-key",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "header read",
+			method:   http.MethodGet,
+			path:     "/api/v1/value/gauge/cpu",
+			header:   apiKeyHeader,
+			value:    "read-key",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "read key writes",
+			method:   http.MethodPost,
+			path:     "/update/gauge/cpu/5",
+			header:   apiKeyHeader,
+			value:    "read-key",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "write key reads",
+			method:   http.MethodGet,
+			path:     "/value/gauge/cpu",
+			header:   apiKeyHeader,
+			value:    "write-key",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "write key writes",
+			method:   http.MethodPost,
+			path:     "/update/gauge/cpu/5",
+			header:   apiKeyHeader,
+			value:    "write-key",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "write key batch",
+			method:   http.MethodPost,
+			path:     "/updates/",
+			body:     `[{"id":"cpu","type":"gauge","value":1}]`,
+			header:   apiKeyHeader,
+			value:    "write-key",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "admin writes",
+			method:   http.MethodPost,
+			path:     "/update/gauge/cpu/5",
+			header:   apiKeyHeader,
+			value:    "admin-key",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "prefix write allowed",
+			method:   http.MethodPost,
+			path:     "/update/gauge/hosts.a.cpu/5",
+			header:   apiKeyHeader,
+			value:    "hosts-key",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "prefix write denied",
+			method:   http.MethodPost,
+			path:     "/update/gauge/cpu/5",
+			header:   apiKeyHeader,
+			value:    "hosts-key",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "prefix json write denied",
+			method:   http.MethodPost,
+			path:     "/update/",
+			body:     `{"id":"cpu","type":"gauge","value":1}`,
+			header:   apiKeyHeader,
+			value:    "hosts-key",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "prefix batch denied",
+			method:   http.MethodPost,
+			path:     "/updates/",
+			body:     `[{"id":"hosts.a.cpu","type":"gauge","value":1},{"id":"cpu","type":"gauge","value":1}]`,
+			header:   apiKeyHeader,
+			value:    "hosts-key",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "prefix read denied",
+			method:   http.MethodGet,
+			path:     "/value/gauge/cpu",
+			header:   apiKeyHeader,
+			value:    "hosts-key",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "prefix json read denied",
+			method:   http.MethodPost,
+			path:     "/value/",
+			body:     `{"id":"cpu","type":"gauge"}`,
+			header:   apiKeyHeader,
+			value:    "hosts-key",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "prefix dashboard denied",
+			method:   http.MethodGet,
+			path:     "/",
+			header:   apiKeyHeader,
+			value:    "hosts-key",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "dashboard read",
+			method:   http.MethodGet,
+			path:     "/",
+			header:   apiKeyHeader,
+			value:    "read-key",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "dashboard without key",
+			method:   http.MethodGet,
+			path:     "/",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "webhook without key",
+			method:   http.MethodPost,
+			path:     "/ingest/ci",
+			body:     `{"finished":2}`,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "read key webhook",
+			method:   http.MethodPost,
+			path:     "/ingest/ci",
+			body:     `{"finished":2}`,
+			header:   apiKeyHeader,
+			value:    "read-key",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "write key webhook",
+			method:   http.MethodPost,
+			path:     "/ingest/ci",
+			body:     `{"finished":2}`,
+			header:   apiKeyHeader,
+			value:    "write-key",
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantCode, rr.Code, rr.Body.String())
+		})
+	}
+}
+
+func TestRouter_apiKeys_list(t *testing.T) {
+	r := newAuthRouter(t, audit.NewAuditor())
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		key         string
+		wantMetrics []string
+		wantMissing []string
+	}{
+		{
+			name:        "unrestricted",
+			method:      http.MethodGet,
+			path:        "/values/",
+			key:         "read-key",
+			wantMetrics: []string{"cpu", "hosts.a.cpu", "hosts.b.cpu"},
+		},
+		{
+			name:        "restricted",
+			method:      http.MethodGet,
+			path:        "/values/",
+			key:         "hosts-key",
+			wantMetrics: []string{"hosts.a.cpu", "hosts.b.cpu"},
+		},
+		{
+			name:        "narrower prefix",
+			method:      http.MethodGet,
+			path:        "/values/?prefix=hosts.a",
+			key:         "hosts-key",
+			wantMetrics: []string{"hosts.a.cpu"},
+		},
+		{
+			name:        "disjoint prefix",
+			method:      http.MethodGet,
+			path:        "/values/?prefix=cpu",
+			key:         "hosts-key",
+			wantMetrics: []string{},
+		},
+		{
+			name:        "bulk",
+			method:      http.MethodPost,
+			path:        "/values/",
+			body:        `["cpu","hosts.b.cpu"]`,
+			key:         "hosts-key",
+			wantMetrics: []string{"hosts.b.cpu"},
+			wantMissing: []string{"cpu"},
+		},
+		{
+			name:        "bulk nothing allowed",
+			method:      http.MethodPost,
+			path:        "/values/",
+			body:        `["cpu"]`,
+			key:         "hosts-key",
+			wantMetrics: []string{},
+			wantMissing: []string{"cpu"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(apiKeyHeader, tt.key)
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			var resp metricsResponse
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+			ids := make([]string, 0, len(resp.Metrics))
+			for _, m := range resp.Metrics {
+				ids = append(ids, m.ID)
+			}
+			assert.Equal(t, tt.wantMetrics, ids)
+			assert.Equal(t, tt.wantMissing, resp.Missing)
+		})
+	}
+}
+
+func TestRouter_apiKeys_audit(t *testing.T) {
+	events := make(eventObserver, 1)
+	a := audit.NewAuditor()
+	a.Add(events)
+
+	r := newAuthRouter(t, a)
+
+	req := httptest.NewRequest(http.MethodPost, "/update/gauge/cpu/5", nil)
+	req.Header.Set("Authorization", "Bearer write-key")
+	rr := httptest.NewRecorder()
+	r.router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, "writer", event.APIKey)
+	case <-time.After(5 * time.Second):
+		t.Fatal("audit event was not logged")
+	}
+}
+
+func TestRouter_auditRejections(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		key        string
+		wantType   audit.EventType
+		wantReason string
+		wantKey    string
+	}{
+		{
+			name:       "no key",
+			path:       "/update/gauge/cpu/5",
+			wantType:   audit.EventAuthFailed,
+			wantReason: "api key required",
+		},
+		{
+			name:       "unknown key",
+			path:       "/update/gauge/cpu/5",
+			key:        "wrong",
+			wantType:   audit.EventAuthFailed,
+			wantReason: "invalid api key",
+		},
+		{
+			name:       "missing scope",
+			path:       "/update/gauge/cpu/5",
+			key:        "read-key",
+			wantType:   audit.EventAccessDenied,
+			wantReason: "api key lacks scope write",
+			wantKey:    "reader",
+		},
+		{
+			name:       "metric outside prefix",
+			path:       "/update/gauge/cpu/5",
+			key:        "hosts-key",
+			wantType:   audit.EventAccessDenied,
+			wantReason: "metric cpu is not allowed for the api key",
+			wantKey:    "hosts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(eventObserver, 1)
+			a := audit.NewAuditor()
+			a.Add(events)
+
+			r := newAuthRouter(t, a)
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			req.RemoteAddr = "10.0.0.5:40000"
+			if tt.key != "" {
+				req.Header.Set(apiKeyHeader, tt.key)
+			}
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+			require.GreaterOrEqual(t, rr.Code, http.StatusBadRequest)
+
+			select {
+			case event := <-events:
+				assert.Equal(t, tt.wantType, event.Type)
+				assert.Equal(t, tt.wantReason, event.Reason)
+				assert.Equal(t, tt.path, event.Route)
+				assert.Equal(t, "10.0.0.5", event.IPAddress)
+				assert.Equal(t, tt.wantKey, event.APIKey)
+			case <-time.After(5 * time.Second):
+				t.Fatal("audit event was not logged")
+			}
+		})
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer secret")
+	h.Set(apiKeyHeader, "secret")
+	h.Set("Accept", "application/json")
+
+	got := redactHeaders(h)
+	assert.Equal(t, "[REDACTED]", got.Get("Authorization"))
+	assert.Equal(t, "[REDACTED]", got.Get(apiKeyHeader))
+	assert.Equal(t, "application/json", got.Get("Accept"))
+	assert.Equal(t, "Bearer secret", h.Get("Authorization"))
+}
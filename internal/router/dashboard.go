@@ -0,0 +1,192 @@
+package router
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+// dashboardRefresh is the default auto-refresh interval of the dashboard in
+// seconds, zero disables it.
+const dashboardRefresh = 10
+
+//go:embed templates static
+var dashboardFS embed.FS
+
+// dashboardTemplates are parsed once, the handlers only execute them.
+var dashboardTemplates = template.Must(
+	template.New("").ParseFS(dashboardFS, "templates/*.tpl"),
+)
+
+// staticFS holds the dashboard stylesheet and script.
+var staticFS = func() fs.FS {
+	sub, err := fs.Sub(dashboardFS, "static")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}()
+
+// byteGauges lists the gauges reported by the agent that hold a size in
+// bytes.
+var byteGauges = map[string]struct{}{
+	"Alloc":        {},
+	"BuckHashSys":  {},
+	"FreeMemory":   {},
+	"GCSys":        {},
+	"HeapAlloc":    {},
+	"HeapIdle":     {},
+	"HeapInuse":    {},
+	"HeapReleased": {},
+	"HeapSys":      {},
+	"MCacheInuse":  {},
+	"MCacheSys":    {},
+	"MSpanInuse":   {},
+	"MSpanSys":     {},
+	"NextGC":       {},
+	"OtherSys":     {},
+	"StackInuse":   {},
+	"StackSys":     {},
+	"Sys":          {},
+	"TotalAlloc":   {},
+	"TotalMemory":  {},
+}
+
+// dashboardMetric is a metric as rendered by the dashboard.
+type dashboardMetric struct {
+	ID      string
+	Type    model.MetricType
+	Value   string
+	Display string
+	Bytes   bool
+}
+
+// dashboardPage is the data of the dashboard templates.
+type dashboardPage struct {
+	Title   string
+	Refresh int
+	Metrics []dashboardMetric
+	Counts  map[string]int
+}
+
+// isByteGauge reports whether the metric holds a size in bytes.
+func isByteGauge(m model.Metric) bool {
+	if m.GetType() != model.GaugeType {
+		return false
+	}
+
+	id := m.GetID()
+	if _, ok := byteGauges[id]; ok {
+		return true
+	}
+
+	return strings.HasSuffix(id, "Bytes") ||
+		strings.HasSuffix(strings.ToLower(id), "_bytes")
+}
+
+// humanBytes formats a size in bytes with binary units.
+func humanBytes(v float64) string {
+	const units = "KMGTPE"
+
+	if math.Abs(v) < 1024 {
+		return strconv.FormatFloat(v, 'f', -1, 64) + " B"
+	}
+
+	exp := 0
+	for math.Abs(v) >= 1024*1024 && exp < len(units)-1 {
+		v /= 1024
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", v/1024, units[exp])
+}
+
+func newDashboardMetric(m model.Metric) dashboardMetric {
+	dm := dashboardMetric{
+		ID:      m.GetID(),
+		Type:    m.GetType(),
+		Value:   m.GetValue(),
+		Display: m.GetValue(),
+		Bytes:   isByteGauge(m),
+	}
+
+	if dm.Bytes {
+		if v, err := strconv.ParseFloat(dm.Value, 64); err == nil {
+			dm.Display = humanBytes(v)
+		}
+	}
+
+	return dm
+}
+
+// renderDashboard executes the named template, the output is buffered so a
+// failure still results in a clean error response.
+func (rt Router) renderDashboard(
+	w http.ResponseWriter,
+	req *http.Request,
+	name string,
+	page dashboardPage,
+) {
+	var buf strings.Builder
+	if err := dashboardTemplates.ExecuteTemplate(&buf, name, page); err != nil {
+		rt.logger.Error("template execute error", slog.Any("error", err))
+		rt.writeError(w, req, errInternal())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(buf.String())); err != nil {
+		rt.logger.Error("error writing response", slog.Any("error", err))
+	}
+}
+
+// rootHandler serves the dashboard listing all metrics.
+func (rt Router) rootHandler(w http.ResponseWriter, req *http.Request) {
+	page, err := rt.repo.ListMetrics(req.Context(), &model.MetricQuery{})
+	if err != nil {
+		rt.logger.Error("error retrieving metrics", slog.Any("error", err))
+		rt.writeError(w, req, errInternal())
+		return
+	}
+
+	data := dashboardPage{
+		Title:   "Metrics",
+		Refresh: dashboardRefresh,
+		Metrics: make([]dashboardMetric, 0, len(page.Metrics)),
+		Counts:  make(map[string]int),
+	}
+	for _, m := range page.Metrics {
+		data.Metrics = append(data.Metrics, newDashboardMetric(m))
+		data.Counts[string(m.GetType())]++
+	}
+
+	rt.renderDashboard(w, req, "root.tpl", data)
+}
+
+// metricPageHandler serves the detail page of a metric.
+func (rt Router) metricPageHandler(w http.ResponseWriter, req *http.Request) {
+	name := chi.URLParam(req, "name")
+
+	m, err := rt.repo.GetMetric(req.Context(), name)
+	if err != nil {
+		rt.writeError(w, req, errNotFound("metric not found"))
+		return
+	}
+
+	rt.renderDashboard(w, req, "metric.tpl", dashboardPage{
+		Title:   m.GetID(),
+		Refresh: dashboardRefresh,
+		Metrics: []dashboardMetric{newDashboardMetric(m)},
+	})
+}
@@ -0,0 +1,148 @@
+package router
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+func TestHumanBytes(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want string
+	}{
+		{in: 0, want: "0 B"},
+		{in: 1023, want: "1023 B"},
+		{in: 1024, want: "1.0 KiB"},
+		{in: 1536, want: "1.5 KiB"},
+		{in: 5 * 1024 * 1024, want: "5.0 MiB"},
+		{in: 3.5 * 1024 * 1024 * 1024, want: "3.5 GiB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, humanBytes(tt.in))
+		})
+	}
+}
+
+func TestIsByteGauge(t *testing.T) {
+	assert.True(t, isByteGauge(model.NewGauge("HeapAlloc", 1)))
+	assert.True(t, isByteGauge(model.NewGauge("cache_bytes", 1)))
+	assert.False(t, isByteGauge(model.NewGauge("GCCPUFraction", 1)))
+	assert.False(t, isByteGauge(model.NewCounter("RxBytes", 1)))
+}
+
+func TestRouter_dashboard(t *testing.T) {
+	repo := memstorage.NewMemoryStorage()
+	require.NoError(t, repo.Initialize([]model.Metric{
+		model.NewGauge("HeapAlloc", 2*1024*1024),
+		model.NewGauge("RandomValue", 0.5),
+		model.NewCounter("PollCount", 7),
+	}))
+
+	r, err := NewRouter(
+		slog.New(slog.DiscardHandler),
+		audit.NewAuditor(),
+		repo,
+		nil,
+		"",
+		"127.0.0.0/8",
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		url          string
+		realIP       string
+		wantCode     int
+		wantType     string
+		wantContains []string
+	}{
+		{
+			name:     "root sorted with units",
+			url:      "/",
+			realIP:   "127.0.0.1",
+			wantCode: http.StatusOK,
+			wantType: "text/html",
+			wantContains: []string{
+				`data-id="HeapAlloc"`,
+				"2.0 MiB",
+				`href="/metrics/PollCount"`,
+				"counter (1)",
+				"gauge (2)",
+			},
+		},
+		{
+			name:         "metric page",
+			url:          "/metrics/PollCount",
+			realIP:       "127.0.0.1",
+			wantCode:     http.StatusOK,
+			wantType:     "text/html",
+			wantContains: []string{"<h2>PollCount</h2>", "/value/counter/PollCount"},
+		},
+		{
+			name:     "unknown metric page",
+			url:      "/metrics/nope",
+			realIP:   "127.0.0.1",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "script",
+			url:          "/static/dashboard.js",
+			realIP:       "127.0.0.1",
+			wantCode:     http.StatusOK,
+			wantType:     "text/javascript",
+			wantContains: []string{"sessionStorage"},
+		},
+		{
+			name:     "stylesheet",
+			url:      "/static/dashboard.css",
+			realIP:   "127.0.0.1",
+			wantCode: http.StatusOK,
+			wantType: "text/css",
+		},
+		{
+			name:     "outside trusted subnet",
+			url:      "/",
+			realIP:   "10.0.0.1",
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.RemoteAddr = net.JoinHostPort(tt.realIP, "1234")
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+
+			require.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantType != "" {
+				assert.Contains(t, rr.Header().Get("Content-Type"), tt.wantType)
+			}
+
+			body := rr.Body.String()
+			for _, s := range tt.wantContains {
+				assert.Contains(t, body, s)
+			}
+
+			if tt.url == "/" && tt.wantCode == http.StatusOK {
+				heap := strings.Index(body, `data-id="HeapAlloc"`)
+				poll := strings.Index(body, `data-id="PollCount"`)
+				random := strings.Index(body, `data-id="RandomValue"`)
+				assert.True(t, heap < poll && poll < random, "rows sorted by name")
+			}
+		})
+	}
+}
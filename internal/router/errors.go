@@ -0,0 +1,126 @@
+package router
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Error codes of the JSON error envelope.
+const (
+	codeBadRequest       = "bad_request"
+	codeValidationFailed = "validation_failed"
+	codeTypeConflict     = "type_conflict"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeNotAcceptable    = "not_acceptable"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeInternal         = "internal_error"
+)
+
+// apiError is an error returned by a handler or middleware.
+//
+// Routes under /api/v1 render it as a JSON envelope. The legacy routes keep
+// the plain-text message the existing agents expect, or the legacy JSON body
+// if one is set.
+type apiError struct {
+	status    int
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	legacy    any
+}
+
+func newAPIError(status int, code, message string) *apiError {
+	return &apiError{status: status, Code: code, Message: message}
+}
+
+func errBadRequest(message string) *apiError {
+	return newAPIError(http.StatusBadRequest, codeBadRequest, message)
+}
+
+func errValidation(message string) *apiError {
+	return newAPIError(http.StatusBadRequest, codeValidationFailed, message)
+}
+
+func errNotFound(message string) *apiError {
+	return newAPIError(http.StatusNotFound, codeNotFound, message)
+}
+
+func errNotAcceptable() *apiError {
+	return newAPIError(
+		http.StatusNotAcceptable,
+		codeNotAcceptable,
+		"supported formats: "+contentTypeJSON+", "+contentTypeNDJSON+", "+
+			contentTypeCSV,
+	)
+}
+
+func errUnauthorized(message string) *apiError {
+	return newAPIError(http.StatusUnauthorized, codeUnauthorized, message)
+}
+
+func errForbidden() *apiError {
+	return newAPIError(
+		http.StatusForbidden,
+		codeForbidden,
+		http.StatusText(http.StatusForbidden),
+	)
+}
+
+func errInternal() *apiError {
+	return newAPIError(
+		http.StatusInternalServerError,
+		codeInternal,
+		http.StatusText(http.StatusInternalServerError),
+	)
+}
+
+// withDetails attaches machine-readable details to the error.
+func (e *apiError) withDetails(details any) *apiError {
+	e.Details = details
+	return e
+}
+
+// withLegacyBody sets the JSON body rendered on the legacy routes instead of
+// the plain-text message.
+func (e *apiError) withLegacyBody(body any) *apiError {
+	e.legacy = body
+	return e
+}
+
+// isAPIv1 reports whether the request targets the versioned API.
+func isAPIv1(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, apiV1Prefix+"/")
+}
+
+// writeError renders the error in the format of the requested route tree.
+func (rt Router) writeError(
+	w http.ResponseWriter,
+	req *http.Request,
+	e *apiError,
+) {
+	switch {
+	case isAPIv1(req):
+		e.RequestID = middleware.GetReqID(req.Context())
+		rt.writeJSON(w, e.status, e)
+	case e.legacy != nil:
+		rt.writeJSON(w, e.status, e.legacy)
+	default:
+		http.Error(w, e.Message, e.status)
+	}
+}
+
+// writeJSON responds with the status and v encoded as JSON.
+func (rt Router) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		rt.logger.Error("error writing response", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,241 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+// grafanaPrefix is the root of the Grafana JSON datasource API.
+const grafanaPrefix = "/grafana"
+
+// grafanaTable is the target type requesting a table frame, any other type
+// gets time-series frames.
+const grafanaTable = "table"
+
+// grafanaSearchRequest is the body of POST /grafana/search.
+type grafanaSearchRequest struct {
+	Target string `json:"target"`
+}
+
+// grafanaQueryRequest is the body of POST /grafana/query. Fields Grafana
+// sends but the server does not use are ignored.
+type grafanaQueryRequest struct {
+	Targets []grafanaTarget `json:"targets"`
+}
+
+// grafanaTarget selects the metrics of a panel query. The target is a metric
+// name, or an RE2 expression matched against names when wrapped in slashes,
+// as in /^Heap/.
+type grafanaTarget struct {
+	Target string `json:"target"`
+	RefID  string `json:"refId"`
+	Type   string `json:"type"`
+	Hide   bool   `json:"hide"`
+}
+
+// grafanaSeries is a time-series frame. Datapoints are value and Unix
+// milliseconds pairs.
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+// grafanaTableFrame is a table frame.
+type grafanaTableFrame struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]any         `json:"rows"`
+}
+
+// grafanaAnnotation is an annotation event.
+type grafanaAnnotation struct {
+	Annotation any      `json:"annotation"`
+	Time       int64    `json:"time"`
+	Title      string   `json:"title"`
+	Text       string   `json:"text,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+}
+
+// grafanaAnnotationsRequest is the body of POST /grafana/annotations.
+type grafanaAnnotationsRequest struct {
+	Annotation any `json:"annotation"`
+}
+
+// grafanaRoutes registers the Grafana simple JSON datasource API. The server
+// keeps current values only, so queries return a single point per metric
+// taken at request time.
+func (rt *Router) grafanaRoutes(r chi.Router) {
+	r.Get("/", rt.grafanaHealth)
+	r.Post("/search", rt.grafanaSearch)
+	r.Post("/query", rt.grafanaQuery)
+	r.Post("/annotations", rt.grafanaAnnotations)
+}
+
+// grafanaHealth answers the datasource connection test.
+func (rt Router) grafanaHealth(w http.ResponseWriter, req *http.Request) {
+	if err := rt.repo.Ping(req.Context()); err != nil {
+		rt.logger.Error("storage ping failed", slog.Any("error", err))
+		rt.writeError(w, req, errInternal())
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// grafanaSearch returns the names of the metrics containing the target,
+// case-insensitively, or all names for an empty target.
+func (rt Router) grafanaSearch(w http.ResponseWriter, req *http.Request) {
+	var sr grafanaSearchRequest
+	if err := decodeGrafana(req, &sr); err != nil {
+		rt.writeError(w, req, errBadRequest("error decoding request body"))
+		return
+	}
+
+	page, err := rt.repo.ListMetrics(req.Context(), &model.MetricQuery{})
+	if err != nil {
+		rt.writeListError(w, req, err)
+		return
+	}
+
+	needle := strings.ToLower(sr.Target)
+	names := make([]string, 0, len(page.Metrics))
+	for _, m := range page.Metrics {
+		if strings.Contains(strings.ToLower(m.GetID()), needle) {
+			names = append(names, m.GetID())
+		}
+	}
+
+	rt.writeJSON(w, http.StatusOK, names)
+}
+
+// grafanaQuery returns the current values of the targets as time-series or
+// table frames.
+func (rt Router) grafanaQuery(w http.ResponseWriter, req *http.Request) {
+	var qr grafanaQueryRequest
+	if err := decodeGrafana(req, &qr); err != nil {
+		rt.writeError(w, req, errBadRequest("error decoding request body"))
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	frames := make([]any, 0, len(qr.Targets))
+	for _, t := range qr.Targets {
+		if t.Hide || t.Target == "" {
+			continue
+		}
+
+		q, err := grafanaTargetQuery(t.Target)
+		if err != nil {
+			rt.writeError(w, req, errValidation(err.Error()))
+			return
+		}
+
+		page, err := rt.repo.ListMetrics(req.Context(), q)
+		if err != nil {
+			rt.writeListError(w, req, err)
+			return
+		}
+
+		if t.Type == grafanaTable {
+			frames = append(frames, grafanaTableOf(page.Metrics, now))
+			continue
+		}
+
+		for _, m := range page.Metrics {
+			v, err := strconv.ParseFloat(m.GetValue(), 64)
+			if err != nil {
+				continue
+			}
+
+			frames = append(frames, grafanaSeries{
+				Target:     m.GetID(),
+				Datapoints: [][2]float64{{v, float64(now)}},
+			})
+		}
+	}
+
+	rt.writeJSON(w, http.StatusOK, frames)
+}
+
+// grafanaAnnotations answers annotation queries. The server records no
+// events, the list is always empty.
+func (rt Router) grafanaAnnotations(w http.ResponseWriter, req *http.Request) {
+	var ar grafanaAnnotationsRequest
+	if err := decodeGrafana(req, &ar); err != nil {
+		rt.writeError(w, req, errBadRequest("error decoding request body"))
+		return
+	}
+
+	rt.writeJSON(w, http.StatusOK, []grafanaAnnotation{})
+}
+
+// grafanaTargetQuery builds the metric query of a target.
+func grafanaTargetQuery(target string) (*model.MetricQuery, error) {
+	q := &model.MetricQuery{IDs: []string{target}}
+	if len(target) > 1 && strings.HasPrefix(target, "/") &&
+		strings.HasSuffix(target, "/") {
+		q = &model.MetricQuery{Regex: target[1 : len(target)-1]}
+	}
+
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func grafanaTableOf(metrics []model.Metric, now int64) grafanaTableFrame {
+	table := grafanaTableFrame{
+		Type: grafanaTable,
+		Columns: []grafanaColumn{
+			{Text: "Time", Type: "time"},
+			{Text: "Metric", Type: "string"},
+			{Text: "Type", Type: "string"},
+			{Text: "Value", Type: "number"},
+		},
+		Rows: make([][]any, 0, len(metrics)),
+	}
+
+	for _, m := range metrics {
+		v, err := strconv.ParseFloat(m.GetValue(), 64)
+		if err != nil {
+			continue
+		}
+
+		table.Rows = append(table.Rows, []any{
+			now,
+			m.GetID(),
+			string(m.GetType()),
+			v,
+		})
+	}
+
+	return table
+}
+
+// decodeGrafana decodes a Grafana request body. Unlike the metrics API it
+// tolerates unknown fields, Grafana sends many the server does not use. An
+// empty body decodes to the zero value.
+func decodeGrafana(req *http.Request, v any) error {
+	err := json.NewDecoder(req.Body).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
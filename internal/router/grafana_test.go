@@ -0,0 +1,147 @@
+package router
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+func TestRouter_grafana(t *testing.T) {
+	repo := memstorage.NewMemoryStorage()
+	require.NoError(t, repo.Initialize([]model.Metric{
+		model.NewGauge("HeapAlloc", 2048),
+		model.NewGauge("HeapSys", 4096),
+		model.NewCounter("PollCount", 7),
+	}))
+
+	r, err := NewRouter(
+		slog.New(slog.DiscardHandler),
+		audit.NewAuditor(),
+		repo,
+		nil,
+		"",
+		"",
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "health",
+			method:   http.MethodGet,
+			path:     "/grafana/",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "search all",
+			method:   http.MethodPost,
+			path:     "/grafana/search",
+			body:     `{"target":""}`,
+			wantCode: http.StatusOK,
+			wantBody: `["HeapAlloc","HeapSys","PollCount"]`,
+		},
+		{
+			name:     "search filtered",
+			method:   http.MethodPost,
+			path:     "/grafana/search",
+			body:     `{"target":"heap","type":"timeserie"}`,
+			wantCode: http.StatusOK,
+			wantBody: `["HeapAlloc","HeapSys"]`,
+		},
+		{
+			name:     "search empty body",
+			method:   http.MethodPost,
+			path:     "/grafana/search",
+			wantCode: http.StatusOK,
+			wantBody: `["HeapAlloc","HeapSys","PollCount"]`,
+		},
+		{
+			name:     "query unknown and hidden targets",
+			method:   http.MethodPost,
+			path:     "/grafana/query",
+			body:     `{"panelId":1,"targets":[{"target":"nope","refId":"A"},{"target":"PollCount","refId":"B","hide":true}]}`,
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+		{
+			name:     "query invalid regex",
+			method:   http.MethodPost,
+			path:     "/grafana/query",
+			body:     `{"targets":[{"target":"/(/","refId":"A"}]}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "query malformed",
+			method:   http.MethodPost,
+			path:     "/grafana/query",
+			body:     `{"targets":`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "annotations",
+			method:   http.MethodPost,
+			path:     "/grafana/annotations",
+			body:     `{"annotation":{"name":"deploys","query":"x"}}`,
+			wantCode: http.StatusOK,
+			wantBody: `[]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+
+			require.Equal(t, tt.wantCode, rr.Code, rr.Body.String())
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("query time series and table", func(t *testing.T) {
+		body := `{"range":{"from":"2026-01-01T00:00:00Z","to":"2026-01-01T01:00:00Z"},"targets":[{"target":"/^Heap/","refId":"A","type":"timeserie"},{"target":"PollCount","refId":"B","type":"table"}]}`
+		req := httptest.NewRequest(http.MethodPost, "/grafana/query", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		r.router.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var frames []json.RawMessage
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &frames))
+		require.Len(t, frames, 3)
+
+		var series grafanaSeries
+		require.NoError(t, json.Unmarshal(frames[0], &series))
+		assert.Equal(t, "HeapAlloc", series.Target)
+		require.Len(t, series.Datapoints, 1)
+		assert.Equal(t, 2048.0, series.Datapoints[0][0])
+		assert.Positive(t, series.Datapoints[0][1])
+
+		require.NoError(t, json.Unmarshal(frames[1], &series))
+		assert.Equal(t, "HeapSys", series.Target)
+
+		var table grafanaTableFrame
+		require.NoError(t, json.Unmarshal(frames[2], &table))
+		assert.Equal(t, "table", table.Type)
+		require.Len(t, table.Columns, 4)
+		require.Len(t, table.Rows, 1)
+		assert.Equal(t, []any{table.Rows[0][0], "PollCount", "counter", 7.0}, table.Rows[0])
+	})
+}
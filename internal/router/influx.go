@@ -0,0 +1,59 @@
+package router
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+// influxWrite handles InfluxDB line protocol writes at /write and
+// /api/v2/write.
+//
+// The precision query parameter sets the timestamp unit. Timestamps are
+// validated but not stored, the storage keeps current values only. The
+// batch mode header applies as for /updates/. Success responds with 204 like
+// InfluxDB does.
+func (rt Router) influxWrite(w http.ResponseWriter, req *http.Request) {
+	mode, err := model.ParseBatchMode(req.Header.Get(batchModeHeader))
+	if err != nil {
+		rt.writeError(w, req, errValidation(err.Error()))
+		return
+	}
+
+	precision, err := ingest.ParsePrecision(req.URL.Query().Get("precision"))
+	if err != nil {
+		rt.writeError(w, req, errBadRequest(err.Error()))
+		return
+	}
+
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		rt.logger.Error("error reading request body", slog.Any("error", err))
+		rt.writeError(w, req, errBadRequest("error reading request body"))
+		return
+	}
+
+	points, err := ingest.ParseLines(data, precision)
+	if err != nil {
+		rt.logger.Error("error parsing line protocol", slog.Any("error", err))
+		rt.writeError(w, req, errBadRequest(err.Error()))
+		return
+	}
+
+	metrics, err := rt.lineProtocol.Metrics(points)
+	if err != nil {
+		rt.writeError(w, req, errValidation(err.Error()))
+		return
+	}
+
+	if len(metrics) > 0 {
+		if _, ok := rt.storeBatch(w, req, metrics, mode); !ok {
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,157 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+func TestRouter_influxWrite(t *testing.T) {
+	key := []byte("influx-key")
+
+	gzipped := func(s string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, _ = gz.Write([]byte(s))
+		_ = gz.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		body       []byte
+		gzip       bool
+		badSum     bool
+		realIP     string
+		wantCode   int
+		wantValues map[string]string
+	}{
+		{
+			name:     "write",
+			path:     "/write?precision=s",
+			body:     []byte("cpu,host=a usage=12.5,procs=3i 1700000000\nreqs value=2i"),
+			realIP:   "10.0.0.1",
+			wantCode: http.StatusNoContent,
+			wantValues: map[string]string{
+				"cpu_usage.host:a": "12.5",
+				"cpu_procs.host:a": "3",
+				"reqs":             "7",
+			},
+		},
+		{
+			name:     "v2 alias with gzip",
+			path:     "/api/v2/write?org=o&bucket=b&precision=ms",
+			body:     gzipped("mem used=1024"),
+			gzip:     true,
+			realIP:   "10.0.0.1",
+			wantCode: http.StatusNoContent,
+			wantValues: map[string]string{
+				"mem_used": "1024",
+			},
+		},
+		{
+			name:     "string fields only",
+			path:     "/write",
+			body:     []byte(`log msg="hello"`),
+			realIP:   "10.0.0.1",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:     "malformed line",
+			path:     "/write",
+			body:     []byte("cpu usage"),
+			realIP:   "10.0.0.1",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid precision",
+			path:     "/write?precision=d",
+			body:     []byte("cpu usage=1"),
+			realIP:   "10.0.0.1",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "type conflict",
+			path:     "/write",
+			body:     []byte("reqs value=1.5"),
+			realIP:   "10.0.0.1",
+			wantCode: http.StatusConflict,
+		},
+		{
+			name:     "bad checksum",
+			path:     "/write",
+			body:     []byte("cpu usage=1"),
+			badSum:   true,
+			realIP:   "10.0.0.1",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "outside trusted subnet",
+			path:     "/write",
+			body:     []byte("cpu usage=1"),
+			realIP:   "192.168.0.1",
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := memstorage.NewMemoryStorage()
+			require.NoError(t, repo.Initialize([]model.Metric{
+				model.NewCounter("reqs", 5),
+			}))
+
+			r, err := NewRouter(
+				slog.New(slog.DiscardHandler),
+				audit.NewAuditor(),
+				repo,
+				key,
+				"",
+				"10.0.0.0/8",
+			)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			req.RemoteAddr = net.JoinHostPort(tt.realIP, "1234")
+			if tt.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+
+			mac := hmac.New(sha256.New, key)
+			mac.Write(tt.body)
+			if tt.badSum {
+				mac.Write([]byte("tampered"))
+			}
+			req.Header.Set(
+				"HashSHA256",
+				base64.RawStdEncoding.EncodeToString(mac.Sum(nil)),
+			)
+
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+			require.Equal(t, tt.wantCode, rr.Code, rr.Body.String())
+
+			for id, want := range tt.wantValues {
+				m, err := repo.GetMetric(context.Background(), id)
+				require.NoError(t, err, id)
+				assert.Equal(t, want, m.GetValue(), id)
+			}
+		})
+	}
+}
@@ -10,11 +10,30 @@ import (
 	"encoding/base64"
 	"io"
 	"log/slog"
-	"net"
 	"net/http"
 	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/keyring"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/netpolicy"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
 )
 
+// requestIDMiddleware echoes the request ID assigned by middleware.RequestID
+// in the response, so clients can correlate errors with server logs.
+func requestIDMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(middleware.RequestIDHeader, id)
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
 func (rt *Router) slogMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -30,11 +49,7 @@ func (rt *Router) slogMiddleware(h http.Handler) http.Handler {
 						"error reading request body",
 						slog.Any("error", err),
 					)
-					http.Error(
-						w,
-						http.StatusText(http.StatusInternalServerError),
-						http.StatusInternalServerError,
-					)
+					rt.writeError(w, r, errInternal())
 					return
 				}
 				r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
@@ -47,11 +62,7 @@ func (rt *Router) slogMiddleware(h http.Handler) http.Handler {
 							"failed to create gzip reader",
 							slog.Any("error", err),
 						)
-						http.Error(
-							w,
-							"failed to create reader",
-							http.StatusBadRequest,
-						)
+						rt.writeError(w, r, errBadRequest("failed to create reader"))
 						return
 					}
 					defer gz.Close()
@@ -62,11 +73,7 @@ func (rt *Router) slogMiddleware(h http.Handler) http.Handler {
 							"error reading decompressed request body",
 							slog.Any("error", err),
 						)
-						http.Error(
-							w,
-							http.StatusText(http.StatusInternalServerError),
-							http.StatusInternalServerError,
-						)
+						rt.writeError(w, r, errInternal())
 						return
 					}
 				}
@@ -86,7 +93,7 @@ func (rt *Router) slogMiddleware(h http.Handler) http.Handler {
 				slog.Int("content_length", int(r.ContentLength)),
 				slog.String("host", r.Host),
 				slog.String("protocol", r.Proto),
-				slog.Any("headers", r.Header),
+				slog.Any("headers", redactHeaders(r.Header)),
 				slog.String("body", logBody),
 			)
 		}
@@ -102,10 +109,28 @@ func (rt *Router) slogMiddleware(h http.Handler) http.Handler {
 			slog.Int("resp_size", ww.size),
 			slog.Duration("duration", time.Since(start)),
 			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("api_key", apikey.Name(r.Context())),
 		)
 	})
 }
 
+// redactHeaders returns a copy of the headers with the credentials hidden.
+func redactHeaders(h http.Header) http.Header {
+	if h.Get("Authorization") == "" && h.Get(apiKeyHeader) == "" {
+		return h
+	}
+
+	h = h.Clone()
+	for _, name := range []string{"Authorization", apiKeyHeader} {
+		if h.Get(name) != "" {
+			h.Set(name, "[REDACTED]")
+		}
+	}
+
+	return h
+}
+
 func (rt *Router) decompressMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("Content-Encoding") == "gzip" {
@@ -122,11 +147,7 @@ func (rt *Router) decompressMiddleware(h http.Handler) http.Handler {
 					"failed to create reader",
 					slog.Any("error", err),
 				)
-				http.Error(
-					w,
-					"failed to create reader",
-					http.StatusBadRequest,
-				)
+				rt.writeError(w, r, errBadRequest("failed to create reader"))
 				return
 			}
 			defer gz.Close()
@@ -137,11 +158,7 @@ func (rt *Router) decompressMiddleware(h http.Handler) http.Handler {
 					"failed to decompress body",
 					slog.Any("error", err),
 				)
-				http.Error(
-					w,
-					"failed to decompress body",
-					http.StatusBadRequest,
-				)
+				rt.writeError(w, r, errBadRequest("failed to decompress body"))
 				return
 			}
 
@@ -154,6 +171,9 @@ func (rt *Router) decompressMiddleware(h http.Handler) http.Handler {
 	})
 }
 
+// decryptMiddleware decrypts the bodies encrypted with the public key of
+// one of the private keys: the one named by the X-Encryption-Key-Id header,
+// or the first key that decrypts the body without it.
 func (rt *Router) decryptMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("X-Encrypted") != "" {
@@ -167,27 +187,35 @@ func (rt *Router) decryptMiddleware(h http.Handler) http.Handler {
 			data, err := io.ReadAll(r.Body)
 			if err != nil {
 				rt.logger.Error("failed to read body", slog.Any("error", err))
-				http.Error(
-					w,
-					http.StatusText(http.StatusBadRequest),
-					http.StatusBadRequest,
-				)
+				rt.writeError(w, r, errBadRequest(http.StatusText(http.StatusBadRequest)))
 				return
 			}
 
-			decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, rt.privateKey, data)
+			keyID := r.Header.Get(keyring.HeaderEncryptionKeyID)
+			keys := rt.privateKeys.Lookup(keyID)
+			if len(keys) == 0 {
+				rt.logger.Error("unknown encryption key", slog.String("key_id", keyID))
+				rt.auditRejection(r, audit.EventDecryptFailed, "unknown encryption key id", keyID)
+				rt.writeError(w, r, errBadRequest("unknown encryption key id"))
+				return
+			}
+
+			var decrypted []byte
+			for _, key := range keys {
+				if decrypted, err = rsa.DecryptPKCS1v15(rand.Reader, key, data); err == nil {
+					break
+				}
+			}
 			if err != nil {
 				rt.logger.Error("failed to decrypt body", slog.Any("error", err))
-				http.Error(
-					w,
-					http.StatusText(http.StatusBadRequest),
-					http.StatusBadRequest,
-				)
+				rt.auditRejection(r, audit.EventDecryptFailed, "failed to decrypt body", keyID)
+				rt.writeError(w, r, errBadRequest(http.StatusText(http.StatusBadRequest)))
 				return
 			}
 
 			r.Body = io.NopCloser(bytes.NewReader(decrypted))
 			r.Header.Del("X-Encrypted")
+			r.Header.Del(keyring.HeaderEncryptionKeyID)
 			r.ContentLength = int64(len(decrypted))
 		}
 
@@ -195,41 +223,55 @@ func (rt *Router) decryptMiddleware(h http.Handler) http.Handler {
 	})
 }
 
+// checksumMiddleware verifies the HashSHA256 checksum of the body as
+// received, sent by older clients, with any of the secrets. Requests signed
+// with version 2 are left to signatureMiddleware.
 func (rt *Router) checksumMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if signing.Present(r.Header.Get) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
 		if r.Header.Get("HashSHA256") == "" {
 			rt.logger.Error("checksum header is nil or unset")
-			http.Error(
-				w,
+			rt.auditRejection(
+				r,
+				audit.EventSignatureInvalid,
 				"checksum header is nil or unset",
-				http.StatusBadRequest,
+				"",
 			)
+			rt.writeError(w, r, errBadRequest("checksum header is nil or unset"))
 			return
 		}
 
-		mac := hmac.New(sha256.New, rt.secretKey)
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			rt.logger.Error(
 				"failed to read request body",
 				slog.Any("error", err),
 			)
-			http.Error(
-				w,
-				http.StatusText(http.StatusInternalServerError),
-				http.StatusInternalServerError,
-			)
+			rt.writeError(w, r, errInternal())
 			return
 		}
 
-		mac.Write(body)
-		sum := mac.Sum(nil)
-		sumEncoded := base64.RawStdEncoding.EncodeToString(sum)
 		sumFromHeader := r.Header.Get("HashSHA256")
 
-		if sumFromHeader != sumEncoded {
+		valid := false
+		for _, key := range rt.secrets.Lookup("") {
+			mac := hmac.New(sha256.New, key)
+			mac.Write(body)
+			sumEncoded := base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+			if hmac.Equal([]byte(sumFromHeader), []byte(sumEncoded)) {
+				valid = true
+				break
+			}
+		}
+
+		if !valid {
 			rt.logger.Error("invalid request checksum")
-			http.Error(w, "invalid request checksum", http.StatusBadRequest)
+			rt.auditRejection(r, audit.EventSignatureInvalid, "invalid request checksum", "")
+			rt.writeError(w, r, errBadRequest("invalid request checksum"))
 			return
 		}
 
@@ -239,40 +281,100 @@ func (rt *Router) checksumMiddleware(h http.Handler) http.Handler {
 	})
 }
 
-func (rt *Router) verifySubnetMiddleware(h http.Handler) http.Handler {
+// signatureMiddleware verifies version 2 signatures over the decoded body.
+// Unsigned requests pass when older checksums are accepted, as
+// checksumMiddleware has verified them.
+func (rt *Router) signatureMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		clientIPStr := r.Header.Get("X-Real-IP")
-		if clientIPStr == "" {
-			rt.logger.Error("x-real-ip header is nil or unset")
-			http.Error(
-				w,
-				"x-real-ip header is nil or unset",
-				http.StatusBadRequest,
+		if !signing.Present(r.Header.Get) && rt.legacySignatures {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		sig, err := signing.Parse(r.Header.Get)
+		if err != nil {
+			rt.logger.Error("invalid request signature", slog.Any("error", err))
+			rt.auditRejection(r, audit.EventSignatureInvalid, err.Error(), "")
+			rt.writeError(w, r, errUnauthorized(err.Error()))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			rt.logger.Error(
+				"failed to read request body",
+				slog.Any("error", err),
 			)
+			rt.writeError(w, r, errInternal())
 			return
 		}
 
-		clientIP := net.ParseIP(clientIPStr)
-		if clientIP == nil {
-			rt.logger.Error("failed to parse x-real-ip", "ip", clientIPStr)
-			http.Error(
-				w,
-				"failed to parse x-real-ip",
-				http.StatusBadRequest,
+		if err := rt.verifier.Verify(r.Method, r.URL.Path, sig, body); err != nil {
+			rt.logger.Error(
+				"invalid request signature",
+				slog.Any("error", err),
+				slog.String("path", r.URL.Path),
+				slog.String("request_id", middleware.GetReqID(r.Context())),
 			)
+			rt.auditRejection(r, audit.EventSignatureInvalid, err.Error(), sig.KeyID)
+			rt.writeError(w, r, errUnauthorized(err.Error()))
 			return
 		}
 
-		if !rt.trustedSubnet.Contains(clientIP) {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// accessMiddleware resolves the client address with the access policy and
+// rejects the clients the common rules deny. The address is kept in the
+// request context for requireAccess and the audit.
+func (rt *Router) accessMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP, err := rt.policy.Client(
+			r.RemoteAddr,
+			r.Header.Values("X-Forwarded-For"),
+			r.Header.Get("X-Real-IP"),
+		)
+		if err != nil {
+			rt.logger.Error("failed to resolve client address", slog.Any("error", err))
+			rt.auditRejection(r, audit.EventAccessDenied, "invalid client address", "")
+			rt.writeError(w, r, errBadRequest("invalid client address"))
+			return
+		}
+
+		r = r.WithContext(netpolicy.NewContext(r.Context(), clientIP))
+
+		if !rt.policy.Allows(clientIP, netpolicy.KindAny) {
 			rt.logger.Warn("access forbidden for ip", "client_ip", clientIP)
-			http.Error(
-				w,
-				http.StatusText(http.StatusForbidden),
-				http.StatusForbidden,
-			)
+			rt.auditRejection(r, audit.EventAccessDenied, "access forbidden for ip", "")
+			rt.writeError(w, r, errForbidden())
 			return
 		}
 
 		h.ServeHTTP(w, r)
 	})
 }
+
+// requireAccess rejects the clients the access policy denies the kind of
+// access. It passes every request without a policy.
+func (rt *Router) requireAccess(kind netpolicy.Kind) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		if rt.policy == nil {
+			return h
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clientIP, ok := netpolicy.FromContext(r.Context())
+			if !ok || !rt.policy.Allows(clientIP, kind) {
+				rt.logger.Warn("access forbidden for ip", "client_ip", clientIP)
+				rt.auditRejection(r, audit.EventAccessDenied, "access forbidden for ip", "")
+				rt.writeError(w, r, errForbidden())
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
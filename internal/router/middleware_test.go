@@ -1,18 +1,30 @@
 package router
 
 import (
+	"bytes"
 	"compress/gzip"
 	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
 	"io"
 	"log/slog"
-	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/keyring"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/netpolicy"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -23,10 +35,16 @@ func TestRouter_checksumMiddleware(t *testing.T) {
 	repo := memstorage.NewMemoryStorage()
 	secretKey := []byte("test-secret-key")
 
+	secrets := keyring.NewSecrets(0)
+	secrets.Set(map[string][]byte{
+		keyring.DefaultID: secretKey,
+		"2025":            []byte("next-secret-key"),
+	})
+
 	router := &Router{
-		logger:    logger,
-		repo:      repo,
-		secretKey: secretKey,
+		logger:  logger,
+		repo:    repo,
+		secrets: secrets,
 	}
 
 	// Test handler that responds with OK
@@ -77,6 +95,17 @@ func TestRouter_checksumMiddleware(t *testing.T) {
 			expectedStatus:   http.StatusOK,
 			expectedResponse: "OK: {\"test\": \"data\"}",
 		},
+		{
+			name: "checksum with another secret",
+			body: `{"test": "data"}`,
+			headerValue: generateValidChecksum(
+				`{"test": "data"}`,
+				[]byte("next-secret-key"),
+			),
+			setupHeader:      true,
+			expectedStatus:   http.StatusOK,
+			expectedResponse: "OK: {\"test\": \"data\"}",
+		},
 		{
 			name:             "invalid checksum",
 			body:             `{"test": "data"}`,
@@ -364,127 +393,499 @@ func TestRouter_slogMiddleware_WithDebugLogging(t *testing.T) {
 	}
 }
 
-func TestReadKey(t *testing.T) {
+func TestRouter_accessMiddleware(t *testing.T) {
+	policy, err := netpolicy.New(
+		netpolicy.WithRules([]string{"192.168.1.0/24", "2001:db8::/32"}, []string{"192.168.1.13/32"}),
+		netpolicy.WithWriteRules([]string{"192.168.1.0/28"}, nil),
+		netpolicy.WithTrustedProxies([]string{"10.0.0.0/8"}),
+	)
+	require.NoError(t, err)
+
+	router := &Router{
+		logger: slog.New(slog.DiscardHandler),
+		policy: policy,
+	}
+
 	tests := []struct {
-		name    string
-		keyPath string
-		wantErr bool
-		errMsg  string
+		name           string
+		remoteAddr     string
+		headers        map[string]string
+		kind           netpolicy.Kind
+		expectedStatus int
+		expectedBody   string
 	}{
 		{
-			name:    "valid RSA key",
-			keyPath: "testdata/private.pem",
-			wantErr: false,
+			name:           "trusted ip",
+			remoteAddr:     "192.168.1.1:5555",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "trusted ipv6",
+			remoteAddr:     "[2001:db8::1]:5555",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "spoofed x-real-ip",
+			remoteAddr:     "172.16.0.1:5555",
+			headers:        map[string]string{"X-Real-IP": "192.168.1.1"},
+			expectedStatus: http.StatusForbidden,
+			expectedBody:   "Forbidden\n",
+		},
+		{
+			name:           "forwarded by trusted proxy",
+			remoteAddr:     "10.0.0.1:5555",
+			headers:        map[string]string{"X-Forwarded-For": "192.168.1.1"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid forwarded address",
+			remoteAddr:     "10.0.0.1:5555",
+			headers:        map[string]string{"X-Forwarded-For": "invalid"},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid client address\n",
+		},
+		{
+			name:           "denied ip",
+			remoteAddr:     "192.168.1.13:5555",
+			expectedStatus: http.StatusForbidden,
 		},
 		{
-			name:    "file not found",
-			keyPath: "testdata/nonexistent_key.pem",
-			wantErr: true,
-			errMsg:  "failed to read file",
+			name:           "write allowed",
+			remoteAddr:     "192.168.1.2:5555",
+			kind:           netpolicy.KindWrite,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "write forbidden",
+			remoteAddr:     "192.168.1.200:5555",
+			kind:           netpolicy.KindWrite,
+			expectedStatus: http.StatusForbidden,
 		},
 		{
-			name:    "invalid PEM format",
-			keyPath: "testdata/invalid_key.pem",
-			wantErr: true,
-			errMsg:  "invalid key format",
+			name:           "read allowed",
+			remoteAddr:     "192.168.1.200:5555",
+			kind:           netpolicy.KindRead,
+			expectedStatus: http.StatusOK,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			key, err := readKey(tt.keyPath)
+			called := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				w.WriteHeader(http.StatusOK)
+			})
 
-			if tt.wantErr {
-				assert.Error(t, err)
-				assert.Nil(t, key)
-				assert.Contains(t, err.Error(), tt.errMsg)
-			} else {
-				assert.NoError(t, err)
-				assert.NotNil(t, key)
+			middleware := router.accessMiddleware(router.requireAccess(tt.kind)(handler))
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			rr := httptest.NewRecorder()
+			middleware.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
 			}
+			assert.Equal(t, tt.expectedStatus == http.StatusOK, called)
 		})
 	}
 }
 
-func TestRouter_verifySubnetMiddleware(t *testing.T) {
-	logger := slog.New(slog.DiscardHandler)
+func TestRouter_signatureMiddleware(t *testing.T) {
+	key := []byte("test-secret-key")
+	body := `[{"id":"cpu","type":"gauge","value":1}]`
 
-	router := &Router{
-		logger: logger,
-		trustedSubnet: &net.IPNet{
-			IP:   net.IPv4(192, 168, 1, 0),
-			Mask: net.IPv4Mask(255, 255, 255, 0),
-		},
+	gzipped := func(t *testing.T, s string) string {
+		t.Helper()
+
+		var buf strings.Builder
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte(s))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		return buf.String()
 	}
 
-	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
+	signed := func(t *testing.T, method, path, body string) http.Header {
+		t.Helper()
+
+		sig, err := signing.NewSigner(key).Sign(method, path, []byte(body))
+		require.NoError(t, err)
+
+		h := http.Header{}
+		for k, v := range sig.Headers() {
+			h.Set(k, v)
+		}
+		return h
+	}
+
+	newRouter := func(t *testing.T, legacy bool) *Router {
+		t.Helper()
+
+		r, err := NewRouter(
+			slog.New(slog.DiscardHandler),
+			audit.NewAuditor(),
+			memstorage.NewMemoryStorage(),
+			key,
+			"",
+			"",
+			WithLegacySignatures(legacy),
+		)
+		require.NoError(t, err)
+		return r
+	}
+
+	replayed := signed(t, http.MethodPost, "/updates/", body)
 
 	tests := []struct {
-		name           string
-		headerValue    string
-		setupHeader    bool
-		expectedStatus int
-		expectedBody   string
-		expectCalled   bool
+		name     string
+		legacy   bool
+		path     string
+		header   http.Header
+		gzip     bool
+		body     string
+		replay   bool
+		wantCode int
 	}{
 		{
-			name:           "trusted ip",
-			headerValue:    "192.168.1.1",
-			setupHeader:    true,
-			expectedStatus: http.StatusOK,
-			expectedBody:   "",
-			expectCalled:   true,
+			name:     "signed compressed batch",
+			legacy:   true,
+			path:     "/updates/",
+			header:   signed(t, http.MethodPost, "/updates/", body),
+			gzip:     true,
+			body:     body,
+			wantCode: http.StatusOK,
 		},
 		{
-			name:           "missing header",
-			setupHeader:    false,
-			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "x-real-ip header is nil or unset\n",
-			expectCalled:   false,
+			name:     "replayed",
+			legacy:   true,
+			path:     "/updates/",
+			header:   replayed,
+			body:     body,
+			replay:   true,
+			wantCode: http.StatusUnauthorized,
 		},
 		{
-			name:           "invalid cidr",
-			headerValue:    "invalid-cidr",
-			setupHeader:    true,
-			expectedStatus: http.StatusBadRequest,
-			expectedBody:   "failed to parse x-real-ip\n",
-			expectCalled:   false,
+			name:     "signed for another path",
+			legacy:   true,
+			path:     "/api/v1/updates/",
+			header:   signed(t, http.MethodPost, "/updates/", body),
+			body:     body,
+			wantCode: http.StatusUnauthorized,
 		},
 		{
-			name:           "forbidden ip",
-			headerValue:    "10.0.0.1",
-			setupHeader:    true,
-			expectedStatus: http.StatusForbidden,
-			expectedBody:   "Forbidden\n",
-			expectCalled:   false,
+			name:     "signed other body",
+			legacy:   true,
+			path:     "/updates/",
+			header:   signed(t, http.MethodPost, "/updates/", "[]"),
+			body:     body,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:   "legacy checksum",
+			legacy: true,
+			path:   "/updates/",
+			header: http.Header{
+				"Hashsha256": {generateValidChecksum(body, key)},
+			},
+			body:     body,
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "legacy checksum rejected",
+			path: "/updates/",
+			header: http.Header{
+				"Hashsha256": {generateValidChecksum(body, key)},
+			},
+			body:     body,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "signed without legacy",
+			path:     "/updates/",
+			header:   signed(t, http.MethodPost, "/updates/", body),
+			body:     body,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "signed single update",
+			path:     "/update/gauge/cpu/1",
+			header:   signed(t, http.MethodPost, "/update/gauge/cpu/1", ""),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "unsigned single update",
+			legacy:   true,
+			path:     "/update/gauge/cpu/1",
+			header:   http.Header{},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "signed influx write",
+			path:     "/write",
+			header:   signed(t, http.MethodPost, "/write", "cpu value=1"),
+			body:     "cpu value=1",
+			wantCode: http.StatusNoContent,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			called := false
-			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				called = true
-				testHandler.ServeHTTP(w, r)
-			})
+			r := newRouter(t, tt.legacy)
 
-			middleware := router.verifySubnetMiddleware(handler)
+			send := func() int {
+				reqBody := tt.body
+				if tt.gzip {
+					reqBody = gzipped(t, tt.body)
+				}
+				req := httptest.NewRequest(
+					http.MethodPost,
+					tt.path,
+					strings.NewReader(reqBody),
+				)
+				req.Header = tt.header.Clone()
+				if tt.gzip {
+					req.Header.Set("Content-Encoding", "gzip")
+				}
 
-			req := httptest.NewRequest(http.MethodGet, "/test", nil)
-			if tt.setupHeader {
-				req.Header.Set("X-Real-IP", tt.headerValue)
+				rr := httptest.NewRecorder()
+				r.router.ServeHTTP(rr, req)
+				return rr.Code
 			}
 
-			rr := httptest.NewRecorder()
-			middleware.ServeHTTP(rr, req)
+			if tt.replay {
+				require.Equal(t, http.StatusOK, send())
+			}
+			assert.Equal(t, tt.wantCode, send())
+		})
+	}
+}
 
-			assert.Equal(t, tt.expectedStatus, rr.Code)
-			if tt.expectedBody != "" {
-				assert.Equal(t, tt.expectedBody, rr.Body.String())
+func TestRouter_auditSecurityRejections(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     []byte
+		remoteAddr string
+		headers    map[string]string
+		wantType   audit.EventType
+		wantReason string
+		wantKeyID  string
+	}{
+		{
+			name:       "forbidden ip",
+			remoteAddr: "10.0.0.1:5555",
+			wantType:   audit.EventAccessDenied,
+			wantReason: "access forbidden for ip",
+		},
+		{
+			name:       "unknown encryption key",
+			remoteAddr: "192.168.0.1:5555",
+			headers: map[string]string{
+				"X-Encrypted":                 "rsa",
+				keyring.HeaderEncryptionKeyID: "next",
+			},
+			wantType:   audit.EventDecryptFailed,
+			wantReason: "unknown encryption key id",
+			wantKeyID:  "next",
+		},
+		{
+			name:       "undecryptable body",
+			remoteAddr: "192.168.0.1:5555",
+			headers:    map[string]string{"X-Encrypted": "rsa"},
+			wantType:   audit.EventDecryptFailed,
+			wantReason: "failed to decrypt body",
+		},
+		{
+			name:       "invalid checksum",
+			secret:     []byte("secret"),
+			remoteAddr: "192.168.0.1:5555",
+			headers:    map[string]string{"HashSHA256": "invalid"},
+			wantType:   audit.EventSignatureInvalid,
+			wantReason: "invalid request checksum",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(eventObserver, 1)
+			a := audit.NewAuditor()
+			a.Add(events)
+
+			r, err := NewRouter(
+				slog.New(slog.DiscardHandler),
+				a,
+				memstorage.NewMemoryStorage(),
+				tt.secret,
+				"../keyring/testdata/private.pem",
+				"192.168.0.0/16",
+			)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(
+				http.MethodPost,
+				"/updates/",
+				strings.NewReader(`[{"id":"cpu","type":"gauge","value":1}]`),
+			)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
 			}
-			assert.Equal(t, tt.expectCalled, called)
+
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+			require.GreaterOrEqual(t, rr.Code, http.StatusBadRequest)
+
+			select {
+			case event := <-events:
+				assert.Equal(t, tt.wantType, event.Type)
+				assert.Equal(t, tt.wantReason, event.Reason)
+				assert.Equal(t, tt.wantKeyID, event.KeyID)
+				assert.Equal(t, "/updates/", event.Route)
+				assert.Equal(t, getClientIP(tt.remoteAddr), event.IPAddress)
+			case <-time.After(5 * time.Second):
+				t.Fatal("audit event was not logged")
+			}
+		})
+	}
+}
+
+func TestRouter_keyRotation(t *testing.T) {
+	dir := t.TempDir()
+	privateKeys := map[string]*rsa.PrivateKey{}
+	for _, id := range []string{"old", "new"} {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		require.NoError(t, err)
+		privateKeys[id] = key
+
+		data := pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})
+		require.NoError(t, os.WriteFile(filepath.Join(dir, id+".pem"), data, 0o600))
+	}
+
+	file := filepath.Join(dir, "keys.json")
+	writeKeys := func(t *testing.T, ids ...string) {
+		t.Helper()
+
+		secrets, keys := map[string]string{}, map[string]string{}
+		for _, id := range ids {
+			secrets[id] = id + "-secret"
+			keys[id] = id + ".pem"
+		}
+		data, err := json.Marshal(map[string]any{
+			"secrets":      secrets,
+			"private_keys": keys,
+		})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(file, data, 0o600))
+	}
+
+	writeKeys(t, "old", "new")
+	keys, err := keyring.Load(keyring.Config{File: file, GracePeriod: time.Hour})
+	require.NoError(t, err)
+
+	r, err := NewRouter(
+		slog.New(slog.DiscardHandler),
+		audit.NewAuditor(),
+		memstorage.NewMemoryStorage(),
+		nil,
+		"",
+		"",
+		WithKeys(keys),
+		WithLegacySignatures(false),
+	)
+	require.NoError(t, err)
+
+	body := `[{"id":"cpu","type":"gauge","value":1}]`
+
+	send := func(t *testing.T, secretID, cryptoID, sendSecretID, sendCryptoID string) int {
+		t.Helper()
+
+		sig, err := signing.NewSigner(
+			[]byte(secretID+"-secret"),
+			signing.WithKeyID(sendSecretID),
+		).Sign(http.MethodPost, "/updates/", []byte(body))
+		require.NoError(t, err)
+
+		encrypted, err := rsa.EncryptPKCS1v15(
+			rand.Reader,
+			&privateKeys[cryptoID].PublicKey,
+			[]byte(body),
+		)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(encrypted))
+		for k, v := range sig.Headers() {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("X-Encrypted", "rsa")
+		if sendCryptoID != "" {
+			req.Header.Set(keyring.HeaderEncryptionKeyID, sendCryptoID)
+		}
+
+		rr := httptest.NewRecorder()
+		r.router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	tests := []struct {
+		name         string
+		secretID     string
+		cryptoID     string
+		sendSecretID string
+		sendCryptoID string
+		wantCode     int
+	}{
+		{
+			name:         "named keys",
+			secretID:     "new",
+			cryptoID:     "new",
+			sendSecretID: "new",
+			sendCryptoID: "new",
+			wantCode:     http.StatusOK,
+		},
+		{
+			name:     "unnamed keys",
+			secretID: "old",
+			cryptoID: "old",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:         "unknown encryption key",
+			secretID:     "new",
+			cryptoID:     "new",
+			sendCryptoID: "next",
+			wantCode:     http.StatusBadRequest,
+		},
+		{
+			name:         "wrong signing key",
+			secretID:     "old",
+			cryptoID:     "new",
+			sendSecretID: "new",
+			wantCode:     http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(
+				t,
+				tt.wantCode,
+				send(t, tt.secretID, tt.cryptoID, tt.sendSecretID, tt.sendCryptoID),
+			)
 		})
 	}
+
+	// the old keys are still accepted for the grace period once removed
+	writeKeys(t, "new")
+	require.NoError(t, keys.Reload())
+	assert.Equal(t, http.StatusOK, send(t, "old", "old", "old", "old"))
+	assert.Equal(t, http.StatusOK, send(t, "new", "new", "new", "new"))
 }
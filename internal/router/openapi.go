@@ -0,0 +1,296 @@
+package router
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// endpoint is a single API operation. The endpoint table drives both the
+// route registration and the OpenAPI document, so the two cannot drift.
+type endpoint struct {
+	method  string
+	pattern string
+	handler http.HandlerFunc
+	doc     operation
+}
+
+// routeGroup is a set of endpoints sharing a path prefix and middleware.
+type routeGroup struct {
+	prefix      string
+	middlewares []func(http.Handler) http.Handler
+	endpoints   []endpoint
+}
+
+// operation documents an endpoint.
+type operation struct {
+	summary   string
+	headers   []parameter
+	query     []parameter
+	params    map[string]string
+	request   *body
+	responses []response
+}
+
+// parameter documents a request header or query parameter.
+type parameter struct {
+	name        string
+	description string
+	enum        []string
+}
+
+// body documents a request or response body. The schema is derived from the
+// Go type of sample.
+type body struct {
+	contentType string
+	sample      any
+}
+
+// response documents a response status, the body may be offered in several
+// content types.
+type response struct {
+	status      int
+	description string
+	bodies      []*body
+}
+
+func jsonBody(sample any) *body {
+	return &body{contentType: "application/json", sample: sample}
+}
+
+func textBody() *body {
+	return &body{contentType: "text/plain", sample: ""}
+}
+
+var pathParamRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// openAPIDocument builds the OpenAPI 3 document of the endpoints mounted
+// under prefix.
+func openAPIDocument(prefix string, groups []routeGroup) map[string]any {
+	reg := &schemaRegistry{schemas: make(map[string]any)}
+	errorSchema := reg.schemaOf(reflect.TypeFor[apiError]())
+
+	paths := make(map[string]any)
+	for _, g := range groups {
+		for _, e := range g.endpoints {
+			path := prefix + g.prefix + e.pattern
+
+			item, ok := paths[path].(map[string]any)
+			if !ok {
+				item = make(map[string]any)
+				paths[path] = item
+			}
+
+			item[strings.ToLower(e.method)] = reg.operationOf(
+				e,
+				errorSchema,
+			)
+		}
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Metrics API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": reg.schemas,
+		},
+	}
+}
+
+func (reg *schemaRegistry) operationOf(
+	e endpoint,
+	errorSchema map[string]any,
+) map[string]any {
+	var params []any
+	for _, m := range pathParamRe.FindAllStringSubmatch(e.pattern, -1) {
+		params = append(params, map[string]any{
+			"name":        m[1],
+			"in":          "path",
+			"required":    true,
+			"description": e.doc.params[m[1]],
+			"schema":      map[string]any{"type": "string"},
+		})
+	}
+
+	params = append(params, parametersOf("header", e.doc.headers)...)
+	params = append(params, parametersOf("query", e.doc.query)...)
+
+	op := map[string]any{"summary": e.doc.summary}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if e.doc.request != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  reg.contentOf(e.doc.request),
+		}
+	}
+
+	responses := map[string]any{
+		"default": map[string]any{
+			"description": "Error",
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": errorSchema},
+			},
+		},
+	}
+	for _, r := range e.doc.responses {
+		resp := map[string]any{"description": r.description}
+		if len(r.bodies) > 0 {
+			resp["content"] = reg.contentOf(r.bodies...)
+		}
+		responses[strconv.Itoa(r.status)] = resp
+	}
+	op["responses"] = responses
+
+	return op
+}
+
+func parametersOf(in string, params []parameter) []any {
+	res := make([]any, 0, len(params))
+	for _, p := range params {
+		schema := map[string]any{"type": "string"}
+		if len(p.enum) > 0 {
+			schema["enum"] = p.enum
+		}
+
+		res = append(res, map[string]any{
+			"name":        p.name,
+			"in":          in,
+			"description": p.description,
+			"schema":      schema,
+		})
+	}
+
+	return res
+}
+
+func (reg *schemaRegistry) contentOf(bodies ...*body) map[string]any {
+	content := make(map[string]any, len(bodies))
+	for _, b := range bodies {
+		content[b.contentType] = map[string]any{
+			"schema": reg.schemaOf(reflect.TypeOf(b.sample)),
+		}
+	}
+
+	return content
+}
+
+// schemaRegistry collects the named schemas referenced by the document.
+type schemaRegistry struct {
+	schemas map[string]any
+}
+
+// schemaOf returns the JSON schema of t. Named structs are registered as
+// components and referenced.
+func (reg *schemaRegistry) schemaOf(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{
+			"type":  "array",
+			"items": reg.schemaOf(t.Elem()),
+		}
+	case reflect.Map:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": reg.schemaOf(t.Elem()),
+		}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := reg.schemas[name]; !ok {
+			// Register before descending to stop on recursive types.
+			reg.schemas[name] = nil
+			reg.schemas[name] = reg.structSchema(t)
+		}
+
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (reg *schemaRegistry) structSchema(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	var required []string
+
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					walk(ft)
+					continue
+				}
+			}
+
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+
+			props[name] = reg.schemaOf(f.Type)
+			if !strings.Contains(opts, "omitempty") &&
+				f.Type.Kind() != reflect.Pointer {
+				required = append(required, name)
+			}
+		}
+	}
+	walk(t)
+
+	schema := map[string]any{
+		"type":       "object",
+		"properties": props,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+
+	return schema
+}
+
+// schemaName returns the component name of a struct type.
+func schemaName(t reflect.Type) string {
+	if t == reflect.TypeFor[apiError]() {
+		return "Error"
+	}
+
+	return t.Name()
+}
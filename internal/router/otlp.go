@@ -0,0 +1,146 @@
+package router
+
+import (
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+const (
+	// otlpPath is the OTLP/HTTP metrics export path.
+	otlpPath = "/v1/metrics"
+
+	contentTypeProtobuf = "application/x-protobuf"
+)
+
+// otlpCodec encodes OTLP messages in the format of the request.
+type otlpCodec struct {
+	contentType string
+	marshal     func(proto.Message) ([]byte, error)
+	unmarshal   func([]byte, proto.Message) error
+}
+
+var otlpCodecs = map[string]otlpCodec{
+	contentTypeProtobuf: {
+		contentType: contentTypeProtobuf,
+		marshal:     proto.Marshal,
+		unmarshal:   proto.Unmarshal,
+	},
+	contentTypeJSON: {
+		contentType: contentTypeJSON,
+		marshal:     protojson.Marshal,
+		unmarshal:   protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal,
+	},
+}
+
+// otlpWrite handles OTLP/HTTP metrics exports in binary protobuf or JSON
+// encoding.
+//
+// The export is applied in best-effort mode as OTLP expects: data points
+// that cannot be converted or stored are reported in the partial success of
+// the response. Errors are answered with a google.rpc.Status in the encoding
+// of the request.
+func (rt Router) otlpWrite(w http.ResponseWriter, req *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	codec, ok := otlpCodecs[mediaType]
+	if !ok {
+		rt.writeOTLPStatus(
+			w,
+			otlpCodecs[contentTypeProtobuf],
+			http.StatusUnsupportedMediaType,
+			codes.InvalidArgument,
+			"unsupported content type "+mediaType,
+		)
+		return
+	}
+
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		rt.logger.Error("error reading request body", slog.Any("error", err))
+		rt.writeOTLPStatus(
+			w,
+			codec,
+			http.StatusBadRequest,
+			codes.InvalidArgument,
+			"error reading request body",
+		)
+		return
+	}
+
+	var in colmetricspb.ExportMetricsServiceRequest
+	if err := codec.unmarshal(data, &in); err != nil {
+		rt.logger.Error("error decoding otlp request", slog.Any("error", err))
+		rt.writeOTLPStatus(
+			w,
+			codec,
+			http.StatusBadRequest,
+			codes.InvalidArgument,
+			err.Error(),
+		)
+		return
+	}
+
+	metrics, commit, rejected, convErr := rt.otlp.Metrics(in.GetResourceMetrics())
+
+	var res *model.BatchResult
+	if len(metrics) > 0 {
+		res, ok = rt.storeBatch(w, req, metrics, model.BatchBestEffort)
+		commit.Apply(res)
+		if !ok {
+			return
+		}
+	}
+
+	out := &colmetricspb.ExportMetricsServiceResponse{}
+	if partial := ingest.PartialSuccess(rejected, convErr, res); partial != nil {
+		rt.logger.Warn(
+			"otlp data points rejected",
+			slog.Int64("rejected", partial.GetRejectedDataPoints()),
+			slog.String("error", partial.GetErrorMessage()),
+		)
+		out.PartialSuccess = partial
+	}
+
+	rt.writeOTLP(w, codec, http.StatusOK, out)
+}
+
+func (rt Router) writeOTLPStatus(
+	w http.ResponseWriter,
+	codec otlpCodec,
+	status int,
+	code codes.Code,
+	message string,
+) {
+	rt.writeOTLP(w, codec, status, &spb.Status{
+		Code:    int32(code),
+		Message: message,
+	})
+}
+
+func (rt Router) writeOTLP(
+	w http.ResponseWriter,
+	codec otlpCodec,
+	status int,
+	m proto.Message,
+) {
+	body, err := codec.marshal(m)
+	if err != nil {
+		rt.logger.Error("error encoding otlp response", slog.Any("error", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", codec.contentType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,203 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+func TestRouter_otlpWrite(t *testing.T) {
+	export := &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{{
+				Key: "service.name",
+				Value: &commonpb.AnyValue{
+					Value: &commonpb.AnyValue_StringValue{StringValue: "api"},
+				},
+			}}},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+				{
+					Name: "requests",
+					Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+						AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+						IsMonotonic:            true,
+						DataPoints: []*metricspb.NumberDataPoint{{
+							StartTimeUnixNano: 1,
+							Value:             &metricspb.NumberDataPoint_AsInt{AsInt: 7},
+						}},
+					}},
+				},
+				{
+					Name: "load",
+					Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+						DataPoints: []*metricspb.NumberDataPoint{{
+							Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 0.5},
+						}},
+					}},
+				},
+			}}},
+		}},
+	}
+
+	binary, err := proto.Marshal(export)
+	require.NoError(t, err)
+	jsonBody, err := protojson.Marshal(export)
+	require.NoError(t, err)
+
+	conflict := &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{{
+				Name: "reqs",
+				Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+					DataPoints: []*metricspb.NumberDataPoint{{
+						Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 1},
+					}},
+				}},
+			}}}},
+		}},
+	}
+	conflictBody, err := proto.Marshal(conflict)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		contentType  string
+		body         []byte
+		realIP       string
+		wantCode     int
+		wantRejected int64
+		wantValues   map[string]string
+	}{
+		{
+			name:        "protobuf",
+			contentType: "application/x-protobuf",
+			body:        binary,
+			realIP:      "10.0.0.1",
+			wantCode:    http.StatusOK,
+			wantValues: map[string]string{
+				"api.requests": "7",
+				"api.load":     "0.5",
+			},
+		},
+		{
+			name:        "json",
+			contentType: "application/json; charset=utf-8",
+			body:        jsonBody,
+			realIP:      "10.0.0.1",
+			wantCode:    http.StatusOK,
+			wantValues: map[string]string{
+				"api.requests": "7",
+				"api.load":     "0.5",
+			},
+		},
+		{
+			name:         "type conflict is a partial success",
+			contentType:  "application/x-protobuf",
+			body:         conflictBody,
+			realIP:       "10.0.0.1",
+			wantCode:     http.StatusOK,
+			wantRejected: 1,
+			wantValues:   map[string]string{"reqs": "5"},
+		},
+		{
+			name:        "malformed body",
+			contentType: "application/x-protobuf",
+			body:        []byte{0xff, 0xff},
+			realIP:      "10.0.0.1",
+			wantCode:    http.StatusBadRequest,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body:        binary,
+			realIP:      "10.0.0.1",
+			wantCode:    http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "outside trusted subnet",
+			contentType: "application/x-protobuf",
+			body:        binary,
+			realIP:      "192.168.0.1",
+			wantCode:    http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := memstorage.NewMemoryStorage()
+			require.NoError(t, repo.Initialize([]model.Metric{
+				model.NewCounter("reqs", 5),
+			}))
+
+			otlp, err := ingest.NewOTLP(
+				ingest.WithResourcePrefix([]string{"service.name"}),
+			)
+			require.NoError(t, err)
+
+			r, err := NewRouter(
+				slog.New(slog.DiscardHandler),
+				audit.NewAuditor(),
+				repo,
+				nil,
+				"",
+				"10.0.0.0/8",
+				WithOTLP(otlp),
+			)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(
+				http.MethodPost,
+				"/v1/metrics",
+				bytes.NewReader(tt.body),
+			)
+			req.Header.Set("Content-Type", tt.contentType)
+			req.RemoteAddr = net.JoinHostPort(tt.realIP, "1234")
+
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+			require.Equal(t, tt.wantCode, rr.Code, rr.Body.String())
+
+			codec := otlpCodecs[rr.Header().Get("Content-Type")]
+
+			switch rr.Code {
+			case http.StatusOK:
+				var resp colmetricspb.ExportMetricsServiceResponse
+				require.NoError(t, codec.unmarshal(rr.Body.Bytes(), &resp))
+				assert.Equal(
+					t,
+					tt.wantRejected,
+					resp.GetPartialSuccess().GetRejectedDataPoints(),
+				)
+			case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+				var st spb.Status
+				require.NoError(t, codec.unmarshal(rr.Body.Bytes(), &st))
+				assert.NotEmpty(t, st.GetMessage())
+			}
+
+			for id, want := range tt.wantValues {
+				m, err := repo.GetMetric(context.Background(), id)
+				require.NoError(t, err, id)
+				assert.Equal(t, want, m.GetValue(), id)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package router
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+const (
+	// remoteWritePath is the Prometheus remote write path under /api/v1.
+	remoteWritePath = "/write"
+
+	// maxRemoteWriteSize bounds the decompressed remote write request.
+	maxRemoteWriteSize = 32 << 20
+)
+
+// remoteWrite handles Prometheus remote write 1.0 requests: snappy
+// compressed prometheus.WriteRequest protobufs.
+//
+// The request is applied in best-effort mode. Rejected metrics answer 400
+// after the others are stored, since Prometheus retries 5xx responses only
+// and retrying would not help. Success responds with 204.
+func (rt Router) remoteWrite(w http.ResponseWriter, req *http.Request) {
+	if enc := req.Header.Get("Content-Encoding"); enc != "snappy" {
+		rt.writeError(w, req, newAPIError(
+			http.StatusUnsupportedMediaType,
+			codeBadRequest,
+			"unsupported content encoding "+enc,
+		))
+		return
+	}
+
+	if strings.Contains(req.Header.Get("Content-Type"), "proto=io.prometheus.write.v2") {
+		rt.writeError(w, req, newAPIError(
+			http.StatusUnsupportedMediaType,
+			codeBadRequest,
+			"remote write 2.0 is not supported",
+		))
+		return
+	}
+
+	compressed, err := io.ReadAll(req.Body)
+	if err != nil {
+		rt.logger.Error("error reading request body", slog.Any("error", err))
+		rt.writeError(w, req, errBadRequest("error reading request body"))
+		return
+	}
+
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil || n > maxRemoteWriteSize {
+		rt.writeError(w, req, errBadRequest("invalid snappy payload"))
+		return
+	}
+
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		rt.logger.Error("error decompressing remote write", slog.Any("error", err))
+		rt.writeError(w, req, errBadRequest("invalid snappy payload"))
+		return
+	}
+
+	series, err := ingest.ParseWriteRequest(data)
+	if err != nil {
+		rt.logger.Error("error parsing remote write", slog.Any("error", err))
+		rt.writeError(w, req, errBadRequest(err.Error()))
+		return
+	}
+
+	metrics, commit, err := rt.remoteWriter.Metrics(series)
+	if err != nil {
+		rt.writeError(w, req, errValidation(err.Error()))
+		return
+	}
+
+	if len(metrics) > 0 {
+		res, ok := rt.storeBatch(w, req, metrics, model.BatchBestEffort)
+		commit.Apply(res)
+		if !ok {
+			return
+		}
+
+		if res.Rejected > 0 {
+			rt.writeError(
+				w,
+				req,
+				errValidation("metrics rejected").withDetails(res),
+			)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
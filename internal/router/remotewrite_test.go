@@ -0,0 +1,147 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+// writeRequest encodes a prometheus.WriteRequest holding one series per
+// name with a single sample.
+func writeRequest(samples map[string]float64) []byte {
+	var req []byte
+	for name, v := range samples {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, "__name__")
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, name)
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(v))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, 1700000000000)
+
+		var ts []byte
+		ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, label)
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+
+	return req
+}
+
+func TestRouter_remoteWrite(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        []byte
+		encoding    string
+		contentType string
+		wantCode    int
+		wantValues  map[string]string
+	}{
+		{
+			name: "write",
+			body: snappy.Encode(nil, writeRequest(map[string]float64{
+				"temp":       21.5,
+				"reqs_total": 3,
+			})),
+			encoding:   "snappy",
+			wantCode:   http.StatusNoContent,
+			wantValues: map[string]string{"temp": "21.5", "reqs_total": "3"},
+		},
+		{
+			name: "rejected metrics",
+			body: snappy.Encode(nil, writeRequest(map[string]float64{
+				"temp": 20,
+				"reqs": 1.5,
+			})),
+			encoding:   "snappy",
+			wantCode:   http.StatusBadRequest,
+			wantValues: map[string]string{"temp": "20", "reqs": "5"},
+		},
+		{
+			name:     "uncompressed",
+			body:     writeRequest(map[string]float64{"temp": 1}),
+			wantCode: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "remote write 2.0",
+			body:        snappy.Encode(nil, writeRequest(map[string]float64{"temp": 1})),
+			encoding:    "snappy",
+			contentType: "application/x-protobuf;proto=io.prometheus.write.v2.Request",
+			wantCode:    http.StatusUnsupportedMediaType,
+		},
+		{
+			name:     "invalid snappy",
+			body:     []byte("not snappy"),
+			encoding: "snappy",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid protobuf",
+			body:     snappy.Encode(nil, []byte{0x0a, 0x05, 0x01}),
+			encoding: "snappy",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := memstorage.NewMemoryStorage()
+			require.NoError(t, repo.Initialize([]model.Metric{
+				model.NewCounter("reqs", 5),
+			}))
+
+			r, err := NewRouter(
+				slog.New(slog.DiscardHandler),
+				audit.NewAuditor(),
+				repo,
+				nil,
+				"",
+				"",
+			)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(
+				http.MethodPost,
+				"/api/v1/write",
+				bytes.NewReader(tt.body),
+			)
+			req.Header.Set("Content-Encoding", tt.encoding)
+			req.Header.Set("Content-Type", "application/x-protobuf")
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+			require.Equal(t, tt.wantCode, rr.Code, rr.Body.String())
+
+			for id, want := range tt.wantValues {
+				m, err := repo.GetMetric(context.Background(), id)
+				require.NoError(t, err, id)
+				assert.Equal(t, want, m.GetValue(), id)
+			}
+		})
+	}
+}
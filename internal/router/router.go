@@ -3,41 +3,166 @@ package router
 import (
 	"context"
 	"crypto/rsa"
-	"crypto/x509"
-	_ "embed"
+	"crypto/tls"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
-	"html/template"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/keyring"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/netpolicy"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/repository"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/tlsconfig"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-//go:embed templates/root.tpl
-var rootTemplate string
+const (
+	// apiShutdownTimeout defines the timeout for graceful shutdown of the API server.
+	apiShutdownTimeout = 5 * time.Second
 
-// apiShutdownTimeout defines the timeout for graceful shutdown of the API server.
-const apiShutdownTimeout = 5 * time.Second
+	// batchModeHeader selects the batch mode of POST /updates/.
+	batchModeHeader = "X-Batch-Mode"
+
+	// apiV1Prefix is the root of the versioned API.
+	apiV1Prefix = "/api/v1"
+)
 
 // Router handles HTTP requests and routes them to appropriate handlers.
 type Router struct {
-	repo          repository.Repository
-	router        http.Handler
-	logger        *slog.Logger
-	auditor       *audit.Auditor
-	secretKey     []byte
-	privateKey    *rsa.PrivateKey
-	trustedSubnet *net.IPNet
+	repo         repository.Repository
+	router       http.Handler
+	logger       *slog.Logger
+	auditor      *audit.Auditor
+	secrets      *keyring.Ring[[]byte]
+	privateKeys  *keyring.Ring[*rsa.PrivateKey]
+	policy       *netpolicy.Policy
+	validator    *model.Validator
+	lineProtocol *ingest.LineProtocol
+	otlp         *ingest.OTLP
+	remoteWriter *ingest.RemoteWrite
+	webhooks     map[string]*ingest.Webhook
+	tlsConfig    *tls.Config
+	apiKeys      *apikey.Store
+	verifier     *signing.Verifier
+	// legacySignatures accepts the HashSHA256 checksums of the body as
+	// received besides version 2 signatures.
+	legacySignatures bool
+}
+
+// Option configures optional Router behaviour.
+type Option func(*Router) error
+
+// WithStrictValidation enables strict validation of metric payloads.
+func WithStrictValidation(strict bool) Option {
+	return func(r *Router) error {
+		r.validator = model.NewValidator(strict)
+		return nil
+	}
+}
+
+// WithLineProtocol sets the mapping of InfluxDB line protocol writes to
+// metrics.
+func WithLineProtocol(lp *ingest.LineProtocol) Option {
+	return func(r *Router) error {
+		r.lineProtocol = lp
+		return nil
+	}
+}
+
+// WithOTLP sets the mapping of OTLP metrics exports to metrics. The mapping
+// keeps the state of cumulative series and may be shared with the gRPC API.
+func WithOTLP(o *ingest.OTLP) Option {
+	return func(r *Router) error {
+		r.otlp = o
+		return nil
+	}
+}
+
+// WithRemoteWrite sets the mapping of Prometheus remote write series to
+// metrics.
+func WithRemoteWrite(rw *ingest.RemoteWrite) Option {
+	return func(r *Router) error {
+		r.remoteWriter = rw
+		return nil
+	}
+}
+
+// WithWebhooks sets the JSON webhook sources served at
+// POST /ingest/{source}, keyed by source name.
+func WithWebhooks(webhooks map[string]*ingest.Webhook) Option {
+	return func(r *Router) error {
+		r.webhooks = webhooks
+		return nil
+	}
+}
+
+// WithTLSConfig serves HTTPS with the configuration instead of plain HTTP.
+func WithTLSConfig(c *tls.Config) Option {
+	return func(r *Router) error {
+		r.tlsConfig = c
+		return nil
+	}
+}
+
+// WithAPIKeys requires the API keys of the store: reads need the read scope
+// and writes the write scope, keys restricted to a prefix only reach the
+// metrics starting with it.
+func WithAPIKeys(s *apikey.Store) Option {
+	return func(r *Router) error {
+		r.apiKeys = s
+		return nil
+	}
+}
+
+// WithKeys sets the HMAC secrets and RSA private keys of the requests,
+// instead of the ones of the key and cryptoKey arguments of NewRouter. The
+// keys may be reloaded while the router serves: the middleware checking
+// checksums and signatures and the one decrypting bodies are enabled by the
+// keys present when the router is created.
+func WithKeys(k *keyring.Keys) Option {
+	return func(r *Router) error {
+		r.secrets = k.Secrets
+		r.privateKeys = k.PrivateKeys
+		return nil
+	}
+}
+
+// WithAccessPolicy restricts the client addresses with the policy instead
+// of the trustedSubnet argument of NewRouter.
+func WithAccessPolicy(p *netpolicy.Policy) Option {
+	return func(r *Router) error {
+		r.policy = p
+		return nil
+	}
+}
+
+// WithSignatureVerifier sets the verifier of version 2 request signatures,
+// one with the secrets and the default clock skew by default.
+func WithSignatureVerifier(v *signing.Verifier) Option {
+	return func(r *Router) error {
+		r.verifier = v
+		return nil
+	}
+}
+
+// WithLegacySignatures accepts or rejects the HashSHA256 checksums of the
+// older clients, accepted by default.
+func WithLegacySignatures(enabled bool) Option {
+	return func(r *Router) error {
+		r.legacySignatures = enabled
+		return nil
+	}
 }
 
 // NewRouter creates a new Router instance.
@@ -48,29 +173,43 @@ func NewRouter(
 	key []byte,
 	cryptoKey string,
 	trustedSubnet string,
+	opts ...Option,
 ) (*Router, error) {
 	r := &Router{
 		logger:    logger,
 		auditor:   a,
 		repo:      repo,
-		secretKey: key,
+		validator: model.NewValidator(false),
+
+		legacySignatures: true,
 	}
 
-	if len(cryptoKey) > 0 {
-		privateKey, err := readKey(cryptoKey)
-		if err != nil {
-			return nil, fmt.Errorf(
-				"failed to read private key from file %s: %w",
-				cryptoKey,
-				err,
-			)
-		}
+	lp, err := ingest.NewLineProtocol()
+	if err != nil {
+		return nil, err
+	}
+	r.lineProtocol = lp
 
-		r.privateKey = privateKey
+	otlp, err := ingest.NewOTLP()
+	if err != nil {
+		return nil, err
 	}
+	r.otlp = otlp
 
-	if len(trustedSubnet) > 0 {
-		_, trustedSubnet, err := net.ParseCIDR(trustedSubnet)
+	rw, err := ingest.NewRemoteWrite()
+	if err != nil {
+		return nil, err
+	}
+	r.remoteWriter = rw
+
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(trustedSubnet) > 0 && r.policy == nil {
+		p, err := netpolicy.New(netpolicy.WithRules([]string{trustedSubnet}, nil))
 		if err != nil {
 			return nil, fmt.Errorf(
 				"failed to parse trusted subnet %s: %w",
@@ -78,7 +217,27 @@ func NewRouter(
 				err,
 			)
 		}
-		r.trustedSubnet = trustedSubnet
+		r.policy = p
+	}
+
+	if r.secrets == nil {
+		keys, err := keyring.Load(keyring.Config{
+			SecretKey: key,
+			CryptoKey: cryptoKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		r.secrets = keys.Secrets
+		r.privateKeys = keys.PrivateKeys
+	}
+
+	if r.secrets.Len() > 0 && r.verifier == nil {
+		v, err := signing.NewVerifier(nil, signing.WithKeys(r.secrets))
+		if err != nil {
+			return nil, err
+		}
+		r.verifier = v
 	}
 
 	r.router = r.initRoutes()
@@ -87,53 +246,345 @@ func NewRouter(
 }
 
 // initRoutes initializes the HTTP routes and middleware.
+//
+// The API is served both at the root, for the existing agents, and under
+// /api/v1, where errors are rendered as JSON envelopes and the OpenAPI
+// document is published.
 func (rt *Router) initRoutes() http.Handler {
 	r := chi.NewMux()
 
 	compressForTypes := []string{
 		"text/html",
+		"text/css",
+		"text/javascript",
 		"application/json",
 	}
 
 	compressor := middleware.NewCompressor(5, compressForTypes...)
 
+	r.Use(middleware.RequestID)
+	r.Use(requestIDMiddleware)
+	if rt.apiKeys != nil {
+		r.Use(rt.authenticateMiddleware)
+	}
 	r.Use(rt.slogMiddleware)
 	r.Use(compressor.Handler)
 
-	if rt.trustedSubnet != nil {
-		r.Use(rt.verifySubnetMiddleware)
+	if rt.policy != nil {
+		r.Use(rt.accessMiddleware)
 	}
 
-	r.Get("/", rt.rootHandler)
-	r.Get("/ping", rt.pingHandler)
+	groups := rt.apiGroups()
+
+	read := r.With(
+		rt.requireAccess(netpolicy.KindRead),
+		rt.requireScope(apikey.ScopeRead),
+		rt.requireAllMetrics,
+	)
+	read.Get("/", rt.rootHandler)
+	read.Get("/metrics/{name}", rt.metricPageHandler)
+	read.Route(grafanaPrefix, rt.grafanaRoutes)
+	r.Handle("/static/*", http.StripPrefix("/static/", http.FileServerFS(staticFS)))
+
+	write := r.With(rt.writeMiddlewares()...)
+	write.Post("/write", rt.influxWrite)
+	write.Post("/api/v2/write", rt.influxWrite)
+	write.Post(otlpPath, rt.otlpWrite)
+	r.With(
+		rt.requireAccess(netpolicy.KindWrite),
+		rt.requireScope(apikey.ScopeWrite),
+		rt.decompressMiddleware,
+	).Post(webhookPath, rt.webhookWrite)
+	mountAPI(r, groups)
+
+	spec, err := json.Marshal(openAPIDocument(apiV1Prefix, groups))
+	if err != nil {
+		rt.logger.Error("error building openapi document", slog.Any("error", err))
+	}
 
-	r.Route("/value", func(r chi.Router) {
-		r.Use(rt.decompressMiddleware)
-		r.Post("/", rt.getMetricJSON)
-		r.Get("/{type}/{name}", rt.getMetric)
+	r.Route(apiV1Prefix, func(r chi.Router) {
+		r.NotFound(func(w http.ResponseWriter, req *http.Request) {
+			rt.writeError(w, req, errNotFound("route not found"))
+		})
+		r.MethodNotAllowed(func(w http.ResponseWriter, req *http.Request) {
+			rt.writeError(w, req, newAPIError(
+				http.StatusMethodNotAllowed,
+				codeMethodNotAllowed,
+				http.StatusText(http.StatusMethodNotAllowed),
+			))
+		})
+
+		mountAPI(r, groups)
+		r.With(rt.writeMiddlewares()...).Post(remoteWritePath, rt.remoteWrite)
+		r.Get("/openapi.json", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			w.Write(spec)
+		})
 	})
 
-	r.Route("/update", func(r chi.Router) {
-		r.Use(rt.decompressMiddleware)
-		r.Post("/", rt.updateMetricJSON)
-		r.Post("/{type}/{name}/{value}", rt.updateMetric)
-	})
+	return r
+}
 
-	r.Route("/updates", func(r chi.Router) {
-		if len(rt.secretKey) > 0 {
-			r.Use(rt.checksumMiddleware)
-		}
+// apiGroups returns the API endpoints shared by the legacy and versioned
+// route trees.
+func (rt *Router) apiGroups() []routeGroup {
+	read := []func(http.Handler) http.Handler{
+		rt.requireAccess(netpolicy.KindRead),
+		rt.requireScope(apikey.ScopeRead),
+		rt.decompressMiddleware,
+	}
+	write := rt.writeMiddlewares()
 
-		r.Use(rt.decompressMiddleware)
+	metricParams := map[string]string{
+		"type":  "metric type, counter or gauge",
+		"name":  "metric name",
+		"value": "metric value, a delta for counters",
+	}
 
-		if rt.privateKey != nil {
-			r.Use(rt.decryptMiddleware)
-		}
+	acceptParam := parameter{
+		name:        "Accept",
+		description: "response format, JSON by default",
+		enum:        []string{contentTypeJSON, contentTypeNDJSON, contentTypeCSV},
+	}
+	listResponse := response{
+		status: http.StatusOK,
+		description: "Matching metrics, the next page cursor is returned in " +
+			nextCursorHeader,
+		bodies: []*body{
+			jsonBody(metricsResponse{}),
+			{contentType: contentTypeNDJSON, sample: model.Metrics{}},
+			{contentType: contentTypeCSV, sample: ""},
+		},
+	}
 
-		r.Post("/", rt.updatesHandler)
-	})
+	return []routeGroup{
+		{
+			endpoints: []endpoint{
+				{
+					method:  http.MethodGet,
+					pattern: "/ping",
+					handler: rt.pingHandler,
+					doc: operation{
+						summary: "Check the storage health",
+						responses: []response{
+							{status: http.StatusOK, description: "Storage is available"},
+						},
+					},
+				},
+			},
+		},
+		{
+			prefix:      "/value",
+			middlewares: read,
+			endpoints: []endpoint{
+				{
+					method:  http.MethodPost,
+					pattern: "/",
+					handler: rt.getMetricJSON,
+					doc: operation{
+						summary: "Get a metric",
+						request: jsonBody(model.Metrics{}),
+						responses: []response{
+							{
+								status:      http.StatusOK,
+								description: "Current metric value",
+								bodies:      []*body{jsonBody(model.Metrics{})},
+							},
+						},
+					},
+				},
+				{
+					method:  http.MethodGet,
+					pattern: "/{type}/{name}",
+					handler: rt.getMetric,
+					doc: operation{
+						summary: "Get a metric value as text",
+						params:  metricParams,
+						responses: []response{
+							{
+								status:      http.StatusOK,
+								description: "Current metric value",
+								bodies:      []*body{textBody()},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			prefix:      "/values",
+			middlewares: read,
+			endpoints: []endpoint{
+				{
+					method:  http.MethodGet,
+					pattern: "/",
+					handler: rt.listMetrics,
+					doc: operation{
+						summary: "List metrics",
+						headers: []parameter{acceptParam},
+						query: []parameter{
+							{
+								name:        "type",
+								description: "keep only metrics of the type",
+								enum: []string{
+									string(model.CounterType),
+									string(model.GaugeType),
+								},
+							},
+							{
+								name:        "prefix",
+								description: "keep only metrics whose name starts with the prefix",
+							},
+							{
+								name:        "regex",
+								description: "keep only metrics whose name matches the RE2 expression",
+							},
+							{
+								name: "limit",
+								description: "page size, " +
+									strconv.Itoa(model.DefaultPageLimit) +
+									" by default, at most " +
+									strconv.Itoa(model.MaxPageLimit),
+							},
+							{
+								name:        "cursor",
+								description: "continue after the cursor returned with the previous page",
+							},
+							{
+								name:        "sort",
+								description: "sort order, a minus sign sorts descending",
+								enum:        []string{"id", "-id", "type", "-type"},
+							},
+						},
+						responses: []response{listResponse},
+					},
+				},
+				{
+					method:  http.MethodPost,
+					pattern: "/",
+					handler: rt.bulkGetMetrics,
+					doc: operation{
+						summary: "Get the listed metrics",
+						headers: []parameter{acceptParam},
+						query: []parameter{
+							{
+								name:        "sort",
+								description: "sort order, a minus sign sorts descending",
+								enum:        []string{"id", "-id", "type", "-type"},
+							},
+						},
+						request:   jsonBody([]string{}),
+						responses: []response{listResponse},
+					},
+				},
+			},
+		},
+		{
+			prefix:      "/update",
+			middlewares: write,
+			endpoints: []endpoint{
+				{
+					method:  http.MethodPost,
+					pattern: "/",
+					handler: rt.updateMetricJSON,
+					doc: operation{
+						summary: "Update a metric",
+						request: jsonBody(model.Metrics{}),
+						responses: []response{
+							{status: http.StatusOK, description: "Metric updated"},
+						},
+					},
+				},
+				{
+					method:  http.MethodPost,
+					pattern: "/{type}/{name}/{value}",
+					handler: rt.updateMetric,
+					doc: operation{
+						summary: "Update a metric from the path",
+						params:  metricParams,
+						responses: []response{
+							{status: http.StatusOK, description: "Metric updated"},
+						},
+					},
+				},
+			},
+		},
+		{
+			prefix:      "/updates",
+			middlewares: write,
+			endpoints: []endpoint{
+				{
+					method:  http.MethodPost,
+					pattern: "/",
+					handler: rt.updatesHandler,
+					doc: operation{
+						summary: "Update a batch of metrics",
+						headers: []parameter{
+							{
+								name:        batchModeHeader,
+								description: "batch mode, atomic by default",
+								enum: []string{
+									string(model.BatchAtomic),
+									string(model.BatchBestEffort),
+								},
+							},
+						},
+						request: jsonBody([]model.Metrics{}),
+						responses: []response{
+							{
+								status:      http.StatusOK,
+								description: "Outcome of every metric",
+								bodies:      []*body{jsonBody(model.BatchResult{})},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
 
-	return r
+// writeMiddlewares returns the middleware chain of the write endpoints:
+// the write access and scope checks, the checksum of older clients if a secret is set,
+// decompression, decryption if a private key is set and the verification of
+// version 2 signatures if a secret is set.
+func (rt *Router) writeMiddlewares() []func(http.Handler) http.Handler {
+	mws := []func(http.Handler) http.Handler{
+		rt.requireAccess(netpolicy.KindWrite),
+		rt.requireScope(apikey.ScopeWrite),
+	}
+	if rt.secrets.Len() > 0 && rt.legacySignatures {
+		mws = append(mws, rt.checksumMiddleware)
+	}
+	mws = append(mws, rt.decompressMiddleware)
+	if rt.privateKeys.Len() > 0 {
+		mws = append(mws, rt.decryptMiddleware)
+	}
+	if rt.verifier != nil {
+		mws = append(mws, rt.signatureMiddleware)
+	}
+
+	return mws
+}
+
+// mountAPI registers the route groups on r.
+func mountAPI(r chi.Router, groups []routeGroup) {
+	for _, g := range groups {
+		if g.prefix == "" {
+			for _, e := range g.endpoints {
+				r.With(g.middlewares...).Method(e.method, e.pattern, e.handler)
+			}
+			continue
+		}
+
+		r.Route(g.prefix, func(r chi.Router) {
+			r.Use(g.middlewares...)
+			for _, e := range g.endpoints {
+				r.Method(e.method, e.pattern, e.handler)
+			}
+		})
+	}
 }
 
 // Run starts the HTTP server and listens for incoming requests.
@@ -143,11 +594,18 @@ func (rt *Router) Run(ctx context.Context, addr string) error {
 		Handler:      rt.router,
 		ReadTimeout:  60 * time.Second,
 		WriteTimeout: 60 * time.Second,
+		TLSConfig:    rt.tlsConfig,
 	}
 
 	errChan := make(chan error, 1)
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		listen := srv.ListenAndServe
+		if srv.TLSConfig != nil {
+			// the certificate is served by the config
+			listen = func() error { return srv.ListenAndServeTLS("", "") }
+		}
+
+		if err := listen(); err != nil && err != http.ErrServerClosed {
 			rt.logger.Error(
 				"failed to start server",
 				slog.Any("error", err),
@@ -157,7 +615,11 @@ func (rt *Router) Run(ctx context.Context, addr string) error {
 		}
 	}()
 
-	rt.logger.Debug("server started", slog.String("address", srv.Addr))
+	rt.logger.Debug(
+		"server started",
+		slog.String("address", srv.Addr),
+		slog.Bool("tls", srv.TLSConfig != nil),
+	)
 
 	select {
 	case err := <-errChan:
@@ -182,42 +644,6 @@ func (rt *Router) Run(ctx context.Context, addr string) error {
 	return nil
 }
 
-// rootHandler serves the root HTML page displaying all metrics.
-func (rt Router) rootHandler(w http.ResponseWriter, req *http.Request) {
-	metrics, err := rt.repo.GetMetrics(req.Context())
-	if err != nil {
-		rt.logger.Error("error retrieving metrics", slog.Any("error", err))
-		http.Error(
-			w,
-			http.StatusText(http.StatusInternalServerError),
-			http.StatusInternalServerError,
-		)
-		return
-	}
-
-	tpl, err := template.New("root").Parse(rootTemplate)
-	if err != nil {
-		rt.logger.Error("template parse error", slog.Any("error", err))
-		http.Error(
-			w,
-			http.StatusText(http.StatusInternalServerError),
-			http.StatusInternalServerError,
-		)
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	if err := tpl.Execute(w, metrics); err != nil {
-		rt.logger.Error("template execute error", slog.Any("error", err))
-		http.Error(
-			w,
-			http.StatusText(http.StatusInternalServerError),
-			http.StatusInternalServerError,
-		)
-	}
-}
-
 // pingHandler checks the health of the storage by performing a ping operation.
 func (rt Router) pingHandler(w http.ResponseWriter, req *http.Request) {
 	if err := rt.repo.Ping(req.Context()); err != nil {
@@ -225,11 +651,7 @@ func (rt Router) pingHandler(w http.ResponseWriter, req *http.Request) {
 			"storage ping failed",
 			slog.Any("error", err),
 		)
-		http.Error(
-			w,
-			http.StatusText(http.StatusInternalServerError),
-			http.StatusInternalServerError,
-		)
+		rt.writeError(w, req, errInternal())
 		return
 	}
 
@@ -238,24 +660,23 @@ func (rt Router) pingHandler(w http.ResponseWriter, req *http.Request) {
 
 // getMetricJSON handles retrieval of a single metric by JSON payload.
 func (rt Router) getMetricJSON(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
 	var metric *model.Metrics
-	if err := json.NewDecoder(req.Body).Decode(&metric); err != nil {
+	if err := rt.decodeJSON(req.Body, &metric); err != nil || metric == nil {
 		rt.logger.Error(
 			"error parsing request body",
 			slog.Any("error", err),
 		)
-		http.Error(w, "error parsing request body", http.StatusBadRequest)
+		rt.writeError(w, req, errBadRequest("error parsing request body"))
 		return
 	}
 
-	if metric.ID == "" {
+	if err := rt.validator.ValidateID(metric.ID); err != nil {
 		rt.logger.Error(
-			"metric name is empty",
+			"invalid metric name",
 			slog.Any("metric", metric),
+			slog.Any("error", err),
 		)
-		http.Error(w, "metric name is empty", http.StatusBadRequest)
+		rt.writeError(w, req, errValidation(err.Error()))
 		return
 	}
 
@@ -264,7 +685,11 @@ func (rt Router) getMetricJSON(w http.ResponseWriter, req *http.Request) {
 			"wrong metric type",
 			slog.String("type", metric.MType),
 		)
-		http.Error(w, "wrong metric type", http.StatusBadRequest)
+		rt.writeError(w, req, errBadRequest("wrong metric type"))
+		return
+	}
+
+	if !rt.authorizeMetrics(w, req, metric.ID) {
 		return
 	}
 
@@ -275,7 +700,7 @@ func (rt Router) getMetricJSON(w http.ResponseWriter, req *http.Request) {
 			slog.Any("error", err),
 			slog.String("metric_id", metric.ID),
 		)
-		http.Error(w, "metric not found", http.StatusNotFound)
+		rt.writeError(w, req, errNotFound("metric not found"))
 		return
 	}
 
@@ -285,47 +710,43 @@ func (rt Router) getMetricJSON(w http.ResponseWriter, req *http.Request) {
 			"error marshalling metric",
 			slog.Any("error", err),
 		)
-		http.Error(
-			w,
-			http.StatusText(http.StatusInternalServerError),
-			http.StatusInternalServerError,
-		)
+		rt.writeError(w, req, errInternal())
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if _, err := w.Write(data); err != nil {
 		rt.logger.Error(
 			"error writing response",
 			slog.Any("error", err),
 		)
-		http.Error(
-			w,
-			http.StatusText(http.StatusInternalServerError),
-			http.StatusInternalServerError,
-		)
-		return
 	}
-
 }
 
 func (rt Router) updateMetricJSON(w http.ResponseWriter, req *http.Request) {
 	var jsonMetric *model.Metrics
-	if err := json.NewDecoder(req.Body).Decode(&jsonMetric); err != nil {
+	if err := rt.decodeJSON(req.Body, &jsonMetric); err != nil {
 		rt.logger.Error(
 			"error decoding request body",
 			slog.Any("error", err),
 		)
-		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		rt.writeError(w, req, errBadRequest("error decoding request body"))
 		return
 	}
 
-	if jsonMetric.ID == "" {
+	if err := rt.validator.Validate(jsonMetric); err != nil {
 		rt.logger.Error(
-			"metric name is empty",
+			"invalid metric",
 			slog.Any("metric", jsonMetric),
+			slog.Any("error", err),
 		)
-		http.Error(w, "metric name is empty", http.StatusBadRequest)
+		var verr *model.ValidationError
+		if !errors.As(err, &verr) {
+			rt.writeError(w, req, errValidation(err.Error()))
+			return
+		}
+		rt.writeValidationErrors(w, req, model.ValidationErrors{verr})
 		return
 	}
 
@@ -336,11 +757,11 @@ func (rt Router) updateMetricJSON(w http.ResponseWriter, req *http.Request) {
 			slog.Any("metric", jsonMetric),
 			slog.Any("error", err),
 		)
-		http.Error(
-			w,
-			"error converting json to metric object",
-			http.StatusBadRequest,
-		)
+		rt.writeError(w, req, errBadRequest("error converting json to metric object"))
+		return
+	}
+
+	if !rt.authorizeMetrics(w, req, metric.GetID()) {
 		return
 	}
 
@@ -350,19 +771,18 @@ func (rt Router) updateMetricJSON(w http.ResponseWriter, req *http.Request) {
 			slog.Any("error", err),
 			slog.Any("metric", metric),
 		)
-		http.Error(
-			w,
-			http.StatusText(http.StatusInternalServerError),
-			http.StatusInternalServerError,
-		)
+		rt.writeError(w, req, errInternal())
 		return
 	}
 
-	metricTypes := []string{metric.GetID()}
-	go rt.runAudit(metricTypes, req.RemoteAddr)
+	rt.auditUpdate(
+		req,
+		[]*model.Metrics{rt.storedValue(req.Context(), metric)},
+		audit.OutcomeSuccess,
+	)
 
-	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 }
 
 type responseWriter struct {
@@ -390,22 +810,49 @@ func (rt Router) updateMetric(w http.ResponseWriter, req *http.Request) {
 	metricName := chi.URLParam(req, "name")
 	metricValue := chi.URLParam(req, "value")
 
-	metric, err := model.NewMetric(metricName, model.MetricType(metricType))
-	if err != nil {
+	if !model.ValidateType(metricType) {
 		rt.logger.Error(
 			"error creating new metric",
+			slog.Any("error", model.ErrInvalidMetricType),
+		)
+		rt.writeError(w, req, errBadRequest("error setting metric"))
+		return
+	}
+
+	if err := rt.validator.ValidateID(metricName); err != nil {
+		rt.logger.Error(
+			"invalid metric name",
+			slog.String("name", metricName),
 			slog.Any("error", err),
 		)
-		http.Error(w, "error setting metric", http.StatusBadRequest)
+		rt.writeError(w, req, errValidation(err.Error()))
+		return
+	}
+
+	if !rt.authorizeMetrics(w, req, metricName) {
 		return
 	}
 
-	if err := metric.SetValue(metricValue); err != nil {
+	metric, err := model.ParseMetric(
+		metricName,
+		model.MetricType(metricType),
+		metricValue,
+	)
+	if err != nil {
 		rt.logger.Error(
 			"error setting metric value",
 			slog.Any("error", err),
 		)
-		http.Error(w, "error setting metric value", http.StatusBadRequest)
+		rt.writeError(w, req, errBadRequest("error setting metric value"))
+		return
+	}
+
+	if err := rt.validator.Validate(metric.ToJSON()); err != nil {
+		rt.logger.Error(
+			"invalid metric value",
+			slog.Any("error", err),
+		)
+		rt.writeError(w, req, errValidation(err.Error()))
 		return
 	}
 
@@ -414,138 +861,282 @@ func (rt Router) updateMetric(w http.ResponseWriter, req *http.Request) {
 			"error saving metric in storage",
 			slog.Any("error", err),
 		)
-		http.Error(
-			w,
-			http.StatusText(http.StatusInternalServerError),
-			http.StatusInternalServerError,
-		)
+		rt.writeError(w, req, errInternal())
 		return
 	}
 
-	metricTypes := []string{metric.GetID()}
-	go rt.runAudit(metricTypes, req.RemoteAddr)
+	rt.auditUpdate(
+		req,
+		[]*model.Metrics{rt.storedValue(req.Context(), metric)},
+		audit.OutcomeSuccess,
+	)
 
-	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
 }
 
 // getMetric handles retrieval of a single metric by type and name.
 func (rt Router) getMetric(w http.ResponseWriter, req *http.Request) {
 	metricName := chi.URLParam(req, "name")
 
+	if !rt.authorizeMetrics(w, req, metricName) {
+		return
+	}
+
 	metric, err := rt.repo.GetMetric(req.Context(), metricName)
 	if err != nil {
-		http.Error(w, "metric not found", http.StatusNotFound)
+		rt.writeError(w, req, errNotFound("metric not found"))
 		return
 	}
 
 	metricValue := metric.GetValue()
 
-	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(metricValue))
 }
 
 // updatesHandler handles batch updates of metrics via JSON payload.
+//
+// The batch mode is taken from the X-Batch-Mode header, atomic by default.
+// The response reports the outcome of every metric. A rejected atomic batch
+// responds with 400 for invalid metrics and 409 for type conflicts.
 func (rt Router) updatesHandler(w http.ResponseWriter, req *http.Request) {
+	mode, err := model.ParseBatchMode(req.Header.Get(batchModeHeader))
+	if err != nil {
+		rt.writeError(w, req, errValidation(err.Error()))
+		return
+	}
+
 	var jsonMetrics []*model.Metrics
-	if err := json.NewDecoder(req.Body).Decode(&jsonMetrics); err != nil {
+	if err := rt.decodeJSON(req.Body, &jsonMetrics); err != nil {
 		rt.logger.Error(
 			"error decoding request body",
 			slog.Any("error", err),
 		)
-		http.Error(w, "error decoding request body", http.StatusBadRequest)
+		rt.writeError(w, req, errBadRequest("error decoding request body"))
 		return
 	}
 
-	var metrics []model.Metric
-	metricTypesMap := make(map[string]struct{})
-	for _, m := range jsonMetrics {
-		if m.ID == "" {
-			rt.logger.Error(
-				"metric name is empty",
-				slog.Any("metric", m),
-			)
-			http.Error(w, "metric name is empty", http.StatusBadRequest)
-			return
-		}
+	res, ok := rt.storeBatch(w, req, jsonMetrics, mode)
+	if !ok {
+		return
+	}
 
-		metric, err := model.MetricFromJSON(m)
-		if err != nil {
-			rt.logger.Error(
-				"error converting metrics from json",
-				slog.Any("metric", m),
-			)
-			http.Error(w, "error converting metrics from json", http.StatusBadRequest)
-			return
-		}
+	rt.writeJSON(w, http.StatusOK, res)
+}
 
-		metrics = append(metrics, metric)
-		metricTypesMap[m.ID] = struct{}{}
+// storeBatch applies a batch update, audits the applied metrics and reports
+// whether the caller should write its success response. A failed or rejected
+// atomic batch is answered here: 403 for metrics outside the prefix of the
+// API key, 400 for invalid metrics, 409 for type conflicts.
+func (rt Router) storeBatch(
+	w http.ResponseWriter,
+	req *http.Request,
+	metrics []*model.Metrics,
+	mode model.BatchMode,
+) (*model.BatchResult, bool) {
+	ids := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		if m != nil {
+			ids = append(ids, m.ID)
+		}
+	}
+	if !rt.authorizeMetrics(w, req, ids...) {
+		return nil, false
 	}
 
-	if err := rt.repo.SetOrUpdateMetricBatch(req.Context(), metrics); err != nil {
+	res, err := repository.ApplyBatch(
+		req.Context(),
+		rt.repo,
+		rt.validator,
+		metrics,
+		mode,
+	)
+	if err != nil {
 		rt.logger.Error(
 			"error batch updating metrics",
 			slog.Any("error", err),
 		)
-		http.Error(
-			w,
-			http.StatusText(http.StatusInternalServerError),
-			http.StatusInternalServerError,
+		rt.writeError(w, req, errInternal())
+		return nil, false
+	}
+
+	if res.Rejected > 0 {
+		rt.logger.Error(
+			"metrics rejected in batch",
+			slog.String("mode", string(mode)),
+			slog.Int("applied", res.Applied),
+			slog.Int("rejected", res.Rejected),
 		)
-		return
 	}
 
-	metricTypes := make([]string, 0, len(metricTypesMap))
-	for id := range metricTypesMap {
-		metricTypes = append(metricTypes, id)
+	if res.Applied > 0 {
+		values := make([]*model.Metrics, 0, res.Applied)
+		for _, it := range res.Results {
+			if it.Applied() {
+				values = append(values, it.Metrics)
+			}
+		}
+
+		outcome := audit.OutcomeSuccess
+		if res.Rejected > 0 {
+			outcome = audit.OutcomePartial
+		}
+		rt.auditUpdate(req, values, outcome)
 	}
 
-	go rt.runAudit(metricTypes, req.RemoteAddr)
+	if mode == model.BatchAtomic && res.Rejected > 0 {
+		e := newAPIError(
+			http.StatusConflict,
+			codeTypeConflict,
+			"batch aborted",
+		)
+		if res.Has(model.BatchItemInvalid) {
+			e = errValidation("validation failed")
+		}
+		rt.writeError(w, req, e.withDetails(res).withLegacyBody(res))
+		return nil, false
+	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
+	return res, true
 }
 
-func (rt *Router) runAudit(metricTypes []string, ipPort string) {
-	ctx, cancel := context.WithTimeout(context.Background(), audit.DefaultTimeout)
-	defer cancel()
+// validationErrorResponse is the body the legacy routes return when a request
+// carries invalid metrics.
+type validationErrorResponse struct {
+	Error  string                 `json:"error"`
+	Errors model.ValidationErrors `json:"errors"`
+}
 
-	clientIP := getClientIP(ipPort)
+// writeValidationErrors responds with 400 and the per-item validation errors.
+func (rt Router) writeValidationErrors(
+	w http.ResponseWriter,
+	req *http.Request,
+	errs model.ValidationErrors,
+) {
+	rt.writeError(
+		w,
+		req,
+		errValidation("validation failed").
+			withDetails(errs).
+			withLegacyBody(validationErrorResponse{
+				Error:  "validation failed",
+				Errors: errs,
+			}),
+	)
+}
 
-	if err := rt.auditor.LogEvent(
-		ctx,
-		metricTypes,
-		clientIP,
-	); err != nil {
-		slog.Error("failed to log audit event", slog.Any("error", err))
+// decodeJSON decodes the request body into v. Unknown fields are rejected in
+// strict validation mode.
+func (rt Router) decodeJSON(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	if rt.validator.Strict() {
+		dec.DisallowUnknownFields()
 	}
+
+	return dec.Decode(v)
 }
 
-func getClientIP(ipPort string) string {
-	ip, _, err := net.SplitHostPort(ipPort)
-	if err != nil {
-		return ipPort
+// auditEvent describes req for the audit: its route and its client, the
+// client address being the one resolved by the access policy if any.
+func auditEvent(req *http.Request) audit.Event {
+	ip := getClientIP(req.RemoteAddr)
+	if client, ok := netpolicy.FromContext(req.Context()); ok {
+		ip = client.String()
 	}
-	return ip
+
+	return audit.Event{
+		IPAddress: ip,
+		Transport: audit.TransportHTTP,
+		Route:     req.URL.Path,
+		UserAgent: req.UserAgent(),
+		RequestID: middleware.GetReqID(req.Context()),
+		Identity:  tlsconfig.PeerIdentity(req.TLS),
+		APIKey:    apikey.Name(req.Context()),
+		KeyID:     req.Header.Get(signing.HeaderKeyID),
+	}
+}
+
+// auditUpdate records the update of the metrics by req, values being the
+// metrics as stored.
+func (rt *Router) auditUpdate(
+	req *http.Request,
+	values []*model.Metrics,
+	outcome audit.Outcome,
+) {
+	event := auditEvent(req)
+	event.Metrics = metricIDs(values)
+	event.Values = values
+	event.Outcome = outcome
+
+	rt.runAudit(event)
 }
 
-func readKey(keyPath string) (*rsa.PrivateKey, error) {
-	privateKeyBytes, err := os.ReadFile(keyPath)
+// storedValue returns the metric as stored after its update when the
+// updates are audited, as sent otherwise or if it cannot be read.
+func (rt *Router) storedValue(ctx context.Context, m model.Metric) *model.Metrics {
+	if !rt.auditor.Enabled() {
+		return m.ToJSON()
+	}
+
+	stored, err := rt.repo.GetMetric(ctx, m.GetID())
 	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
+		return m.ToJSON()
 	}
 
-	privateKeyPEM, _ := pem.Decode(privateKeyBytes)
-	if privateKeyPEM == nil {
-		return nil, errors.New("invalid key format")
+	return stored.ToJSON()
+}
+
+// metricIDs returns the distinct IDs of the metrics in order.
+func metricIDs(metrics []*model.Metrics) []string {
+	ids := make([]string, 0, len(metrics))
+	seen := make(map[string]struct{}, len(metrics))
+	for _, m := range metrics {
+		if _, ok := seen[m.ID]; ok {
+			continue
+		}
+		seen[m.ID] = struct{}{}
+		ids = append(ids, m.ID)
 	}
 
-	privateKey, err := x509.ParsePKCS1PrivateKey(privateKeyPEM.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode key: %w", err)
+	return ids
+}
+
+// auditRejection records the rejection of the request as a security event
+// of the type, keyID naming the key the request used if known.
+func (rt *Router) auditRejection(
+	req *http.Request,
+	typ audit.EventType,
+	reason string,
+	keyID string,
+) {
+	event := auditEvent(req)
+	event.Outcome = audit.OutcomeRejected
+	event.Type = typ
+	event.Reason = reason
+	if keyID != "" {
+		event.KeyID = keyID
 	}
 
-	return privateKey, nil
+	rt.runAudit(event)
+}
+
+// runAudit logs the event, which only waits for the observers queueing it
+// when the server wraps them in dispatchers.
+func (rt *Router) runAudit(event audit.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), audit.DefaultTimeout)
+	defer cancel()
+
+	if err := rt.auditor.LogEvent(ctx, event); err != nil {
+		slog.Error("failed to log audit event", slog.Any("error", err))
+	}
+}
+
+func getClientIP(ipPort string) string {
+	ip, _, err := net.SplitHostPort(ipPort)
+	if err != nil {
+		return ipPort
+	}
+	return ip
 }
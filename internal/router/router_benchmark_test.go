@@ -2,6 +2,7 @@ package router
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"log/slog"
 	"net/http"
@@ -15,6 +16,7 @@ import (
 	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
 	mocks "github.com/fragpit/yandex-go-dev-metrics/internal/mocks/repository"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
 )
 
 func BenchmarkRouter_updatesHandler(b *testing.B) {
@@ -34,22 +36,26 @@ func BenchmarkRouter_updatesHandler(b *testing.B) {
 		metrics = append(metrics, metric)
 	}
 
-	var testMetrics []model.Metric
-	for _, m := range metrics {
+	var (
+		testMetrics []model.Metric
+		testResults []*model.BatchItemResult
+	)
+	for i, m := range metrics {
 		metric, err := model.MetricFromJSON(m)
 		if err != nil {
 			b.Fail()
 		}
 
 		testMetrics = append(testMetrics, metric)
+		testResults = append(testResults, model.NewAppliedResult(i, metric))
 	}
 
 	ctrl := gomock.NewController(b)
 	defer ctrl.Finish()
 	storeMock := mocks.NewMockRepository(ctrl)
 	storeMock.EXPECT().
-		SetOrUpdateMetricBatch(gomock.Any(), testMetrics).
-		Return(nil).
+		SetOrUpdateMetricBatch(gomock.Any(), testMetrics, model.BatchAtomic).
+		Return(testResults, nil).
 		AnyTimes()
 
 	router, err := NewRouter(logger, auditor, storeMock, nil, "", "")
@@ -79,3 +85,102 @@ func BenchmarkRouter_updatesHandler(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkRouter_memstorageParallel measures the full update/read path on
+// top of the in-memory storage under concurrent load.
+func BenchmarkRouter_memstorageParallel(b *testing.B) {
+	logger := slog.New(slog.DiscardHandler)
+	auditor := audit.NewAuditor()
+	repo := memstorage.NewMemoryStorage()
+
+	router, err := NewRouter(logger, auditor, repo, nil, "", "")
+	require.NoError(b, err)
+
+	const count = 1000
+	bodies := make([][]byte, count)
+	for i := 0; i < count; i++ {
+		delta := int64(1)
+		body, _ := json.Marshal(&model.Metrics{
+			ID:    "Counter" + strconv.Itoa(i),
+			MType: string(model.CounterType),
+			Delta: &delta,
+		})
+		bodies[i] = body
+	}
+
+	for _, readRatio := range []int{0, 50, 90} {
+		b.Run("read_"+strconv.Itoa(readRatio), func(b *testing.B) {
+			b.SetParallelism(8)
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					i++
+					body := bodies[i%count]
+
+					var req *http.Request
+					if i%100 < readRatio {
+						req = httptest.NewRequest(
+							http.MethodPost,
+							"/value/",
+							bytes.NewReader(body),
+						)
+					} else {
+						req = httptest.NewRequest(
+							http.MethodPost,
+							"/update/",
+							bytes.NewReader(body),
+						)
+					}
+					req.Header.Set("Content-Type", "application/json")
+
+					w := httptest.NewRecorder()
+					router.router.ServeHTTP(w, req)
+
+					if w.Code != http.StatusOK && w.Code != http.StatusNotFound {
+						b.Fatalf("unexpected status %d", w.Code)
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkRouter_rootHandlerParallel measures rendering of the root page
+// while metrics are being updated concurrently.
+func BenchmarkRouter_rootHandlerParallel(b *testing.B) {
+	logger := slog.New(slog.DiscardHandler)
+	auditor := audit.NewAuditor()
+	repo := memstorage.NewMemoryStorage()
+
+	router, err := NewRouter(logger, auditor, repo, nil, "", "")
+	require.NoError(b, err)
+
+	for i := 0; i < 100; i++ {
+		m := &model.GaugeMetric{ID: "Gauge" + strconv.Itoa(i), Value: float64(i)}
+		require.NoError(b, repo.SetOrUpdateMetric(context.Background(), m))
+	}
+
+	b.SetParallelism(8)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			i++
+			if i%2 == 0 {
+				m := &model.GaugeMetric{
+					ID:    "Gauge" + strconv.Itoa(i%100),
+					Value: float64(i),
+				}
+				_ = repo.SetOrUpdateMetric(context.Background(), m)
+				continue
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			w := httptest.NewRecorder()
+			router.router.ServeHTTP(w, req)
+		}
+	})
+}
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,10 +15,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
@@ -160,7 +166,8 @@ func TestRouter_updateMetricJSON(t *testing.T) {
 			assert.Equal(t, tt.want.code, res.StatusCode)
 
 			if tt.want.value != "" {
-				if metric, ok := repo.Metrics[tt.body.ID]; ok {
+				metric, err := repo.GetMetric(context.Background(), tt.body.ID)
+				if assert.NoError(t, err) {
 					assert.Equal(t, tt.want.value, metric.GetValue())
 				}
 			}
@@ -174,14 +181,10 @@ func TestRouter_getMetricJSON(t *testing.T) {
 	a := audit.NewAuditor()
 
 	var err error
-	m1, err := model.NewMetric("test_metric_1", model.CounterType)
-	require.NoError(t, err)
-	err = m1.SetValue("42")
+	m1, err := model.ParseMetric("test_metric_1", model.CounterType, "42")
 	require.NoError(t, err)
 
-	m2, err := model.NewMetric("test_metric_2", model.GaugeType)
-	require.NoError(t, err)
-	err = m2.SetValue("3.14")
+	m2, err := model.ParseMetric("test_metric_2", model.GaugeType, "3.14")
 	require.NoError(t, err)
 
 	var metricsStore []model.Metric
@@ -288,7 +291,8 @@ func TestRouter_getMetricJSON(t *testing.T) {
 			assert.Equal(t, tt.want.code, res.StatusCode)
 
 			if tt.want.value != "" {
-				if metric, ok := repo.Metrics[tt.body.ID]; ok {
+				metric, err := repo.GetMetric(context.Background(), tt.body.ID)
+				if assert.NoError(t, err) {
 					assert.Equal(t, tt.want.value, metric.GetValue())
 				}
 			}
@@ -590,7 +594,8 @@ func TestRouter_updateMetric(t *testing.T) {
 			assert.Equal(t, tt.want.code, res.StatusCode)
 
 			if tt.want.value != "" {
-				if metric, ok := repo.Metrics[mValue]; ok {
+				metric, err := repo.GetMetric(context.Background(), mName)
+				if assert.NoError(t, err) {
 					assert.Equal(t, tt.want.value, metric.GetValue())
 				}
 			}
@@ -604,9 +609,7 @@ func TestRouter_getMetric(t *testing.T) {
 	a := audit.NewAuditor()
 
 	var err error
-	metric, err := model.NewMetric("test_metric_1", model.CounterType)
-	require.NoError(t, err)
-	err = metric.SetValue("42")
+	metric, err := model.ParseMetric("test_metric_1", model.CounterType, "42")
 	require.NoError(t, err)
 
 	err = repo.SetOrUpdateMetric(context.Background(), metric)
@@ -826,8 +829,8 @@ func TestRouter_updatesHandler(t *testing.T) {
 			if tt.want.code == http.StatusOK && tt.body != nil {
 				for _, m := range tt.body {
 					if m.ID != "" && model.ValidateType(m.MType) {
-						metric, ok := repo.Metrics[m.ID]
-						assert.True(t, ok)
+						metric, err := repo.GetMetric(context.Background(), m.ID)
+						require.NoError(t, err)
 						if m.MType == string(model.GaugeType) && m.Value != nil {
 							assert.Equal(t, fmt.Sprintf("%v", *m.Value), metric.GetValue())
 						}
@@ -841,6 +844,174 @@ func TestRouter_updatesHandler(t *testing.T) {
 	}
 }
 
+func TestRouter_updatesHandler_strict(t *testing.T) {
+	repo := memstorage.NewMemoryStorage()
+	l := slog.New(slog.DiscardHandler)
+	a := audit.NewAuditor()
+	r, err := NewRouter(l, a, repo, nil, "", "", WithStrictValidation(true))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantCode   int
+		wantStatus []model.BatchItemStatus
+	}{
+		{
+			name:     "valid batch",
+			body:     `[{"id":"strict_c","type":"counter","delta":1},{"id":"strict_g","type":"gauge","value":1.5}]`,
+			wantCode: http.StatusOK,
+			wantStatus: []model.BatchItemStatus{
+				model.BatchItemApplied,
+				model.BatchItemApplied,
+			},
+		},
+		{
+			name:     "per item errors",
+			body:     `[{"id":"ok","type":"counter","delta":1},{"id":"bad name","type":"gauge","value":1},{"id":"g","type":"gauge"}]`,
+			wantCode: http.StatusBadRequest,
+			wantStatus: []model.BatchItemStatus{
+				model.BatchItemSkipped,
+				model.BatchItemInvalid,
+				model.BatchItemInvalid,
+			},
+		},
+		{
+			name:     "unknown field",
+			body:     `[{"id":"c","type":"counter","delta":1,"extra":true}]`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(
+				http.MethodPost,
+				"/updates/",
+				strings.NewReader(tt.body),
+			)
+			rr := httptest.NewRecorder()
+			r.updatesHandler(rr, req)
+			res := rr.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+
+			if tt.wantStatus == nil {
+				return
+			}
+
+			var resp model.BatchResult
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&resp))
+			require.Len(t, resp.Results, len(tt.wantStatus))
+			for i, want := range tt.wantStatus {
+				assert.Equal(t, i, resp.Results[i].Index)
+				assert.Equal(t, want, resp.Results[i].Status)
+				if want == model.BatchItemInvalid {
+					assert.NotEmpty(t, resp.Results[i].Reason)
+				}
+			}
+
+			_, err := repo.GetMetric(context.Background(), "ok")
+			assert.ErrorIs(t, err, memstorage.ErrMetricNotFound)
+		})
+	}
+}
+
+func TestRouter_updatesHandler_batchMode(t *testing.T) {
+	body := `[{"id":"mode_c","type":"counter","delta":2},{"id":"mode_g","type":"counter","delta":1},{"id":"","type":"gauge","value":1}]`
+
+	tests := []struct {
+		name       string
+		mode       string
+		wantCode   int
+		wantStatus []model.BatchItemStatus
+		wantValue  string
+	}{
+		{
+			name:     "atomic by default",
+			wantCode: http.StatusBadRequest,
+			wantStatus: []model.BatchItemStatus{
+				model.BatchItemSkipped,
+				model.BatchItemSkipped,
+				model.BatchItemInvalid,
+			},
+		},
+		{
+			name:     "best effort",
+			mode:     "best-effort",
+			wantCode: http.StatusOK,
+			wantStatus: []model.BatchItemStatus{
+				model.BatchItemApplied,
+				model.BatchItemTypeConflict,
+				model.BatchItemInvalid,
+			},
+			wantValue: "7",
+		},
+		{
+			name:     "invalid mode",
+			mode:     "sometimes",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := memstorage.NewMemoryStorage()
+			require.NoError(t, repo.Initialize([]model.Metric{
+				model.NewCounter("mode_c", 5),
+				model.NewGauge("mode_g", 1),
+			}))
+
+			r, err := NewRouter(
+				slog.New(slog.DiscardHandler),
+				audit.NewAuditor(),
+				repo,
+				nil,
+				"",
+				"",
+			)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(
+				http.MethodPost,
+				"/updates/",
+				strings.NewReader(body),
+			)
+			if tt.mode != "" {
+				req.Header.Set(batchModeHeader, tt.mode)
+			}
+			rr := httptest.NewRecorder()
+			r.updatesHandler(rr, req)
+			res := rr.Result()
+			defer res.Body.Close()
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+
+			if tt.wantStatus == nil {
+				return
+			}
+
+			assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+			var resp model.BatchResult
+			require.NoError(t, json.NewDecoder(res.Body).Decode(&resp))
+			require.Len(t, resp.Results, len(tt.wantStatus))
+			for i, want := range tt.wantStatus {
+				assert.Equal(t, want, resp.Results[i].Status)
+			}
+
+			m, err := repo.GetMetric(context.Background(), "mode_c")
+			require.NoError(t, err)
+			if tt.wantValue == "" {
+				assert.Equal(t, "5", m.GetValue())
+				return
+			}
+
+			assert.Equal(t, tt.wantValue, m.GetValue())
+			assert.Equal(t, int64(7), *resp.Results[0].Delta)
+		})
+	}
+}
+
 func int64Ptr(v int64) *int64 {
 	return &v
 }
@@ -861,8 +1032,7 @@ func TestRouter_rootHandler(t *testing.T) {
 	router, err := NewRouter(logger, auditor, repo, nil, "", "")
 	require.NoError(t, err)
 
-	m1, _ := model.NewMetric("test_gauge", model.GaugeType)
-	_ = m1.SetValue("42.5")
+	m1, _ := model.ParseMetric("test_gauge", model.GaugeType, "42.5")
 	_ = repo.SetOrUpdateMetric(context.Background(), m1)
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -874,3 +1044,503 @@ func TestRouter_rootHandler(t *testing.T) {
 	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
 	assert.Contains(t, w.Body.String(), "test_gauge")
 }
+
+func TestRouter_apiV1(t *testing.T) {
+	r, err := NewRouter(
+		slog.New(slog.DiscardHandler),
+		audit.NewAuditor(),
+		memstorage.NewMemoryStorage(),
+		nil,
+		"",
+		"",
+		WithStrictValidation(true),
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		wantCode    int
+		wantType    string
+		wantBody    string
+		wantErrCode string
+	}{
+		{
+			name:     "update from path",
+			method:   http.MethodPost,
+			path:     "/api/v1/update/counter/v1_counter/3",
+			wantCode: http.StatusOK,
+			wantType: "text/plain",
+		},
+		{
+			name:     "get value as text",
+			method:   http.MethodGet,
+			path:     "/api/v1/value/counter/v1_counter",
+			wantCode: http.StatusOK,
+			wantType: "text/plain",
+			wantBody: "3",
+		},
+		{
+			name:     "get value as json",
+			method:   http.MethodPost,
+			path:     "/api/v1/value/",
+			body:     `{"id":"v1_counter","type":"counter"}`,
+			wantCode: http.StatusOK,
+			wantType: "application/json",
+			wantBody: `{"id":"v1_counter","type":"counter","delta":3}`,
+		},
+		{
+			name:        "metric not found",
+			method:      http.MethodGet,
+			path:        "/api/v1/value/gauge/missing",
+			wantCode:    http.StatusNotFound,
+			wantType:    "application/json",
+			wantErrCode: codeNotFound,
+		},
+		{
+			name:        "malformed body",
+			method:      http.MethodPost,
+			path:        "/api/v1/update/",
+			body:        `{invalid`,
+			wantCode:    http.StatusBadRequest,
+			wantType:    "application/json",
+			wantErrCode: codeBadRequest,
+		},
+		{
+			name:        "invalid metric",
+			method:      http.MethodPost,
+			path:        "/api/v1/update/",
+			body:        `{"id":"bad name","type":"counter","delta":1}`,
+			wantCode:    http.StatusBadRequest,
+			wantType:    "application/json",
+			wantErrCode: codeValidationFailed,
+		},
+		{
+			name:        "rejected batch",
+			method:      http.MethodPost,
+			path:        "/api/v1/updates/",
+			body:        `[{"id":"v1_counter","type":"gauge","value":1}]`,
+			wantCode:    http.StatusConflict,
+			wantType:    "application/json",
+			wantErrCode: codeTypeConflict,
+		},
+		{
+			name:        "unknown route",
+			method:      http.MethodGet,
+			path:        "/api/v1/unknown",
+			wantCode:    http.StatusNotFound,
+			wantType:    "application/json",
+			wantErrCode: codeNotFound,
+		},
+		{
+			name:     "legacy route keeps plain text errors",
+			method:   http.MethodGet,
+			path:     "/value/gauge/missing",
+			wantCode: http.StatusNotFound,
+			wantType: "text/plain; charset=utf-8",
+			wantBody: "metric not found\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(
+				tt.method,
+				tt.path,
+				strings.NewReader(tt.body),
+			)
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+			res := rr.Result()
+			defer res.Body.Close()
+
+			assert.Equal(t, tt.wantCode, res.StatusCode)
+			assert.Equal(t, tt.wantType, res.Header.Get("Content-Type"))
+
+			requestID := res.Header.Get("X-Request-Id")
+			assert.NotEmpty(t, requestID)
+
+			data, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, string(data))
+			}
+
+			if tt.wantErrCode == "" {
+				return
+			}
+
+			var e apiError
+			require.NoError(t, json.Unmarshal(data, &e))
+			assert.Equal(t, tt.wantErrCode, e.Code)
+			assert.NotEmpty(t, e.Message)
+			assert.Equal(t, requestID, e.RequestID)
+		})
+	}
+}
+
+func TestRouter_openAPI(t *testing.T) {
+	r, err := NewRouter(
+		slog.New(slog.DiscardHandler),
+		audit.NewAuditor(),
+		memstorage.NewMemoryStorage(),
+		nil,
+		"",
+		"",
+	)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	r.router.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+
+	for _, g := range r.apiGroups() {
+		for _, e := range g.endpoints {
+			path := apiV1Prefix + g.prefix + e.pattern
+			op, ok := doc.Paths[path][strings.ToLower(e.method)]
+			if assert.True(t, ok, "missing %s %s", e.method, path) {
+				assert.NotEmpty(t, op["summary"])
+				assert.Contains(t, op["responses"], "default")
+			}
+		}
+	}
+
+	refs := regexp.MustCompile(`"#/components/schemas/(\w+)"`).
+		FindAllStringSubmatch(rr.Body.String(), -1)
+	require.NotEmpty(t, refs)
+	for _, ref := range refs {
+		assert.Contains(t, doc.Components.Schemas, ref[1])
+	}
+}
+
+func TestRouter_listMetrics(t *testing.T) {
+	repo := memstorage.NewMemoryStorage()
+	require.NoError(t, repo.Initialize([]model.Metric{
+		model.NewGauge("cpu1", 1.5),
+		model.NewGauge("cpu2", 2),
+		model.NewCounter("cpu_count", 3),
+		model.NewCounter("polls", 5),
+	}))
+
+	r, err := NewRouter(
+		slog.New(slog.DiscardHandler),
+		audit.NewAuditor(),
+		repo,
+		nil,
+		"",
+		"",
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		wantCode    int
+		wantType    string
+		wantBody    string
+		wantNext    bool
+		wantMetrics []string
+	}{
+		{
+			name:        "json",
+			url:         "/values",
+			wantCode:    http.StatusOK,
+			wantType:    contentTypeJSON,
+			wantMetrics: []string{"cpu1", "cpu2", "cpu_count", "polls"},
+		},
+		{
+			name:        "filtered json page",
+			url:         "/values?type=gauge&prefix=cpu&limit=1",
+			accept:      "application/json",
+			wantCode:    http.StatusOK,
+			wantType:    contentTypeJSON,
+			wantNext:    true,
+			wantMetrics: []string{"cpu1"},
+		},
+		{
+			name:     "ndjson",
+			url:      "/values?regex=count$",
+			accept:   "application/x-ndjson",
+			wantCode: http.StatusOK,
+			wantType: contentTypeNDJSON,
+			wantBody: `{"id":"cpu_count","type":"counter","delta":3}` + "\n",
+		},
+		{
+			name:     "csv by quality",
+			url:      "/values?sort=-id&prefix=cpu",
+			accept:   "application/json;q=0.5, text/csv",
+			wantCode: http.StatusOK,
+			wantType: contentTypeCSV,
+			wantBody: "id,type,delta,value\ncpu_count,counter,3,\ncpu2,gauge,,2\ncpu1,gauge,,1.5\n",
+		},
+		{
+			name:     "not acceptable",
+			url:      "/values",
+			accept:   "text/html",
+			wantCode: http.StatusNotAcceptable,
+		},
+		{
+			name:     "invalid limit",
+			url:      "/values?limit=0",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid regex",
+			url:      "/values?regex=(",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid cursor",
+			url:      "/values?cursor=!",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "invalid sort",
+			url:      "/values?sort=value",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+
+			require.Equal(t, tt.wantCode, rr.Code, rr.Body.String())
+			if tt.wantType == "" {
+				return
+			}
+
+			assert.Equal(t, tt.wantType, rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantNext, rr.Header().Get(nextCursorHeader) != "")
+
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+
+			if tt.wantMetrics != nil {
+				var resp metricsResponse
+				require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+				ids := make([]string, 0, len(resp.Metrics))
+				for _, m := range resp.Metrics {
+					ids = append(ids, m.ID)
+				}
+				assert.Equal(t, tt.wantMetrics, ids)
+				assert.Equal(t, rr.Header().Get(nextCursorHeader), resp.NextCursor)
+			}
+		})
+	}
+
+	t.Run("paging", func(t *testing.T) {
+		var ids []string
+		url := "/api/v1/values?limit=3"
+		for url != "" {
+			req := httptest.NewRequest(http.MethodGet, url, nil)
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var resp metricsResponse
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+			for _, m := range resp.Metrics {
+				ids = append(ids, m.ID)
+			}
+
+			url = ""
+			if resp.NextCursor != "" {
+				url = "/api/v1/values?limit=3&cursor=" + resp.NextCursor
+			}
+		}
+
+		assert.Equal(t, []string{"cpu1", "cpu2", "cpu_count", "polls"}, ids)
+	})
+}
+
+func TestRouter_bulkGetMetrics(t *testing.T) {
+	repo := memstorage.NewMemoryStorage()
+	require.NoError(t, repo.Initialize([]model.Metric{
+		model.NewGauge("cpu1", 1),
+		model.NewCounter("polls", 5),
+	}))
+
+	r, err := NewRouter(
+		slog.New(slog.DiscardHandler),
+		audit.NewAuditor(),
+		repo,
+		nil,
+		"",
+		"",
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		body        string
+		wantCode    int
+		wantMetrics []string
+		wantMissing []string
+	}{
+		{
+			name:        "found and missing",
+			body:        `["polls","nope","cpu1","nope"]`,
+			wantCode:    http.StatusOK,
+			wantMetrics: []string{"cpu1", "polls"},
+			wantMissing: []string{"nope"},
+		},
+		{
+			name:     "empty list",
+			body:     `[]`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "not a list",
+			body:     `{"id":"cpu1"}`,
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(
+				http.MethodPost,
+				"/values/",
+				strings.NewReader(tt.body),
+			)
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+
+			require.Equal(t, tt.wantCode, rr.Code, rr.Body.String())
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var resp metricsResponse
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+
+			ids := make([]string, 0, len(resp.Metrics))
+			for _, m := range resp.Metrics {
+				ids = append(ids, m.ID)
+			}
+			assert.Equal(t, tt.wantMetrics, ids)
+			assert.Equal(t, tt.wantMissing, resp.Missing)
+		})
+	}
+}
+
+// eventObserver passes the audit events to a channel.
+type eventObserver chan audit.Event
+
+func (o eventObserver) Notify(_ context.Context, event audit.Event) error {
+	o <- event
+	return nil
+}
+
+func TestRouter_auditIdentity(t *testing.T) {
+	events := make(eventObserver, 1)
+	a := audit.NewAuditor()
+	a.Add(events)
+
+	r, err := NewRouter(
+		slog.New(slog.DiscardHandler),
+		a,
+		memstorage.NewMemoryStorage(),
+		nil,
+		"",
+		"",
+	)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/update/counter/requests/1", nil)
+	req.RemoteAddr = "10.0.0.5:40000"
+	req.Header.Set("User-Agent", "agent/1.0")
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{
+			{Subject: pkix.Name{CommonName: "agent-1", Organization: []string{"metrics"}}},
+		}},
+	}
+	w := httptest.NewRecorder()
+	r.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, []string{"requests"}, event.Metrics)
+		assert.Equal(t, "10.0.0.5", event.IPAddress)
+		assert.Equal(t, "CN=agent-1,O=metrics", event.Identity)
+		assert.Equal(t, audit.SchemaVersion, event.Version)
+		assert.Equal(t, audit.TransportHTTP, event.Transport)
+		assert.Equal(t, "/update/counter/requests/1", event.Route)
+		assert.Equal(t, "agent/1.0", event.UserAgent)
+		assert.Equal(t, "req-1", event.RequestID)
+		assert.Equal(t, audit.OutcomeSuccess, event.Outcome)
+		assert.Equal(
+			t,
+			[]*model.Metrics{{ID: "requests", MType: "counter", Delta: int64Ptr(1)}},
+			event.Values,
+		)
+	case <-time.After(5 * time.Second):
+		t.Fatal("audit event was not logged")
+	}
+}
+
+func TestRouter_auditBatch(t *testing.T) {
+	events := make(eventObserver, 1)
+	a := audit.NewAuditor()
+	a.Add(events)
+
+	repo := memstorage.NewMemoryStorage()
+	require.NoError(t, repo.Initialize([]model.Metric{
+		model.NewCounter("requests", 1),
+	}))
+
+	r, err := NewRouter(slog.New(slog.DiscardHandler), a, repo, nil, "", "")
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(
+		http.MethodPost,
+		"/updates/",
+		strings.NewReader(`[
+			{"id":"requests","type":"counter","delta":2},
+			{"id":"requests","type":"gauge","value":1},
+			{"id":"load","type":"gauge","value":0.5}
+		]`),
+	)
+	req.Header.Set(batchModeHeader, string(model.BatchBestEffort))
+	w := httptest.NewRecorder()
+	r.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	select {
+	case event := <-events:
+		assert.Equal(t, []string{"requests", "load"}, event.Metrics)
+		assert.Equal(t, audit.OutcomePartial, event.Outcome)
+		assert.Equal(t, []*model.Metrics{
+			{ID: "requests", MType: "counter", Delta: int64Ptr(3)},
+			{ID: "load", MType: "gauge", Value: float64Ptr(0.5)},
+		}, event.Values)
+	case <-time.After(5 * time.Second):
+		t.Fatal("audit event was not logged")
+	}
+}
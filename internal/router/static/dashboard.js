@@ -0,0 +1,299 @@
+// Metrics dashboard: sorting, searching and filtering of the metrics table,
+// auto-refresh and sparklines. History exists only in this browser: values
+// seen while refreshing are kept in sessionStorage.
+(function () {
+    "use strict";
+
+    const HISTORY_KEY = "metrics-history";
+    const HISTORY_POINTS = 60;
+    const PAGE_LIMIT = 1000;
+
+    const units = ["KiB", "MiB", "GiB", "TiB", "PiB", "EiB"];
+
+    function humanBytes(v) {
+        if (Math.abs(v) < 1024) {
+            return v + " B";
+        }
+        let exp = -1;
+        do {
+            v /= 1024;
+            exp++;
+        } while (Math.abs(v) >= 1024 && exp < units.length - 1);
+        return v.toFixed(1) + " " + units[exp];
+    }
+
+    function display(el, raw) {
+        if (el.hasAttribute("data-bytes")) {
+            const v = Number(raw);
+            if (!Number.isNaN(v)) {
+                return humanBytes(v);
+            }
+        }
+        return raw;
+    }
+
+    function loadHistory() {
+        try {
+            return JSON.parse(sessionStorage.getItem(HISTORY_KEY)) || {};
+        } catch (e) {
+            return {};
+        }
+    }
+
+    function saveHistory(history) {
+        try {
+            sessionStorage.setItem(HISTORY_KEY, JSON.stringify(history));
+        } catch (e) {
+            // Storage full or disabled, sparklines stay empty.
+        }
+    }
+
+    function record(history, id, value) {
+        const points = history[id] || (history[id] = []);
+        points.push(value);
+        if (points.length > HISTORY_POINTS) {
+            points.splice(0, points.length - HISTORY_POINTS);
+        }
+    }
+
+    function drawSparkline(svg, points) {
+        svg.textContent = "";
+        if (!points || points.length < 2) {
+            return;
+        }
+
+        const min = Math.min(...points);
+        const span = Math.max(...points) - min || 1;
+        const step = 100 / (points.length - 1);
+        const coords = points.map(function (v, i) {
+            const y = 19 - ((v - min) / span) * 18;
+            return (i * step).toFixed(2) + "," + y.toFixed(2);
+        });
+
+        const line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+        line.setAttribute("points", coords.join(" "));
+        svg.appendChild(line);
+    }
+
+    function valueOf(m) {
+        return String(m.type === "counter" ? m.delta : m.value);
+    }
+
+    function update(el, raw, history) {
+        el.dataset.value = raw;
+        const cell = el.querySelector(".value");
+        cell.textContent = display(el, raw);
+        cell.title = raw;
+
+        const raws = el.querySelector(".raw code");
+        if (raws) {
+            raws.textContent = raw;
+        }
+
+        drawSparkline(el.querySelector(".spark"), history[el.dataset.id]);
+    }
+
+    async function fetchAll() {
+        const metrics = [];
+        let cursor = "";
+        do {
+            const url = "/values?limit=" + PAGE_LIMIT +
+                (cursor ? "&cursor=" + encodeURIComponent(cursor) : "");
+            const res = await fetch(url, { headers: { Accept: "application/json" } });
+            if (!res.ok) {
+                throw new Error(res.status + " " + res.statusText);
+            }
+            const page = await res.json();
+            metrics.push(...page.metrics);
+            cursor = page.next_cursor || "";
+        } while (cursor);
+        return metrics;
+    }
+
+    async function fetchOne(id) {
+        const res = await fetch("/values", {
+            method: "POST",
+            headers: { Accept: "application/json", "Content-Type": "application/json" },
+            body: JSON.stringify([id]),
+        });
+        if (!res.ok) {
+            throw new Error(res.status + " " + res.statusText);
+        }
+        return (await res.json()).metrics;
+    }
+
+    function setupTable(table, history) {
+        const tbody = table.tBodies[0];
+        const search = document.getElementById("search");
+        const filters = Array.from(document.querySelectorAll(".type-filter"));
+        const shown = document.getElementById("shown");
+        const headers = Array.from(table.querySelectorAll("th[data-sort]"));
+        let sortKey = "id";
+        let sortDesc = false;
+
+        function rows() {
+            return Array.from(tbody.rows).filter(function (r) {
+                return r.dataset.id !== undefined;
+            });
+        }
+
+        function compare(a, b) {
+            let res;
+            if (sortKey === "value") {
+                res = Number(a.dataset.value) - Number(b.dataset.value);
+            } else {
+                res = a.dataset[sortKey].localeCompare(b.dataset[sortKey]);
+            }
+            if (res === 0 && sortKey !== "id") {
+                res = a.dataset.id.localeCompare(b.dataset.id);
+            }
+            return sortDesc ? -res : res;
+        }
+
+        function sort() {
+            rows().sort(compare).forEach(function (r) {
+                tbody.appendChild(r);
+            });
+            headers.forEach(function (th) {
+                if (th.dataset.sort === sortKey) {
+                    th.setAttribute("aria-sort", sortDesc ? "descending" : "ascending");
+                } else {
+                    th.removeAttribute("aria-sort");
+                }
+            });
+        }
+
+        function filter() {
+            const needle = search.value.trim().toLowerCase();
+            const types = filters.filter(function (f) {
+                return f.checked;
+            }).map(function (f) {
+                return f.value;
+            });
+
+            let visible = 0;
+            const all = rows();
+            all.forEach(function (r) {
+                const ok = types.includes(r.dataset.type) &&
+                    r.dataset.id.toLowerCase().includes(needle);
+                r.hidden = !ok;
+                if (ok) {
+                    visible++;
+                }
+            });
+            shown.textContent = visible + " of " + all.length + " shown";
+        }
+
+        function addRow(m) {
+            const empty = tbody.querySelector("tr.empty");
+            if (empty) {
+                empty.remove();
+            }
+
+            const tr = tbody.insertRow();
+            tr.dataset.id = m.id;
+            tr.dataset.type = m.type;
+
+            const name = tr.insertCell();
+            const link = document.createElement("a");
+            link.href = "/metrics/" + encodeURIComponent(m.id);
+            link.textContent = m.id;
+            name.appendChild(link);
+
+            tr.insertCell().textContent = m.type;
+
+            const value = tr.insertCell();
+            value.className = "num value";
+
+            const spark = document.createElementNS("http://www.w3.org/2000/svg", "svg");
+            spark.setAttribute("class", "spark");
+            spark.setAttribute("viewBox", "0 0 100 20");
+            spark.setAttribute("preserveAspectRatio", "none");
+            tr.insertCell().appendChild(spark);
+
+            return tr;
+        }
+
+        headers.forEach(function (th) {
+            th.addEventListener("click", function () {
+                sortDesc = th.dataset.sort === sortKey ? !sortDesc : false;
+                sortKey = th.dataset.sort;
+                sort();
+            });
+        });
+        search.addEventListener("input", filter);
+        filters.forEach(function (f) {
+            f.addEventListener("change", filter);
+        });
+
+        rows().forEach(function (r) {
+            update(r, r.dataset.value, history);
+        });
+        filter();
+
+        return async function refresh() {
+            const metrics = await fetchAll();
+            const byID = new Map(rows().map(function (r) {
+                return [r.dataset.id, r];
+            }));
+
+            metrics.forEach(function (m) {
+                const raw = valueOf(m);
+                record(history, m.id, Number(raw));
+                update(byID.get(m.id) || addRow(m), raw, history);
+            });
+            saveHistory(history);
+
+            sort();
+            filter();
+        };
+    }
+
+    function setupDetail(section, history) {
+        update(section, section.dataset.value, history);
+
+        return async function refresh() {
+            const metrics = await fetchOne(section.dataset.id);
+            if (metrics.length === 0) {
+                return;
+            }
+            const raw = valueOf(metrics[0]);
+            record(history, section.dataset.id, Number(raw));
+            saveHistory(history);
+            update(section, raw, history);
+        };
+    }
+
+    function setupRefresh(refresh) {
+        const select = document.getElementById("refresh");
+        const stored = sessionStorage.getItem("metrics-refresh");
+        select.value = stored !== null ? stored : document.body.dataset.refresh;
+
+        let timer = null;
+        function schedule() {
+            clearInterval(timer);
+            const seconds = Number(select.value);
+            sessionStorage.setItem("metrics-refresh", select.value);
+            if (seconds > 0) {
+                timer = setInterval(function () {
+                    refresh().catch(function (err) {
+                        console.error("refresh failed:", err);
+                    });
+                }, seconds * 1000);
+            }
+        }
+
+        select.addEventListener("change", schedule);
+        schedule();
+    }
+
+    const history = loadHistory();
+    const table = document.getElementById("metrics");
+    const section = document.getElementById("metric");
+
+    if (table) {
+        setupRefresh(setupTable(table, history));
+    } else if (section) {
+        setupRefresh(setupDetail(section, history));
+    }
+})();
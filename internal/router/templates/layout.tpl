@@ -0,0 +1,32 @@
+{{- define "header" -}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{ .Title }}</title>
+    <link rel="stylesheet" href="/static/dashboard.css">
+</head>
+<body data-refresh="{{ .Refresh }}">
+    <header>
+        <h1><a href="/">Metrics</a></h1>
+        <label class="refresh">
+            Auto-refresh
+            <select id="refresh">
+                <option value="0">off</option>
+                <option value="5">5s</option>
+                <option value="10">10s</option>
+                <option value="30">30s</option>
+                <option value="60">1m</option>
+            </select>
+        </label>
+    </header>
+    <main>
+{{- end }}
+
+{{- define "footer" }}
+    </main>
+    <script src="/static/dashboard.js"></script>
+</body>
+</html>
+{{- end }}
@@ -0,0 +1,19 @@
+{{- template "header" . }}
+        {{- range .Metrics }}
+        <section id="metric" data-id="{{ .ID }}" data-type="{{ .Type }}" data-value="{{ .Value }}"{{ if .Bytes }} data-bytes{{ end }}>
+            <h2>{{ .ID }}</h2>
+            <dl>
+                <dt>Type</dt>
+                <dd>{{ .Type }}</dd>
+                <dt>Value</dt>
+                <dd class="value" title="{{ .Value }}">{{ .Display }}</dd>
+                <dt>Raw value</dt>
+                <dd class="raw"><code>{{ .Value }}</code></dd>
+                <dt>API</dt>
+                <dd><a href="/value/{{ .Type }}/{{ .ID }}"><code>GET /value/{{ .Type }}/{{ .ID }}</code></a></dd>
+            </dl>
+            <svg class="spark large" viewBox="0 0 100 20" preserveAspectRatio="none"></svg>
+            <p class="muted history">History is collected by this browser while the dashboard refreshes.</p>
+        </section>
+        {{- end }}
+{{- template "footer" . }}
@@ -1,17 +1,30 @@
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>Metrics</title>
-</head>
-<body>
-    <h1>Metrics</h1>
-    <ul>
-        {{- range $name, $item := . }}
-        <li>
-            {{ $name }} ({{ $item.GetType }}): {{ $item.GetValue }}
-        </li>
-        {{- end }}
-    </ul>
-</body>
-</html>
+{{- template "header" . }}
+        <div class="toolbar">
+            <input id="search" type="search" placeholder="Search metrics" autofocus>
+            <label><input type="checkbox" class="type-filter" value="counter" checked> counter ({{ index .Counts "counter" }})</label>
+            <label><input type="checkbox" class="type-filter" value="gauge" checked> gauge ({{ index .Counts "gauge" }})</label>
+            <span id="shown" class="muted"></span>
+        </div>
+        <table id="metrics">
+            <thead>
+                <tr>
+                    <th data-sort="id" aria-sort="ascending">Name</th>
+                    <th data-sort="type">Type</th>
+                    <th data-sort="value" class="num">Value</th>
+                    <th>Trend</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{- range .Metrics }}
+                <tr data-id="{{ .ID }}" data-type="{{ .Type }}" data-value="{{ .Value }}"{{ if .Bytes }} data-bytes{{ end }}>
+                    <td><a href="/metrics/{{ .ID }}">{{ .ID }}</a></td>
+                    <td>{{ .Type }}</td>
+                    <td class="num value" title="{{ .Value }}">{{ .Display }}</td>
+                    <td><svg class="spark" viewBox="0 0 100 20" preserveAspectRatio="none"></svg></td>
+                </tr>
+                {{- else }}
+                <tr class="empty"><td colspan="4">No metrics reported yet.</td></tr>
+                {{- end }}
+            </tbody>
+        </table>
+{{- template "footer" . }}
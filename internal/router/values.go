@@ -0,0 +1,303 @@
+package router
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+// Content types offered by the list endpoints.
+const (
+	contentTypeJSON   = "application/json"
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeCSV    = "text/csv"
+)
+
+// nextCursorHeader carries the cursor of the next page in every format.
+const nextCursorHeader = "X-Next-Cursor"
+
+// metricsResponse is the JSON body of the list endpoints.
+type metricsResponse struct {
+	Metrics    []*model.Metrics `json:"metrics"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	Missing    []string         `json:"missing,omitempty"`
+}
+
+// listMetrics handles filtered and paginated listing of metrics. An API key
+// restricted to a prefix only lists the metrics starting with it.
+func (rt Router) listMetrics(w http.ResponseWriter, req *http.Request) {
+	format, ok := negotiateFormat(req.Header.Get("Accept"))
+	if !ok {
+		rt.writeError(w, req, errNotAcceptable())
+		return
+	}
+
+	q, err := parseListQuery(req)
+	if err != nil {
+		rt.writeError(w, req, errValidation(err.Error()))
+		return
+	}
+
+	if k, ok := apikey.FromContext(req.Context()); ok {
+		prefix, ok := k.Narrow(q.Prefix)
+		if !ok {
+			rt.writeMetrics(w, format, &model.MetricPage{}, nil)
+			return
+		}
+		q.Prefix = prefix
+	}
+
+	page, err := rt.repo.ListMetrics(req.Context(), q)
+	if err != nil {
+		rt.writeListError(w, req, err)
+		return
+	}
+
+	rt.writeMetrics(w, format, page, nil)
+}
+
+// bulkGetMetrics handles reading the metrics listed by name in the request
+// body. Names that are not stored, or are outside the prefix of the API key,
+// are reported as missing in JSON.
+func (rt Router) bulkGetMetrics(w http.ResponseWriter, req *http.Request) {
+	format, ok := negotiateFormat(req.Header.Get("Accept"))
+	if !ok {
+		rt.writeError(w, req, errNotAcceptable())
+		return
+	}
+
+	var ids []string
+	if err := rt.decodeJSON(req.Body, &ids); err != nil {
+		rt.logger.Error(
+			"error decoding request body",
+			slog.Any("error", err),
+		)
+		rt.writeError(w, req, errBadRequest("error decoding request body"))
+		return
+	}
+
+	if len(ids) == 0 || len(ids) > model.MaxPageLimit {
+		rt.writeError(w, req, errValidation(
+			"ids must list between 1 and "+
+				strconv.Itoa(model.MaxPageLimit)+" names",
+		))
+		return
+	}
+
+	sortOrder, err := model.ParseSortOrder(req.URL.Query().Get("sort"))
+	if err != nil {
+		rt.writeError(w, req, errValidation(err.Error()))
+		return
+	}
+
+	allowed := ids
+	if k, ok := apikey.FromContext(req.Context()); ok {
+		allowed = make([]string, 0, len(ids))
+		for _, id := range ids {
+			if k.Allows(id) {
+				allowed = append(allowed, id)
+			}
+		}
+	}
+
+	// an empty id list would match every metric
+	page := &model.MetricPage{}
+	if len(allowed) > 0 {
+		page, err = rt.repo.ListMetrics(req.Context(), &model.MetricQuery{
+			IDs:  allowed,
+			Sort: sortOrder,
+		})
+		if err != nil {
+			rt.writeListError(w, req, err)
+			return
+		}
+	}
+
+	found := make(map[string]struct{}, len(page.Metrics))
+	for _, m := range page.Metrics {
+		found[m.GetID()] = struct{}{}
+	}
+
+	var missing []string
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			missing = append(missing, id)
+			found[id] = struct{}{}
+		}
+	}
+
+	rt.writeMetrics(w, format, page, missing)
+}
+
+// parseListQuery builds a metric query from the URL parameters.
+func parseListQuery(req *http.Request) (*model.MetricQuery, error) {
+	params := req.URL.Query()
+
+	q := &model.MetricQuery{
+		Type:   model.MetricType(params.Get("type")),
+		Prefix: params.Get("prefix"),
+		Regex:  params.Get("regex"),
+		Limit:  model.DefaultPageLimit,
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil, model.ErrInvalidLimit
+		}
+		q.Limit = limit
+	}
+
+	sortOrder, err := model.ParseSortOrder(params.Get("sort"))
+	if err != nil {
+		return nil, err
+	}
+	q.Sort = sortOrder
+
+	if v := params.Get("cursor"); v != "" {
+		c, err := model.ParseCursor(v)
+		if err != nil {
+			return nil, err
+		}
+		q.After = c
+	}
+
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// writeListError renders an error returned by Repository.ListMetrics.
+func (rt Router) writeListError(
+	w http.ResponseWriter,
+	req *http.Request,
+	err error,
+) {
+	if errors.Is(err, model.ErrInvalidRegex) ||
+		errors.Is(err, model.ErrInvalidMetricType) {
+		rt.writeError(w, req, errValidation(err.Error()))
+		return
+	}
+
+	rt.logger.Error("error listing metrics", slog.Any("error", err))
+	rt.writeError(w, req, errInternal())
+}
+
+// writeMetrics renders a page of metrics in the negotiated format.
+func (rt Router) writeMetrics(
+	w http.ResponseWriter,
+	format string,
+	page *model.MetricPage,
+	missing []string,
+) {
+	var next string
+	if page.Next != nil {
+		next = page.Next.Encode()
+		w.Header().Set(nextCursorHeader, next)
+	}
+
+	switch format {
+	case contentTypeNDJSON:
+		w.Header().Set("Content-Type", contentTypeNDJSON)
+		w.WriteHeader(http.StatusOK)
+
+		enc := json.NewEncoder(w)
+		for _, m := range page.Metrics {
+			if err := enc.Encode(m.ToJSON()); err != nil {
+				rt.logger.Error("error writing response", slog.Any("error", err))
+				return
+			}
+		}
+	case contentTypeCSV:
+		w.Header().Set("Content-Type", contentTypeCSV)
+		w.WriteHeader(http.StatusOK)
+
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"id", "type", "delta", "value"})
+		for _, m := range page.Metrics {
+			row := []string{m.GetID(), string(m.GetType()), "", ""}
+			if m.GetType() == model.CounterType {
+				row[2] = m.GetValue()
+			} else {
+				row[3] = m.GetValue()
+			}
+			_ = cw.Write(row)
+		}
+
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			rt.logger.Error("error writing response", slog.Any("error", err))
+		}
+	default:
+		resp := metricsResponse{
+			Metrics:    make([]*model.Metrics, 0, len(page.Metrics)),
+			NextCursor: next,
+			Missing:    missing,
+		}
+		for _, m := range page.Metrics {
+			resp.Metrics = append(resp.Metrics, m.ToJSON())
+		}
+
+		rt.writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// negotiateFormat picks the response content type from the Accept header.
+// Media ranges are tried by descending quality; JSON is the default.
+func negotiateFormat(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return contentTypeJSON, true
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mediaType, q})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, r := range ranges {
+		switch r.mediaType {
+		case contentTypeJSON, "application/*", "*/*":
+			return contentTypeJSON, true
+		case contentTypeNDJSON, "application/ndjson":
+			return contentTypeNDJSON, true
+		case contentTypeCSV, "text/*":
+			return contentTypeCSV, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+)
+
+const (
+	// webhookPath receives the JSON webhooks of the configured sources.
+	webhookPath = "/ingest/{source}"
+
+	// maxWebhookSize bounds the webhook payload.
+	maxWebhookSize = 1 << 20
+)
+
+// webhookWrite handles the JSON webhooks of third-party services. The
+// metrics are extracted by the mapping rules of the source and stored in
+// the mode of the X-Batch-Mode header, atomic by default.
+//
+// Webhook senders cannot sign with the agent key or encrypt, so only
+// decompression applies. A source with a secret verifies the signature
+// header instead: a missing or wrong signature responds with 401.
+func (rt Router) webhookWrite(w http.ResponseWriter, req *http.Request) {
+	source := strings.ToLower(chi.URLParam(req, "source"))
+	wh, ok := rt.webhooks[source]
+	if !ok {
+		rt.writeError(w, req, errNotFound("unknown webhook source"))
+		return
+	}
+
+	mode, err := model.ParseBatchMode(req.Header.Get(batchModeHeader))
+	if err != nil {
+		rt.writeError(w, req, errValidation(err.Error()))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxWebhookSize))
+	if err != nil {
+		rt.logger.Error("error reading request body", slog.Any("error", err))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			rt.writeError(w, req, newAPIError(
+				http.StatusRequestEntityTooLarge,
+				codeBadRequest,
+				"webhook payload too large",
+			))
+			return
+		}
+		rt.writeError(w, req, errBadRequest("error reading request body"))
+		return
+	}
+
+	if err := wh.Verify(req.Header.Get(wh.SignatureHeader()), body); err != nil {
+		rt.logger.Warn(
+			"webhook signature rejected",
+			slog.String("source", source),
+			slog.String("remote_addr", req.RemoteAddr),
+		)
+		rt.auditRejection(req, audit.EventSignatureInvalid, err.Error(), "")
+		rt.writeError(w, req, errUnauthorized(err.Error()))
+		return
+	}
+
+	metrics, err := wh.Metrics(body)
+	if err != nil {
+		rt.logger.Error(
+			"error mapping webhook",
+			slog.String("source", source),
+			slog.Any("error", err),
+		)
+		rt.writeError(w, req, errBadRequest(err.Error()))
+		return
+	}
+
+	res := model.NewBatchResult(mode, []*model.BatchItemResult{})
+	if len(metrics) > 0 {
+		res, ok = rt.storeBatch(w, req, metrics, mode)
+		if !ok {
+			return
+		}
+	}
+
+	rt.writeJSON(w, http.StatusOK, res)
+}
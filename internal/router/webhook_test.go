@@ -0,0 +1,176 @@
+package router
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
+)
+
+func TestRouter_webhookWrite(t *testing.T) {
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	jobs := `{"jobs":[{"name":"lint","duration":12},{"name":"test","duration":40.5}]}`
+
+	tests := []struct {
+		name       string
+		source     string
+		body       string
+		signature  string
+		batchMode  string
+		wantCode   int
+		wantValues map[string]string
+	}{
+		{
+			name:      "signed",
+			source:    "ci",
+			body:      jobs,
+			signature: sign(jobs),
+			wantCode:  http.StatusOK,
+			wantValues: map[string]string{
+				"ci.lint.duration": "12",
+				"ci.test.duration": "40.5",
+			},
+		},
+		{
+			name:      "source name is case insensitive",
+			source:    "CI",
+			body:      jobs,
+			signature: sign(jobs),
+			wantCode:  http.StatusOK,
+		},
+		{
+			name:     "missing signature",
+			source:   "ci",
+			body:     jobs,
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:      "wrong signature",
+			source:    "ci",
+			body:      jobs,
+			signature: sign(`{}`),
+			wantCode:  http.StatusUnauthorized,
+		},
+		{
+			name:       "counter",
+			source:     "builds",
+			body:       `{"finished":2}`,
+			wantCode:   http.StatusOK,
+			wantValues: map[string]string{"builds": "7"},
+		},
+		{
+			name:     "nothing extracted",
+			source:   "builds",
+			body:     `{"started":1}`,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "non-numeric value",
+			source:   "builds",
+			body:     `{"finished":"two"}`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "malformed payload",
+			source:   "builds",
+			body:     `{"finished":`,
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:      "invalid batch mode",
+			source:    "builds",
+			body:      `{"finished":2}`,
+			batchMode: "bogus",
+			wantCode:  http.StatusBadRequest,
+		},
+		{
+			name:     "unknown source",
+			source:   "other",
+			body:     `{}`,
+			wantCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := memstorage.NewMemoryStorage()
+			require.NoError(t, repo.Initialize([]model.Metric{
+				model.NewCounter("builds", 5),
+			}))
+
+			ci, err := ingest.NewWebhook(ingest.WebhookSource{
+				Secret: "secret",
+				Rules: []ingest.WebhookRule{{
+					Each:  "$.jobs[*]",
+					Name:  "ci.{$.name}.duration",
+					Value: "$.duration",
+				}},
+			})
+			require.NoError(t, err)
+
+			builds, err := ingest.NewWebhook(ingest.WebhookSource{
+				Rules: []ingest.WebhookRule{{
+					Name:  "builds",
+					Type:  "counter",
+					Value: "$.finished",
+				}},
+			})
+			require.NoError(t, err)
+
+			r, err := NewRouter(
+				slog.New(slog.DiscardHandler),
+				audit.NewAuditor(),
+				repo,
+				[]byte("agent-key"),
+				"",
+				"",
+				WithWebhooks(map[string]*ingest.Webhook{
+					"ci":     ci,
+					"builds": builds,
+				}),
+			)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(
+				http.MethodPost,
+				"/ingest/"+tt.source,
+				strings.NewReader(tt.body),
+			)
+			req.Header.Set("Content-Type", "application/json")
+			if tt.signature != "" {
+				req.Header.Set(ingest.DefaultSignatureHeader, tt.signature)
+			}
+			if tt.batchMode != "" {
+				req.Header.Set(batchModeHeader, tt.batchMode)
+			}
+
+			rr := httptest.NewRecorder()
+			r.router.ServeHTTP(rr, req)
+			require.Equal(t, tt.wantCode, rr.Code, rr.Body.String())
+
+			for id, want := range tt.wantValues {
+				m, err := repo.GetMetric(context.Background(), id)
+				require.NoError(t, err, id)
+				assert.Equal(t, want, m.GetValue(), id)
+			}
+		})
+	}
+}
@@ -2,22 +2,34 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
 	"syscall"
 
+	"github.com/fragpit/yandex-go-dev-metrics/internal/apikey"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/audit"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/cacher"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/config"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/graphite"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/grpcapi"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/ingest"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/keyring"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/mqtt"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/netpolicy"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/repository"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/router"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/memstorage"
 	"github.com/fragpit/yandex-go-dev-metrics/internal/storage/postgresql"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/tlsconfig"
+	"github.com/fragpit/yandex-go-dev-metrics/pkg/retry"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -62,17 +74,32 @@ func Run() error {
 	}
 	defer repo.Close(ctx)
 
-	auditor := audit.NewAuditor()
-
-	if cfg.AuditFile != "" {
-		fileAuditor := audit.NewFileObserver(cfg.AuditFile)
-		auditor.Add(fileAuditor)
+	auditor, httpObserver, err := newAuditor(cfg)
+	if err != nil {
+		return err
 	}
+	defer func() {
+		timeout := audit.DefaultTimeout
+		if httpObserver != nil {
+			timeout = max(timeout, httpObserver.BatchTimeout(cfg.AuditBatchSize))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
 
-	if cfg.AuditURL != "" {
-		httpAuditor := audit.NewHTTPObserver(cfg.AuditURL)
-		auditor.Add(httpAuditor)
-	}
+		if err := auditor.Close(ctx); err != nil {
+			logger.Error("failed to flush audit events", slog.Any("error", err))
+		}
+
+		if httpObserver != nil {
+			stats := httpObserver.Stats()
+			logger.Info(
+				"audit http delivery stats",
+				slog.Int64("delivered", stats.Delivered),
+				slog.Int64("failed", stats.Failed),
+				slog.Int64("dead_lettered", stats.DeadLettered),
+			)
+		}
+	}()
 
 	logger.Info("starting server", slog.String("address", cfg.Address))
 
@@ -128,14 +155,102 @@ func Run() error {
 		})
 	}
 
+	otlp, err := ingest.NewOTLP(
+		ingest.WithOTLPTagMode(cfg.OTLPTags),
+		ingest.WithResourcePrefix(cfg.OTLPPrefix),
+	)
+	if err != nil {
+		return fmt.Errorf("invalid otlp mapping: %w", err)
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	keys, err := keyring.Load(keyring.Config{
+		SecretKey:   []byte(cfg.SecretKey),
+		CryptoKey:   cfg.CryptoKey,
+		File:        cfg.KeysFile,
+		GracePeriod: cfg.KeyGracePeriod,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load keys: %w", err)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	eg.Go(func() error {
+		reloadKeys(ctx, logger, hup, keys)
+		return nil
+	})
+
+	var verifier *signing.Verifier
+	if keys.Secrets.Len() > 0 {
+		verifier, err = signing.NewVerifier(
+			nil,
+			signing.WithKeys(keys.Secrets),
+			signing.WithMaxSkew(cfg.SignatureMaxSkew),
+		)
+		if err != nil {
+			return fmt.Errorf("invalid signature config: %w", err)
+		}
+	}
+
+	policy, err := newAccessPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	var apiKeys *apikey.Store
+	if cfg.APIKeysFile != "" {
+		apiKeys, err = apikey.Load(cfg.APIKeysFile)
+		if err != nil {
+			return fmt.Errorf("failed to load api keys: %w", err)
+		}
+	}
+
 	if len(cfg.Address) > 0 {
+		lp, err := ingest.NewLineProtocol(
+			ingest.WithTagMode(cfg.InfluxTags),
+			ingest.WithFieldTypes(cfg.InfluxTypes),
+		)
+		if err != nil {
+			return fmt.Errorf("invalid line protocol mapping: %w", err)
+		}
+
+		rw, err := ingest.NewRemoteWrite(
+			ingest.WithRemoteWriteTagMode(cfg.RemoteWriteTags),
+		)
+		if err != nil {
+			return fmt.Errorf("invalid remote write mapping: %w", err)
+		}
+
+		webhooks, err := newWebhooks(cfg.Webhooks)
+		if err != nil {
+			return err
+		}
+
 		router, err := router.NewRouter(
 			logger.With("service", "router"),
 			auditor,
 			repo,
 			[]byte(cfg.SecretKey),
 			cfg.CryptoKey,
-			cfg.TrustedSubnet,
+			"",
+			router.WithAccessPolicy(policy),
+			router.WithStrictValidation(cfg.StrictValidation),
+			router.WithLineProtocol(lp),
+			router.WithOTLP(otlp),
+			router.WithRemoteWrite(rw),
+			router.WithWebhooks(webhooks),
+			router.WithTLSConfig(tlsConfig),
+			router.WithAPIKeys(apiKeys),
+			router.WithKeys(keys),
+			router.WithSignatureVerifier(verifier),
+			router.WithLegacySignatures(cfg.LegacySignatures),
 		)
 		if err != nil {
 			return err
@@ -151,9 +266,16 @@ func Run() error {
 	}
 
 	if len(cfg.GRPCAddress) > 0 {
-		var opts []grpcapi.Option
-		if cfg.TrustedSubnet != "" {
-			opts = append(opts, grpcapi.WithTrustedSubnet(cfg.TrustedSubnet))
+		opts := []grpcapi.Option{
+			grpcapi.WithStrictValidation(cfg.StrictValidation),
+			grpcapi.WithOTLP(otlp),
+			grpcapi.WithTLSConfig(tlsConfig),
+			grpcapi.WithAllowedClients(cfg.GRPCClients),
+			grpcapi.WithAPIKeys(apiKeys),
+			grpcapi.WithSignatureVerifier(verifier),
+			grpcapi.WithLegacySignatures(cfg.LegacySignatures),
+			grpcapi.WithAccessPolicy(policy),
+			grpcapi.WithAuditor(auditor),
 		}
 		gapi, err := grpcapi.NewGRPCAPI(cfg.GRPCAddress, repo, opts...)
 		if err != nil {
@@ -171,6 +293,55 @@ func Run() error {
 		})
 	}
 
+	if cfg.GraphiteAddress != "" || cfg.GraphitePickle != "" {
+		gl, err := graphite.New(
+			cfg.GraphiteAddress,
+			repo,
+			graphite.WithPickleAddress(cfg.GraphitePickle),
+			graphite.WithRules(cfg.GraphiteRules),
+			graphite.WithStrictValidation(cfg.StrictValidation),
+			graphite.WithLogger(logger.With("service", "graphite")),
+		)
+		if err != nil {
+			logger.Error("failed to init graphite listener", slog.String("error", err.Error()))
+			return err
+		}
+
+		eg.Go(func() error {
+			if err := gl.Run(ctx); err != nil {
+				logger.Error("graphite listener error", slog.String("error", err.Error()))
+				return err
+			}
+
+			return nil
+		})
+	}
+
+	if cfg.MQTTBroker != "" {
+		sub, err := mqtt.New(
+			cfg.MQTTBroker,
+			cfg.MQTTTopics,
+			repo,
+			mqtt.WithClientID(cfg.MQTTClientID),
+			mqtt.WithCredentials(cfg.MQTTUsername, cfg.MQTTPassword),
+			mqtt.WithStrictValidation(cfg.StrictValidation),
+			mqtt.WithLogger(logger.With("service", "mqtt")),
+		)
+		if err != nil {
+			logger.Error("failed to init mqtt subscriber", slog.String("error", err.Error()))
+			return err
+		}
+
+		eg.Go(func() error {
+			if err := sub.Run(ctx); err != nil {
+				logger.Error("mqtt subscriber error", slog.String("error", err.Error()))
+				return err
+			}
+
+			return nil
+		})
+	}
+
 	err = eg.Wait()
 	if err != nil && !errors.Is(err, context.Canceled) {
 		logger.Error("server shutdown with error", slog.Any("error", err))
@@ -180,3 +351,179 @@ func Run() error {
 	logger.Info("server shut down")
 	return nil
 }
+
+// reloadKeys reloads the keys on every signal of hup until the context is
+// done. The current keys are kept when they fail to load.
+func reloadKeys(
+	ctx context.Context,
+	logger *slog.Logger,
+	hup <-chan os.Signal,
+	keys *keyring.Keys,
+) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if err := keys.Reload(); err != nil {
+				logger.Error("failed to reload keys", slog.Any("error", err))
+				continue
+			}
+
+			logger.Info(
+				"keys reloaded",
+				slog.Any("secrets", keys.Secrets.IDs()),
+				slog.Any("private_keys", keys.PrivateKeys.IDs()),
+			)
+		}
+	}
+}
+
+// newAuditor creates the auditor of the configured observers, each one
+// receiving the events from its own dispatcher. The HTTP observer is
+// returned for its delivery stats, nil without an audit URL.
+func newAuditor(
+	cfg *config.ServerConfig,
+) (*audit.Auditor, *audit.HTTPObserver, error) {
+	auditor := audit.NewAuditor()
+	schema := audit.WithSchemaVersion(cfg.AuditSchema)
+
+	if cfg.AuditSpillDir != "" {
+		if err := os.MkdirAll(cfg.AuditSpillDir, 0700); err != nil {
+			return nil, nil, fmt.Errorf("failed to create audit spill dir: %w", err)
+		}
+	}
+
+	add := func(
+		name string,
+		obs audit.Observer,
+		extra ...audit.DispatcherOption,
+	) error {
+		opts := append([]audit.DispatcherOption{
+			audit.WithQueueSize(cfg.AuditQueueSize),
+			audit.WithBatchSize(cfg.AuditBatchSize),
+			audit.WithOverflow(audit.Overflow(cfg.AuditOverflow)),
+		}, extra...)
+		if cfg.AuditSpillDir != "" {
+			opts = append(opts, audit.WithSpillFile(
+				filepath.Join(cfg.AuditSpillDir, name+".spill"),
+			))
+		}
+
+		d, err := audit.NewDispatcher(obs, opts...)
+		if err != nil {
+			return fmt.Errorf("invalid %s audit config: %w", name, err)
+		}
+		auditor.Add(d)
+		return nil
+	}
+
+	if cfg.AuditFile != "" {
+		if err := add("file", audit.NewFileObserver(cfg.AuditFile, schema)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var httpObserver *audit.HTTPObserver
+	if cfg.AuditURL != "" {
+		opts := []audit.ObserverOption{
+			schema,
+			audit.WithTimeout(cfg.AuditHTTPTimeout),
+			audit.WithRetryBackoff(retry.ExponentialBackoff(
+				audit.DefaultRetryWait,
+				cfg.AuditHTTPRetries,
+			)),
+			audit.WithAuthToken(cfg.AuditHTTPToken),
+			audit.WithHMACKey([]byte(cfg.AuditHTTPKey), cfg.AuditHTTPKeyID),
+			audit.WithDeadLetterFile(cfg.AuditDeadLetter),
+		}
+		if cfg.AuditHTTPNDJSON {
+			opts = append(opts, audit.WithNDJSONBatches())
+		}
+		httpObserver = audit.NewHTTPObserver(cfg.AuditURL, opts...)
+		err := add(
+			"http",
+			httpObserver,
+			audit.WithDeliveryTimeout(httpObserver.BatchTimeout(cfg.AuditBatchSize)),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return auditor, httpObserver, nil
+}
+
+// newTLSConfig loads the server certificate, nil when TLS is not
+// configured.
+func newTLSConfig(cfg *config.ServerConfig) (*tls.Config, error) {
+	if cfg.TLSCert == "" {
+		return nil, nil
+	}
+
+	opts := []tlsconfig.Option{tlsconfig.WithMinVersion(cfg.TLSMinVersion)}
+	if cfg.TLSClientCA != "" {
+		opts = append(opts, tlsconfig.WithClientCA(cfg.TLSClientCA))
+	}
+
+	c, err := tlsconfig.NewServer(cfg.TLSCert, cfg.TLSKey, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls config: %w", err)
+	}
+
+	return c, nil
+}
+
+// newAccessPolicy builds the access policy of the APIs, nil when no
+// client address rule is configured. The trusted subnet is an allowed CIDR
+// of every request.
+func newAccessPolicy(cfg *config.ServerConfig) (*netpolicy.Policy, error) {
+	allow := cfg.AllowCIDRs
+	if cfg.TrustedSubnet != "" {
+		allow = append(slices.Clone(allow), cfg.TrustedSubnet)
+	}
+
+	if len(allow) == 0 && len(cfg.DenyCIDRs) == 0 &&
+		len(cfg.ReadAllowCIDRs) == 0 && len(cfg.ReadDenyCIDRs) == 0 &&
+		len(cfg.WriteAllowCIDRs) == 0 && len(cfg.WriteDenyCIDRs) == 0 {
+		return nil, nil
+	}
+
+	p, err := netpolicy.New(
+		netpolicy.WithRules(allow, cfg.DenyCIDRs),
+		netpolicy.WithReadRules(cfg.ReadAllowCIDRs, cfg.ReadDenyCIDRs),
+		netpolicy.WithWriteRules(cfg.WriteAllowCIDRs, cfg.WriteDenyCIDRs),
+		netpolicy.WithTrustedProxies(cfg.TrustedProxies),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access policy: %w", err)
+	}
+
+	return p, nil
+}
+
+// newWebhooks compiles the configured webhook sources.
+func newWebhooks(
+	sources map[string]config.WebhookSource,
+) (map[string]*ingest.Webhook, error) {
+	webhooks := make(map[string]*ingest.Webhook, len(sources))
+	for name, src := range sources {
+		rules := make([]ingest.WebhookRule, 0, len(src.Rules))
+		for _, r := range src.Rules {
+			rules = append(rules, ingest.WebhookRule(r))
+		}
+
+		wh, err := ingest.NewWebhook(ingest.WebhookSource{
+			Secret: src.Secret,
+			Header: src.Header,
+			Scheme: src.Scheme,
+			Rules:  rules,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook source %s: %w", name, err)
+		}
+		webhooks[name] = wh
+	}
+
+	return webhooks, nil
+}
@@ -0,0 +1,345 @@
+// Package signing signs write requests with a key shared by the clients and
+// the server.
+//
+// Version 2 signatures cover the request method, its path, a timestamp, a
+// random nonce and the SHA-256 digest of the body once decompressed and
+// decrypted. The HMAC-SHA256 of the canonical request
+//
+//	v2
+//	POST
+//	/updates/
+//	1700000000
+//	<nonce>
+//	<hex of the SHA-256 of the body>
+//
+// is sent in the X-Signature header, or the x-signature metadata over gRPC,
+// along with X-Signature-Version, X-Signature-Timestamp and
+// X-Signature-Nonce. gRPC calls are signed as POST requests to the full
+// method name with the deterministic protobuf encoding of the request as
+// the body.
+//
+// The optional X-Signature-Key-Id header names the key of the server key
+// set the request is signed with. The header is not signed and only
+// selects the key; without it the server tries every key of the set.
+//
+// The server rejects signatures whose timestamp is outside of the allowed
+// clock skew and nonces it has already seen within that window.
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is the signature scheme version.
+const Version = "v2"
+
+// Headers of a signature. gRPC metadata uses their lowercase form.
+const (
+	HeaderVersion   = "X-Signature-Version"
+	HeaderTimestamp = "X-Signature-Timestamp"
+	HeaderNonce     = "X-Signature-Nonce"
+	HeaderSignature = "X-Signature"
+	HeaderKeyID     = "X-Signature-Key-Id"
+)
+
+// DefaultMaxSkew is the allowed clock skew unless set otherwise.
+const DefaultMaxSkew = 5 * time.Minute
+
+var (
+	// ErrMissing reports a request without a signature.
+	ErrMissing = errors.New("signature missing")
+	// ErrMalformed reports signature headers that cannot be parsed.
+	ErrMalformed = errors.New("signature malformed")
+	// ErrInvalid reports a signature that does not match the request.
+	ErrInvalid = errors.New("signature invalid")
+	// ErrExpired reports a timestamp outside of the allowed clock skew.
+	ErrExpired = errors.New("signature timestamp out of range")
+	// ErrReplayed reports a nonce that was already used.
+	ErrReplayed = errors.New("signature nonce reused")
+)
+
+// Signature is the signature of a request.
+type Signature struct {
+	Timestamp int64
+	Nonce     string
+	MAC       string
+	// KeyID names the key the request is signed with, if set.
+	KeyID string
+}
+
+// Present reports whether a request carries version 2 signature headers,
+// get returning the value of a header.
+func Present(get func(string) string) bool {
+	return get(HeaderVersion) != ""
+}
+
+// Parse reads the signature from the request headers, get returning the
+// value of a header.
+func Parse(get func(string) string) (Signature, error) {
+	version := get(HeaderVersion)
+	if version == "" {
+		return Signature{}, ErrMissing
+	}
+	if version != Version {
+		return Signature{}, fmt.Errorf("%w: unsupported version %q", ErrMalformed, version)
+	}
+
+	ts, err := strconv.ParseInt(get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return Signature{}, fmt.Errorf("%w: invalid timestamp", ErrMalformed)
+	}
+
+	sig := Signature{
+		Timestamp: ts,
+		Nonce:     get(HeaderNonce),
+		MAC:       get(HeaderSignature),
+		KeyID:     get(HeaderKeyID),
+	}
+	if sig.Nonce == "" || sig.MAC == "" {
+		return Signature{}, fmt.Errorf("%w: nonce and signature are required", ErrMalformed)
+	}
+
+	return sig, nil
+}
+
+// Headers returns the headers carrying the signature.
+func (s Signature) Headers() map[string]string {
+	h := map[string]string{
+		HeaderVersion:   Version,
+		HeaderTimestamp: strconv.FormatInt(s.Timestamp, 10),
+		HeaderNonce:     s.Nonce,
+		HeaderSignature: s.MAC,
+	}
+	if s.KeyID != "" {
+		h[HeaderKeyID] = s.KeyID
+	}
+
+	return h
+}
+
+// Signer signs requests.
+type Signer struct {
+	key   []byte
+	keyID string
+	now   func() time.Time
+}
+
+// SignerOption configures a Signer.
+type SignerOption func(*Signer)
+
+// WithKeyID names the key in the signatures, for the server to pick it
+// from its key set.
+func WithKeyID(id string) SignerOption {
+	return func(s *Signer) {
+		s.keyID = id
+	}
+}
+
+// NewSigner creates a signer with the shared key.
+func NewSigner(key []byte, opts ...SignerOption) *Signer {
+	s := &Signer{key: key, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Sign returns the signature of a request with a new nonce. The body is the
+// one before compression and encryption.
+func (s *Signer) Sign(method, path string, body []byte) (Signature, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return Signature{}, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sig := Signature{
+		Timestamp: s.now().Unix(),
+		Nonce:     hex.EncodeToString(nonce),
+		KeyID:     s.keyID,
+	}
+	sig.MAC = mac(s.key, method, path, sig.Timestamp, sig.Nonce, body)
+
+	return sig, nil
+}
+
+// Keys is a set of keys identified by key ID, such as a keyring.Ring.
+type Keys interface {
+	// Lookup returns the keys to try for the key ID, every key for an
+	// empty ID.
+	Lookup(id string) [][]byte
+}
+
+// singleKey is the only key of a verifier, whatever the key ID.
+type singleKey []byte
+
+func (k singleKey) Lookup(string) [][]byte { return [][]byte{k} }
+
+// Verifier checks the signatures of requests.
+type Verifier struct {
+	keys    Keys
+	maxSkew time.Duration
+	now     func() time.Time
+	nonces  *nonceCache
+}
+
+// VerifierOption configures a Verifier.
+type VerifierOption func(*Verifier) error
+
+// WithMaxSkew sets the allowed difference between the signature timestamp
+// and the server clock, DefaultMaxSkew by default.
+func WithMaxSkew(d time.Duration) VerifierOption {
+	return func(v *Verifier) error {
+		if d <= 0 {
+			return fmt.Errorf("max skew must be positive, got %s", d)
+		}
+		v.maxSkew = d
+		return nil
+	}
+}
+
+// WithClock sets the clock of the verifier, time.Now by default.
+func WithClock(now func() time.Time) VerifierOption {
+	return func(v *Verifier) error {
+		v.now = now
+		return nil
+	}
+}
+
+// WithKeys verifies the signatures with the keys of the set instead of a
+// single shared key.
+func WithKeys(keys Keys) VerifierOption {
+	return func(v *Verifier) error {
+		v.keys = keys
+		return nil
+	}
+}
+
+// NewVerifier creates a verifier with the shared key, or the keys set by
+// WithKeys.
+func NewVerifier(key []byte, opts ...VerifierOption) (*Verifier, error) {
+	v := &Verifier{
+		maxSkew: DefaultMaxSkew,
+		now:     time.Now,
+	}
+	if len(key) > 0 {
+		v.keys = singleKey(key)
+	}
+
+	for _, opt := range opts {
+		if err := opt(v); err != nil {
+			return nil, err
+		}
+	}
+
+	if v.keys == nil {
+		return nil, errors.New("signing key is empty")
+	}
+
+	v.nonces = newNonceCache(v.maxSkew)
+
+	return v, nil
+}
+
+// Verify checks the signature of a request and records its nonce. The body
+// is the one after decompression and decryption.
+func (v *Verifier) Verify(method, path string, sig Signature, body []byte) error {
+	now := v.now()
+	signed := time.Unix(sig.Timestamp, 0)
+	if signed.Before(now.Add(-v.maxSkew)) || signed.After(now.Add(v.maxSkew)) {
+		return ErrExpired
+	}
+
+	keys := v.keys.Lookup(sig.KeyID)
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: unknown key id %q", ErrInvalid, sig.KeyID)
+	}
+
+	valid := false
+	for _, key := range keys {
+		want := mac(key, method, path, sig.Timestamp, sig.Nonce, body)
+		if hmac.Equal([]byte(want), []byte(sig.MAC)) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return ErrInvalid
+	}
+
+	// the nonce cannot be replayed once the timestamp is out of range
+	if !v.nonces.add(sig.Nonce, signed.Add(v.maxSkew), now) {
+		return ErrReplayed
+	}
+
+	return nil
+}
+
+// canonical returns the signed form of a request.
+func canonical(method, path string, ts int64, nonce string, body []byte) string {
+	digest := sha256.Sum256(body)
+
+	return strings.Join([]string{
+		Version,
+		strings.ToUpper(method),
+		path,
+		strconv.FormatInt(ts, 10),
+		nonce,
+		hex.EncodeToString(digest[:]),
+	}, "\n")
+}
+
+func mac(key []byte, method, path string, ts int64, nonce string, body []byte) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(canonical(method, path, ts, nonce, body)))
+
+	return base64.RawStdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// nonceCache remembers the nonces until their signature expires.
+type nonceCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	interval  time.Duration
+	lastPrune time.Time
+}
+
+func newNonceCache(interval time.Duration) *nonceCache {
+	return &nonceCache{
+		seen:     make(map[string]time.Time),
+		interval: interval,
+	}
+}
+
+// add records the nonce until expiry and reports whether it was unseen.
+// Expired nonces are dropped at most once per interval.
+func (c *nonceCache) add(nonce string, expiry, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastPrune) >= c.interval {
+		for n, exp := range c.seen {
+			if now.After(exp) {
+				delete(c.seen, n)
+			}
+		}
+		c.lastPrune = now
+	}
+
+	if exp, ok := c.seen[nonce]; ok && !now.After(exp) {
+		return false
+	}
+	c.seen[nonce] = expiry
+
+	return true
+}
@@ -0,0 +1,239 @@
+package signing
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier_Verify(t *testing.T) {
+	key := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	body := []byte(`[{"id":"cpu","type":"gauge","value":1}]`)
+
+	signer := NewSigner(key)
+	signer.now = func() time.Time { return now }
+
+	sign := func(t *testing.T) Signature {
+		t.Helper()
+		sig, err := signer.Sign(http.MethodPost, "/updates/", body)
+		require.NoError(t, err)
+		return sig
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*Signature)
+		method  string
+		path    string
+		body    []byte
+		clock   time.Time
+		wantErr error
+	}{
+		{name: "valid"},
+		{name: "lowercase method", method: "post"},
+		{name: "other method", method: http.MethodPut, wantErr: ErrInvalid},
+		{name: "other path", path: "/update/", wantErr: ErrInvalid},
+		{name: "other body", body: []byte(`[]`), wantErr: ErrInvalid},
+		{
+			name:    "other key",
+			modify:  func(s *Signature) { s.MAC = "AAAA" },
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "tampered timestamp",
+			modify:  func(s *Signature) { s.Timestamp++ },
+			wantErr: ErrInvalid,
+		},
+		{name: "within skew", clock: now.Add(4 * time.Minute)},
+		{name: "too old", clock: now.Add(6 * time.Minute), wantErr: ErrExpired},
+		{name: "from the future", clock: now.Add(-6 * time.Minute), wantErr: ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := now
+			if !tt.clock.IsZero() {
+				clock = tt.clock
+			}
+			v, err := NewVerifier(key, WithClock(func() time.Time { return clock }))
+			require.NoError(t, err)
+
+			sig := sign(t)
+			if tt.modify != nil {
+				tt.modify(&sig)
+			}
+
+			method, path, b := http.MethodPost, "/updates/", body
+			if tt.method != "" {
+				method = tt.method
+			}
+			if tt.path != "" {
+				path = tt.path
+			}
+			if tt.body != nil {
+				b = tt.body
+			}
+
+			assert.ErrorIs(t, v.Verify(method, path, sig, b), tt.wantErr)
+		})
+	}
+}
+
+func TestVerifier_Replay(t *testing.T) {
+	key := []byte("secret")
+	clock := time.Unix(1700000000, 0)
+	now := func() time.Time { return clock }
+
+	v, err := NewVerifier(key, WithClock(now))
+	require.NoError(t, err)
+
+	signer := NewSigner(key)
+	signer.now = now
+	sig, err := signer.Sign(http.MethodPost, "/updates/", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, v.Verify(http.MethodPost, "/updates/", sig, nil))
+	assert.ErrorIs(t, v.Verify(http.MethodPost, "/updates/", sig, nil), ErrReplayed)
+
+	// nonces are dropped once their signature has expired
+	clock = clock.Add(2 * DefaultMaxSkew)
+	fresh, err := signer.Sign(http.MethodPost, "/updates/", nil)
+	require.NoError(t, err)
+	require.NoError(t, v.Verify(http.MethodPost, "/updates/", fresh, nil))
+	assert.Len(t, v.nonces.seen, 1)
+	assert.Contains(t, v.nonces.seen, fresh.Nonce)
+}
+
+// testKeys are keys by ID.
+type testKeys map[string][]byte
+
+func (k testKeys) Lookup(id string) [][]byte {
+	if id == "" {
+		return [][]byte{k["old"], k["new"]}
+	}
+	if key, ok := k[id]; ok {
+		return [][]byte{key}
+	}
+	return nil
+}
+
+func TestVerifier_Keys(t *testing.T) {
+	keys := testKeys{"old": []byte("old-secret"), "new": []byte("new-secret")}
+
+	v, err := NewVerifier(nil, WithKeys(keys))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		signer  *Signer
+		wantErr error
+	}{
+		{name: "named key", signer: NewSigner(keys["new"], WithKeyID("new"))},
+		{name: "unnamed key", signer: NewSigner(keys["new"])},
+		{
+			name:    "wrong key id",
+			signer:  NewSigner(keys["new"], WithKeyID("old")),
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "unknown key id",
+			signer:  NewSigner(keys["new"], WithKeyID("next")),
+			wantErr: ErrInvalid,
+		},
+		{
+			name:    "unknown key",
+			signer:  NewSigner([]byte("other")),
+			wantErr: ErrInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := tt.signer.Sign(http.MethodPost, "/updates/", nil)
+			require.NoError(t, err)
+
+			assert.ErrorIs(t, v.Verify(http.MethodPost, "/updates/", sig, nil), tt.wantErr)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	valid := Signature{Timestamp: 1700000000, Nonce: "abc", MAC: "mac"}
+	withKeyID := Signature{Timestamp: 1700000000, Nonce: "abc", MAC: "mac", KeyID: "2025"}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    Signature
+		wantErr error
+	}{
+		{name: "valid", headers: valid.Headers(), want: valid},
+		{name: "key id", headers: withKeyID.Headers(), want: withKeyID},
+		{name: "missing", headers: map[string]string{}, wantErr: ErrMissing},
+		{
+			name: "unknown version",
+			headers: map[string]string{
+				HeaderVersion:   "v3",
+				HeaderTimestamp: "1700000000",
+				HeaderNonce:     "abc",
+				HeaderSignature: "mac",
+			},
+			wantErr: ErrMalformed,
+		},
+		{
+			name: "invalid timestamp",
+			headers: map[string]string{
+				HeaderVersion:   Version,
+				HeaderTimestamp: "yesterday",
+				HeaderNonce:     "abc",
+				HeaderSignature: "mac",
+			},
+			wantErr: ErrMalformed,
+		},
+		{
+			name: "no nonce",
+			headers: map[string]string{
+				HeaderVersion:   Version,
+				HeaderTimestamp: "1700000000",
+				HeaderSignature: "mac",
+			},
+			wantErr: ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+
+			assert.Equal(t, tt.wantErr != ErrMissing, Present(h.Get))
+
+			got, err := Parse(h.Get)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewVerifier(t *testing.T) {
+	_, err := NewVerifier(nil)
+	assert.Error(t, err)
+
+	_, err = NewVerifier([]byte("secret"), WithMaxSkew(0))
+	assert.Error(t, err)
+
+	v, err := NewVerifier([]byte("secret"), WithMaxSkew(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, v.maxSkew)
+}
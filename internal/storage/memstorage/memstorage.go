@@ -1,8 +1,10 @@
 package memstorage
 
 import (
+	"container/heap"
 	"context"
 	"errors"
+	"sort"
 	"sync"
 
 	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
@@ -11,102 +13,279 @@ import (
 
 var _ repository.Repository = (*MemoryStorage)(nil)
 
-type MemoryStorage struct {
+// shardCount is the number of lock stripes. It must be a power of two so the
+// shard index can be computed with a mask.
+const shardCount = 64
+
+var (
+	ErrMetricNotFound = errors.New("metric id not found")
+	ErrTypeMismatch   = model.ErrTypeMismatch
+)
+
+// shard holds a part of the metrics. Stored metrics are immutable values, so
+// they can be handed out to readers without copying.
+type shard struct {
 	mu      sync.RWMutex
-	Metrics map[string]model.Metric
+	metrics map[string]model.Metric
+}
+
+// MemoryStorage is an in-memory repository split into lock-striped shards.
+// Every metric name is mapped to exactly one shard, so operations on
+// different metrics rarely contend for the same lock.
+type MemoryStorage struct {
+	shards [shardCount]*shard
 }
 
 func NewMemoryStorage() *MemoryStorage {
-	return &MemoryStorage{
-		mu:      sync.RWMutex{},
-		Metrics: map[string]model.Metric{},
+	s := &MemoryStorage{}
+	for i := range s.shards {
+		s.shards[i] = &shard{metrics: make(map[string]model.Metric)}
 	}
+
+	return s
+}
+
+// shardIndex returns the shard index for a metric name using inline FNV-1a,
+// which avoids allocating a hasher on every call.
+func shardIndex(name string) int {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+
+	h := uint32(offset32)
+	for i := 0; i < len(name); i++ {
+		h ^= uint32(name[i])
+		h *= prime32
+	}
+
+	return int(h & (shardCount - 1))
+}
+
+func (s *MemoryStorage) shardFor(name string) *shard {
+	return s.shards[shardIndex(name)]
 }
 
 func (s *MemoryStorage) GetMetric(
 	ctx context.Context,
 	name string,
 ) (model.Metric, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shardFor(name)
 
-	if m, ok := s.Metrics[name]; ok {
-		return m, nil
-	} else {
-		return nil, errors.New("metric id not found")
+	sh.mu.RLock()
+	m, ok := sh.metrics[name]
+	sh.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrMetricNotFound
 	}
+
+	return m, nil
 }
 
 func (s *MemoryStorage) SetOrUpdateMetric(
 	ctx context.Context,
 	metric model.Metric,
 ) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	in, err := model.ValueOf(metric)
+	if err != nil {
+		return err
+	}
 
-	if m, ok := s.Metrics[metric.GetID()]; ok {
-		if m.GetType() != metric.GetType() {
-			return errors.New("metric already exist with another type")
-		}
+	sh := s.shardFor(in.GetID())
 
-		if err := m.SetValue(metric.GetValue()); err != nil {
-			return err
-		}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	} else {
-		s.Metrics[metric.GetID()] = metric
+	merged, err := merge(sh.metrics[in.GetID()], in)
+	if err != nil {
+		return err
 	}
+	sh.metrics[in.GetID()] = merged
 
 	return nil
 }
 
+// SetOrUpdateMetricBatch applies the batch and reports the outcome of every
+// metric. The shards touched by the batch are locked in ascending order and
+// the batch is merged into a staging map first. In atomic mode nothing is
+// committed if any metric conflicts; in best-effort mode only conflicting
+// metrics are left out.
 func (s *MemoryStorage) SetOrUpdateMetricBatch(
 	ctx context.Context,
 	metrics []model.Metric,
-) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	mode model.BatchMode,
+) ([]*model.BatchItemResult, error) {
+	values := make([]model.Metric, len(metrics))
+	idx := make([]int, 0, len(metrics))
+	seen := make(map[int]struct{}, len(metrics))
+	for i, metric := range metrics {
+		v, err := model.ValueOf(metric)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
 
-	for _, metric := range metrics {
-		if m, ok := s.Metrics[metric.GetID()]; ok {
-			if m.GetType() != metric.GetType() {
-				return errors.New("metric already exist with another type")
-			}
+		n := shardIndex(v.GetID())
+		if _, ok := seen[n]; !ok {
+			seen[n] = struct{}{}
+			idx = append(idx, n)
+		}
+	}
+	sort.Ints(idx)
 
-			if err := m.SetValue(metric.GetValue()); err != nil {
-				return err
-			}
+	for _, n := range idx {
+		s.shards[n].mu.Lock()
+	}
+	defer func() {
+		for _, n := range idx {
+			s.shards[n].mu.Unlock()
+		}
+	}()
 
-		} else {
-			s.Metrics[metric.GetID()] = metric
+	results := make([]*model.BatchItemResult, len(values))
+	staged := make(map[string]model.Metric, len(values))
+	var conflict bool
+	for i, v := range values {
+		id := v.GetID()
+		cur, ok := staged[id]
+		if !ok {
+			cur = s.shardFor(id).metrics[id]
 		}
+
+		merged, err := merge(cur, v)
+		if err != nil {
+			results[i] = model.NewConflictResult(i, v)
+			conflict = true
+			continue
+		}
+		staged[id] = merged
+		results[i] = model.NewAppliedResult(i, merged)
 	}
 
-	return nil
+	if conflict && mode == model.BatchAtomic {
+		for i, res := range results {
+			if res.Applied() {
+				results[i] = model.NewSkippedResult(i, values[i].ToJSON())
+			}
+		}
+
+		return results, nil
+	}
+
+	for id, m := range staged {
+		s.shardFor(id).metrics[id] = m
+	}
+
+	return results, nil
 }
 
+// GetMetrics returns a snapshot of all stored metrics. The returned map is
+// owned by the caller; it is built shard by shard under read locks and is
+// never shared with the storage.
 func (s *MemoryStorage) GetMetrics(
 	ctx context.Context,
 ) (map[string]model.Metric, error) {
-	return s.Metrics, nil
+	res := make(map[string]model.Metric, s.Len())
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for name, m := range sh.metrics {
+			res[name] = m
+		}
+		sh.mu.RUnlock()
+	}
+
+	return res, nil
 }
 
-func (s *MemoryStorage) Initialize(metrics []model.Metric) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// ListMetrics returns a page of the metrics selected by the query. With a
+// limit set only the first limit+1 metrics in query order are kept while
+// scanning, so a page costs O(n log limit) instead of sorting the store.
+func (s *MemoryStorage) ListMetrics(
+	ctx context.Context,
+	q *model.MetricQuery,
+) (*model.MetricPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	sel := &selection{q: q, max: q.Limit + 1}
+	if q.Limit == 0 {
+		sel.max = 0
+	}
+
+	if len(q.IDs) > 0 {
+		seen := make(map[string]struct{}, len(q.IDs))
+		for _, id := range q.IDs {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
 
+			sh := s.shardFor(id)
+			sh.mu.RLock()
+			m, ok := sh.metrics[id]
+			sh.mu.RUnlock()
+
+			if ok {
+				sel.offer(m)
+			}
+		}
+	} else {
+		for _, sh := range s.shards {
+			sh.mu.RLock()
+			for _, m := range sh.metrics {
+				sel.offer(m)
+			}
+			sh.mu.RUnlock()
+		}
+	}
+
+	metrics := sel.sorted()
+	page := &model.MetricPage{Metrics: metrics}
+	if q.Limit > 0 && len(metrics) > q.Limit {
+		page.Metrics = metrics[:q.Limit]
+		page.Next = model.CursorOf(page.Metrics[q.Limit-1])
+	}
+
+	return page, nil
+}
+
+// Len returns the number of stored metrics.
+func (s *MemoryStorage) Len() int {
+	var n int
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		n += len(sh.metrics)
+		sh.mu.RUnlock()
+	}
+
+	return n
+}
+
+func (s *MemoryStorage) Initialize(metrics []model.Metric) error {
 	for _, metric := range metrics {
-		s.Metrics[metric.GetID()] = metric
+		v, err := model.ValueOf(metric)
+		if err != nil {
+			return err
+		}
+
+		sh := s.shardFor(v.GetID())
+		sh.mu.Lock()
+		sh.metrics[v.GetID()] = v
+		sh.mu.Unlock()
 	}
 
 	return nil
 }
 
 func (s *MemoryStorage) Reset() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		sh.metrics = make(map[string]model.Metric)
+		sh.mu.Unlock()
+	}
 
-	s.Metrics = make(map[string]model.Metric)
 	return nil
 }
 
@@ -117,3 +296,77 @@ func (s *MemoryStorage) Ping(_ context.Context) error {
 func (s *MemoryStorage) Close(_ context.Context) error {
 	return nil
 }
+
+// selection collects the metrics matching a query. When max is set it keeps
+// only the max first metrics in query order in a heap whose root is the
+// last of them.
+type selection struct {
+	q       *model.MetricQuery
+	max     int
+	metrics []model.Metric
+}
+
+func (s *selection) offer(m model.Metric) {
+	if !s.q.Match(m) {
+		return
+	}
+
+	if s.q.After != nil && !s.q.Less(s.q.After, model.CursorOf(m)) {
+		return
+	}
+
+	if s.max == 0 || len(s.metrics) < s.max {
+		heap.Push(s, m)
+		return
+	}
+
+	if s.less(0, m) {
+		return
+	}
+
+	s.metrics[0] = m
+	heap.Fix(s, 0)
+}
+
+// less reports whether the i-th kept metric sorts before m.
+func (s *selection) less(i int, m model.Metric) bool {
+	return s.q.Less(model.CursorOf(s.metrics[i]), model.CursorOf(m))
+}
+
+// sorted returns the kept metrics in query order.
+func (s *selection) sorted() []model.Metric {
+	sort.Slice(s.metrics, func(i, j int) bool {
+		return s.less(i, s.metrics[j])
+	})
+
+	return s.metrics
+}
+
+// heap.Interface with the metric sorting last in query order at the root.
+
+func (s *selection) Len() int { return len(s.metrics) }
+
+func (s *selection) Less(i, j int) bool { return !s.less(i, s.metrics[j]) }
+
+func (s *selection) Swap(i, j int) {
+	s.metrics[i], s.metrics[j] = s.metrics[j], s.metrics[i]
+}
+
+func (s *selection) Push(x any) { s.metrics = append(s.metrics, x.(model.Metric)) }
+
+func (s *selection) Pop() any {
+	m := s.metrics[len(s.metrics)-1]
+	s.metrics = s.metrics[:len(s.metrics)-1]
+
+	return m
+}
+
+// merge returns the result of applying the update to the current value, cur
+// is nil when the metric is not stored yet.
+func merge(cur, update model.Metric) (model.Metric, error) {
+	if cur == nil {
+		return update, nil
+	}
+
+	return cur.Merge(update)
+}
@@ -2,6 +2,9 @@ package memstorage
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
@@ -12,8 +15,7 @@ import (
 func TestNewMemoryStorage(t *testing.T) {
 	storage := NewMemoryStorage()
 	assert.NotNil(t, storage)
-	assert.NotNil(t, storage.Metrics)
-	assert.Equal(t, 0, len(storage.Metrics))
+	assert.Equal(t, 0, storage.Len())
 }
 
 func TestMemoryStorage_SetOrUpdateMetric(t *testing.T) {
@@ -29,8 +31,7 @@ func TestMemoryStorage_SetOrUpdateMetric(t *testing.T) {
 			name:  "add new gauge metric",
 			setup: func(s *MemoryStorage) {},
 			metric: func() model.Metric {
-				m, _ := model.NewMetric("test_gauge", model.GaugeType)
-				_ = m.SetValue("42.5")
+				m, _ := model.ParseMetric("test_gauge", model.GaugeType, "42.5")
 				return m
 			},
 			wantErr: false,
@@ -44,8 +45,7 @@ func TestMemoryStorage_SetOrUpdateMetric(t *testing.T) {
 			name:  "add new counter metric",
 			setup: func(s *MemoryStorage) {},
 			metric: func() model.Metric {
-				m, _ := model.NewMetric("test_counter", model.CounterType)
-				_ = m.SetValue("100")
+				m, _ := model.ParseMetric("test_counter", model.CounterType, "100")
 				return m
 			},
 			wantErr: false,
@@ -58,13 +58,11 @@ func TestMemoryStorage_SetOrUpdateMetric(t *testing.T) {
 		{
 			name: "update existing counter metric",
 			setup: func(s *MemoryStorage) {
-				m, _ := model.NewMetric("test_counter", model.CounterType)
-				_ = m.SetValue("50")
+				m, _ := model.ParseMetric("test_counter", model.CounterType, "50")
 				_ = s.SetOrUpdateMetric(context.Background(), m)
 			},
 			metric: func() model.Metric {
-				m, _ := model.NewMetric("test_counter", model.CounterType)
-				_ = m.SetValue("25")
+				m, _ := model.ParseMetric("test_counter", model.CounterType, "25")
 				return m
 			},
 			wantErr: false,
@@ -77,13 +75,11 @@ func TestMemoryStorage_SetOrUpdateMetric(t *testing.T) {
 		{
 			name: "update existing gauge metric",
 			setup: func(s *MemoryStorage) {
-				m, _ := model.NewMetric("test_gauge", model.GaugeType)
-				_ = m.SetValue("10.5")
+				m, _ := model.ParseMetric("test_gauge", model.GaugeType, "10.5")
 				_ = s.SetOrUpdateMetric(context.Background(), m)
 			},
 			metric: func() model.Metric {
-				m, _ := model.NewMetric("test_gauge", model.GaugeType)
-				_ = m.SetValue("20.7")
+				m, _ := model.ParseMetric("test_gauge", model.GaugeType, "20.7")
 				return m
 			},
 			wantErr: false,
@@ -96,13 +92,11 @@ func TestMemoryStorage_SetOrUpdateMetric(t *testing.T) {
 		{
 			name: "error on type mismatch",
 			setup: func(s *MemoryStorage) {
-				m, _ := model.NewMetric("test_metric", model.GaugeType)
-				_ = m.SetValue("10.5")
+				m, _ := model.ParseMetric("test_metric", model.GaugeType, "10.5")
 				_ = s.SetOrUpdateMetric(context.Background(), m)
 			},
 			metric: func() model.Metric {
-				m, _ := model.NewMetric("test_metric", model.CounterType)
-				_ = m.SetValue("100")
+				m, _ := model.ParseMetric("test_metric", model.CounterType, "100")
 				return m
 			},
 			wantErr: true,
@@ -142,8 +136,7 @@ func TestMemoryStorage_GetMetric(t *testing.T) {
 		{
 			name: "get existing metric",
 			setup: func(s *MemoryStorage) {
-				m, _ := model.NewMetric("test_metric", model.GaugeType)
-				_ = m.SetValue("42.5")
+				m, _ := model.ParseMetric("test_metric", model.GaugeType, "42.5")
 				_ = s.SetOrUpdateMetric(context.Background(), m)
 			},
 			id:      "test_metric",
@@ -180,58 +173,57 @@ func TestMemoryStorage_SetOrUpdateMetricBatch(t *testing.T) {
 		name      string
 		setup     func(*MemoryStorage)
 		metrics   func() []model.Metric
-		wantErr   bool
+		want      []model.BatchItemStatus
 		checkFunc func(*testing.T, *MemoryStorage)
 	}{
 		{
 			name:  "add multiple new metrics",
 			setup: func(s *MemoryStorage) {},
 			metrics: func() []model.Metric {
-				m1, _ := model.NewMetric("gauge1", model.GaugeType)
-				_ = m1.SetValue("10.5")
-				m2, _ := model.NewMetric("counter1", model.CounterType)
-				_ = m2.SetValue("100")
+				m1, _ := model.ParseMetric("gauge1", model.GaugeType, "10.5")
+				m2, _ := model.ParseMetric("counter1", model.CounterType, "100")
 				return []model.Metric{m1, m2}
 			},
-			wantErr: false,
+			want: []model.BatchItemStatus{
+				model.BatchItemApplied,
+				model.BatchItemApplied,
+			},
 			checkFunc: func(t *testing.T, s *MemoryStorage) {
-				assert.Equal(t, 2, len(s.Metrics))
+				assert.Equal(t, 2, s.Len())
 			},
 		},
 		{
 			name: "update existing and add new metrics",
 			setup: func(s *MemoryStorage) {
-				m, _ := model.NewMetric("existing", model.CounterType)
-				_ = m.SetValue("50")
+				m, _ := model.ParseMetric("existing", model.CounterType, "50")
 				_ = s.SetOrUpdateMetric(context.Background(), m)
 			},
 			metrics: func() []model.Metric {
-				m1, _ := model.NewMetric("existing", model.CounterType)
-				_ = m1.SetValue("30")
-				m2, _ := model.NewMetric("new_metric", model.GaugeType)
-				_ = m2.SetValue("42.5")
+				m1, _ := model.ParseMetric("existing", model.CounterType, "30")
+				m2, _ := model.ParseMetric("new_metric", model.GaugeType, "42.5")
 				return []model.Metric{m1, m2}
 			},
-			wantErr: false,
+			want: []model.BatchItemStatus{
+				model.BatchItemApplied,
+				model.BatchItemApplied,
+			},
 			checkFunc: func(t *testing.T, s *MemoryStorage) {
-				assert.Equal(t, 2, len(s.Metrics))
+				assert.Equal(t, 2, s.Len())
 				m, _ := s.GetMetric(context.Background(), "existing")
 				assert.Equal(t, "80", m.GetValue())
 			},
 		},
 		{
-			name: "error on type mismatch in batch",
+			name: "type mismatch in batch",
 			setup: func(s *MemoryStorage) {
-				m, _ := model.NewMetric("test_metric", model.GaugeType)
-				_ = m.SetValue("10.5")
+				m, _ := model.ParseMetric("test_metric", model.GaugeType, "10.5")
 				_ = s.SetOrUpdateMetric(context.Background(), m)
 			},
 			metrics: func() []model.Metric {
-				m1, _ := model.NewMetric("test_metric", model.CounterType)
-				_ = m1.SetValue("100")
+				m1, _ := model.ParseMetric("test_metric", model.CounterType, "100")
 				return []model.Metric{m1}
 			},
-			wantErr: true,
+			want: []model.BatchItemStatus{model.BatchItemTypeConflict},
 		},
 	}
 
@@ -240,15 +232,21 @@ func TestMemoryStorage_SetOrUpdateMetricBatch(t *testing.T) {
 			storage := NewMemoryStorage()
 			tt.setup(storage)
 
-			err := storage.SetOrUpdateMetricBatch(context.Background(), tt.metrics())
+			results, err := storage.SetOrUpdateMetricBatch(
+				context.Background(),
+				tt.metrics(),
+				model.BatchAtomic,
+			)
+			require.NoError(t, err)
 
-			if tt.wantErr {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-				if tt.checkFunc != nil {
-					tt.checkFunc(t, storage)
-				}
+			statuses := make([]model.BatchItemStatus, 0, len(results))
+			for _, r := range results {
+				statuses = append(statuses, r.Status)
+			}
+			assert.Equal(t, tt.want, statuses)
+
+			if tt.checkFunc != nil {
+				tt.checkFunc(t, storage)
 			}
 		})
 	}
@@ -257,10 +255,8 @@ func TestMemoryStorage_SetOrUpdateMetricBatch(t *testing.T) {
 func TestMemoryStorage_GetMetrics(t *testing.T) {
 	storage := NewMemoryStorage()
 
-	m1, _ := model.NewMetric("gauge1", model.GaugeType)
-	_ = m1.SetValue("10.5")
-	m2, _ := model.NewMetric("counter1", model.CounterType)
-	_ = m2.SetValue("100")
+	m1, _ := model.ParseMetric("gauge1", model.GaugeType, "10.5")
+	m2, _ := model.ParseMetric("counter1", model.CounterType, "100")
 
 	_ = storage.SetOrUpdateMetric(context.Background(), m1)
 	_ = storage.SetOrUpdateMetric(context.Background(), m2)
@@ -270,17 +266,263 @@ func TestMemoryStorage_GetMetrics(t *testing.T) {
 	assert.Equal(t, 2, len(metrics))
 }
 
+func TestMemoryStorage_GetMetrics_Snapshot(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	m := &model.CounterMetric{ID: "counter1", Value: 10}
+	require.NoError(t, storage.SetOrUpdateMetric(context.Background(), m))
+
+	snapshot, err := storage.GetMetrics(context.Background())
+	require.NoError(t, err)
+
+	// mutating the returned map must not leak into the storage
+	delete(snapshot, "counter1")
+
+	// mutating the caller's metric after it was stored as well
+	m.Value = 100
+
+	got, err := storage.GetMetric(context.Background(), "counter1")
+	require.NoError(t, err)
+	assert.Equal(t, "10", got.GetValue())
+	assert.Equal(t, 1, storage.Len())
+}
+
+func TestMemoryStorage_ListMetrics(t *testing.T) {
+	storage := NewMemoryStorage()
+	require.NoError(t, storage.Initialize([]model.Metric{
+		model.NewGauge("cpu1", 1),
+		model.NewGauge("cpu2", 2),
+		model.NewCounter("cpu_count", 3),
+		model.NewGauge("mem", 4),
+		model.NewCounter("polls", 5),
+	}))
+
+	tests := []struct {
+		name    string
+		q       model.MetricQuery
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "all by id",
+			want: []string{"cpu1", "cpu2", "cpu_count", "mem", "polls"},
+		},
+		{
+			name: "desc by id",
+			q:    model.MetricQuery{Sort: model.SortOrder{Desc: true}},
+			want: []string{"polls", "mem", "cpu_count", "cpu2", "cpu1"},
+		},
+		{
+			name: "by type",
+			q:    model.MetricQuery{Sort: model.SortOrder{Field: model.SortByType}},
+			want: []string{"cpu_count", "polls", "cpu1", "cpu2", "mem"},
+		},
+		{
+			name: "type and prefix",
+			q:    model.MetricQuery{Type: model.GaugeType, Prefix: "cpu"},
+			want: []string{"cpu1", "cpu2"},
+		},
+		{
+			name: "regex",
+			q:    model.MetricQuery{Regex: `^(mem|polls)$`},
+			want: []string{"mem", "polls"},
+		},
+		{
+			name: "ids",
+			q:    model.MetricQuery{IDs: []string{"polls", "missing", "cpu1", "polls"}},
+			want: []string{"cpu1", "polls"},
+		},
+		{
+			name: "after cursor",
+			q:    model.MetricQuery{After: &model.Cursor{ID: "cpu_count"}},
+			want: []string{"mem", "polls"},
+		},
+		{
+			name:    "invalid regex",
+			q:       model.MetricQuery{Regex: "("},
+			wantErr: model.ErrInvalidRegex,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := storage.ListMetrics(context.Background(), &tt.q)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Nil(t, page.Next)
+
+			ids := make([]string, 0, len(page.Metrics))
+			for _, m := range page.Metrics {
+				ids = append(ids, m.GetID())
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
+
+func TestMemoryStorage_ListMetrics_Paging(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	var metrics []model.Metric
+	for i := range 25 {
+		metrics = append(metrics, model.NewCounter(fmt.Sprintf("c%02d", i), 1))
+		metrics = append(metrics, model.NewGauge(fmt.Sprintf("g%02d", i), 1))
+	}
+	require.NoError(t, storage.Initialize(metrics))
+
+	for _, sort := range []string{"id", "-id", "type", "-type"} {
+		t.Run(sort, func(t *testing.T) {
+			o, err := model.ParseSortOrder(sort)
+			require.NoError(t, err)
+
+			q := &model.MetricQuery{Sort: o, Limit: 7}
+			var prev *model.Cursor
+			var pages, total int
+			for {
+				page, err := storage.ListMetrics(context.Background(), q)
+				require.NoError(t, err)
+				pages++
+
+				for _, m := range page.Metrics {
+					cur := model.CursorOf(m)
+					if prev != nil {
+						assert.True(t, q.Less(prev, cur))
+					}
+					prev = cur
+				}
+				total += len(page.Metrics)
+
+				if page.Next == nil {
+					break
+				}
+				q.After = page.Next
+			}
+
+			assert.Equal(t, len(metrics), total)
+			assert.Equal(t, 8, pages)
+		})
+	}
+}
+
+func TestMemoryStorage_SetOrUpdateMetricBatch_Modes(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      model.BatchMode
+		want      []model.BatchItemStatus
+		wantFresh string
+	}{
+		{
+			name: "atomic aborts on conflict",
+			mode: model.BatchAtomic,
+			want: []model.BatchItemStatus{
+				model.BatchItemSkipped,
+				model.BatchItemTypeConflict,
+				model.BatchItemSkipped,
+			},
+		},
+		{
+			name: "best effort applies the rest",
+			mode: model.BatchBestEffort,
+			want: []model.BatchItemStatus{
+				model.BatchItemApplied,
+				model.BatchItemTypeConflict,
+				model.BatchItemApplied,
+			},
+			wantFresh: "3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := NewMemoryStorage()
+
+			g, _ := model.ParseMetric("conflict", model.GaugeType, "1.5")
+			require.NoError(t, storage.SetOrUpdateMetric(context.Background(), g))
+
+			m1, _ := model.ParseMetric("fresh", model.CounterType, "1")
+			m2, _ := model.ParseMetric("conflict", model.CounterType, "1")
+			m3, _ := model.ParseMetric("fresh", model.CounterType, "2")
+
+			results, err := storage.SetOrUpdateMetricBatch(
+				context.Background(),
+				[]model.Metric{m1, m2, m3},
+				tt.mode,
+			)
+			require.NoError(t, err)
+			require.Len(t, results, len(tt.want))
+
+			for i, r := range results {
+				assert.Equal(t, i, r.Index)
+				assert.Equal(t, tt.want[i], r.Status)
+			}
+
+			fresh, err := storage.GetMetric(context.Background(), "fresh")
+			if tt.wantFresh == "" {
+				assert.ErrorIs(t, err, ErrMetricNotFound)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantFresh, fresh.GetValue())
+			assert.Equal(t, int64(1), *results[0].Delta)
+			assert.Equal(t, int64(3), *results[2].Delta)
+
+			conflict, err := storage.GetMetric(context.Background(), "conflict")
+			require.NoError(t, err)
+			assert.Equal(t, "1.5", conflict.GetValue())
+		})
+	}
+}
+
+func TestMemoryStorage_Concurrent(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	const (
+		workers = 16
+		updates = 500
+	)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < updates; i++ {
+				name := "counter" + strconv.Itoa(i%10)
+				m := &model.CounterMetric{ID: name, Value: 1}
+				_ = storage.SetOrUpdateMetric(context.Background(), m)
+				_, _ = storage.GetMetrics(context.Background())
+			}
+		}()
+	}
+	wg.Wait()
+
+	metrics, err := storage.GetMetrics(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 10)
+
+	var total int64
+	for _, m := range metrics {
+		v, err := strconv.ParseInt(m.GetValue(), 10, 64)
+		require.NoError(t, err)
+		total += v
+	}
+	assert.Equal(t, int64(workers*updates), total)
+}
+
 func TestMemoryStorage_Initialize(t *testing.T) {
 	storage := NewMemoryStorage()
 
-	m1, _ := model.NewMetric("gauge1", model.GaugeType)
-	_ = m1.SetValue("10.5")
-	m2, _ := model.NewMetric("counter1", model.CounterType)
-	_ = m2.SetValue("100")
+	m1, _ := model.ParseMetric("gauge1", model.GaugeType, "10.5")
+	m2, _ := model.ParseMetric("counter1", model.CounterType, "100")
 
 	err := storage.Initialize([]model.Metric{m1, m2})
 	assert.NoError(t, err)
-	assert.Equal(t, 2, len(storage.Metrics))
+	assert.Equal(t, 2, storage.Len())
 
 	metric, err := storage.GetMetric(context.Background(), "gauge1")
 	assert.NoError(t, err)
@@ -290,15 +532,14 @@ func TestMemoryStorage_Initialize(t *testing.T) {
 func TestMemoryStorage_Reset(t *testing.T) {
 	storage := NewMemoryStorage()
 
-	m, _ := model.NewMetric("test", model.GaugeType)
-	_ = m.SetValue("10.5")
+	m, _ := model.ParseMetric("test", model.GaugeType, "10.5")
 	_ = storage.SetOrUpdateMetric(context.Background(), m)
 
-	assert.Equal(t, 1, len(storage.Metrics))
+	assert.Equal(t, 1, storage.Len())
 
 	err := storage.Reset()
 	assert.NoError(t, err)
-	assert.Equal(t, 0, len(storage.Metrics))
+	assert.Equal(t, 0, storage.Len())
 }
 
 func TestMemoryStorage_Ping(t *testing.T) {
@@ -34,6 +34,31 @@ func runMigrations(ctx context.Context, conn *pgxpool.Pool) error {
 			`,
 			DownSQL: `DROP TABLE IF EXISTS metrics;`,
 		},
+		{
+			Sequence: 2,
+			Name:     "store typed metric values",
+			UpSQL: `
+			ALTER TABLE metrics RENAME COLUMN value TO value_text;
+			ALTER TABLE metrics
+				ADD COLUMN delta BIGINT,
+				ADD COLUMN value DOUBLE PRECISION;
+			UPDATE metrics SET delta = CAST(value_text AS BIGINT)
+				WHERE type = 'counter';
+			UPDATE metrics SET value = CAST(value_text AS DOUBLE PRECISION)
+				WHERE type = 'gauge';
+			ALTER TABLE metrics DROP COLUMN value_text;
+			`,
+			DownSQL: `
+			ALTER TABLE metrics ADD COLUMN value_text TEXT;
+			UPDATE metrics SET value_text = CAST(delta AS TEXT)
+				WHERE type = 'counter';
+			UPDATE metrics SET value_text = CAST(value AS TEXT)
+				WHERE type = 'gauge';
+			ALTER TABLE metrics DROP COLUMN delta, DROP COLUMN value;
+			ALTER TABLE metrics RENAME COLUMN value_text TO value;
+			ALTER TABLE metrics ALTER COLUMN value SET NOT NULL;
+			`,
+		},
 	}
 
 	if err := m.Migrate(ctx); err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jackc/pgerrcode"
@@ -56,11 +57,31 @@ func NewStorage(ctx context.Context, dbDSN string) (*Storage, error) {
 	}, nil
 }
 
+const (
+	qUpsertCounter = `
+		INSERT INTO metrics (id, type, delta)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE
+		SET delta = metrics.delta + EXCLUDED.delta
+		WHERE metrics.type = EXCLUDED.type
+		RETURNING id, type, delta, value
+	`
+
+	qUpsertGauge = `
+		INSERT INTO metrics (id, type, value)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE
+		SET value = EXCLUDED.value
+		WHERE metrics.type = EXCLUDED.type
+		RETURNING id, type, delta, value
+	`
+)
+
 // GetMetrics retrieves all metrics from the database.
 func (s *Storage) GetMetrics(
 	ctx context.Context,
 ) (map[string]model.Metric, error) {
-	q := `SELECT id, type, value FROM metrics`
+	q := `SELECT id, type, delta, value FROM metrics`
 	rows, err := s.DB.Query(ctx, q)
 	if err != nil {
 		return nil, fmt.Errorf("error querying db: %w", err)
@@ -69,21 +90,12 @@ func (s *Storage) GetMetrics(
 
 	metrics := make(map[string]model.Metric)
 	for rows.Next() {
-		var id, metricType, value string
-		if err := rows.Scan(&id, &metricType, &value); err != nil {
-			return nil, fmt.Errorf("error reading values: %w", err)
-		}
-
-		metric, err := model.NewMetric(id, model.MetricType(metricType))
+		metric, err := scanMetric(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		if err := metric.SetValue(value); err != nil {
-			return nil, err
-		}
-
-		metrics[id] = metric
+		metrics[metric.GetID()] = metric
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -97,24 +109,10 @@ func (s *Storage) GetMetric(
 	ctx context.Context,
 	name string,
 ) (model.Metric, error) {
-	q := `SELECT id, type, value FROM metrics WHERE id = $1`
+	q := `SELECT id, type, delta, value FROM metrics WHERE id = $1`
 	row := s.DB.QueryRow(ctx, q, name)
 
-	var id, metricType, value string
-	if err := row.Scan(&id, &metricType, &value); err != nil {
-		return nil, fmt.Errorf("error reading values: %w", err)
-	}
-
-	metric, err := model.NewMetric(id, model.MetricType(metricType))
-	if err != nil {
-		return nil, err
-	}
-
-	if err := metric.SetValue(value); err != nil {
-		return nil, err
-	}
-
-	return metric, nil
+	return scanMetric(row)
 }
 
 // SetOrUpdateMetric inserts a new metric or updates an existing one in the database.
@@ -122,87 +120,243 @@ func (s *Storage) SetOrUpdateMetric(
 	ctx context.Context,
 	metric model.Metric,
 ) error {
-	var q string
-
-	if metric.GetType() == "counter" {
-		q = `
-		INSERT INTO metrics (id, type, value)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (id) DO
-		UPDATE SET value = CAST(metrics.value AS BIGINT) +
-							CAST(EXCLUDED.value AS BIGINT)
-		`
-	} else {
-		q = `
-		INSERT INTO metrics (id, type, value)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (id) DO
-		UPDATE SET value = EXCLUDED.value
-		`
+	q, arg, err := upsertQuery(metric)
+	if err != nil {
+		return err
 	}
 
-	_, err := s.DB.Exec(
-		ctx,
-		q,
-		metric.GetID(),
-		metric.GetType(),
-		metric.GetValue(),
-	)
+	tag, err := s.DB.Exec(ctx, q, metric.GetID(), metric.GetType(), arg)
 	if err != nil {
 		return fmt.Errorf("error querying db: %w", err)
 	}
 
+	if tag.RowsAffected() == 0 {
+		return model.ErrTypeMismatch
+	}
+
 	return nil
 }
 
-// SetOrUpdateMetricBatch inserts or updates a batch of metrics in the database.
+// SetOrUpdateMetricBatch inserts or updates a batch of metrics in the
+// database and reports the outcome of every metric. The batch runs in a
+// single transaction, which is rolled back in atomic mode if any metric
+// conflicts with the stored type.
 func (s *Storage) SetOrUpdateMetricBatch(
 	ctx context.Context,
 	metrics []model.Metric,
-) error {
-	qCounter := `
-		INSERT INTO metrics (id, type, value)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (id) DO
-		UPDATE SET value = CAST(metrics.value AS BIGINT) +
-							CAST(EXCLUDED.value AS BIGINT)
-    `
-
-	qGauge := `
-		INSERT INTO metrics (id, type, value)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (id) DO UPDATE
-		SET value = EXCLUDED.value
-    `
-
+	mode model.BatchMode,
+) ([]*model.BatchItemResult, error) {
 	b := &pgx.Batch{}
 
 	for _, m := range metrics {
-		var q string
-		if m.GetType() == "counter" {
-			q = qCounter
-		} else {
-			q = qGauge
+		q, arg, err := upsertQuery(m)
+		if err != nil {
+			return nil, err
 		}
 
-		b.Queue(q, m.GetID(), m.GetType(), m.GetValue())
+		b.Queue(q, m.GetID(), m.GetType(), arg)
 	}
 
-	br := s.DB.SendBatch(ctx, b)
-	defer br.Close()
-
-	for i := 0; i < b.Len(); i++ {
-		_, err := br.Exec()
-		if err != nil {
-			return fmt.Errorf(
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	br := tx.SendBatch(ctx, b)
+
+	results := make([]*model.BatchItemResult, len(metrics))
+	var conflict bool
+	for i, m := range metrics {
+		stored, err := scanMetric(br.QueryRow())
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			results[i] = model.NewConflictResult(i, m)
+			conflict = true
+		case err != nil:
+			_ = br.Close()
+			return nil, fmt.Errorf(
 				"error executing batch command %d: %w",
 				i,
 				err,
 			)
+		default:
+			results[i] = model.NewAppliedResult(i, stored)
 		}
 	}
 
-	return nil
+	if err := br.Close(); err != nil {
+		return nil, fmt.Errorf("error closing batch: %w", err)
+	}
+
+	if conflict && mode == model.BatchAtomic {
+		for i, res := range results {
+			if res.Applied() {
+				results[i] = model.NewSkippedResult(i, metrics[i].ToJSON())
+			}
+		}
+
+		return results, nil
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return results, nil
+}
+
+// ListMetrics returns a page of the metrics selected by the query. Filtering,
+// ordering and keyset pagination are done by the database. Names are
+// compared with the "C" collation to match the byte order used by cursors.
+// The regex is evaluated as a POSIX expression, which agrees with RE2 for
+// the common syntax.
+func (s *Storage) ListMetrics(
+	ctx context.Context,
+	q *model.MetricQuery,
+) (*model.MetricPage, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	query, args := listQuery(q)
+
+	rows, err := s.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying db: %w", err)
+	}
+	defer rows.Close()
+
+	var metrics []model.Metric
+	for rows.Next() {
+		m, err := scanMetric(rows)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+
+	page := &model.MetricPage{Metrics: metrics}
+	if q.Limit > 0 && len(metrics) > q.Limit {
+		page.Metrics = metrics[:q.Limit]
+		page.Next = model.CursorOf(page.Metrics[q.Limit-1])
+	}
+
+	return page, nil
+}
+
+// listQuery builds the SQL statement and arguments of a validated query.
+func listQuery(q *model.MetricQuery) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.Type != "" {
+		conds = append(conds, "type = "+arg(string(q.Type)))
+	}
+
+	if q.Prefix != "" {
+		conds = append(conds, "id LIKE "+arg(likePrefix(q.Prefix)))
+	}
+
+	if q.Regex != "" {
+		conds = append(conds, "id ~ "+arg(q.Regex))
+	}
+
+	if len(q.IDs) > 0 {
+		conds = append(conds, "id = ANY("+arg(q.IDs)+")")
+	}
+
+	op, dir := ">", "ASC"
+	if q.Sort.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	if c := q.After; c != nil {
+		if q.Sort.Field == model.SortByType {
+			t := arg(string(c.Type))
+			conds = append(conds, fmt.Sprintf(
+				`(type %[1]s %[2]s OR (type = %[2]s AND id COLLATE "C" %[1]s %[3]s))`,
+				op, t, arg(c.ID),
+			))
+		} else {
+			conds = append(conds, fmt.Sprintf(`id COLLATE "C" %s %s`, op, arg(c.ID)))
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT id, type, delta, value FROM metrics")
+	if len(conds) > 0 {
+		b.WriteString(" WHERE ")
+		b.WriteString(strings.Join(conds, " AND "))
+	}
+
+	b.WriteString(" ORDER BY ")
+	if q.Sort.Field == model.SortByType {
+		b.WriteString("type " + dir + ", ")
+	}
+	b.WriteString(`id COLLATE "C" ` + dir)
+
+	if q.Limit > 0 {
+		b.WriteString(" LIMIT " + arg(q.Limit+1))
+	}
+
+	return b.String(), args
+}
+
+// likePrefix returns a LIKE pattern matching names starting with prefix.
+func likePrefix(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return r.Replace(prefix) + "%"
+}
+
+// upsertQuery returns the upsert statement and the typed value argument for
+// the metric.
+func upsertQuery(m model.Metric) (string, any, error) {
+	switch m.GetType() {
+	case model.CounterType:
+		return qUpsertCounter, m.Int64(), nil
+	case model.GaugeType:
+		return qUpsertGauge, m.Float64(), nil
+	default:
+		return "", nil, model.ErrInvalidMetricType
+	}
+}
+
+// scanMetric reads a metric from a row selected as id, type, delta, value.
+func scanMetric(row pgx.Row) (model.Metric, error) {
+	var (
+		id, metricType string
+		delta          *int64
+		value          *float64
+	)
+	if err := row.Scan(&id, &metricType, &delta, &value); err != nil {
+		return nil, fmt.Errorf("error reading values: %w", err)
+	}
+
+	switch model.MetricType(metricType) {
+	case model.CounterType:
+		if delta == nil {
+			return nil, fmt.Errorf("counter %s has no delta", id)
+		}
+		return model.NewCounter(id, *delta), nil
+	case model.GaugeType:
+		if value == nil {
+			return nil, fmt.Errorf("gauge %s has no value", id)
+		}
+		return model.NewGauge(id, *value), nil
+	default:
+		return nil, model.ErrInvalidMetricType
+	}
 }
 
 func (s *Storage) Initialize(metrics []model.Metric) error {
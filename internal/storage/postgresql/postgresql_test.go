@@ -90,8 +90,7 @@ func TestStorage_SetOrUpdateMetric(t *testing.T) {
 		{
 			name: "add new gauge metric",
 			metric: func() model.Metric {
-				m, _ := model.NewMetric("test_gauge_1", model.GaugeType)
-				_ = m.SetValue("42.5")
+				m, _ := model.ParseMetric("test_gauge_1", model.GaugeType, "42.5")
 				return m
 			},
 			wantErr: false,
@@ -104,8 +103,7 @@ func TestStorage_SetOrUpdateMetric(t *testing.T) {
 		{
 			name: "update existing gauge metric",
 			metric: func() model.Metric {
-				m, _ := model.NewMetric("test_gauge_1", model.GaugeType)
-				_ = m.SetValue("20.7")
+				m, _ := model.ParseMetric("test_gauge_1", model.GaugeType, "20.7")
 				return m
 			},
 			wantErr: false,
@@ -118,8 +116,7 @@ func TestStorage_SetOrUpdateMetric(t *testing.T) {
 		{
 			name: "add new counter metric",
 			metric: func() model.Metric {
-				m, _ := model.NewMetric("test_counter_1", model.CounterType)
-				_ = m.SetValue("100")
+				m, _ := model.ParseMetric("test_counter_1", model.CounterType, "100")
 				return m
 			},
 			wantErr: false,
@@ -132,8 +129,7 @@ func TestStorage_SetOrUpdateMetric(t *testing.T) {
 		{
 			name: "update existing counter metric",
 			metric: func() model.Metric {
-				m, _ := model.NewMetric("test_counter_1", model.CounterType)
-				_ = m.SetValue("25")
+				m, _ := model.ParseMetric("test_counter_1", model.CounterType, "25")
 				return m
 			},
 			wantErr: false,
@@ -173,8 +169,7 @@ func TestStorage_GetMetric(t *testing.T) {
 		{
 			name: "get existing metric",
 			setup: func(s *Storage) {
-				m, _ := model.NewMetric("test_metric_2", model.GaugeType)
-				_ = m.SetValue("42.5")
+				m, _ := model.ParseMetric("test_metric_2", model.GaugeType, "42.5")
 				_ = s.SetOrUpdateMetric(context.Background(), m)
 			},
 			id:      "test_metric_2",
@@ -210,20 +205,21 @@ func TestStorage_SetOrUpdateMetricBatch(t *testing.T) {
 		name      string
 		setup     func(*Storage)
 		metrics   func() []model.Metric
-		wantErr   bool
+		want      []model.BatchItemStatus
 		checkFunc func(*testing.T, *Storage)
 	}{
 		{
 			name:  "add multiple new metrics",
 			setup: func(s *Storage) {},
 			metrics: func() []model.Metric {
-				m1, _ := model.NewMetric("test_gauge_3", model.GaugeType)
-				_ = m1.SetValue("10.5")
-				m2, _ := model.NewMetric("test_counter_3", model.CounterType)
-				_ = m2.SetValue("100")
+				m1, _ := model.ParseMetric("test_gauge_3", model.GaugeType, "10.5")
+				m2, _ := model.ParseMetric("test_counter_3", model.CounterType, "100")
 				return []model.Metric{m1, m2}
 			},
-			wantErr: false,
+			want: []model.BatchItemStatus{
+				model.BatchItemApplied,
+				model.BatchItemApplied,
+			},
 			checkFunc: func(t *testing.T, s *Storage) {
 				metrics, _ := s.GetMetrics(t.Context())
 				assert.NotNil(t, metrics["test_gauge_3"].GetID())
@@ -235,18 +231,18 @@ func TestStorage_SetOrUpdateMetricBatch(t *testing.T) {
 		{
 			name: "update existing and add new metrics",
 			setup: func(s *Storage) {
-				m, _ := model.NewMetric("existing_3", model.CounterType)
-				_ = m.SetValue("50")
+				m, _ := model.ParseMetric("existing_3", model.CounterType, "50")
 				_ = s.SetOrUpdateMetric(t.Context(), m)
 			},
 			metrics: func() []model.Metric {
-				m1, _ := model.NewMetric("existing_3", model.CounterType)
-				_ = m1.SetValue("30")
-				m2, _ := model.NewMetric("new_metric_3", model.GaugeType)
-				_ = m2.SetValue("42.5")
+				m1, _ := model.ParseMetric("existing_3", model.CounterType, "30")
+				m2, _ := model.ParseMetric("new_metric_3", model.GaugeType, "42.5")
 				return []model.Metric{m1, m2}
 			},
-			wantErr: false,
+			want: []model.BatchItemStatus{
+				model.BatchItemApplied,
+				model.BatchItemApplied,
+			},
 			checkFunc: func(t *testing.T, s *Storage) {
 
 				m1, _ := s.GetMetric(t.Context(), "existing_3")
@@ -256,18 +252,16 @@ func TestStorage_SetOrUpdateMetricBatch(t *testing.T) {
 			},
 		},
 		{
-			name: "error on type mismatch in batch",
+			name: "type mismatch in batch",
 			setup: func(s *Storage) {
-				m, _ := model.NewMetric("test_metric_3", model.GaugeType)
-				_ = m.SetValue("10.5")
+				m, _ := model.ParseMetric("test_metric_3", model.GaugeType, "10.5")
 				_ = s.SetOrUpdateMetric(t.Context(), m)
 			},
 			metrics: func() []model.Metric {
-				m1, _ := model.NewMetric("test_metric_3", model.CounterType)
-				_ = m1.SetValue("100")
+				m1, _ := model.ParseMetric("test_metric_3", model.CounterType, "100")
 				return []model.Metric{m1}
 			},
-			wantErr: true,
+			want: []model.BatchItemStatus{model.BatchItemTypeConflict},
 		},
 	}
 
@@ -275,15 +269,21 @@ func TestStorage_SetOrUpdateMetricBatch(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setup(pgStorage)
 
-			err := pgStorage.SetOrUpdateMetricBatch(t.Context(), tt.metrics())
+			results, err := pgStorage.SetOrUpdateMetricBatch(
+				t.Context(),
+				tt.metrics(),
+				model.BatchAtomic,
+			)
+			require.NoError(t, err)
 
-			if tt.wantErr {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-				if tt.checkFunc != nil {
-					tt.checkFunc(t, pgStorage)
-				}
+			statuses := make([]model.BatchItemStatus, 0, len(results))
+			for _, r := range results {
+				statuses = append(statuses, r.Status)
+			}
+			assert.Equal(t, tt.want, statuses)
+
+			if tt.checkFunc != nil {
+				tt.checkFunc(t, pgStorage)
 			}
 		})
 	}
@@ -291,10 +291,8 @@ func TestStorage_SetOrUpdateMetricBatch(t *testing.T) {
 
 func TestStorage_GetMetrics(t *testing.T) {
 	t.Run("test GetMetrics", func(t *testing.T) {
-		m1, _ := model.NewMetric("test_gauge_4", model.GaugeType)
-		_ = m1.SetValue("10.5")
-		m2, _ := model.NewMetric("test_counter_4", model.CounterType)
-		_ = m2.SetValue("100")
+		m1, _ := model.ParseMetric("test_gauge_4", model.GaugeType, "10.5")
+		m2, _ := model.ParseMetric("test_counter_4", model.CounterType, "100")
 
 		var err error
 		err = pgStorage.SetOrUpdateMetric(t.Context(), m1)
@@ -308,3 +306,106 @@ func TestStorage_GetMetrics(t *testing.T) {
 		assert.Equal(t, m2, metrics["test_counter_4"])
 	})
 }
+
+func TestStorage_ListMetrics(t *testing.T) {
+	require.NoError(t, pgStorage.Initialize([]model.Metric{
+		model.NewGauge("list_cpu1", 1),
+		model.NewGauge("list_cpu2", 2),
+		model.NewCounter("list_cpu_count", 3),
+		model.NewGauge("list_mem", 4),
+		model.NewCounter("list_polls", 5),
+		model.NewGauge("list%_escaped", 6),
+	}))
+
+	tests := []struct {
+		name    string
+		q       model.MetricQuery
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "prefix",
+			q:    model.MetricQuery{Prefix: "list_"},
+			want: []string{"list_cpu1", "list_cpu2", "list_cpu_count", "list_mem", "list_polls"},
+		},
+		{
+			name: "prefix is not a pattern",
+			q:    model.MetricQuery{Prefix: "list%"},
+			want: []string{"list%_escaped"},
+		},
+		{
+			name: "type and desc",
+			q: model.MetricQuery{
+				Type:   model.GaugeType,
+				Prefix: "list_cpu",
+				Sort:   model.SortOrder{Desc: true},
+			},
+			want: []string{"list_cpu2", "list_cpu1"},
+		},
+		{
+			name: "by type",
+			q: model.MetricQuery{
+				Prefix: "list_",
+				Sort:   model.SortOrder{Field: model.SortByType},
+			},
+			want: []string{"list_cpu_count", "list_polls", "list_cpu1", "list_cpu2", "list_mem"},
+		},
+		{
+			name: "regex",
+			q:    model.MetricQuery{Regex: `^list_(mem|polls)$`},
+			want: []string{"list_mem", "list_polls"},
+		},
+		{
+			name: "ids",
+			q:    model.MetricQuery{IDs: []string{"list_polls", "list_missing", "list_cpu1"}},
+			want: []string{"list_cpu1", "list_polls"},
+		},
+		{
+			name:    "invalid regex",
+			q:       model.MetricQuery{Regex: "("},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := pgStorage.ListMetrics(t.Context(), &tt.q)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+
+			ids := make([]string, 0, len(page.Metrics))
+			for _, m := range page.Metrics {
+				ids = append(ids, m.GetID())
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+
+	t.Run("paging", func(t *testing.T) {
+		q := &model.MetricQuery{Prefix: "list_", Limit: 2}
+
+		var ids []string
+		for {
+			page, err := pgStorage.ListMetrics(t.Context(), q)
+			require.NoError(t, err)
+			for _, m := range page.Metrics {
+				ids = append(ids, m.GetID())
+			}
+
+			if page.Next == nil {
+				break
+			}
+			q.After = page.Next
+		}
+
+		assert.Equal(
+			t,
+			[]string{"list_cpu1", "list_cpu2", "list_cpu_count", "list_mem", "list_polls"},
+			ids,
+		)
+	})
+}
@@ -0,0 +1,103 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader serves a certificate and key pair from files and loads them
+// again once either file changes, so renewed certificates are picked up
+// without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// NewCertReloader loads the pair from certFile and keyFile.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.certificate(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.certificate()
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (r *CertReloader) GetClientCertificate(
+	*tls.CertificateRequestInfo,
+) (*tls.Certificate, error) {
+	return r.certificate()
+}
+
+// certificate returns the current pair, loading it again if the files were
+// modified since the last load. A pair that fails to load, such as one
+// caught in the middle of an update, keeps the previous one in use.
+func (r *CertReloader) certificate() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	certMod, keyMod, err := r.modTimes()
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, err
+	}
+
+	if r.cert != nil && certMod.Equal(r.certMod) && keyMod.Equal(r.keyMod) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			slog.Error(
+				"failed to reload tls certificate",
+				slog.String("cert_file", r.certFile),
+				slog.Any("error", err),
+			)
+			// retried on the next change of the files
+			r.certMod, r.keyMod = certMod, keyMod
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+
+	if r.cert != nil {
+		slog.Info("tls certificate reloaded", slog.String("cert_file", r.certFile))
+	}
+
+	r.cert = &cert
+	r.certMod, r.keyMod = certMod, keyMod
+
+	return r.cert, nil
+}
+
+func (r *CertReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to stat certificate: %w", err)
+	}
+
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to stat key: %w", err)
+	}
+
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
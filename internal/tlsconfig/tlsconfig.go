@@ -0,0 +1,171 @@
+// Package tlsconfig builds the TLS configurations of the servers and the
+// agent: certificates reloaded from disk on change, the minimum protocol
+// version and the CA bundles of mutual TLS.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// DefaultMinVersion is the minimum TLS version unless set otherwise.
+const DefaultMinVersion = "1.2"
+
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Option configures a TLS configuration.
+type Option func(*tls.Config) error
+
+// WithMinVersion sets the minimum TLS version, 1.2 or 1.3.
+func WithMinVersion(version string) Option {
+	return func(c *tls.Config) error {
+		v, err := ParseVersion(version)
+		if err != nil {
+			return err
+		}
+		c.MinVersion = v
+		return nil
+	}
+}
+
+// WithClientCA requires clients to present a certificate signed by a CA of
+// the PEM bundle at path.
+func WithClientCA(path string) Option {
+	return func(c *tls.Config) error {
+		pool, err := readCertPool(path)
+		if err != nil {
+			return fmt.Errorf("failed to read client ca from file %s: %w", path, err)
+		}
+		c.ClientCAs = pool
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		return nil
+	}
+}
+
+// WithRootCA verifies the server certificate with the CAs of the PEM bundle
+// at path instead of the system ones.
+func WithRootCA(path string) Option {
+	return func(c *tls.Config) error {
+		pool, err := readCertPool(path)
+		if err != nil {
+			return fmt.Errorf("failed to read ca from file %s: %w", path, err)
+		}
+		c.RootCAs = pool
+		return nil
+	}
+}
+
+// WithServerName verifies the server certificate against the name instead
+// of the host the client connects to.
+func WithServerName(name string) Option {
+	return func(c *tls.Config) error {
+		c.ServerName = name
+		return nil
+	}
+}
+
+// WithClientCertificate presents the certificate and key pair at the paths
+// to servers that request one. The pair is reloaded on change.
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(c *tls.Config) error {
+		r, err := NewCertReloader(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		c.GetClientCertificate = r.GetClientCertificate
+		return nil
+	}
+}
+
+// NewServer creates the configuration of a server presenting the
+// certificate and key pair at the paths, reloaded on change.
+func NewServer(certFile, keyFile string, opts ...Option) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both certificate and key are required")
+	}
+
+	r, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// NewClient creates the configuration of a client.
+func NewClient(opts ...Option) (*tls.Config, error) {
+	c := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// ParseVersion returns the TLS version constant of a version such as 1.2.
+// Versions older than 1.2 are rejected.
+func ParseVersion(version string) (uint16, error) {
+	v, ok := versions[version]
+	if !ok {
+		return 0, fmt.Errorf("unsupported tls version %q", version)
+	}
+
+	return v, nil
+}
+
+// PeerIdentity returns the subject of the verified client certificate of
+// the connection, or an empty string without one.
+func PeerIdentity(state *tls.ConnectionState) string {
+	cert := PeerCertificate(state)
+	if cert == nil {
+		return ""
+	}
+
+	return cert.Subject.String()
+}
+
+// PeerCertificate returns the verified client certificate of the
+// connection, nil without one.
+func PeerCertificate(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil ||
+		len(state.VerifiedChains) == 0 ||
+		len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
+
+func readCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificates found")
+	}
+
+	return pool, nil
+}
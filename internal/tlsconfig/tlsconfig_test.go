@@ -0,0 +1,288 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues certificates for the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	writePEM(t, ca.path("ca.pem"), "CERTIFICATE", der)
+
+	return ca
+}
+
+func (ca *testCA) path(name string) string {
+	return filepath.Join(ca.dir, name)
+}
+
+// issue writes a certificate and key pair for the common name to
+// name.pem and name-key.pem.
+func (ca *testCA) issue(t *testing.T, name, cn string, serial int64) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"metrics"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth,
+		},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	writePEM(t, ca.path(name+"-key.pem"), "EC PRIVATE KEY", keyDER)
+	writePEM(t, ca.path(name+".pem"), "CERTIFICATE", der)
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{version: "1.2", want: tls.VersionTLS12},
+		{version: "1.3", want: tls.VersionTLS13},
+		{version: "1.0", wantErr: true},
+		{version: "1.1", wantErr: true},
+		{version: "1.4", wantErr: true},
+		{version: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := ParseVersion(tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	ca := newTestCA(t)
+	ca.issue(t, "server", "localhost", 2)
+
+	tests := []struct {
+		name           string
+		cert           string
+		key            string
+		opts           []Option
+		wantMinVersion uint16
+		wantClientAuth tls.ClientAuthType
+		wantErr        bool
+	}{
+		{
+			name:           "defaults",
+			cert:           ca.path("server.pem"),
+			key:            ca.path("server-key.pem"),
+			wantMinVersion: tls.VersionTLS12,
+		},
+		{
+			name: "mutual tls",
+			cert: ca.path("server.pem"),
+			key:  ca.path("server-key.pem"),
+			opts: []Option{
+				WithMinVersion("1.3"),
+				WithClientCA(ca.path("ca.pem")),
+			},
+			wantMinVersion: tls.VersionTLS13,
+			wantClientAuth: tls.RequireAndVerifyClientCert,
+		},
+		{name: "no key", cert: ca.path("server.pem"), wantErr: true},
+		{
+			name:    "missing certificate",
+			cert:    ca.path("missing.pem"),
+			key:     ca.path("server-key.pem"),
+			wantErr: true,
+		},
+		{
+			name:    "invalid min version",
+			cert:    ca.path("server.pem"),
+			key:     ca.path("server-key.pem"),
+			opts:    []Option{WithMinVersion("1.5")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid client ca",
+			cert:    ca.path("server.pem"),
+			key:     ca.path("server-key.pem"),
+			opts:    []Option{WithClientCA(ca.path("server-key.pem"))},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewServer(tt.cert, tt.key, tt.opts...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantMinVersion, c.MinVersion)
+			assert.Equal(t, tt.wantClientAuth, c.ClientAuth)
+		})
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t)
+	ca.issue(t, "server", "first", 2)
+
+	r, err := NewCertReloader(ca.path("server.pem"), ca.path("server-key.pem"))
+	require.NoError(t, err)
+
+	subject := func() string {
+		t.Helper()
+
+		cert, err := r.GetCertificate(nil)
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+	assert.Equal(t, "first", subject())
+
+	// the renewed pair is served once the files change
+	ca.issue(t, "server", "second", 3)
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{"server.pem", "server-key.pem"} {
+		require.NoError(t, os.Chtimes(ca.path(name), later, later))
+	}
+	assert.Equal(t, "second", subject())
+
+	// a broken pair keeps the previous one in use
+	require.NoError(t, os.WriteFile(ca.path("server.pem"), []byte("broken"), 0o600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(ca.path("server.pem"), later, later))
+	assert.Equal(t, "second", subject())
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	ca.issue(t, "server", "localhost", 2)
+	ca.issue(t, "agent", "agent-1", 3)
+
+	serverConfig, err := NewServer(
+		ca.path("server.pem"),
+		ca.path("server-key.pem"),
+		WithClientCA(ca.path("ca.pem")),
+	)
+	require.NoError(t, err)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+
+	identity := make(chan string, 1)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity <- PeerIdentity(r.TLS)
+		}),
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	url := "https://" + ln.Addr().String()
+
+	t.Run("with client certificate", func(t *testing.T) {
+		clientConfig, err := NewClient(
+			WithRootCA(ca.path("ca.pem")),
+			WithClientCertificate(ca.path("agent.pem"), ca.path("agent-key.pem")),
+		)
+		require.NoError(t, err)
+
+		client := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: clientConfig},
+		}
+		resp, err := client.Get(url)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, "CN=agent-1,O=metrics", <-identity)
+	})
+
+	t.Run("without client certificate", func(t *testing.T) {
+		clientConfig, err := NewClient(WithRootCA(ca.path("ca.pem")))
+		require.NoError(t, err)
+
+		client := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: clientConfig},
+		}
+		_, err = client.Get(url)
+		assert.Error(t, err)
+	})
+}
+
+func TestPeerIdentity(t *testing.T) {
+	assert.Empty(t, PeerIdentity(nil))
+	assert.Empty(t, PeerIdentity(&tls.ConnectionState{}))
+}
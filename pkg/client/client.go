@@ -0,0 +1,336 @@
+// Package client pushes metrics to the metrics server.
+//
+// A Client accumulates counter increments and gauge values in memory and
+// sends them in batches from a background goroutine, over REST or gRPC:
+//
+//	t, err := client.NewRESTTransport("http://localhost:8080")
+//	...
+//	c, err := client.New(t)
+//	...
+//	defer c.Close()
+//
+//	c.Counter("requests").Add(1)
+//	c.Gauge("queue_size").Set(12)
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/fragpit/yandex-go-dev-metrics/pkg/retry"
+)
+
+const (
+	defaultFlushInterval = 10 * time.Second
+	defaultBatchSize     = 500
+	defaultTimeout       = 10 * time.Second
+)
+
+// Client batches metric updates and flushes them in the background every
+// flush interval, or earlier once a batch worth of metrics is pending.
+//
+// Increments of a counter between flushes are summed and only the last
+// value of a gauge is sent. A flush retries with the backoff of the
+// client. If it still fails the metrics are kept and sent by the next
+// flush, merged with the updates made in between; metrics the server
+// rejects are dropped.
+type Client struct {
+	transport     Transport
+	flushInterval time.Duration
+	batchSize     int
+	timeout       time.Duration
+	retrier       *retry.Retrier
+	logger        *slog.Logger
+	onError       func(error)
+
+	mu       sync.Mutex
+	counters map[string]int64
+	gauges   map[string]float64
+
+	// flushMu keeps the order of the flushes.
+	flushMu   sync.Mutex
+	full      chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// Option configures a Client.
+type Option func(*Client) error
+
+// WithFlushInterval sets the interval of the background flushes.
+func WithFlushInterval(d time.Duration) Option {
+	return func(c *Client) error {
+		if d <= 0 {
+			return errors.New("flush interval must be positive")
+		}
+		c.flushInterval = d
+		return nil
+	}
+}
+
+// WithBatchSize sets the largest number of metrics sent in one request.
+// A flush starts early once that many metrics are pending.
+func WithBatchSize(n int) Option {
+	return func(c *Client) error {
+		if n < 1 {
+			return errors.New("batch size must be positive")
+		}
+		c.batchSize = n
+		return nil
+	}
+}
+
+// WithTimeout bounds every send attempt and the final flush of Close.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) error {
+		if d <= 0 {
+			return errors.New("timeout must be positive")
+		}
+		c.timeout = d
+		return nil
+	}
+}
+
+// WithRetryBackoff sets the waits between the attempts to send a batch.
+// An empty backoff disables retries.
+func WithRetryBackoff(backoff []time.Duration) Option {
+	return func(c *Client) error {
+		c.retrier = retry.NewRetrier(isRetryable, retry.WithBackoff(backoff))
+		return nil
+	}
+}
+
+// WithLogger sets the logger.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithErrorHandler sets the function called with the errors of the
+// background flushes, which are logged by default.
+func WithErrorHandler(fn func(error)) Option {
+	return func(c *Client) error {
+		c.onError = fn
+		return nil
+	}
+}
+
+// New creates a Client sending through the transport and starts the
+// background flushes. The Client owns the transport and closes it on
+// Close.
+func New(t Transport, opts ...Option) (*Client, error) {
+	if t == nil {
+		return nil, errors.New("no transport")
+	}
+
+	c := &Client{
+		transport:     t,
+		flushInterval: defaultFlushInterval,
+		batchSize:     defaultBatchSize,
+		timeout:       defaultTimeout,
+		retrier:       retry.NewRetrier(isRetryable),
+		logger:        slog.Default(),
+		counters:      make(map[string]int64),
+		gauges:        make(map[string]float64),
+		full:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.onError == nil {
+		c.onError = func(err error) {
+			c.logger.Error("failed to flush metrics", slog.Any("error", err))
+		}
+	}
+
+	go c.run()
+
+	return c, nil
+}
+
+func isRetryable(err error) bool {
+	return !errors.Is(err, ErrRejected) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// Counter is a handle of a counter metric.
+type Counter struct {
+	c    *Client
+	name string
+}
+
+// Counter returns the handle of the named counter.
+func (c *Client) Counter(name string) Counter {
+	return Counter{c: c, name: name}
+}
+
+// Add increments the counter by n.
+func (m Counter) Add(n int64) {
+	m.c.mu.Lock()
+	m.c.counters[m.name] += n
+	m.c.mu.Unlock()
+
+	m.c.pending()
+}
+
+// Gauge is a handle of a gauge metric.
+type Gauge struct {
+	c    *Client
+	name string
+}
+
+// Gauge returns the handle of the named gauge.
+func (c *Client) Gauge(name string) Gauge {
+	return Gauge{c: c, name: name}
+}
+
+// Set sets the gauge to v.
+func (m Gauge) Set(v float64) {
+	m.c.mu.Lock()
+	m.c.gauges[m.name] = v
+	m.c.mu.Unlock()
+
+	m.c.pending()
+}
+
+// pending starts an early flush once a batch worth of metrics is pending.
+func (c *Client) pending() {
+	c.mu.Lock()
+	n := len(c.counters) + len(c.gauges)
+	c.mu.Unlock()
+
+	if n < c.batchSize {
+		return
+	}
+
+	select {
+	case c.full <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Client) run() {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		case <-c.full:
+		}
+
+		if err := c.Flush(context.Background()); err != nil {
+			c.onError(err)
+		}
+	}
+}
+
+// Flush sends the pending metrics. The metrics that could not be sent are
+// kept for the next flush, unless the server rejected them.
+func (c *Client) Flush(ctx context.Context) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	batch := c.take()
+	for start := 0; start < len(batch); start += c.batchSize {
+		chunk := batch[start:min(start+c.batchSize, len(batch))]
+
+		var delivered int
+		err := c.retrier.Do(ctx, func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			err := c.transport.Send(ctx, chunk[delivered:])
+
+			// do not send the stored part again
+			var partial *partialError
+			if errors.As(err, &partial) {
+				delivered += partial.delivered
+			}
+			return err
+		})
+		if err == nil {
+			continue
+		}
+
+		if errors.Is(err, ErrRejected) {
+			c.logger.Warn("metrics rejected by server", slog.Any("error", err))
+			continue
+		}
+
+		c.restore(batch[start+delivered:])
+		return err
+	}
+
+	return nil
+}
+
+// take removes the pending metrics.
+func (c *Client) take() []Metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	batch := make([]Metric, 0, len(c.counters)+len(c.gauges))
+	for name, delta := range c.counters {
+		batch = append(batch, Metric{Name: name, Kind: KindCounter, Delta: delta})
+	}
+	for name, v := range c.gauges {
+		batch = append(batch, Metric{Name: name, Kind: KindGauge, Value: v})
+	}
+
+	clear(c.counters)
+	clear(c.gauges)
+
+	return batch
+}
+
+// restore returns unsent metrics to the pending ones. Counter increments
+// are added up, a gauge set since is newer than the unsent value.
+func (c *Client) restore(batch []Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, m := range batch {
+		switch m.Kind {
+		case KindCounter:
+			c.counters[m.Name] += m.Delta
+		case KindGauge:
+			if _, ok := c.gauges[m.Name]; !ok {
+				c.gauges[m.Name] = m.Value
+			}
+		}
+	}
+}
+
+// Close stops the background flushes, flushes the pending metrics and
+// closes the transport. Updates made after Close are not sent.
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		<-c.stopped
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+
+		err = errors.Join(c.Flush(ctx), c.transport.Close())
+	})
+
+	return err
+}
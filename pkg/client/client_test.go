@@ -0,0 +1,263 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransport records the batches it is sent and fails the sends with
+// the queued errors.
+type fakeTransport struct {
+	mu      sync.Mutex
+	batches [][]Metric
+	errs    []error
+	closed  bool
+	sent    chan struct{}
+}
+
+func newFakeTransport(errs ...error) *fakeTransport {
+	return &fakeTransport{errs: errs, sent: make(chan struct{}, 16)}
+}
+
+func (t *fakeTransport) Send(_ context.Context, metrics []Metric) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var err error
+	if len(t.errs) > 0 {
+		err, t.errs = t.errs[0], t.errs[1:]
+	}
+
+	var partial *partialError
+	switch {
+	case errors.As(err, &partial):
+		t.batches = append(t.batches, sorted(metrics[:partial.delivered]))
+	case err == nil:
+		t.batches = append(t.batches, sorted(metrics))
+	}
+
+	select {
+	case t.sent <- struct{}{}:
+	default:
+	}
+
+	return err
+}
+
+func (t *fakeTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	return nil
+}
+
+func (t *fakeTransport) sentBatches() [][]Metric {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.batches
+}
+
+func sorted(metrics []Metric) []Metric {
+	out := append([]Metric(nil), metrics...)
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func newTestClient(t *testing.T, tr Transport, opts ...Option) *Client {
+	t.Helper()
+
+	opts = append([]Option{
+		WithFlushInterval(time.Hour),
+		WithRetryBackoff(nil),
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithErrorHandler(func(error) {}),
+	}, opts...)
+
+	c, err := New(tr, opts...)
+	require.NoError(t, err)
+
+	return c
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		tr      Transport
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "defaults", tr: newFakeTransport()},
+		{
+			name: "with options",
+			tr:   newFakeTransport(),
+			opts: []Option{
+				WithFlushInterval(time.Second),
+				WithBatchSize(10),
+				WithTimeout(time.Second),
+				WithRetryBackoff([]time.Duration{time.Millisecond}),
+			},
+		},
+		{name: "no transport", wantErr: true},
+		{
+			name:    "invalid flush interval",
+			tr:      newFakeTransport(),
+			opts:    []Option{WithFlushInterval(0)},
+			wantErr: true,
+		},
+		{
+			name:    "invalid batch size",
+			tr:      newFakeTransport(),
+			opts:    []Option{WithBatchSize(0)},
+			wantErr: true,
+		},
+		{
+			name:    "invalid timeout",
+			tr:      newFakeTransport(),
+			opts:    []Option{WithTimeout(-time.Second)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.tr, tt.opts...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.NoError(t, c.Close())
+		})
+	}
+}
+
+func TestClient_Flush(t *testing.T) {
+	tr := newFakeTransport()
+	c := newTestClient(t, tr)
+	defer c.Close()
+
+	c.Counter("requests").Add(1)
+	c.Counter("requests").Add(2)
+	c.Gauge("queue").Set(5)
+	c.Gauge("queue").Set(7)
+
+	require.NoError(t, c.Flush(context.Background()))
+	// nothing is pending, nothing is sent
+	require.NoError(t, c.Flush(context.Background()))
+
+	assert.Equal(t, [][]Metric{{
+		{Name: "queue", Kind: KindGauge, Value: 7},
+		{Name: "requests", Kind: KindCounter, Delta: 3},
+	}}, tr.sentBatches())
+}
+
+func TestClient_Flush_Failed(t *testing.T) {
+	tr := newFakeTransport(errors.New("connection refused"))
+	c := newTestClient(t, tr)
+	defer c.Close()
+
+	c.Counter("requests").Add(3)
+	c.Gauge("queue").Set(5)
+	c.Gauge("load").Set(1)
+
+	require.Error(t, c.Flush(context.Background()))
+
+	// the unsent metrics are merged with the updates made in between
+	c.Counter("requests").Add(2)
+	c.Gauge("queue").Set(8)
+
+	require.NoError(t, c.Flush(context.Background()))
+	assert.Equal(t, [][]Metric{{
+		{Name: "load", Kind: KindGauge, Value: 1},
+		{Name: "queue", Kind: KindGauge, Value: 8},
+		{Name: "requests", Kind: KindCounter, Delta: 5},
+	}}, tr.sentBatches())
+}
+
+func TestClient_Flush_Retry(t *testing.T) {
+	tr := newFakeTransport(
+		&partialError{delivered: 1, err: errors.New("connection reset")},
+	)
+	c := newTestClient(t, tr, WithRetryBackoff([]time.Duration{time.Millisecond}))
+	defer c.Close()
+
+	c.Counter("a").Add(1)
+	c.Counter("b").Add(2)
+
+	require.NoError(t, c.Flush(context.Background()))
+
+	// the delivered metric is not sent again
+	batches := tr.sentBatches()
+	require.Len(t, batches, 2)
+	assert.Len(t, batches[0], 1)
+	assert.Len(t, batches[1], 1)
+	assert.NotEqual(t, batches[0][0].Name, batches[1][0].Name)
+}
+
+func TestClient_Flush_Rejected(t *testing.T) {
+	tr := newFakeTransport(ErrRejected)
+	c := newTestClient(t, tr, WithRetryBackoff([]time.Duration{time.Millisecond}))
+	defer c.Close()
+
+	c.Gauge("queue").Set(5)
+
+	// rejected metrics are neither retried nor kept
+	require.NoError(t, c.Flush(context.Background()))
+	require.NoError(t, c.Flush(context.Background()))
+	assert.Empty(t, tr.sentBatches())
+}
+
+func TestClient_BatchSize(t *testing.T) {
+	tr := newFakeTransport()
+	c := newTestClient(t, tr, WithBatchSize(2))
+	defer c.Close()
+
+	c.Gauge("a").Set(1)
+	c.Gauge("b").Set(2)
+
+	// a full batch is flushed before the interval
+	select {
+	case <-tr.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was not flushed")
+	}
+
+	c.mu.Lock()
+	for _, name := range []string{"c", "d", "e"} {
+		c.gauges[name] = 1
+	}
+	c.mu.Unlock()
+
+	require.NoError(t, c.Flush(context.Background()))
+
+	batches := tr.sentBatches()
+	require.Len(t, batches, 3)
+	assert.Len(t, batches[1], 2)
+	assert.Len(t, batches[2], 1)
+}
+
+func TestClient_Close(t *testing.T) {
+	tr := newFakeTransport()
+	c := newTestClient(t, tr)
+
+	c.Counter("requests").Add(1)
+
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Close())
+
+	assert.Equal(t, [][]Metric{{
+		{Name: "requests", Kind: KindCounter, Delta: 1},
+	}}, tr.sentBatches())
+	assert.True(t, tr.closed)
+}
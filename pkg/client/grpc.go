@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/fragpit/yandex-go-dev-metrics/internal/proto"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
+)
+
+var _ Transport = (*GRPCTransport)(nil)
+
+// GRPCTransport sends metrics with the UpdateMetrics call of the gRPC API
+// in best-effort batch mode.
+type GRPCTransport struct {
+	conn        *grpc.ClientConn
+	client      pb.MetricsClient
+	dialOptions []grpc.DialOption
+	realIP      string
+	apiKey      string
+	signer      *signing.Signer
+	secretKey   []byte
+	secretKeyID string
+}
+
+// GRPCOption configures a GRPCTransport.
+type GRPCOption func(*GRPCTransport) error
+
+// WithDialOptions adds options of the gRPC connection. The connection is
+// insecure unless transport credentials are set.
+func WithDialOptions(opts ...grpc.DialOption) GRPCOption {
+	return func(t *GRPCTransport) error {
+		t.dialOptions = append(t.dialOptions, opts...)
+		return nil
+	}
+}
+
+// WithGRPCRealIP sets the x-real-ip metadata, the local address used to
+// reach the server by default.
+func WithGRPCRealIP(ip string) GRPCOption {
+	return func(t *GRPCTransport) error {
+		t.realIP = ip
+		return nil
+	}
+}
+
+// WithGRPCAPIKey sends the API key as a bearer token in the authorization
+// metadata.
+func WithGRPCAPIKey(key string) GRPCOption {
+	return func(t *GRPCTransport) error {
+		t.apiKey = key
+		return nil
+	}
+}
+
+// WithGRPCSecretKey signs the calls with the key shared with the server.
+func WithGRPCSecretKey(key []byte) GRPCOption {
+	return func(t *GRPCTransport) error {
+		t.secretKey = key
+		return nil
+	}
+}
+
+// WithGRPCSecretKeyID names the secret key in the signatures, for the
+// server to pick it from its key set instead of trying every key.
+func WithGRPCSecretKeyID(id string) GRPCOption {
+	return func(t *GRPCTransport) error {
+		t.secretKeyID = id
+		return nil
+	}
+}
+
+// NewGRPCTransport creates a GRPCTransport for the server at host:port.
+func NewGRPCTransport(addr string, opts ...GRPCOption) (*GRPCTransport, error) {
+	t := &GRPCTransport{
+		dialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		},
+	}
+
+	for _, opt := range opts {
+		if err := opt(t); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(t.secretKey) > 0 {
+		t.signer = signing.NewSigner(t.secretKey, signing.WithKeyID(t.secretKeyID))
+	}
+
+	if t.realIP == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to get hostname from address %s: %w",
+				addr,
+				err,
+			)
+		}
+
+		ip, err := localIPFor(host)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to get source ip for provided server hostname: %w",
+				err,
+			)
+		}
+		t.realIP = ip.String()
+	}
+
+	conn, err := grpc.NewClient(addr, t.dialOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init grpc client: %w", err)
+	}
+	t.conn = conn
+	t.client = pb.NewMetricsClient(conn)
+
+	return t, nil
+}
+
+// Send implements Transport.
+func (t *GRPCTransport) Send(ctx context.Context, metrics []Metric) error {
+	in := make([]*pb.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		pm := &pb.Metric{}
+		pm.SetId(m.Name)
+
+		switch m.Kind {
+		case KindCounter:
+			pm.SetType(pb.Metric_MTYPE_COUNTER)
+			pm.SetDelta(m.Delta)
+		case KindGauge:
+			pm.SetType(pb.Metric_MTYPE_GAUGE)
+			pm.SetValue(m.Value)
+		default:
+			return fmt.Errorf(
+				"%w: unknown metric type %s for %s",
+				ErrRejected,
+				m.Kind,
+				m.Name,
+			)
+		}
+
+		in = append(in, pm)
+	}
+
+	req := pb.UpdateMetricsRequest_builder{
+		Metrics: in,
+		Mode:    pb.UpdateMetricsRequest_BATCH_MODE_BEST_EFFORT.Enum(),
+	}.Build()
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-real-ip", t.realIP)
+	if t.apiKey != "" {
+		ctx = metadata.AppendToOutgoingContext(
+			ctx,
+			"authorization", "Bearer "+t.apiKey,
+		)
+	}
+	if t.signer != nil {
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+
+		sig, err := t.signer.Sign(
+			http.MethodPost,
+			pb.Metrics_UpdateMetrics_FullMethodName,
+			body,
+		)
+		if err != nil {
+			return err
+		}
+		for k, v := range sig.Headers() {
+			ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+		}
+	}
+
+	resp, err := t.client.UpdateMetrics(ctx, req)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.InvalidArgument,
+			codes.FailedPrecondition,
+			codes.PermissionDenied,
+			codes.Unauthenticated:
+			return fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+		return fmt.Errorf("failed to send metrics: %w", err)
+	}
+
+	if resp.GetRejected() == 0 {
+		return nil
+	}
+
+	for _, r := range resp.GetResults() {
+		if r.GetStatus() != pb.MetricResult_STATUS_APPLIED {
+			return rejection(int(resp.GetRejected()), r.GetMetric().GetId(), r.GetReason())
+		}
+	}
+
+	return rejection(int(resp.GetRejected()), "", "")
+}
+
+// Close implements Transport.
+func (t *GRPCTransport) Close() error {
+	return t.conn.Close()
+}
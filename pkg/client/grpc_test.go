@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/fragpit/yandex-go-dev-metrics/internal/proto"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
+)
+
+// testMetricsServer records the UpdateMetrics calls and answers with the
+// response or error it is set up with.
+type testMetricsServer struct {
+	pb.UnimplementedMetricsServer
+
+	resp   *pb.UpdateMetricsResponse
+	err    error
+	req    *pb.UpdateMetricsRequest
+	md     metadata.MD
+	realIP []string
+}
+
+func (s *testMetricsServer) UpdateMetrics(
+	ctx context.Context,
+	in *pb.UpdateMetricsRequest,
+) (*pb.UpdateMetricsResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.req = in
+	s.md = md
+	s.realIP = md.Get("x-real-ip")
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.resp != nil {
+		return s.resp, nil
+	}
+
+	return pb.UpdateMetricsResponse_builder{}.Build(), nil
+}
+
+func startMetricsServer(t *testing.T, srv pb.MetricsServer) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	gs := grpc.NewServer()
+	pb.RegisterMetricsServer(gs, srv)
+	go gs.Serve(ln)
+	t.Cleanup(gs.Stop)
+
+	return ln.Addr().String()
+}
+
+func TestGRPCTransport_Send(t *testing.T) {
+	srv := &testMetricsServer{}
+	addr := startMetricsServer(t, srv)
+
+	tr, err := NewGRPCTransport(addr)
+	require.NoError(t, err)
+	defer tr.Close()
+
+	require.NoError(t, tr.Send(context.Background(), []Metric{
+		{Name: "requests", Kind: KindCounter, Delta: 3},
+		{Name: "queue", Kind: KindGauge, Value: 7.5},
+	}))
+
+	assert.Equal(t, []string{"127.0.0.1"}, srv.realIP)
+	assert.Equal(
+		t,
+		pb.UpdateMetricsRequest_BATCH_MODE_BEST_EFFORT,
+		srv.req.GetMode(),
+	)
+
+	got := srv.req.GetMetrics()
+	require.Len(t, got, 2)
+	assert.Equal(t, "requests", got[0].GetId())
+	assert.Equal(t, pb.Metric_MTYPE_COUNTER, got[0].GetType())
+	assert.Equal(t, int64(3), got[0].GetDelta())
+	assert.Equal(t, "queue", got[1].GetId())
+	assert.Equal(t, pb.Metric_MTYPE_GAUGE, got[1].GetType())
+	assert.Equal(t, 7.5, got[1].GetValue())
+}
+
+func TestGRPCTransport_Send_Signed(t *testing.T) {
+	srv := &testMetricsServer{}
+	addr := startMetricsServer(t, srv)
+
+	tr, err := NewGRPCTransport(
+		addr,
+		WithGRPCSecretKey([]byte("secret")),
+		WithGRPCSecretKeyID("2025-10"),
+		WithGRPCAPIKey("agent-key"),
+	)
+	require.NoError(t, err)
+	defer tr.Close()
+
+	require.NoError(t, tr.Send(context.Background(), []Metric{
+		{Name: "requests", Kind: KindCounter, Delta: 3},
+	}))
+
+	assert.Equal(t, []string{"Bearer agent-key"}, srv.md.Get("authorization"))
+
+	sig, err := signing.Parse(func(key string) string {
+		if v := srv.md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "2025-10", sig.KeyID)
+
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(srv.req)
+	require.NoError(t, err)
+
+	v, err := signing.NewVerifier([]byte("secret"))
+	require.NoError(t, err)
+	assert.NoError(t, v.Verify(
+		http.MethodPost,
+		pb.Metrics_UpdateMetrics_FullMethodName,
+		sig,
+		body,
+	))
+}
+
+func TestGRPCTransport_Send_Errors(t *testing.T) {
+	rejected := pb.MetricResult_builder{
+		Status: pb.MetricResult_STATUS_INVALID.Enum(),
+		Metric: pb.Metric_builder{Id: proto.String("queue")}.Build(),
+		Reason: proto.String("invalid value"),
+	}.Build()
+
+	tests := []struct {
+		name         string
+		server       *testMetricsServer
+		wantRejected bool
+	}{
+		{
+			name:         "invalid argument",
+			server:       &testMetricsServer{err: status.Error(codes.InvalidArgument, "invalid")},
+			wantRejected: true,
+		},
+		{
+			name:         "permission denied",
+			server:       &testMetricsServer{err: status.Error(codes.PermissionDenied, "denied")},
+			wantRejected: true,
+		},
+		{
+			name:   "unavailable",
+			server: &testMetricsServer{err: status.Error(codes.Unavailable, "unavailable")},
+		},
+		{
+			name: "rejected metric",
+			server: &testMetricsServer{resp: pb.UpdateMetricsResponse_builder{
+				Results:  []*pb.MetricResult{rejected},
+				Rejected: proto.Uint32(1),
+			}.Build()},
+			wantRejected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startMetricsServer(t, tt.server)
+
+			tr, err := NewGRPCTransport(addr, WithGRPCRealIP("10.0.0.1"))
+			require.NoError(t, err)
+			defer tr.Close()
+
+			err = tr.Send(context.Background(), []Metric{
+				{Name: "queue", Kind: KindGauge, Value: 1},
+			})
+			require.Error(t, err)
+			assert.Equal(t, tt.wantRejected, errors.Is(err, ErrRejected))
+			assert.Equal(t, []string{"10.0.0.1"}, tt.server.realIP)
+		})
+	}
+}
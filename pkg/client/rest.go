@@ -0,0 +1,397 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/keyring"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
+)
+
+// pkcs1v15Overhead is the padding of an RSA PKCS #1 v1.5 block.
+const pkcs1v15Overhead = 11
+
+var _ Transport = (*RESTTransport)(nil)
+
+// RESTTransport sends metrics to POST /updates/ of the HTTP API in
+// best-effort batch mode.
+//
+// The body is processed the way the server middleware expects it back:
+// signed with the secret key over the plain JSON, encrypted with the public
+// key when one is set, then gzip compressed. The server decrypts a body as a
+// single RSA block, so with encryption a batch is split into requests small
+// enough for the key.
+type RESTTransport struct {
+	updateURL   string
+	updatePath  string
+	httpClient  *http.Client
+	signer      *signing.Signer
+	secretKey   []byte
+	secretKeyID string
+	publicKey   *rsa.PublicKey
+	cryptoKeyID string
+	gzip        bool
+	realIP      string
+	apiKey      string
+}
+
+// RESTOption configures a RESTTransport.
+type RESTOption func(*RESTTransport) error
+
+// WithHTTPClient sets the HTTP client, http.DefaultClient by default.
+func WithHTTPClient(hc *http.Client) RESTOption {
+	return func(t *RESTTransport) error {
+		t.httpClient = hc
+		return nil
+	}
+}
+
+// WithSecretKey signs the requests with the key shared with the server.
+func WithSecretKey(key []byte) RESTOption {
+	return func(t *RESTTransport) error {
+		t.secretKey = key
+		return nil
+	}
+}
+
+// WithSecretKeyID names the secret key in the signatures, for the server
+// to pick it from its key set instead of trying every key.
+func WithSecretKeyID(id string) RESTOption {
+	return func(t *RESTTransport) error {
+		t.secretKeyID = id
+		return nil
+	}
+}
+
+// WithCryptoKey encrypts the requests with the server public key read from
+// the PEM file at path.
+func WithCryptoKey(path string) RESTOption {
+	return func(t *RESTTransport) error {
+		key, err := readPublicKey(path)
+		if err != nil {
+			return fmt.Errorf("failed to read public key from file %s: %w", path, err)
+		}
+		t.publicKey = key
+		return nil
+	}
+}
+
+// WithCryptoKeyID names the key pair of the public key in the
+// X-Encryption-Key-Id header, for the server to pick the private key from
+// its key set instead of trying every key.
+func WithCryptoKeyID(id string) RESTOption {
+	return func(t *RESTTransport) error {
+		t.cryptoKeyID = id
+		return nil
+	}
+}
+
+// WithGzip enables or disables the compression of the requests, enabled
+// by default.
+func WithGzip(enabled bool) RESTOption {
+	return func(t *RESTTransport) error {
+		t.gzip = enabled
+		return nil
+	}
+}
+
+// WithRealIP sets the X-Real-IP header, the local address used to reach
+// the server by default.
+func WithRealIP(ip string) RESTOption {
+	return func(t *RESTTransport) error {
+		t.realIP = ip
+		return nil
+	}
+}
+
+// WithAPIKey sends the API key as a bearer token.
+func WithAPIKey(key string) RESTOption {
+	return func(t *RESTTransport) error {
+		t.apiKey = key
+		return nil
+	}
+}
+
+// NewRESTTransport creates a RESTTransport for the server at serverURL,
+// such as http://localhost:8080.
+func NewRESTTransport(serverURL string, opts ...RESTOption) (*RESTTransport, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid server url %q", serverURL)
+	}
+
+	t := &RESTTransport{
+		updateURL:  strings.TrimSuffix(serverURL, "/") + "/updates/",
+		updatePath: strings.TrimSuffix(u.Path, "/") + "/updates/",
+		httpClient: http.DefaultClient,
+		gzip:       true,
+	}
+
+	for _, opt := range opts {
+		if err := opt(t); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(t.secretKey) > 0 {
+		t.signer = signing.NewSigner(t.secretKey, signing.WithKeyID(t.secretKeyID))
+	}
+
+	if t.realIP == "" {
+		ip, err := localIPFor(u.Hostname())
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to get source ip for provided server hostname: %w",
+				err,
+			)
+		}
+		t.realIP = ip.String()
+	}
+
+	return t, nil
+}
+
+// Send implements Transport.
+func (t *RESTTransport) Send(ctx context.Context, metrics []Metric) error {
+	items := make([]*model.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		item, err := toJSON(m)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+		items = append(items, item)
+	}
+
+	batches, err := t.split(items)
+	if err != nil {
+		return err
+	}
+
+	var rejected error
+	delivered := 0
+	for _, batch := range batches {
+		err := t.post(ctx, batch)
+		switch {
+		case errors.Is(err, ErrRejected):
+			rejected = errors.Join(rejected, err)
+		case err != nil && delivered > 0:
+			return &partialError{delivered: delivered, err: err}
+		case err != nil:
+			return err
+		}
+		delivered += len(batch)
+	}
+
+	return rejected
+}
+
+// split splits the batch into bodies the public key can encrypt.
+func (t *RESTTransport) split(items []*model.Metrics) ([][]*model.Metrics, error) {
+	if t.publicKey == nil {
+		return [][]*model.Metrics{items}, nil
+	}
+
+	limit := t.publicKey.Size() - pkcs1v15Overhead
+
+	var batches [][]*model.Metrics
+	var batch []*model.Metrics
+	size := 2 // brackets
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		if 2+len(data) > limit {
+			return nil, fmt.Errorf(
+				"%w: metric %s is too large for the public key",
+				ErrRejected,
+				item.ID,
+			)
+		}
+
+		// one more byte for the comma
+		if len(batch) > 0 && size+1+len(data) > limit {
+			batches = append(batches, batch)
+			batch, size = nil, 2
+		}
+		if len(batch) > 0 {
+			size++
+		}
+		batch = append(batch, item)
+		size += len(data)
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches, nil
+}
+
+func (t *RESTTransport) post(ctx context.Context, batch []*model.Metrics) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("error marshaling metrics: %w", err)
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Real-IP", t.realIP)
+	header.Set("X-Batch-Mode", string(model.BatchBestEffort))
+	if t.apiKey != "" {
+		header.Set("Authorization", "Bearer "+t.apiKey)
+	}
+
+	if t.signer != nil {
+		sig, err := t.signer.Sign(http.MethodPost, t.updatePath, body)
+		if err != nil {
+			return err
+		}
+		for k, v := range sig.Headers() {
+			header.Set(k, v)
+		}
+	}
+
+	if t.publicKey != nil {
+		body, err = rsa.EncryptPKCS1v15(rand.Reader, t.publicKey, body)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt body: %w", err)
+		}
+		header.Set("X-Encrypted", "rsa")
+		if t.cryptoKeyID != "" {
+			header.Set(keyring.HeaderEncryptionKeyID, t.cryptoKeyID)
+		}
+	}
+
+	if t.gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+		header.Set("Content-Encoding", "gzip")
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		t.updateURL,
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header = header
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error reporting metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("server error %d: %s", resp.StatusCode, bytes.TrimSpace(data))
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf(
+			"%w: status %d: %s",
+			ErrRejected,
+			resp.StatusCode,
+			bytes.TrimSpace(data),
+		)
+	}
+
+	var res model.BatchResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+
+	if res.Rejected == 0 {
+		return nil
+	}
+
+	for _, it := range res.Results {
+		if !it.Applied() && it.Metrics != nil {
+			return rejection(res.Rejected, it.ID, it.Reason)
+		}
+	}
+
+	return rejection(res.Rejected, "", "")
+}
+
+// Close implements Transport.
+func (t *RESTTransport) Close() error {
+	return nil
+}
+
+// rejection reports the metrics rejected in a best-effort batch with the
+// reason of the first one.
+func rejection(rejected int, id, reason string) error {
+	if id == "" {
+		return fmt.Errorf("%w: %d metrics", ErrRejected, rejected)
+	}
+
+	return fmt.Errorf("%w: %d metrics, %s: %s", ErrRejected, rejected, id, reason)
+}
+
+func toJSON(m Metric) (*model.Metrics, error) {
+	item := &model.Metrics{ID: m.Name, MType: string(m.Kind)}
+	switch m.Kind {
+	case KindCounter:
+		delta := m.Delta
+		item.Delta = &delta
+	case KindGauge:
+		v := m.Value
+		item.Value = &v
+	default:
+		return nil, fmt.Errorf("unknown metric type %s for %s", m.Kind, m.Name)
+	}
+
+	return item, nil
+}
+
+func readPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid key format")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key: %w", err)
+	}
+
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unexpected key type %T", key)
+	}
+
+	return publicKey, nil
+}
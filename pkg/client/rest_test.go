@@ -0,0 +1,299 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fragpit/yandex-go-dev-metrics/internal/model"
+	"github.com/fragpit/yandex-go-dev-metrics/internal/signing"
+)
+
+// testServer decodes the requests the way the server middleware does and
+// records the received metrics.
+type testServer struct {
+	t          *testing.T
+	verifier   *signing.Verifier
+	privateKey *rsa.PrivateKey
+	status     int
+	result     *model.BatchResult
+	// header holds headers every request must carry.
+	header http.Header
+
+	mu       sync.Mutex
+	requests int
+	metrics  []model.Metrics
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t := s.t
+
+	assert.Equal(t, "/updates/", r.URL.Path)
+	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+	assert.Equal(t, "127.0.0.1", r.Header.Get("X-Real-IP"))
+	assert.Equal(t, string(model.BatchBestEffort), r.Header.Get("X-Batch-Mode"))
+	for k := range s.header {
+		assert.Equal(t, s.header.Get(k), r.Header.Get(k), k)
+	}
+
+	body, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		body, err = io.ReadAll(zr)
+		require.NoError(t, err)
+	}
+
+	if s.privateKey != nil {
+		assert.Equal(t, "rsa", r.Header.Get("X-Encrypted"))
+		body, err = rsa.DecryptPKCS1v15(rand.Reader, s.privateKey, body)
+		require.NoError(t, err)
+	}
+
+	if s.verifier != nil {
+		sig, err := signing.Parse(r.Header.Get)
+		require.NoError(t, err)
+		assert.NoError(t, s.verifier.Verify(r.Method, r.URL.Path, sig, body))
+	}
+
+	var metrics []model.Metrics
+	require.NoError(t, json.Unmarshal(body, &metrics))
+
+	s.mu.Lock()
+	s.requests++
+	s.metrics = append(s.metrics, metrics...)
+	s.mu.Unlock()
+
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+
+	result := s.result
+	if result == nil {
+		items := make([]*model.BatchItemResult, 0, len(metrics))
+		for i := range metrics {
+			items = append(items, &model.BatchItemResult{
+				Metrics: &metrics[i],
+				Status:  model.BatchItemApplied,
+			})
+		}
+		result = model.NewBatchResult(model.BatchBestEffort, items)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	require.NoError(t, json.NewEncoder(w).Encode(result))
+}
+
+func newTestVerifier(t *testing.T) *signing.Verifier {
+	t.Helper()
+
+	v, err := signing.NewVerifier([]byte("secret"))
+	require.NoError(t, err)
+
+	return v
+}
+
+func writePublicKey(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "public.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	return path
+}
+
+func TestNewRESTTransport(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		opts    []RESTOption
+		wantErr bool
+	}{
+		{name: "valid", url: "http://127.0.0.1:8080"},
+		{name: "trailing slash", url: "http://127.0.0.1:8080/"},
+		{name: "no host", url: "127.0.0.1:8080", wantErr: true},
+		{
+			name:    "missing crypto key",
+			url:     "http://127.0.0.1:8080",
+			opts:    []RESTOption{WithCryptoKey("testdata/missing.pem")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := NewRESTTransport(tt.url, tt.opts...)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "http://127.0.0.1:8080/updates/", tr.updateURL)
+		})
+	}
+}
+
+func TestRESTTransport_Send(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	metrics := []Metric{
+		{Name: "requests", Kind: KindCounter, Delta: 3},
+		{Name: "queue", Kind: KindGauge, Value: 7.5},
+		{Name: "errors", Kind: KindCounter, Delta: 1},
+		{Name: "load", Kind: KindGauge, Value: 0.25},
+	}
+
+	tests := []struct {
+		name         string
+		server       *testServer
+		opts         []RESTOption
+		wantRequests int
+	}{
+		{
+			name:         "plain",
+			server:       &testServer{},
+			opts:         []RESTOption{WithGzip(false)},
+			wantRequests: 1,
+		},
+		{
+			name:         "signed and compressed",
+			server:       &testServer{verifier: newTestVerifier(t)},
+			opts:         []RESTOption{WithSecretKey([]byte("secret"))},
+			wantRequests: 1,
+		},
+		{
+			// a 1024 bit key encrypts two metrics per request
+			name: "encrypted",
+			server: &testServer{
+				verifier:   newTestVerifier(t),
+				privateKey: key,
+			},
+			opts: []RESTOption{
+				WithSecretKey([]byte("secret")),
+				WithCryptoKey(writePublicKey(t, key)),
+			},
+			wantRequests: 2,
+		},
+		{
+			name: "key ids",
+			server: &testServer{
+				verifier:   newTestVerifier(t),
+				privateKey: key,
+				header: http.Header{
+					"X-Signature-Key-Id":  {"2025-10"},
+					"X-Encryption-Key-Id": {"2025-11"},
+				},
+			},
+			opts: []RESTOption{
+				WithSecretKeyID("2025-10"),
+				WithSecretKey([]byte("secret")),
+				WithCryptoKey(writePublicKey(t, key)),
+				WithCryptoKeyID("2025-11"),
+			},
+			wantRequests: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tt.server
+			srv.t = t
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			opts := append([]RESTOption{WithRealIP("127.0.0.1")}, tt.opts...)
+			tr, err := NewRESTTransport(ts.URL, opts...)
+			require.NoError(t, err)
+
+			require.NoError(t, tr.Send(context.Background(), metrics))
+
+			assert.Equal(t, tt.wantRequests, srv.requests)
+			require.Len(t, srv.metrics, len(metrics))
+			for i, m := range metrics {
+				got := srv.metrics[i]
+				assert.Equal(t, m.Name, got.ID)
+				assert.Equal(t, string(m.Kind), got.MType)
+				if m.Kind == KindCounter {
+					assert.Equal(t, m.Delta, *got.Delta)
+				} else {
+					assert.Equal(t, m.Value, *got.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestRESTTransport_Send_Errors(t *testing.T) {
+	rejected := model.Metrics{ID: "queue", MType: "gauge"}
+
+	tests := []struct {
+		name         string
+		server       *testServer
+		wantRejected bool
+	}{
+		{
+			name:         "bad request",
+			server:       &testServer{status: http.StatusBadRequest},
+			wantRejected: true,
+		},
+		{
+			name:   "server error",
+			server: &testServer{status: http.StatusInternalServerError},
+		},
+		{
+			name: "rejected metric",
+			server: &testServer{result: model.NewBatchResult(
+				model.BatchBestEffort,
+				[]*model.BatchItemResult{{
+					Metrics: &rejected,
+					Status:  model.BatchItemInvalid,
+					Reason:  "invalid value",
+				}},
+			)},
+			wantRejected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := tt.server
+			srv.t = t
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			tr, err := NewRESTTransport(ts.URL, WithRealIP("127.0.0.1"))
+			require.NoError(t, err)
+
+			err = tr.Send(context.Background(), []Metric{
+				{Name: "queue", Kind: KindGauge, Value: 1},
+			})
+			require.Error(t, err)
+			assert.Equal(t, tt.wantRejected, errors.Is(err, ErrRejected))
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrRejected reports metrics the server refused. Sending them again would
+// not help, so they are dropped instead of retried.
+var ErrRejected = errors.New("metrics rejected")
+
+// Kind is the type of a metric.
+type Kind string
+
+const (
+	KindCounter Kind = "counter"
+	KindGauge   Kind = "gauge"
+)
+
+// Metric is a metric update sent by a Transport. Counters carry the
+// increase since the previous update in Delta, gauges the current Value.
+type Metric struct {
+	Name  string
+	Kind  Kind
+	Delta int64
+	Value float64
+}
+
+// Transport delivers batches of metric updates to the server.
+type Transport interface {
+	// Send delivers a batch. An error wrapping ErrRejected means the
+	// server refused some of the metrics and the rest were stored.
+	Send(ctx context.Context, metrics []Metric) error
+	Close() error
+}
+
+// partialError reports a failed batch whose first delivered metrics were
+// stored by the server before the failure.
+type partialError struct {
+	delivered int
+	err       error
+}
+
+func (e *partialError) Error() string {
+	return fmt.Sprintf("%d metrics delivered: %v", e.delivered, e.err)
+}
+
+func (e *partialError) Unwrap() error {
+	return e.err
+}
+
+// localIPFor returns the local address used to reach the host, sent in
+// X-Real-IP for the trusted subnet check of the server.
+func localIPFor(host string) (net.IP, error) {
+	// UDP dial doesn't send packets, the port is arbitrary
+	conn, err := net.Dial("udp4", net.JoinHostPort(host, "1"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	udpAddr, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		return nil, fmt.Errorf("unexpected local addr type %T", conn.LocalAddr())
+	}
+
+	return udpAddr.IP, nil
+}
@@ -27,6 +27,17 @@ func WithBackoff(durations []time.Duration) Option {
 	}
 }
 
+// ExponentialBackoff returns n backoff durations starting from initial
+// and doubling every time.
+func ExponentialBackoff(initial time.Duration, n int) []time.Duration {
+	backoff := make([]time.Duration, 0, max(n, 0))
+	for i := range n {
+		backoff = append(backoff, initial<<i)
+	}
+
+	return backoff
+}
+
 func NewRetrier(IsRetryable IsRetryableFunc, opts ...Option) *Retrier {
 	r := &Retrier{
 		backoff: []time.Duration{
@@ -44,7 +55,8 @@ func NewRetrier(IsRetryable IsRetryableFunc, opts ...Option) *Retrier {
 	return r
 }
 
-// Do executes Operation function and retries it according to configured backoff
+// Do executes Operation function and retries it according to configured
+// backoff. Waiting for the next attempt stops when ctx is cancelled.
 func (r *Retrier) Do(ctx context.Context, op Operation) error {
 	var lastErr error
 	err := op(ctx)
@@ -59,7 +71,11 @@ func (r *Retrier) Do(ctx context.Context, op Operation) error {
 
 	for _, t := range r.backoff {
 		log.Printf("operation error, retrying in %v", t)
-		time.Sleep(t)
+		select {
+		case <-time.After(t):
+		case <-ctx.Done():
+			return fmt.Errorf("operation cancelled: %w", lastErr)
+		}
 
 		err = op(ctx)
 		if err == nil {
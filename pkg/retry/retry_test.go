@@ -247,6 +247,28 @@ func TestRetrier_Do_ContextCancellation(t *testing.T) {
 	assert.GreaterOrEqual(t, callCount, 1)
 }
 
+func TestRetrier_Do_CancelledBackoff(t *testing.T) {
+	retrier := NewRetrier(alwaysRetryable, WithBackoff([]time.Duration{time.Hour}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	operation := func(ctx context.Context) error {
+		cancel()
+		return errRetryable
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- retrier.Do(ctx, operation)
+	}()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, errRetryable)
+	case <-time.After(time.Second):
+		t.Fatal("backoff was not interrupted by cancellation")
+	}
+}
+
 func TestRetrier_Do_EmptyBackoff(t *testing.T) {
 	retrier := NewRetrier(alwaysRetryable, WithBackoff([]time.Duration{}))
 	ctx := context.Background()
@@ -606,3 +628,37 @@ func BenchmarkRetrier_Do_DatabasePingWithRetries(b *testing.B) {
 		_ = retrier.Do(ctx, op)
 	}
 }
+
+func TestExponentialBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial time.Duration
+		n       int
+		want    []time.Duration
+	}{
+		{
+			name:    "three retries",
+			initial: time.Second,
+			n:       3,
+			want:    []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name:    "no retries",
+			initial: time.Second,
+			n:       0,
+			want:    []time.Duration{},
+		},
+		{
+			name:    "negative",
+			initial: time.Second,
+			n:       -1,
+			want:    []time.Duration{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ExponentialBackoff(tt.initial, tt.n))
+		})
+	}
+}